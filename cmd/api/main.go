@@ -6,20 +6,31 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+	// Embed the time zone database so REPORT_TIMEZONE resolves in images without one
+	_ "time/tzdata"
 
 	"github.com/rogerwesterbo/svennescamping-backend/internal/clients"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/httpserver"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/middlewares"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/services"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/settings"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"github.com/spf13/viper"
 	"go.uber.org/automaxprocs/maxprocs"
 	"go.uber.org/zap"
 )
 
 func main() {
-	// Initialize logger
-	if err := logger.InitLogger(true); err != nil { // Set to true for development
+	// Load the settings first, so the logger is configured from them. Until then entries go to the default JSON logger.
+	settings.Init()
+
+	// Initialize the global logger, colored console output in development and JSON otherwise unless LOG_FORMAT is set
+	// Repeated entries are sampled outside development so provider outages don't flood the logs
+	err := logger.InitLoggerWithFormat(viper.GetBool(consts.DEVELOPMENT), viper.GetString(consts.LOG_FORMAT),
+		logger.WithSampling(viper.GetInt(consts.LOG_SAMPLING_INITIAL), viper.GetInt(consts.LOG_SAMPLING_THEREAFTER)))
+	if err != nil {
 		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
 	}
 	defer logger.Sync()
@@ -35,54 +46,63 @@ func main() {
 
 	cancelChan := make(chan os.Signal, 1)
 
-	stop := make(chan struct{})
 	// catch SIGETRM or SIGINTERRUPT.
 	signal.Notify(cancelChan, syscall.SIGTERM, syscall.SIGINT)
 
-	settings.Init()
-
 	// Initialize role service after settings are loaded
 	middlewares.InitializeRoleService()
 
-	clients.InitializeClients()
-
+	// Prices are loaded first, since mock clients generate their sample transactions from them
 	services.InitializeServices()
 
+	clients.InitializeClients()
+
 	logger.Info("Starting Svennes Camping Backend API")
 
 	// Create context for background operations
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Start the webhook dispatcher before fetching so transactions from the initial fetch are delivered
+	clients.StartWebhookDispatcher(ctx)
+
 	// Start background transaction fetching
 	clients.StartBackgroundFetching(ctx)
 
 	// Start the HTTP server
-	go func() {
-		httpserver.Start()
-		sig := <-cancelChan
-		_, _ = fmt.Println()
-		_, _ = fmt.Println(sig)
-		stop <- struct{}{}
-	}()
+	go httpserver.Start()
 
 	logger.Info("Lumi 2025 Backend API started successfully",
 		zap.String("version", settings.Version),
 		zap.String("commit", settings.Commit),
-		zap.String("port", "8888"),
-		zap.String("host", "localhost"),
 	)
 	// Wait for shutdown signal
-	<-stop
+	sig := <-cancelChan
+	logger.Info("Received shutdown signal", zap.String("signal", sig.String()))
+
+	// Let in-flight requests finish before stopping the services they depend on. Everything shares one
+	// SHUTDOWN_TIMEOUT deadline, so the cache is persisted before the orchestrator kills the process.
+	shutdownTimeout := settings.GetDuration(consts.SHUTDOWN_TIMEOUT, 20*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+	if err := httpserver.Shutdown(shutdownCtx); err != nil {
+		logger.Error("HTTP server shutdown failed", zap.Error(err))
+	}
 
-	// Stop background fetching before shutting down
+	// Stop background fetching before shutting down. Stopping cancels in-flight provider calls, and the wait
+	// is bounded by what is left of SHUTDOWN_TIMEOUT so a call ignoring cancellation can't hold up the deploy.
 	logger.Info("Stopping background transaction fetching")
-	clients.StopBackgroundFetching()
+	cancel()
+	if err := clients.StopBackgroundFetching(shutdownCtx); err != nil {
+		logger.Error("Background fetching did not stop in time", zap.Error(err))
+	}
+	clients.StopWebhookDispatcher()
+
+	// Persist the cache before exiting so the next start is warm
+	clients.CloseCache()
 
 	logger.Info("Shutting down Lumi 2025 Backend API gracefully",
 		zap.String("version", settings.Version),
 		zap.String("commit", settings.Commit),
-		zap.String("port", "8888"),
-		zap.String("host", "localhost"),
 	)
 }
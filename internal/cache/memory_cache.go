@@ -3,6 +3,7 @@ package cache
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	gocache "github.com/patrickmn/go-cache"
@@ -13,10 +14,22 @@ import (
 
 type InMemoryCache struct {
 	cache *gocache.Cache
+
+	// Optional snapshot persistence (see NewPersistentCache)
+	snapshotPath string
+	stopChan     chan struct{}
+	wg           sync.WaitGroup
+	closeOnce    sync.Once
 }
 
-// Compile-time check to ensure InMemoryCache implements Cache interface
-var _ interfaces.Cache = (*InMemoryCache)(nil)
+// Compile-time checks to ensure InMemoryCache implements the Cache and CacheStatsProvider interfaces
+var (
+	_ interfaces.Cache              = (*InMemoryCache)(nil)
+	_ interfaces.CacheStatsProvider = (*InMemoryCache)(nil)
+)
+
+// nearExpiryWindow is how close to expiry a cached transaction counts as nearing expiry in Stats
+const nearExpiryWindow = time.Hour
 
 func NewInMemoryCache(defaultExpiration, cleanupInterval time.Duration) *InMemoryCache {
 	return &InMemoryCache{
@@ -57,6 +70,22 @@ func (c *InMemoryCache) GetTransactions(pattern string) []entities.Transaction {
 	return transactions
 }
 
+// GetTransactionsBySource returns the cached transactions from the given payment source,
+// matching on the transaction's Source rather than its key
+func (c *InMemoryCache) GetTransactionsBySource(source string) []entities.Transaction {
+	var transactions []entities.Transaction
+	for key, item := range c.cache.Items() {
+		if !strings.HasPrefix(key, "transaction:") {
+			continue
+		}
+		if transaction, ok := item.Object.(entities.Transaction); ok && transaction.Source == source {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	return transactions
+}
+
 func (c *InMemoryCache) DeleteTransaction(key string) {
 	transactionKey := fmt.Sprintf("transaction:%s", key)
 	c.cache.Delete(transactionKey)
@@ -98,6 +127,78 @@ func (c *InMemoryCache) DeletePrice(key string) {
 	c.cache.Delete(priceKey)
 }
 
+// Annotation cache methods (no expiration)
+func (c *InMemoryCache) SetAnnotation(key string, annotation entities.TransactionAnnotation) {
+	annotationKey := fmt.Sprintf("annotation:%s", key)
+	c.cache.Set(annotationKey, annotation, gocache.NoExpiration)
+}
+
+func (c *InMemoryCache) GetAnnotation(key string) (entities.TransactionAnnotation, bool) {
+	annotationKey := fmt.Sprintf("annotation:%s", key)
+	if item, found := c.cache.Get(annotationKey); found {
+		if annotation, ok := item.(entities.TransactionAnnotation); ok {
+			return annotation, true
+		}
+	}
+	return entities.TransactionAnnotation{}, false
+}
+
+func (c *InMemoryCache) GetAnnotations() map[string]entities.TransactionAnnotation {
+	annotations := make(map[string]entities.TransactionAnnotation)
+	for key, item := range c.cache.Items() {
+		if !strings.HasPrefix(key, "annotation:") {
+			continue
+		}
+		if annotation, ok := item.Object.(entities.TransactionAnnotation); ok {
+			annotations[strings.TrimPrefix(key, "annotation:")] = annotation
+		}
+	}
+
+	return annotations
+}
+
+func (c *InMemoryCache) DeleteAnnotation(key string) {
+	annotationKey := fmt.Sprintf("annotation:%s", key)
+	c.cache.Delete(annotationKey)
+}
+
+// Stats summarizes the cached transactions and prices in one pass over the cache
+func (c *InMemoryCache) Stats() entities.CacheStats {
+	stats := entities.CacheStats{
+		BySource:         make(map[string]int),
+		NearExpiryWindow: nearExpiryWindow.String(),
+	}
+	nearExpiry := time.Now().Add(nearExpiryWindow).UnixNano()
+
+	for key, item := range c.cache.Items() {
+		if strings.HasPrefix(key, "price:") {
+			stats.Prices++
+			continue
+		}
+
+		transaction, ok := item.Object.(entities.Transaction)
+		if !strings.HasPrefix(key, "transaction:") || !ok {
+			continue
+		}
+
+		stats.TotalTransactions++
+		stats.BySource[transaction.Source]++
+		if item.Expiration > 0 && item.Expiration <= nearExpiry {
+			stats.NearingExpiry++
+		}
+
+		createdAt := transaction.CreatedAt
+		if stats.OldestCreatedAt == nil || createdAt.Before(*stats.OldestCreatedAt) {
+			stats.OldestCreatedAt = &createdAt
+		}
+		if stats.NewestCreatedAt == nil || createdAt.After(*stats.NewestCreatedAt) {
+			stats.NewestCreatedAt = &createdAt
+		}
+	}
+
+	return stats
+}
+
 // Clear cache
 func (c *InMemoryCache) Clear() {
 	c.cache.Flush()
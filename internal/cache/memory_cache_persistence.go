@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// snapshotEntry is a single cached transaction or annotation as stored in the snapshot file
+type snapshotEntry struct {
+	Key         string                          `json:"key"`
+	Transaction *entities.Transaction           `json:"transaction,omitempty"`
+	Annotation  *entities.TransactionAnnotation `json:"annotation,omitempty"`
+	ExpiresAt   int64                           `json:"expires_at"` // Unix nanoseconds, 0 means no expiration
+}
+
+// NewPersistentCache creates an in-memory cache that snapshots its transactions and annotations to the given file.
+// Existing snapshots are restored on creation, skipping expired entries. A snapshot is written
+// every snapshotInterval (if positive) and on Close.
+func NewPersistentCache(path string, defaultExpiration, cleanupInterval, snapshotInterval time.Duration) *InMemoryCache {
+	c := NewInMemoryCache(defaultExpiration, cleanupInterval)
+	c.snapshotPath = path
+	c.stopChan = make(chan struct{})
+
+	if err := c.loadSnapshot(); err != nil {
+		// A corrupt or unreadable snapshot should never prevent startup
+		logger.Warn("Failed to restore cache snapshot, starting empty",
+			zap.String("path", path),
+			zap.Error(err))
+		c.cache.Flush()
+	}
+
+	if snapshotInterval > 0 {
+		c.wg.Add(1)
+		go c.snapshotLoop(snapshotInterval)
+	}
+
+	return c
+}
+
+// Snapshot writes all non-expired transactions and all annotations to the snapshot file
+func (c *InMemoryCache) Snapshot() error {
+	if c.snapshotPath == "" {
+		return nil
+	}
+
+	var entries []snapshotEntry
+	transactions := 0
+	for key, item := range c.cache.Items() {
+		switch object := item.Object.(type) {
+		case entities.Transaction:
+			if strings.HasPrefix(key, "transaction:") {
+				entries = append(entries, snapshotEntry{
+					Key:         strings.TrimPrefix(key, "transaction:"),
+					Transaction: &object,
+					ExpiresAt:   item.Expiration,
+				})
+				transactions++
+			}
+		case entities.TransactionAnnotation:
+			if strings.HasPrefix(key, "annotation:") {
+				entries = append(entries, snapshotEntry{
+					Key:        strings.TrimPrefix(key, "annotation:"),
+					Annotation: &object,
+				})
+			}
+		}
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache snapshot: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a half-written snapshot
+	if err := os.MkdirAll(filepath.Dir(c.snapshotPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	tmpPath := c.snapshotPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write cache snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, c.snapshotPath); err != nil {
+		return fmt.Errorf("failed to replace cache snapshot: %w", err)
+	}
+
+	logger.Debug("Wrote cache snapshot",
+		zap.String("path", c.snapshotPath),
+		zap.Int("transactions", transactions),
+		zap.Int("annotations", len(entries)-transactions))
+	return nil
+}
+
+// Close stops periodic snapshots and writes a final snapshot
+func (c *InMemoryCache) Close() error {
+	if c.snapshotPath == "" {
+		return nil
+	}
+
+	c.closeOnce.Do(func() {
+		close(c.stopChan)
+		c.wg.Wait()
+	})
+
+	return c.Snapshot()
+}
+
+// snapshotLoop periodically writes snapshots until the cache is closed
+func (c *InMemoryCache) snapshotLoop(interval time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			if err := c.Snapshot(); err != nil {
+				logger.Error("Failed to write cache snapshot", zap.Error(err))
+			}
+		}
+	}
+}
+
+// loadSnapshot restores transactions and annotations from the snapshot file if it exists
+func (c *InMemoryCache) loadSnapshot() error {
+	data, err := os.ReadFile(c.snapshotPath)
+	if os.IsNotExist(err) {
+		logger.Debug("No cache snapshot found", zap.String("path", c.snapshotPath))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read cache snapshot: %w", err)
+	}
+
+	var entries []snapshotEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to decode cache snapshot: %w", err)
+	}
+
+	now := time.Now()
+	restored := 0
+	for _, entry := range entries {
+		if entry.Annotation != nil {
+			c.SetAnnotation(entry.Key, *entry.Annotation)
+			restored++
+			continue
+		}
+		if entry.Transaction == nil {
+			continue
+		}
+
+		expiration := gocache.NoExpiration
+		if entry.ExpiresAt > 0 {
+			expiration = time.Unix(0, entry.ExpiresAt).Sub(now)
+			if expiration <= 0 {
+				continue // Expired entries are never restored
+			}
+		}
+		c.SetTransaction(entry.Key, *entry.Transaction, expiration)
+		restored++
+	}
+
+	logger.Info("Restored cache snapshot",
+		zap.String("path", c.snapshotPath),
+		zap.Int("restored", restored),
+		zap.Int("skipped_expired", len(entries)-restored))
+	return nil
+}
@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -268,3 +270,127 @@ func TestInMemoryCache_Expiration(t *testing.T) {
 		t.Errorf("Expected price to persist (no expiration)")
 	}
 }
+
+func TestPersistentCache_SnapshotRoundTrip(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "cache.json")
+
+	cache := NewPersistentCache(snapshotPath, 1*time.Hour, 10*time.Minute, 0)
+	cache.SetTransaction("tx1", entities.Transaction{ID: "tx1", Amount: 100.0, Currency: "NOK"}, 1*time.Hour)
+	cache.SetTransaction("expiring_tx", entities.Transaction{ID: "expiring_tx"}, 1*time.Millisecond)
+	cache.SetPrice("product", prices.Price{Product: "product", Price: 50.0})
+	notes := "Paid at reception"
+	cache.SetAnnotation("tx1", entities.TransactionAnnotation{Archived: true, Notes: &notes})
+
+	if err := cache.Close(); err != nil {
+		t.Fatalf("Failed to close cache: %v", err)
+	}
+
+	// Let the short-lived entry expire before restoring
+	time.Sleep(10 * time.Millisecond)
+
+	restored := NewPersistentCache(snapshotPath, 1*time.Hour, 10*time.Minute, 0)
+	defer restored.Close()
+
+	retrieved, found := restored.GetTransaction("tx1")
+	if !found {
+		t.Fatalf("Expected transaction to be restored from snapshot")
+	}
+	if retrieved.Amount != 100.0 {
+		t.Errorf("Expected restored amount 100.0, got %f", retrieved.Amount)
+	}
+
+	if _, found := restored.GetTransaction("expiring_tx"); found {
+		t.Errorf("Expected expired transaction not to be restored")
+	}
+
+	if _, found := restored.GetPrice("product"); found {
+		t.Errorf("Expected prices not to be part of the snapshot")
+	}
+
+	annotation, found := restored.GetAnnotation("tx1")
+	if !found || !annotation.Archived || annotation.Notes == nil || *annotation.Notes != notes {
+		t.Errorf("Expected annotation to be restored from snapshot, got %+v", annotation)
+	}
+}
+
+func TestPersistentCache_CorruptSnapshot(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "cache.json")
+	if err := os.WriteFile(snapshotPath, []byte("{not valid json"), 0o600); err != nil {
+		t.Fatalf("Failed to write corrupt snapshot: %v", err)
+	}
+
+	cache := NewPersistentCache(snapshotPath, 1*time.Hour, 10*time.Minute, 0)
+	defer cache.Close()
+
+	if transactions := cache.GetTransactions(""); len(transactions) != 0 {
+		t.Errorf("Expected empty cache after corrupt snapshot, got %d transactions", len(transactions))
+	}
+}
+
+func TestInMemoryCache_Stats(t *testing.T) {
+	cache := NewInMemoryCache(24*time.Hour, 10*time.Minute)
+
+	empty := cache.Stats()
+	if empty.TotalTransactions != 0 || empty.OldestCreatedAt != nil || empty.NewestCreatedAt != nil {
+		t.Errorf("Expected empty stats, got %+v", empty)
+	}
+
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	cache.SetTransaction("stripe_1", entities.Transaction{ID: "stripe_1", Source: "stripe", CreatedAt: base}, 24*time.Hour)
+	cache.SetTransaction("stripe_2", entities.Transaction{ID: "stripe_2", Source: "stripe", CreatedAt: base.Add(2 * time.Hour)}, 24*time.Hour)
+	cache.SetTransaction("vipps_1", entities.Transaction{ID: "vipps_1", Source: "vipps", CreatedAt: base.Add(-time.Hour)}, 30*time.Minute)
+	cache.SetPrice("Tent", prices.Price{Product: "Tent", Price: 250, Currency: "NOK"})
+
+	stats := cache.Stats()
+	if stats.TotalTransactions != 3 || stats.BySource["stripe"] != 2 || stats.BySource["vipps"] != 1 {
+		t.Errorf("Unexpected transaction counts %+v", stats)
+	}
+	if !stats.OldestCreatedAt.Equal(base.Add(-time.Hour)) || !stats.NewestCreatedAt.Equal(base.Add(2*time.Hour)) {
+		t.Errorf("Unexpected CreatedAt range %v to %v", stats.OldestCreatedAt, stats.NewestCreatedAt)
+	}
+	if stats.NearingExpiry != 1 {
+		t.Errorf("Expected 1 transaction nearing expiry, got %d", stats.NearingExpiry)
+	}
+	if stats.Prices != 1 {
+		t.Errorf("Expected 1 price, got %d", stats.Prices)
+	}
+}
+
+func TestInMemoryCache_GetTransactionsBySource(t *testing.T) {
+	cache := NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	// The key mentions vipps, but the source field is what counts
+	cache.SetTransaction("vipps_lookalike", entities.Transaction{ID: "vipps_lookalike", Source: "stripe"}, time.Hour)
+	cache.SetTransaction("tx_2", entities.Transaction{ID: "tx_2", Source: "vipps"}, time.Hour)
+	cache.SetPrice("vipps", prices.Price{})
+
+	transactions := cache.GetTransactionsBySource("vipps")
+	if len(transactions) != 1 || transactions[0].ID != "tx_2" {
+		t.Errorf("Expected only tx_2, got %v", transactions)
+	}
+	if transactions := cache.GetTransactionsBySource("zettle"); len(transactions) != 0 {
+		t.Errorf("Expected no zettle transactions, got %v", transactions)
+	}
+}
+
+func TestInMemoryCache_Annotations(t *testing.T) {
+	cache := NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	cache.SetTransaction("tx_1", entities.Transaction{ID: "tx_1", Source: "stripe"}, time.Hour)
+	cache.SetAnnotation("tx_1", entities.TransactionAnnotation{Archived: true})
+
+	// Annotations are not transactions, and outlive the cached transaction
+	if transactions := cache.GetTransactions(""); len(transactions) != 1 {
+		t.Errorf("Expected only the transaction to be listed, got %v", transactions)
+	}
+	cache.DeleteTransaction("tx_1")
+	if annotation, found := cache.GetAnnotation("tx_1"); !found || !annotation.Archived {
+		t.Errorf("Expected tx_1 to stay annotated after its transaction was removed, got %+v", annotation)
+	}
+	if _, found := cache.GetAnnotation("tx_2"); found {
+		t.Error("Expected tx_2 not to be annotated")
+	}
+
+	annotations := cache.GetAnnotations()
+	if len(annotations) != 1 || !annotations["tx_1"].Archived {
+		t.Errorf("Expected only tx_1 to be annotated, got %v", annotations)
+	}
+}
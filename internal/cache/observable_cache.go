@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+)
+
+// subscriberBufferSize is how many events a subscriber may have pending before it is dropped
+const subscriberBufferSize = 64
+
+// ObservableCache wraps a cache and notifies subscribers when transactions are set or deleted through it.
+// Only writes made through this instance are observed, so with a shared Redis cache subscribers
+// don't see changes made by other replicas, and expiry and Clear emit no events. Setting a transaction
+// that is already cached unchanged, as every background refresh does, emits no event either.
+type ObservableCache struct {
+	interfaces.Cache
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+// subscriber is a single Subscribe call; close is shared by unsubscribing and being dropped
+type subscriber struct {
+	events    chan entities.CacheEvent
+	closeOnce sync.Once
+}
+
+func (s *subscriber) close() {
+	s.closeOnce.Do(func() { close(s.events) })
+}
+
+// Compile-time check to ensure ObservableCache implements the Cache and CacheNotifier interfaces
+var (
+	_ interfaces.Cache         = (*ObservableCache)(nil)
+	_ interfaces.CacheNotifier = (*ObservableCache)(nil)
+)
+
+// NewObservableCache wraps the given cache
+func NewObservableCache(cache interfaces.Cache) *ObservableCache {
+	return &ObservableCache{
+		Cache:       cache,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// SetTransaction stores the transaction and emits a set event if it is new or changed
+func (c *ObservableCache) SetTransaction(key string, transaction entities.Transaction, expiration time.Duration) {
+	stored, exists := c.Cache.GetTransaction(key)
+	c.Cache.SetTransaction(key, transaction, expiration)
+	if exists && unchanged(stored, transaction) {
+		return
+	}
+
+	c.notify(entities.CacheEvent{
+		Type:        entities.CacheEventSet,
+		Key:         key,
+		Transaction: transaction,
+		Created:     !exists,
+	})
+}
+
+// unchanged reports whether a stored transaction equals the one being set. When it was cached and the raw
+// provider data are ignored, since they differ on every fetch or don't survive a round trip through Redis.
+func unchanged(stored, transaction entities.Transaction) bool {
+	if !stored.CreatedAt.Equal(transaction.CreatedAt) {
+		return false
+	}
+	for _, t := range []*entities.Transaction{&stored, &transaction} {
+		t.CreatedAt, t.CachedAt = time.Time{}, time.Time{}
+		t.Data, t.TransferData = nil, nil
+	}
+	return reflect.DeepEqual(stored, transaction)
+}
+
+// DeleteTransaction removes the transaction and emits a delete event
+func (c *ObservableCache) DeleteTransaction(key string) {
+	transaction, _ := c.Cache.GetTransaction(key)
+	c.Cache.DeleteTransaction(key)
+
+	c.notify(entities.CacheEvent{
+		Type:        entities.CacheEventDelete,
+		Key:         key,
+		Transaction: transaction,
+	})
+}
+
+// Subscribe returns a channel receiving cache events and a function to unsubscribe.
+// A subscriber whose buffer fills up is dropped and its channel closed rather than blocking writers.
+func (c *ObservableCache) Subscribe() (<-chan entities.CacheEvent, func()) {
+	sub := &subscriber{events: make(chan entities.CacheEvent, subscriberBufferSize)}
+
+	c.mu.Lock()
+	c.subscribers[sub] = struct{}{}
+	c.mu.Unlock()
+
+	unsubscribe := func() {
+		c.mu.Lock()
+		delete(c.subscribers, sub)
+		c.mu.Unlock()
+		sub.close()
+	}
+
+	return sub.events, unsubscribe
+}
+
+// notify sends the event to every subscriber, dropping those that have fallen behind
+func (c *ObservableCache) notify(event entities.CacheEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for sub := range c.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			delete(c.subscribers, sub)
+			sub.close()
+		}
+	}
+}
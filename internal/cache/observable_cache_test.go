@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+// nextEvent returns the next pending event, failing the test if there is none
+func nextEvent(t *testing.T, events <-chan entities.CacheEvent) entities.CacheEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("Expected an event, but the channel was closed")
+		}
+		return event
+	default:
+		t.Fatal("Expected an event, but none was pending")
+	}
+	return entities.CacheEvent{}
+}
+
+func TestObservableCache_SetAndDeleteEvents(t *testing.T) {
+	cache := NewObservableCache(NewInMemoryCache(1*time.Hour, 10*time.Minute))
+	events, unsubscribe := cache.Subscribe()
+	defer unsubscribe()
+
+	transaction := entities.Transaction{ID: "tx_1", Source: "stripe", Amount: 100}
+	cache.SetTransaction(transaction.ID, transaction, time.Hour)
+	transaction.Status = "succeeded"
+	cache.SetTransaction(transaction.ID, transaction, time.Hour)
+	cache.DeleteTransaction(transaction.ID)
+
+	created := nextEvent(t, events)
+	if created.Type != entities.CacheEventSet || !created.Created || created.Key != "tx_1" || created.Transaction.ID != "tx_1" {
+		t.Errorf("Unexpected event for new transaction: %+v", created)
+	}
+
+	updated := nextEvent(t, events)
+	if updated.Type != entities.CacheEventSet || updated.Created {
+		t.Errorf("Expected set event for an existing transaction to not be marked created: %+v", updated)
+	}
+
+	deleted := nextEvent(t, events)
+	if deleted.Type != entities.CacheEventDelete || deleted.Key != "tx_1" || deleted.Transaction.ID != "tx_1" {
+		t.Errorf("Unexpected delete event: %+v", deleted)
+	}
+
+	if _, found := cache.GetTransaction(transaction.ID); found {
+		t.Error("Expected transaction to be removed from the wrapped cache")
+	}
+}
+
+func TestObservableCache_UnchangedSetsEmitNoEvents(t *testing.T) {
+	cache := NewObservableCache(NewInMemoryCache(1*time.Hour, 10*time.Minute))
+
+	// A refresh of more transactions than a subscriber buffers
+	createdAt := time.Now()
+	refresh := func() {
+		for i := 0; i < subscriberBufferSize*2; i++ {
+			id := fmt.Sprintf("tx_%d", i)
+			cache.SetTransaction(id, entities.Transaction{ID: id, CreatedAt: createdAt, CachedAt: time.Now(), Data: &struct{}{}}, time.Hour)
+		}
+	}
+	refresh()
+
+	events, unsubscribe := cache.Subscribe()
+	defer unsubscribe()
+
+	// Refreshing the same transactions again sends nothing, so the subscriber isn't dropped
+	refresh()
+	cache.SetTransaction("tx_0", entities.Transaction{ID: "tx_0", CreatedAt: createdAt, Status: "refunded"}, time.Hour)
+
+	if event := nextEvent(t, events); event.Key != "tx_0" || event.Transaction.Status != "refunded" {
+		t.Errorf("Expected only the changed transaction, got %+v", event)
+	}
+	select {
+	case event, ok := <-events:
+		t.Errorf("Expected no further events, got %+v (open %v)", event, ok)
+	default:
+	}
+}
+
+func TestObservableCache_FanOut(t *testing.T) {
+	cache := NewObservableCache(NewInMemoryCache(1*time.Hour, 10*time.Minute))
+	first, unsubscribeFirst := cache.Subscribe()
+	defer unsubscribeFirst()
+	second, unsubscribeSecond := cache.Subscribe()
+	defer unsubscribeSecond()
+
+	cache.SetTransaction("tx_1", entities.Transaction{ID: "tx_1"}, time.Hour)
+
+	if event := nextEvent(t, first); event.Key != "tx_1" {
+		t.Errorf("Expected first subscriber to receive tx_1, got %q", event.Key)
+	}
+	if event := nextEvent(t, second); event.Key != "tx_1" {
+		t.Errorf("Expected second subscriber to receive tx_1, got %q", event.Key)
+	}
+}
+
+func TestObservableCache_Unsubscribe(t *testing.T) {
+	cache := NewObservableCache(NewInMemoryCache(1*time.Hour, 10*time.Minute))
+	events, unsubscribe := cache.Subscribe()
+
+	unsubscribe()
+	// Unsubscribing twice must not panic on closing the channel again
+	unsubscribe()
+
+	if _, ok := <-events; ok {
+		t.Error("Expected channel to be closed after unsubscribing")
+	}
+
+	// Writes after unsubscribing must not send on the closed channel
+	cache.SetTransaction("tx_1", entities.Transaction{ID: "tx_1"}, time.Hour)
+}
+
+func TestObservableCache_DropsSlowSubscriber(t *testing.T) {
+	cache := NewObservableCache(NewInMemoryCache(1*time.Hour, 10*time.Minute))
+	slow, unsubscribeSlow := cache.Subscribe()
+	defer unsubscribeSlow()
+
+	total := subscriberBufferSize + 5
+	for i := 0; i < total; i++ {
+		id := fmt.Sprintf("tx_%d", i)
+		cache.SetTransaction(id, entities.Transaction{ID: id}, time.Hour)
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != subscriberBufferSize {
+		t.Errorf("Expected %d buffered events before being dropped, got %d", subscriberBufferSize, received)
+	}
+	if count := len(cache.GetTransactions("")); count != total {
+		t.Errorf("Expected writer to store all %d transactions, got %d", total, count)
+	}
+
+	// Subscribers joining later are unaffected
+	fresh, unsubscribeFresh := cache.Subscribe()
+	defer unsubscribeFresh()
+	cache.SetTransaction("tx_late", entities.Transaction{ID: "tx_late"}, time.Hour)
+	if event := nextEvent(t, fresh); event.Key != "tx_late" {
+		t.Errorf("Expected tx_late, got %q", event.Key)
+	}
+}
@@ -0,0 +1,25 @@
+package cache
+
+import "testing"
+
+func TestEscapeRedisGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{pattern: "stripe_internal", expected: "stripe_internal"},
+		{pattern: "a*b", expected: `a\*b`},
+		{pattern: "a?b", expected: `a\?b`},
+		{pattern: "[abc]", expected: `\[abc\]`},
+		{pattern: `a\b`, expected: `a\\b`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(sub *testing.T) {
+			result := escapeRedisGlob(test.pattern)
+			if result != test.expected {
+				sub.Errorf("escapeRedisGlob(%q) = %q, want %q", test.pattern, result, test.expected)
+			}
+		})
+	}
+}
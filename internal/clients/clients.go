@@ -2,36 +2,82 @@ package clients
 
 import (
 	"context"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/rogerwesterbo/svennescamping-backend/internal/cache"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/clients/mock"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/clients/stripe"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/clients/vipps"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/clients/zettle"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/readiness"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/repository"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/services"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/services/prices"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/settings"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httpclienthelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/redacthelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 )
 
 var (
-	StripeClient          *stripe.StripeClient
-	VippsClient           *vipps.VippsClient
-	ZettleClient          *zettle.ZettleClient
+	StripeClient *stripe.StripeClient
+	VippsClient  *vipps.VippsClient
+	ZettleClient *zettle.ZettleClient
+	// MockClients replace the payment clients by source when USE_MOCK_CLIENTS is set
+	MockClients           map[string]*mock.MockClient
 	Cache                 interfaces.Cache
+	ObservableCache       *cache.ObservableCache
 	TransactionRepository interfaces.TransactionRepository
 )
 
 func InitializeClients() {
-	// Initialize cache with 24h default expiration and 1h cleanup interval
-	Cache = cache.NewInMemoryCache(24*time.Hour, 1*time.Hour)
+	// Configured credentials are masked wherever provider responses are logged
+	redacthelpers.AddSecrets(
+		viper.GetString(consts.STRIPE_APIKEY),
+		viper.GetString(consts.STRIPE_WEBHOOKKEY),
+		viper.GetString(consts.VIPPS_SUBSCRIPTION_KEY),
+		viper.GetString(consts.VIPPS_SECRET),
+		viper.GetString(consts.VIPPS_WEBHOOK_SECRET),
+		viper.GetString(consts.ZETTLE_APIKEY),
+		viper.GetString(consts.ZETTLE_SECRET),
+		viper.GetString(consts.OUTBOUND_WEBHOOK_SECRET),
+	)
+
+	Cache = initializeCache()
+	// Transaction writes go through the observable cache so subscribers see sets and deletes
+	ObservableCache = cache.NewObservableCache(Cache)
+
+	// All payment clients share one HTTP client so connections are pooled
+	httpClient := httpclienthelpers.NewClient(settings.GetDuration(consts.HTTP_CLIENT_TIMEOUT, httpclienthelpers.DefaultTimeout))
+	if viper.GetBool(consts.DEBUG_HTTP) {
+		logger.Warn("Logging payment provider requests and responses, disable DEBUG_HTTP when done debugging")
+		httpClient = httpclienthelpers.NewDebugClient(httpClient)
+	}
+	lookbackDays := fetchLookbackDays()
+	// Provider dates without a time zone are read in the report time zone so they land on the right day
+	reportLocation := settings.GetLocation(consts.REPORT_TIMEZONE, time.UTC)
+
+	if viper.GetBool(consts.USE_MOCK_CLIENTS) {
+		MockClients = initializeMockClients(lookbackDays)
+	}
 
 	// Initialize Stripe client
 	stripeAPIKey := viper.GetString(consts.STRIPE_APIKEY)
-	if stripeAPIKey != "" {
-		StripeClient = stripe.NewStripeClient(stripeAPIKey)
+	if MockClients == nil && stripeAPIKey != "" && providerEnabled(consts.PAYMENT_SOURCE_STRIPE, consts.STRIPE_ENABLED) {
+		StripeClient = stripe.NewStripeClient(
+			stripeAPIKey,
+			viper.GetString(consts.STRIPE_OBJECT_TYPE),
+			viper.GetInt(consts.STRIPE_MAX_RETRY_ATTEMPTS),
+			stripe.WithHTTPClient(httpClient),
+			stripe.WithLookbackDays(lookbackDays),
+		)
 	}
 
 	// Initialize Vipps client
@@ -40,8 +86,9 @@ func InitializeClients() {
 	vippsClientID := viper.GetString(consts.VIPPS_CLIENT_ID)
 	vippsSecret := viper.GetString(consts.VIPPS_SECRET)
 	vippsMerchantSerialNumber := viper.GetString(consts.VIPPS_MERCHANT_SERIAL_NUMBER)
-	if vippsSubscriptionKey != "" {
-		VippsClient = vipps.NewVippsClient(vippsSubscriptionKey, vippsAPIURL, vippsClientID, vippsSecret, vippsMerchantSerialNumber)
+	if MockClients == nil && vippsSubscriptionKey != "" && providerEnabled(consts.PAYMENT_SOURCE_VIPPS, consts.VIPPS_ENABLED) {
+		VippsClient = vipps.NewVippsClient(vippsSubscriptionKey, vippsAPIURL, vippsClientID, vippsSecret, vippsMerchantSerialNumber,
+			vipps.WithHTTPClient(httpClient), vipps.WithLookbackDays(lookbackDays), vipps.WithLocation(reportLocation))
 	}
 
 	// Initialize Zettle client
@@ -49,38 +96,266 @@ func InitializeClients() {
 	zettleAPIURL := viper.GetString(consts.ZETTLE_APIURL)
 	zettleClientID := viper.GetString(consts.ZETTLE_CLIENT_ID)
 	zettleSecret := viper.GetString(consts.ZETTLE_SECRET)
-	if zettleAPIKey != "" {
-		ZettleClient = zettle.NewZettleClient(zettleAPIKey, zettleAPIURL, zettleClientID, zettleSecret)
+	if MockClients == nil && zettleAPIKey != "" && providerEnabled(consts.PAYMENT_SOURCE_ZETTLE, consts.ZETTLE_ENABLED) {
+		ZettleClient = zettle.NewZettleClient(zettleAPIKey, zettleAPIURL, zettleClientID, zettleSecret,
+			zettle.WithHTTPClient(httpClient), zettle.WithLookbackDays(lookbackDays), zettle.WithLocation(reportLocation))
+	}
+
+	paymentClientConfigured := len(EnabledProviders()) > 0
+	if !paymentClientConfigured {
+		logger.Warn("No payment clients configured, the API will not report ready")
 	}
+	readiness.Set(readiness.CheckPaymentClients, paymentClientConfigured)
 
 	// Initialize repository with all available clients
+	stripeClient, vippsClient, zettleClient := paymentClients()
 	TransactionRepository = repository.NewTransactionRepository(
-		Cache,
-		StripeClient,
-		VippsClient,
-		ZettleClient,
+		ObservableCache,
+		stripeClient,
+		vippsClient,
+		zettleClient,
+		repository.WithDedupe(dedupeConfig()),
+		repository.WithTTL(cacheTTL()),
+		repository.WithFetchBatchSize(services.FetchBatchSize()),
+		repository.WithRefreshCooldown(settings.GetDuration(consts.REFRESH_COOLDOWN, repository.DefaultRefreshCooldown)),
+		repository.WithFallbackRefreshTimeout(settings.GetDuration(consts.FALLBACK_REFRESH_TIMEOUT, repository.DefaultFallbackRefreshTimeout)),
 	)
 
 	// Initialize transaction services through the services package
 	services.InitializeTransactionServices(
-		Cache,
+		ObservableCache,
+		ObservableCache,
 		TransactionRepository,
-		StripeClient,
-		VippsClient,
-		ZettleClient,
+		stripeClient,
+		vippsClient,
+		zettleClient,
+		reportLocation,
 	)
 
 	logger.Info("All clients and services initialized successfully")
 }
 
+// initializeMockClients creates a mock client per payment source, generating sample transactions from the price list
+func initializeMockClients(lookbackDays int) map[string]*mock.MockClient {
+	var priceList []prices.Price
+	if services.PriceService != nil {
+		priceList = services.PriceService.GetAllPrices()
+	}
+
+	logger.Warn("Using mock payment clients with sample transactions, never enable USE_MOCK_CLIENTS in production",
+		zap.Int("prices", len(priceList)))
+
+	mockClients := make(map[string]*mock.MockClient, len(consts.ValidPaymentSources))
+	for _, source := range consts.ValidPaymentSources {
+		mockClients[source] = mock.NewMockClient(source, priceList, mock.WithLookbackDays(lookbackDays))
+	}
+	return mockClients
+}
+
+// EnabledProviders returns the payment sources transactions are fetched from, mock or real
+func EnabledProviders() []string {
+	var providers []string
+	if MockClients != nil {
+		for _, source := range consts.ValidPaymentSources {
+			if MockClients[source] != nil {
+				providers = append(providers, source)
+			}
+		}
+		return providers
+	}
+
+	if StripeClient != nil {
+		providers = append(providers, consts.PAYMENT_SOURCE_STRIPE)
+	}
+	if VippsClient != nil {
+		providers = append(providers, consts.PAYMENT_SOURCE_VIPPS)
+	}
+	if ZettleClient != nil {
+		providers = append(providers, consts.PAYMENT_SOURCE_ZETTLE)
+	}
+	return providers
+}
+
+// paymentClients returns the payment clients as transaction sources, the mock clients when they are used.
+// Missing clients stay nil interfaces, since a nil client pointer in an interface is not nil and would not be
+// skipped by the repository and fetcher.
+func paymentClients() (stripeClient, vippsClient, zettleClient interfaces.Transactions) {
+	if MockClients != nil {
+		return mockClient(consts.PAYMENT_SOURCE_STRIPE), mockClient(consts.PAYMENT_SOURCE_VIPPS), mockClient(consts.PAYMENT_SOURCE_ZETTLE)
+	}
+
+	if StripeClient != nil {
+		stripeClient = StripeClient
+	}
+	if VippsClient != nil {
+		vippsClient = VippsClient
+	}
+	if ZettleClient != nil {
+		zettleClient = ZettleClient
+	}
+	return stripeClient, vippsClient, zettleClient
+}
+
+// mockClient returns the mock client of the source as a transaction source, or nil if there is none
+func mockClient(source string) interfaces.Transactions {
+	if client := MockClients[source]; client != nil {
+		return client
+	}
+	return nil
+}
+
+// providerEnabled reports whether a provider with credentials should be used, from its enabled setting.
+// A disabled provider gets no client, so the repository and background fetcher skip it.
+func providerEnabled(source, key string) bool {
+	if viper.GetBool(key) {
+		return true
+	}
+	logger.Warn("Payment provider disabled by settings, not fetching from it",
+		zap.String("provider", source),
+		zap.String("key", key))
+	return false
+}
+
+// dedupeConfig reads the cross-provider deduplication settings. Deduplication is off unless DEDUPE_WINDOW is set.
+func dedupeConfig() repository.DedupeConfig {
+	var preferredSources []string
+	for _, source := range strings.Split(viper.GetString(consts.DEDUPE_PREFERRED_SOURCES), ";") {
+		if source = strings.TrimSpace(source); source != "" {
+			preferredSources = append(preferredSources, strings.ToLower(source))
+		}
+	}
+
+	config := repository.DedupeConfig{
+		Window:           settings.GetDuration(consts.DEDUPE_WINDOW, 0),
+		PreferredSources: preferredSources,
+	}
+
+	if config.Enabled() {
+		logger.Info("Cross-provider transaction deduplication enabled",
+			zap.Duration("window", config.Window),
+			zap.Strings("preferred_sources", config.PreferredSources))
+	}
+
+	return config
+}
+
+// fetchLookbackDays reads how many days back providers are asked for transactions, from FETCH_LOOKBACK_DAYS.
+// Non-positive values fall back to the default and values above the maximum are capped, both with a warning.
+func fetchLookbackDays() int {
+	days := viper.GetInt(consts.FETCH_LOOKBACK_DAYS)
+	switch {
+	case days <= 0:
+		logger.Warn("Invalid fetch lookback, using default",
+			zap.String("key", consts.FETCH_LOOKBACK_DAYS),
+			zap.String("value", viper.GetString(consts.FETCH_LOOKBACK_DAYS)),
+			zap.Int("default", consts.FETCH_LOOKBACK_DAYS_DEFAULT))
+		return consts.FETCH_LOOKBACK_DAYS_DEFAULT
+	case days > consts.FETCH_LOOKBACK_DAYS_MAX:
+		logger.Warn("Fetch lookback too large, capping it",
+			zap.String("key", consts.FETCH_LOOKBACK_DAYS),
+			zap.Int("value", days),
+			zap.Int("max", consts.FETCH_LOOKBACK_DAYS_MAX))
+		return consts.FETCH_LOOKBACK_DAYS_MAX
+	}
+	return days
+}
+
+// initializeCache picks the cache implementation based on settings: Redis when REDIS_URL is set,
+// otherwise an in-memory cache expiring entries after CACHE_TTL and cleaning up every CACHE_CLEANUP_INTERVAL,
+// persisted to disk across restarts when a snapshot path is configured
+func initializeCache() interfaces.Cache {
+	redisURL := viper.GetString(consts.REDIS_URL)
+	if redisURL != "" {
+		redisCache, err := cache.NewRedisCache(redisURL)
+		if err == nil {
+			logger.Info("Using Redis transaction cache")
+			return redisCache
+		}
+		logger.Error("Failed to initialize Redis cache, falling back to in-memory cache", zap.Error(err))
+	}
+
+	ttl := cacheTTL()
+	cleanupInterval := settings.GetDuration(consts.CACHE_CLEANUP_INTERVAL, consts.CACHE_CLEANUP_INTERVAL_DEFAULT)
+
+	snapshotPath := viper.GetString(consts.CACHE_SNAPSHOT_PATH)
+	if snapshotPath != "" {
+		snapshotInterval := settings.GetDuration(consts.CACHE_SNAPSHOT_INTERVAL, 5*time.Minute)
+		logger.Info("Using persistent transaction cache",
+			zap.String("path", snapshotPath),
+			zap.Duration("snapshot_interval", snapshotInterval))
+		return cache.NewPersistentCache(snapshotPath, ttl, cleanupInterval, snapshotInterval)
+	}
+
+	return cache.NewInMemoryCache(ttl, cleanupInterval)
+}
+
+// cacheTTL returns how long cached transactions are kept, from CACHE_TTL
+func cacheTTL() time.Duration {
+	return settings.GetDuration(consts.CACHE_TTL, consts.CACHE_TTL_DEFAULT)
+}
+
+// CloseCache flushes and closes the cache if it holds resources (e.g. a disk snapshot)
+func CloseCache() {
+	closer, ok := Cache.(io.Closer)
+	if !ok {
+		return
+	}
+
+	if err := closer.Close(); err != nil {
+		logger.Error("Failed to close cache", zap.Error(err))
+		return
+	}
+	logger.Info("Cache closed")
+}
+
 // StartBackgroundFetching starts the background data fetching from all providers
 func StartBackgroundFetching(ctx context.Context) {
 	services.StartBackgroundFetching(ctx)
 }
 
-// StopBackgroundFetching stops the background data fetching
-func StopBackgroundFetching() {
-	services.StopBackgroundFetching()
+// StopBackgroundFetching stops the background data fetching, waiting for in-flight fetches until the context is done
+func StopBackgroundFetching(ctx context.Context) error {
+	return services.StopBackgroundFetching(ctx)
+}
+
+// StartWebhookDispatcher starts delivering new transactions to the outbound webhook, if configured
+func StartWebhookDispatcher(ctx context.Context) {
+	services.StartWebhookDispatcher(ctx)
+}
+
+// StopWebhookDispatcher stops outbound webhook deliveries
+func StopWebhookDispatcher() {
+	services.StopWebhookDispatcher()
+}
+
+// CheckProviderHealth runs a connectivity check against each configured payment provider, bounded by PROVIDER_HEALTH_TIMEOUT
+func CheckProviderHealth(ctx context.Context) []entities.ProviderHealth {
+	checkers := make(map[string]interfaces.HealthChecker)
+	for source, client := range MockClients {
+		checkers[source] = client
+	}
+	if StripeClient != nil {
+		checkers[consts.PAYMENT_SOURCE_STRIPE] = StripeClient
+	}
+	if VippsClient != nil {
+		checkers[consts.PAYMENT_SOURCE_VIPPS] = VippsClient
+	}
+	if ZettleClient != nil {
+		checkers[consts.PAYMENT_SOURCE_ZETTLE] = ZettleClient
+	}
+
+	timeout := settings.GetDuration(consts.PROVIDER_HEALTH_TIMEOUT, services.DefaultProviderHealthTimeout)
+	return services.CheckProviderHealth(ctx, checkers, timeout)
+}
+
+// GetBackgroundFetchInterval returns the configured background fetch interval
+func GetBackgroundFetchInterval() time.Duration {
+	return services.GetBackgroundFetchInterval()
+}
+
+// GetBackgroundFetchStats returns per-provider fetch statistics
+func GetBackgroundFetchStats() map[string]services.ProviderStats {
+	return services.GetBackgroundFetchStats()
 }
 
 // IsBackgroundFetchingRunning returns true if background fetching is active
@@ -0,0 +1,210 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/services/prices"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+)
+
+// DefaultTransactionsPerDay is how many sample transactions a mock client generates per day of lookback
+const DefaultTransactionsPerDay = 5
+
+// fallbackPrice is sold when the price list is empty, so the dashboard still has data
+var fallbackPrice = prices.Price{Product: "Sample product", Price: 100, Currency: "NOK"}
+
+// MockClient serves deterministic sample transactions for one payment source, for local development
+// without provider credentials. The same source, seed and prices always give the same transactions.
+type MockClient struct {
+	source       string
+	prices       []prices.Price
+	seed         int64
+	lookbackDays int
+	perDay       int
+	now          func() time.Time
+
+	// Generated transactions, newest first
+	transactions []entities.Transaction
+}
+
+// Compile-time check to ensure MockClient implements Transactions interface
+var _ interfaces.Transactions = (*MockClient)(nil)
+
+// Compile-time check to ensure MockClient implements HealthChecker interface
+var _ interfaces.HealthChecker = (*MockClient)(nil)
+
+// Option configures optional settings on a MockClient
+type Option func(*MockClient)
+
+// WithSeed sets the seed sample transactions are generated from. By default the seed is derived from the source.
+func WithSeed(seed int64) Option {
+	return func(m *MockClient) {
+		m.seed = seed
+	}
+}
+
+// WithLookbackDays sets how many days back sample transactions are spread. Non-positive values keep the default.
+func WithLookbackDays(days int) Option {
+	return func(m *MockClient) {
+		if days > 0 {
+			m.lookbackDays = days
+		}
+	}
+}
+
+// WithTransactionsPerDay sets how many sample transactions are generated per day. Non-positive values keep the default.
+func WithTransactionsPerDay(perDay int) Option {
+	return func(m *MockClient) {
+		if perDay > 0 {
+			m.perDay = perDay
+		}
+	}
+}
+
+// withNow sets the clock sample transactions are dated from, for tests
+func withNow(now func() time.Time) Option {
+	return func(m *MockClient) {
+		m.now = now
+	}
+}
+
+// NewMockClient creates a mock client generating sample transactions for the source, with amounts
+// taken from the given prices so they match products in the price list
+func NewMockClient(source string, priceList []prices.Price, opts ...Option) *MockClient {
+	client := &MockClient{
+		source:       source,
+		prices:       priceList,
+		seed:         sourceSeed(source),
+		lookbackDays: consts.FETCH_LOOKBACK_DAYS_DEFAULT,
+		perDay:       DefaultTransactionsPerDay,
+		now:          time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	if len(client.prices) == 0 {
+		client.prices = []prices.Price{fallbackPrice}
+	}
+	client.transactions = client.generate()
+
+	return client
+}
+
+// GetLatestTransactions returns up to limit sample transactions, newest first
+func (m *MockClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit = min(max(limit, 0), len(m.transactions))
+	transactions := make([]entities.Transaction, limit)
+	for i := range limit {
+		transactions[i] = m.served(m.transactions[i])
+	}
+	return transactions, nil
+}
+
+// GetTransactionByID returns the sample transaction with the given ID or external ID
+func (m *MockClient) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return entities.Transaction{}, err
+	}
+
+	for _, transaction := range m.transactions {
+		if transaction.ID == id || transaction.ExternalID == id {
+			return m.served(transaction), nil
+		}
+	}
+	return entities.Transaction{}, fmt.Errorf("%w: %s", interfaces.ErrTransactionNotFound, id)
+}
+
+// CheckHealth always succeeds, since there is no provider to reach
+func (m *MockClient) CheckHealth(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// generate creates the sample transactions, spread over the lookback period up to today.
+// Most are succeeded, with a few refunded, failed and pending ones to exercise status filters.
+func (m *MockClient) generate() []entities.Transaction {
+	random := rand.New(rand.NewSource(m.seed))
+	// Anchor on the start of today, so the transactions stay the same throughout the day
+	now := m.now()
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	count := m.lookbackDays * m.perDay
+	transactions := make([]entities.Transaction, 0, count)
+	for i := range count {
+		price := m.prices[random.Intn(len(m.prices))]
+		daysAgo := i / m.perDay
+		// Spread over opening hours, from 08:00 to 22:00
+		createdAt := today.AddDate(0, 0, -daysAgo).Add(8*time.Hour + time.Duration(random.Intn(14*60))*time.Minute)
+		// Today's transactions later than now would be dated in the future
+		if createdAt.After(now) {
+			createdAt = now
+		}
+
+		status := consts.TRANSACTION_STATUS_SUCCEEDED
+		switch roll := random.Intn(100); {
+		case roll < 3:
+			status = consts.TRANSACTION_STATUS_REFUNDED
+		case roll < 6:
+			status = consts.TRANSACTION_STATUS_FAILED
+		case roll < 8:
+			status = consts.TRANSACTION_STATUS_PENDING
+		}
+
+		externalID := fmt.Sprintf("%s_%04d", m.source, i+1)
+		transactions = append(transactions, entities.Transaction{
+			ID:              fmt.Sprintf("mock_%s", externalID),
+			ExternalID:      externalID,
+			Source:          m.source,
+			Amount:          price.Price,
+			Currency:        price.Currency,
+			Status:          status,
+			CreatedAt:       createdAt,
+			Description:     price.Product,
+			PaymentMethod:   paymentMethod(m.source),
+			TransactionType: "mock_payment",
+			Metadata:        map[string]string{"provider": m.source, "mock": "true"},
+		})
+	}
+
+	// Newest first, like the real providers
+	slices.SortStableFunc(transactions, func(a, b entities.Transaction) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	return transactions
+}
+
+// paymentMethod returns the payment method the real client of the source reports
+func paymentMethod(source string) string {
+	if source == consts.PAYMENT_SOURCE_VIPPS {
+		return "vipps"
+	}
+	return "card"
+}
+
+// sourceSeed derives a stable seed from the source, so each source gets its own sample transactions
+func sourceSeed(source string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(source))
+	return int64(hash.Sum64())
+}
+
+// served copies a generated transaction as served now, with its own metadata so callers can't change the generated ones
+func (m *MockClient) served(transaction entities.Transaction) entities.Transaction {
+	transaction.Metadata = maps.Clone(transaction.Metadata)
+	transaction.CachedAt = m.now()
+	return transaction
+}
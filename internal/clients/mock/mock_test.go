@@ -0,0 +1,129 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/services/prices"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+)
+
+var testPrices = []prices.Price{
+	{Product: "Cabin", Price: 650, Currency: "NOK"},
+	{Product: "Shower", Price: 15, Currency: "NOK"},
+	{Product: "Bed linen", Price: 75, Currency: "NOK"},
+}
+
+func fixedNow() time.Time {
+	return time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+}
+
+func TestMockClient_GetLatestTransactionsIsDeterministic(t *testing.T) {
+	first := NewMockClient(consts.PAYMENT_SOURCE_VIPPS, testPrices, withNow(fixedNow))
+	second := NewMockClient(consts.PAYMENT_SOURCE_VIPPS, testPrices, withNow(fixedNow))
+
+	a, err := first.GetLatestTransactions(context.Background(), 50)
+	if err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+	b, err := second.GetLatestTransactions(context.Background(), 50)
+	if err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+
+	if len(a) != 50 {
+		t.Fatalf("Expected 50 transactions, got %d", len(a))
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Error("Expected the same transactions from clients with the same source and prices")
+	}
+
+	other, _ := NewMockClient(consts.PAYMENT_SOURCE_ZETTLE, testPrices, withNow(fixedNow)).GetLatestTransactions(context.Background(), 50)
+	if reflect.DeepEqual(a, other) {
+		t.Error("Expected different sources to get different transactions")
+	}
+}
+
+func TestMockClient_TransactionsMatchPrices(t *testing.T) {
+	client := NewMockClient(consts.PAYMENT_SOURCE_STRIPE, testPrices, withNow(fixedNow), WithLookbackDays(10))
+
+	transactions, err := client.GetLatestTransactions(context.Background(), 1000)
+	if err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+	if len(transactions) != 10*DefaultTransactionsPerDay {
+		t.Fatalf("Expected %d transactions, got %d", 10*DefaultTransactionsPerDay, len(transactions))
+	}
+
+	oldest := fixedNow().Truncate(24*time.Hour).AddDate(0, 0, -9)
+	for i, transaction := range transactions {
+		if transaction.Source != consts.PAYMENT_SOURCE_STRIPE {
+			t.Errorf("Expected source stripe, got %q", transaction.Source)
+		}
+		matched := false
+		for _, price := range testPrices {
+			if transaction.Description == price.Product && transaction.Amount == price.Price && transaction.Currency == price.Currency {
+				matched = true
+			}
+		}
+		if !matched {
+			t.Errorf("Transaction %s doesn't match a price: %s %.2f %s",
+				transaction.ID, transaction.Description, transaction.Amount, transaction.Currency)
+		}
+		if transaction.CreatedAt.Before(oldest) || transaction.CreatedAt.After(fixedNow()) {
+			t.Errorf("Transaction %s created outside the lookback period: %s", transaction.ID, transaction.CreatedAt)
+		}
+		if i > 0 && transaction.CreatedAt.After(transactions[i-1].CreatedAt) {
+			t.Errorf("Expected transactions newest first, %s is after %s", transaction.ID, transactions[i-1].ID)
+		}
+	}
+}
+
+func TestMockClient_FallsBackWithoutPrices(t *testing.T) {
+	client := NewMockClient(consts.PAYMENT_SOURCE_STRIPE, nil, withNow(fixedNow))
+
+	transactions, err := client.GetLatestTransactions(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+	if len(transactions) != 5 || transactions[0].Amount != fallbackPrice.Price {
+		t.Errorf("Expected 5 transactions of the fallback price, got %v", transactions)
+	}
+}
+
+func TestMockClient_GetTransactionByID(t *testing.T) {
+	client := NewMockClient(consts.PAYMENT_SOURCE_ZETTLE, testPrices, withNow(fixedNow))
+
+	latest, err := client.GetLatestTransactions(context.Background(), 1)
+	if err != nil || len(latest) != 1 {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+
+	byID, err := client.GetTransactionByID(context.Background(), latest[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get transaction by ID: %v", err)
+	}
+	if byID.ExternalID != latest[0].ExternalID {
+		t.Errorf("Expected transaction %s, got %s", latest[0].ExternalID, byID.ExternalID)
+	}
+
+	byExternalID, err := client.GetTransactionByID(context.Background(), latest[0].ExternalID)
+	if err != nil || byExternalID.ID != latest[0].ID {
+		t.Errorf("Expected transaction %s by external ID, got %s (%v)", latest[0].ID, byExternalID.ID, err)
+	}
+
+	// Changing a returned transaction must not change the generated one
+	byID.Metadata["mock"] = "changed"
+	again, _ := client.GetTransactionByID(context.Background(), latest[0].ID)
+	if again.Metadata["mock"] != "true" {
+		t.Errorf("Expected generated metadata to be unchanged, got %v", again.Metadata)
+	}
+
+	if _, err := client.GetTransactionByID(context.Background(), "missing"); !errors.Is(err, interfaces.ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+}
@@ -3,62 +3,135 @@ package stripe
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httpclienthelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/statushelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
 	"github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/balance"
 	"github.com/stripe/stripe-go/v78/charge"
+	"github.com/stripe/stripe-go/v78/paymentintent"
 	"go.uber.org/zap"
 )
 
 type StripeClient struct {
-	APIKey string
-	ctx    context.Context
+	APIKey         string
+	ObjectType     string // consts.STRIPE_OBJECT_TYPE_CHARGE or consts.STRIPE_OBJECT_TYPE_PAYMENT_INTENT
+	MaxAttempts    int    // Attempts per Stripe call on rate limits and server errors
+	retryBaseDelay time.Duration
+	lookbackDays   int // Days back charges and payment intents are listed
+	httpClient     *http.Client
+	charges        *charge.Client
+	paymentIntents *paymentintent.Client
+	balances       *balance.Client
+	ctx            context.Context
 }
 
+// stripeMaxPageSize is the most objects Stripe returns per list request
+const stripeMaxPageSize = 100
+
 // Compile-time check to ensure StripeClient implements Transactions interface
 var _ interfaces.Transactions = (*StripeClient)(nil)
 
-func NewStripeClient(apiKey string) *StripeClient {
-	stripe.Key = apiKey
-	return &StripeClient{APIKey: apiKey}
+// Compile-time check to ensure StripeClient implements HealthChecker interface
+var _ interfaces.HealthChecker = (*StripeClient)(nil)
+
+// Option configures optional settings on a StripeClient
+type Option func(*StripeClient)
+
+// WithHTTPClient sets the HTTP client used for all Stripe requests. A nil client keeps the shared default.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(s *StripeClient) {
+		if httpClient != nil {
+			s.httpClient = httpClient
+		}
+	}
 }
 
-func (s *StripeClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
-	params := &stripe.ChargeListParams{}
-	params.Limit = stripe.Int64(int64(limit))
-	params.Context = ctx
+// WithLookbackDays sets how many days back charges and payment intents are listed. Non-positive values keep the default.
+func WithLookbackDays(days int) Option {
+	return func(s *StripeClient) {
+		if days > 0 {
+			s.lookbackDays = days
+		}
+	}
+}
 
-	i := charge.List(params)
+func NewStripeClient(apiKey string, objectType string, maxAttempts int, opts ...Option) *StripeClient {
+	stripe.Key = apiKey
 
-	var transactions []entities.Transaction
-	for i.Next() {
-		ch := i.Charge()
-		transaction := entities.Transaction{
-			ID:              fmt.Sprintf("stripe_internal_%s", ch.ID),
-			ExternalID:      ch.ID,
-			Source:          consts.PAYMENT_SOURCE_STRIPE,
-			Amount:          float64(ch.Amount) / 100, // Stripe beløp er i cent
-			Currency:        string(ch.Currency),
-			Status:          statushelpers.NormalizeTransactionStatus(string(ch.Status), consts.PAYMENT_SOURCE_STRIPE),
-			CreatedAt:       time.Unix(ch.Created, 0),
-			TransactionType: string(ch.PaymentMethodDetails.Type),
-			Description:     ch.Description,
-			ReceiptURL:      ch.ReceiptURL,
-			Metadata:        ch.Metadata,
-			//Data:            ch,
-			TransferData: ch.TransferData,
-			CachedAt:     time.Now(),
+	if objectType != consts.STRIPE_OBJECT_TYPE_CHARGE && objectType != consts.STRIPE_OBJECT_TYPE_PAYMENT_INTENT {
+		if objectType != "" {
+			logger.Warn("Unknown Stripe object type, falling back to charges", zap.String("object_type", objectType))
 		}
+		objectType = consts.STRIPE_OBJECT_TYPE_CHARGE
+	}
+
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	client := &StripeClient{
+		APIKey:         apiKey,
+		ObjectType:     objectType,
+		MaxAttempts:    maxAttempts,
+		retryBaseDelay: defaultRetryBaseDelay,
+		lookbackDays:   consts.FETCH_LOOKBACK_DAYS_DEFAULT,
+		httpClient:     httpclienthelpers.DefaultClient(),
+	}
 
-		transactions = append(transactions, transaction)
+	for _, opt := range opts {
+		opt(client)
 	}
 
-	if err := i.Err(); err != nil {
+	// Use a dedicated backend so the HTTP client isn't shared through Stripe's global state.
+	// stripe-go's own retries are disabled, so withRetry is the only retry layer and honours Retry-After.
+	backend := stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+		HTTPClient:        client.httpClient,
+		MaxNetworkRetries: stripe.Int64(0),
+	})
+	client.charges = &charge.Client{B: backend, Key: apiKey}
+	client.paymentIntents = &paymentintent.Client{B: backend, Key: apiKey}
+	client.balances = &balance.Client{B: backend, Key: apiKey}
+
+	return client
+}
+
+func (s *StripeClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
+	if s.ObjectType == consts.STRIPE_OBJECT_TYPE_PAYMENT_INTENT {
+		return s.getLatestPaymentIntents(ctx, limit)
+	}
+
+	params := &stripe.ChargeListParams{
+		CreatedRange: s.createdRange(),
+	}
+	params.Limit = pageSize(limit)
+	params.Context = ctx
+	// Expand the customer in the same request to avoid a lookup per charge
+	params.AddExpand("data.customer")
+
+	var transactions []entities.Transaction
+	err := s.withRetry(ctx, "list charges", func() error {
+		// Restart the listing on retry so a failed page isn't lost
+		transactions = nil
+		i := s.charges.List(params)
+		// Stop at the limit, so the next page is never requested
+		for len(transactions) < limit && i.Next() {
+			transaction := ChargeToTransaction(i.Charge())
+			// Omit the raw charge data from listings to keep the cache small
+			transaction.Data = nil
+			transactions = append(transactions, transaction)
+		}
+		return i.Err()
+	})
+	if err != nil {
 		logger.Error("Error retrieving charges", zap.Error(err))
 		return nil, fmt.Errorf("error retrieving charges: %w", err)
 	}
@@ -66,16 +139,64 @@ func (s *StripeClient) GetLatestTransactions(ctx context.Context, limit int) ([]
 	return transactions, nil
 }
 
+// CheckHealth verifies Stripe is reachable and accepts the API key by reading the account balance.
+// It is not retried so a failing check reports promptly.
+func (s *StripeClient) CheckHealth(ctx context.Context) error {
+	params := &stripe.BalanceParams{}
+	params.Context = ctx
+
+	if _, err := s.balances.Get(params); err != nil {
+		return fmt.Errorf("error retrieving balance: %w", err)
+	}
+	return nil
+}
+
 func (s *StripeClient) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
+	// PaymentIntent IDs are always prefixed with pi_, independent of the configured object type
+	if strings.HasPrefix(id, "pi_") {
+		return s.getPaymentIntentByID(ctx, id)
+	}
+
 	params := &stripe.ChargeParams{}
 	params.Context = ctx
+	params.AddExpand("customer")
 
-	ch, err := charge.Get(id, params)
+	var ch *stripe.Charge
+	err := s.withRetry(ctx, "get charge", func() error {
+		var err error
+		ch, err = s.charges.Get(id, params)
+		return err
+	})
 	if err != nil {
+		if isNotFoundError(err) {
+			return entities.Transaction{}, fmt.Errorf("%w: %s", interfaces.ErrTransactionNotFound, id)
+		}
 		logger.Error("Error retrieving charge by ID", zap.Error(err), zap.String("id", id))
 		return entities.Transaction{}, fmt.Errorf("error retrieving charge by ID: %w", err)
 	}
 
+	return ChargeToTransaction(ch), nil
+}
+
+// ChargeToTransaction converts a Stripe charge to a transaction
+func ChargeToTransaction(ch *stripe.Charge) entities.Transaction {
+	transactionType := ""
+	if ch.PaymentMethodDetails != nil {
+		transactionType = string(ch.PaymentMethodDetails.Type)
+	}
+
+	// Copy the metadata so the customer email doesn't leak into the charge itself
+	metadata := make(map[string]string, len(ch.Metadata)+1)
+	for key, value := range ch.Metadata {
+		metadata[key] = value
+	}
+
+	billingEmail := ""
+	if ch.BillingDetails != nil {
+		billingEmail = ch.BillingDetails.Email
+	}
+	customerID := applyCustomerDetails(metadata, ch.Customer, billingEmail)
+
 	transaction := entities.Transaction{
 		ID:              fmt.Sprintf("stripe_internal_%s", ch.ID),
 		ExternalID:      ch.ID,
@@ -84,14 +205,61 @@ func (s *StripeClient) GetTransactionByID(ctx context.Context, id string) (entit
 		Currency:        string(ch.Currency),
 		Status:          statushelpers.NormalizeTransactionStatus(string(ch.Status), consts.PAYMENT_SOURCE_STRIPE),
 		CreatedAt:       time.Unix(ch.Created, 0),
-		TransactionType: string(ch.PaymentMethodDetails.Type),
+		CustomerID:      customerID,
+		TransactionType: transactionType,
 		Description:     ch.Description,
 		ReceiptURL:      ch.ReceiptURL,
-		Metadata:        ch.Metadata,
+		Metadata:        metadata,
 		Data:            ch,
 		TransferData:    ch.TransferData,
 		CachedAt:        time.Now(),
 	}
+	applyRefund(&transaction, ch.Amount, ch)
+	return transaction
+}
+
+// applyRefund applies the refunds of a charge to a transaction for amount, in the smallest currency unit.
+// Refunds keep the charge status as succeeded, so the refund fields are checked explicitly. A full refund gives
+// the refunded status. A partial refund keeps the status and counts only the net amount, with the refunded and
+// original amounts in Metadata["refunded_amount"] and Metadata["original_amount"].
+func applyRefund(transaction *entities.Transaction, amount int64, ch *stripe.Charge) {
+	switch {
+	case ch.Refunded:
+		transaction.Status = consts.TRANSACTION_STATUS_REFUNDED
+	case ch.AmountRefunded > 0:
+		transaction.Metadata["refunded_amount"] = strconv.FormatFloat(float64(ch.AmountRefunded)/100, 'f', 2, 64)
+		transaction.Metadata["original_amount"] = strconv.FormatFloat(float64(amount)/100, 'f', 2, 64)
+		transaction.Amount = float64(amount-ch.AmountRefunded) / 100
+	}
+}
+
+// applyCustomerDetails adds the customer email to the metadata and returns the customer ID.
+// Guest checkouts have no customer, so the billing email is used as a fallback.
+func applyCustomerDetails(metadata map[string]string, customer *stripe.Customer, billingEmail string) string {
+	customerID := ""
+	customerEmail := ""
+	if customer != nil {
+		customerID = customer.ID
+		customerEmail = customer.Email
+	}
+	if customerEmail == "" {
+		customerEmail = billingEmail
+	}
+	if customerEmail != "" {
+		metadata["customer_email"] = customerEmail
+	}
+
+	return customerID
+}
 
-	return transaction, nil
+// pageSize returns the list page size for a requested limit, capped at what Stripe allows
+func pageSize(limit int) *int64 {
+	return stripe.Int64(int64(min(limit, stripeMaxPageSize)))
+}
+
+// createdRange limits listings to objects created within the lookback window
+func (s *StripeClient) createdRange() *stripe.RangeQueryParams {
+	return &stripe.RangeQueryParams{
+		GreaterThanOrEqual: time.Now().AddDate(0, 0, -s.lookbackDays).Unix(),
+	}
 }
@@ -0,0 +1,137 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/statushelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"github.com/stripe/stripe-go/v78"
+	"go.uber.org/zap"
+)
+
+func (s *StripeClient) getLatestPaymentIntents(ctx context.Context, limit int) ([]entities.Transaction, error) {
+	params := &stripe.PaymentIntentListParams{
+		CreatedRange: s.createdRange(),
+	}
+	params.Limit = pageSize(limit)
+	params.Context = ctx
+	// Expand the customer and latest charge in the same request to avoid a lookup per intent
+	params.AddExpand("data.customer")
+	params.AddExpand("data.latest_charge")
+
+	var transactions []entities.Transaction
+	err := s.withRetry(ctx, "list payment intents", func() error {
+		// Restart the listing on retry so a failed page isn't lost
+		transactions = nil
+		i := s.paymentIntents.List(params)
+		// Stop at the limit, so the next page is never requested
+		for len(transactions) < limit && i.Next() {
+			transaction := PaymentIntentToTransaction(i.PaymentIntent())
+			// Omit the raw intent data from listings to keep the cache small
+			transaction.Data = nil
+			transactions = append(transactions, transaction)
+		}
+		return i.Err()
+	})
+	if err != nil {
+		logger.Error("Error retrieving payment intents", zap.Error(err))
+		return nil, fmt.Errorf("error retrieving payment intents: %w", err)
+	}
+
+	return transactions, nil
+}
+
+func (s *StripeClient) getPaymentIntentByID(ctx context.Context, id string) (entities.Transaction, error) {
+	params := &stripe.PaymentIntentParams{}
+	params.Context = ctx
+	params.AddExpand("customer")
+	params.AddExpand("latest_charge")
+
+	var pi *stripe.PaymentIntent
+	err := s.withRetry(ctx, "get payment intent", func() error {
+		var err error
+		pi, err = s.paymentIntents.Get(id, params)
+		return err
+	})
+	if err != nil {
+		if isNotFoundError(err) {
+			return entities.Transaction{}, fmt.Errorf("%w: %s", interfaces.ErrTransactionNotFound, id)
+		}
+		logger.Error("Error retrieving payment intent by ID", zap.Error(err), zap.String("id", id))
+		return entities.Transaction{}, fmt.Errorf("error retrieving payment intent by ID: %w", err)
+	}
+
+	return PaymentIntentToTransaction(pi), nil
+}
+
+// PaymentIntentToTransaction converts a Stripe PaymentIntent to a transaction.
+// Receipt, payment method and refund details are taken from the latest charge when it is expanded.
+func PaymentIntentToTransaction(pi *stripe.PaymentIntent) entities.Transaction {
+	status := string(pi.Status)
+
+	metadata := make(map[string]string, len(pi.Metadata)+1)
+	for key, value := range pi.Metadata {
+		metadata[key] = value
+	}
+
+	transactionType := ""
+	receiptURL := ""
+	billingEmail := pi.ReceiptEmail
+	var transferData any
+	if ch := pi.LatestCharge; ch != nil {
+		if ch.PaymentMethodDetails != nil {
+			transactionType = string(ch.PaymentMethodDetails.Type)
+		}
+		if billingEmail == "" && ch.BillingDetails != nil {
+			billingEmail = ch.BillingDetails.Email
+		}
+		receiptURL = ch.ReceiptURL
+		transferData = ch.TransferData
+	}
+	if transactionType == "" && len(pi.PaymentMethodTypes) > 0 {
+		transactionType = pi.PaymentMethodTypes[0]
+	}
+
+	customerID := applyCustomerDetails(metadata, pi.Customer, billingEmail)
+
+	transaction := entities.Transaction{
+		ID:              fmt.Sprintf("stripe_internal_%s", pi.ID),
+		ExternalID:      pi.ID,
+		Source:          consts.PAYMENT_SOURCE_STRIPE,
+		Amount:          float64(pi.Amount) / 100, // Stripe beløp er i cent
+		Currency:        string(pi.Currency),
+		Status:          statushelpers.NormalizeTransactionStatus(status, consts.PAYMENT_SOURCE_STRIPE),
+		CreatedAt:       time.Unix(pi.Created, 0),
+		CustomerID:      customerID,
+		TransactionType: transactionType,
+		Description:     pi.Description,
+		ReceiptURL:      receiptURL,
+		Metadata:        metadata,
+		Data:            pi,
+		TransferData:    transferData,
+		CachedAt:        time.Now(),
+	}
+	// Refunds keep the intent status as succeeded, so check the charge explicitly
+	if pi.LatestCharge != nil {
+		applyRefund(&transaction, pi.Amount, pi.LatestCharge)
+	}
+	return transaction
+}
+
+// ChargeToPaymentIntentTransaction converts a Stripe charge to the transaction of its PaymentIntent, so charge
+// webhook events update the payment intents listed with STRIPE_OBJECT_TYPE=payment_intent instead of adding
+// the payment again. A charge without a PaymentIntent is converted like ChargeToTransaction.
+func ChargeToPaymentIntentTransaction(ch *stripe.Charge) entities.Transaction {
+	transaction := ChargeToTransaction(ch)
+	if ch.PaymentIntent != nil && ch.PaymentIntent.ID != "" {
+		transaction.ID = fmt.Sprintf("stripe_internal_%s", ch.PaymentIntent.ID)
+		transaction.ExternalID = ch.PaymentIntent.ID
+		transaction.Metadata["charge_id"] = ch.ID
+	}
+	return transaction
+}
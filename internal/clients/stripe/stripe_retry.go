@@ -0,0 +1,102 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"github.com/stripe/stripe-go/v78"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultMaxAttempts is used when no positive attempt count is configured
+	defaultMaxAttempts = 3
+	// defaultRetryBaseDelay is the first retry delay when Stripe gives no Retry-After, doubled per attempt
+	defaultRetryBaseDelay = 1 * time.Second
+	// maxRetryDelay caps both the exponential delay and the Retry-After header
+	maxRetryDelay = 30 * time.Second
+)
+
+// withRetry runs fn until it succeeds, fails with a non-transient error or runs out of attempts.
+// Context cancellation stops waiting between attempts immediately.
+func (s *StripeClient) withRetry(ctx context.Context, operation string, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= s.MaxAttempts; attempt++ {
+		err = fn()
+		if err == nil || !isRetryableError(err) || attempt == s.MaxAttempts {
+			return err
+		}
+
+		delay := s.retryDelay(err, attempt)
+		logger.Warn("Transient Stripe error, retrying",
+			zap.String("operation", operation),
+			zap.Int("attempt", attempt),
+			zap.Int("max_attempts", s.MaxAttempts),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return err
+}
+
+// isRetryableError reports whether a Stripe error is a rate limit or server error
+func isRetryableError(err error) bool {
+	var stripeErr *stripe.Error
+	if !errors.As(err, &stripeErr) {
+		return false
+	}
+
+	return stripeErr.HTTPStatusCode == http.StatusTooManyRequests || stripeErr.HTTPStatusCode >= http.StatusInternalServerError
+}
+
+// isNotFoundError reports whether Stripe rejected a lookup because the object doesn't exist
+func isNotFoundError(err error) bool {
+	var stripeErr *stripe.Error
+	return errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == http.StatusNotFound
+}
+
+// retryDelay honors the Retry-After header on rate limits and otherwise backs off exponentially
+func (s *StripeClient) retryDelay(err error, attempt int) time.Duration {
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == http.StatusTooManyRequests && stripeErr.LastResponse != nil {
+		if delay, ok := parseRetryAfter(stripeErr.LastResponse.Header.Get("Retry-After")); ok {
+			return min(delay, maxRetryDelay)
+		}
+	}
+
+	delay := s.retryBaseDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxRetryDelay)
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
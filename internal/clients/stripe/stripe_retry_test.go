@@ -0,0 +1,129 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/stripe/stripe-go/v78"
+)
+
+// newStripeError creates a Stripe API error with the given status and Retry-After header
+func newStripeError(status int, retryAfter string) *stripe.Error {
+	stripeErr := &stripe.Error{HTTPStatusCode: status}
+	stripeErr.LastResponse = &stripe.APIResponse{Header: http.Header{}}
+	if retryAfter != "" {
+		stripeErr.LastResponse.Header.Set("Retry-After", retryAfter)
+	}
+	return stripeErr
+}
+
+func newTestStripeClient(maxAttempts int) *StripeClient {
+	client := NewStripeClient("sk_test", "", maxAttempts)
+	client.retryBaseDelay = 1 * time.Millisecond
+	return client
+}
+
+func TestWithRetry_RetriesTransientErrors(t *testing.T) {
+	client := newTestStripeClient(3)
+
+	calls := 0
+	err := client.withRetry(context.Background(), "test", func() error {
+		calls++
+		if calls < 3 {
+			return newStripeError(http.StatusInternalServerError, "")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected success after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
+
+func TestWithRetry_StopsOnPermanentErrorAndMaxAttempts(t *testing.T) {
+	client := newTestStripeClient(2)
+
+	calls := 0
+	err := client.withRetry(context.Background(), "test", func() error {
+		calls++
+		return newStripeError(http.StatusBadRequest, "")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected a single call for a permanent error, got %d calls (err %v)", calls, err)
+	}
+
+	calls = 0
+	err = client.withRetry(context.Background(), "test", func() error {
+		calls++
+		return newStripeError(http.StatusTooManyRequests, "")
+	})
+	if err == nil || calls != 2 {
+		t.Errorf("Expected 2 calls before giving up, got %d calls (err %v)", calls, err)
+	}
+}
+
+func TestWithRetry_ContextCancellation(t *testing.T) {
+	client := newTestStripeClient(5)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := client.withRetry(ctx, "test", func() error {
+		calls++
+		cancel()
+		// A long Retry-After must not delay cancellation
+		return newStripeError(http.StatusTooManyRequests, "20")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	client := newTestStripeClient(3)
+	client.retryBaseDelay = 1 * time.Second
+
+	if delay := client.retryDelay(newStripeError(http.StatusTooManyRequests, "7"), 1); delay != 7*time.Second {
+		t.Errorf("Expected Retry-After delay of 7s, got %v", delay)
+	}
+	if delay := client.retryDelay(newStripeError(http.StatusTooManyRequests, "3600"), 1); delay != maxRetryDelay {
+		t.Errorf("Expected Retry-After to be capped at %v, got %v", maxRetryDelay, delay)
+	}
+	if delay := client.retryDelay(newStripeError(http.StatusBadGateway, ""), 3); delay != 4*time.Second {
+		t.Errorf("Expected exponential delay of 4s, got %v", delay)
+	}
+}
+
+func TestStripeClient_OnlyRetriesInWithRetry(t *testing.T) {
+	requests := 0
+	httpClient := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requests++
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"error": {"type": "api_error", "message": "unavailable"}}`)),
+			Request:    r,
+		}, nil
+	})}
+
+	client := NewStripeClient("sk_test", consts.STRIPE_OBJECT_TYPE_CHARGE, 2, WithHTTPClient(httpClient))
+	client.retryBaseDelay = 1 * time.Millisecond
+
+	if _, err := client.GetLatestTransactions(context.Background(), 10); err == nil {
+		t.Fatal("Expected an error when Stripe keeps failing")
+	}
+	// stripe-go's own retries would multiply the attempts
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, one per attempt, got %d", requests)
+	}
+}
@@ -0,0 +1,223 @@
+package stripe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/stripe/stripe-go/v78"
+)
+
+func TestChargeToTransaction_CustomerDetails(t *testing.T) {
+	ch := &stripe.Charge{
+		ID:       "ch_123",
+		Status:   stripe.ChargeStatusSucceeded,
+		Customer: &stripe.Customer{ID: "cus_123", Email: "guest@example.com"},
+		Metadata: map[string]string{"order": "1"},
+	}
+
+	transaction := ChargeToTransaction(ch)
+	if transaction.CustomerID != "cus_123" {
+		t.Errorf("Expected customer ID cus_123, got %q", transaction.CustomerID)
+	}
+	if transaction.Metadata["customer_email"] != "guest@example.com" {
+		t.Errorf("Expected customer email in metadata, got %q", transaction.Metadata["customer_email"])
+	}
+	if _, found := ch.Metadata["customer_email"]; found {
+		t.Error("Expected the charge metadata to be left untouched")
+	}
+}
+
+func TestChargeToTransaction_GuestCheckout(t *testing.T) {
+	ch := &stripe.Charge{
+		ID:             "ch_456",
+		Status:         stripe.ChargeStatusSucceeded,
+		BillingDetails: &stripe.ChargeBillingDetails{Email: "billing@example.com"},
+	}
+
+	transaction := ChargeToTransaction(ch)
+	if transaction.CustomerID != "" {
+		t.Errorf("Expected empty customer ID for guest checkout, got %q", transaction.CustomerID)
+	}
+	if transaction.Metadata["customer_email"] != "billing@example.com" {
+		t.Errorf("Expected billing email in metadata, got %q", transaction.Metadata["customer_email"])
+	}
+
+	transaction = ChargeToTransaction(&stripe.Charge{ID: "ch_789"})
+	if _, found := transaction.Metadata["customer_email"]; found {
+		t.Error("Expected no customer email when the charge has none")
+	}
+}
+
+func TestPaymentIntentToTransaction(t *testing.T) {
+	pi := &stripe.PaymentIntent{
+		ID:       "pi_123",
+		Amount:   39000,
+		Currency: stripe.CurrencyNOK,
+		Status:   stripe.PaymentIntentStatusRequiresAction,
+	}
+
+	transaction := PaymentIntentToTransaction(pi)
+	if transaction.ID != "stripe_internal_pi_123" || transaction.ExternalID != "pi_123" {
+		t.Errorf("Unexpected transaction identity %s/%s", transaction.ID, transaction.ExternalID)
+	}
+	if transaction.Amount != 390 {
+		t.Errorf("Expected amount 390, got %f", transaction.Amount)
+	}
+	if transaction.Status != consts.TRANSACTION_STATUS_PENDING {
+		t.Errorf("Expected status %s, got %s", consts.TRANSACTION_STATUS_PENDING, transaction.Status)
+	}
+
+	// A refunded latest charge overrides the succeeded intent status
+	pi.Status = stripe.PaymentIntentStatusSucceeded
+	pi.LatestCharge = &stripe.Charge{ID: "ch_123", Refunded: true, AmountRefunded: 39000, ReceiptURL: "https://example.com/receipt"}
+	transaction = PaymentIntentToTransaction(pi)
+	if transaction.Status != consts.TRANSACTION_STATUS_REFUNDED {
+		t.Errorf("Expected status %s, got %s", consts.TRANSACTION_STATUS_REFUNDED, transaction.Status)
+	}
+	if transaction.ReceiptURL != "https://example.com/receipt" {
+		t.Errorf("Expected receipt URL from latest charge, got %q", transaction.ReceiptURL)
+	}
+}
+
+func TestChargeToTransaction_Refunds(t *testing.T) {
+	ch := &stripe.Charge{ID: "ch_1", Amount: 50000, Status: stripe.ChargeStatusSucceeded, AmountRefunded: 12550}
+
+	// A partial refund keeps the charge succeeded and counts the net amount
+	transaction := ChargeToTransaction(ch)
+	if transaction.Status != consts.TRANSACTION_STATUS_SUCCEEDED || transaction.Amount != 374.50 {
+		t.Errorf("Expected a succeeded transaction of 374.50, got %s of %v", transaction.Status, transaction.Amount)
+	}
+	if transaction.Metadata["refunded_amount"] != "125.50" || transaction.Metadata["original_amount"] != "500.00" {
+		t.Errorf("Expected refunded and original amounts in metadata, got %v", transaction.Metadata)
+	}
+
+	ch.Refunded, ch.AmountRefunded = true, 50000
+	if transaction = ChargeToTransaction(ch); transaction.Status != consts.TRANSACTION_STATUS_REFUNDED {
+		t.Errorf("Expected a fully refunded charge to be %s, got %s", consts.TRANSACTION_STATUS_REFUNDED, transaction.Status)
+	}
+
+	// The same applies to the latest charge of a payment intent
+	pi := &stripe.PaymentIntent{
+		ID:           "pi_1",
+		Amount:       50000,
+		Status:       stripe.PaymentIntentStatusSucceeded,
+		LatestCharge: &stripe.Charge{ID: "ch_1", AmountRefunded: 12550},
+	}
+	if transaction = PaymentIntentToTransaction(pi); transaction.Status != consts.TRANSACTION_STATUS_SUCCEEDED || transaction.Amount != 374.50 {
+		t.Errorf("Expected a partially refunded intent to be succeeded with 374.50, got %s of %v", transaction.Status, transaction.Amount)
+	}
+}
+
+func TestChargeToPaymentIntentTransaction(t *testing.T) {
+	var ch stripe.Charge
+	body := `{"id": "ch_1", "amount": 50000, "currency": "nok", "status": "succeeded", "payment_intent": "pi_1", "amount_refunded": 10000}`
+	if err := json.Unmarshal([]byte(body), &ch); err != nil {
+		t.Fatalf("Failed to parse charge: %v", err)
+	}
+
+	// Stored under the ID polling gives the intent, with the refund of the charge
+	transaction := ChargeToPaymentIntentTransaction(&ch)
+	listed := PaymentIntentToTransaction(&stripe.PaymentIntent{ID: "pi_1"})
+	if transaction.ID != listed.ID || transaction.ExternalID != "pi_1" || transaction.Metadata["charge_id"] != "ch_1" {
+		t.Errorf("Expected the charge under its payment intent, got %s/%s with %v", transaction.ID, transaction.ExternalID, transaction.Metadata)
+	}
+	if transaction.Amount != 400 {
+		t.Errorf("Expected the net amount 400, got %v", transaction.Amount)
+	}
+
+	// A charge without a payment intent keeps its own identity
+	if transaction = ChargeToPaymentIntentTransaction(&stripe.Charge{ID: "ch_2"}); transaction.ID != "stripe_internal_ch_2" {
+		t.Errorf("Expected stripe_internal_ch_2, got %s", transaction.ID)
+	}
+}
+
+// roundTripFunc lets a function act as an HTTP transport
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestStripeClient_WithHTTPClient(t *testing.T) {
+	var requestedPath, requestedLimit string
+	httpClient := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requestedPath = r.URL.Path
+		requestedLimit = r.URL.Query().Get("limit")
+		body := `{"object":"list","url":"/v1/charges","has_more":false,"data":[{"id":"ch_1","amount":1000,"currency":"nok","status":"succeeded"}]}`
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})}
+
+	client := NewStripeClient("sk_test", consts.STRIPE_OBJECT_TYPE_CHARGE, 1, WithHTTPClient(httpClient))
+
+	transactions, err := client.GetLatestTransactions(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+	if requestedLimit != "10" {
+		t.Errorf("Expected the requested limit 10, got %q", requestedLimit)
+	}
+	if requestedPath != "/v1/charges" {
+		t.Errorf("Expected request through the injected client to /v1/charges, got %q", requestedPath)
+	}
+	if len(transactions) != 1 || transactions[0].ID != "stripe_internal_ch_1" {
+		t.Errorf("Unexpected transactions %v", transactions)
+	}
+}
+
+func TestStripeClient_GetLatestTransactionsStopsAtLimit(t *testing.T) {
+	for _, objectType := range []string{consts.STRIPE_OBJECT_TYPE_CHARGE, consts.STRIPE_OBJECT_TYPE_PAYMENT_INTENT} {
+		t.Run(objectType, func(t *testing.T) {
+			// Three full pages, as for a busy lookback window
+			requests := 0
+			httpClient := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				requests++
+				size, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+				objects := make([]string, size)
+				for n := range objects {
+					objects[n] = fmt.Sprintf(`{"id":"obj_%d_%d","amount":1000,"currency":"nok","status":"succeeded"}`, requests, n)
+				}
+				body := fmt.Sprintf(`{"object":"list","url":%q,"has_more":%t,"data":[%s]}`, r.URL.Path, requests < 3, strings.Join(objects, ","))
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": []string{"application/json"}},
+					Body:       io.NopCloser(strings.NewReader(body)),
+					Request:    r,
+				}, nil
+			})}
+
+			client := NewStripeClient("sk_test", objectType, 1, WithHTTPClient(httpClient))
+
+			transactions, err := client.GetLatestTransactions(context.Background(), stripeMaxPageSize+50)
+			if err != nil {
+				t.Fatalf("Failed to get transactions: %v", err)
+			}
+			if len(transactions) != stripeMaxPageSize+50 {
+				t.Errorf("Expected %d transactions, got %d", stripeMaxPageSize+50, len(transactions))
+			}
+			if requests != 2 {
+				t.Errorf("Expected 2 page requests, got %d", requests)
+			}
+		})
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	if size := *pageSize(50); size != 50 {
+		t.Errorf("Expected a limit within the Stripe maximum to be kept, got %d", size)
+	}
+	if size := *pageSize(500); size != stripeMaxPageSize {
+		t.Errorf("Expected a limit above the Stripe maximum to be capped at %d, got %d", stripeMaxPageSize, size)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,7 +15,10 @@ import (
 
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httpclienthelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/redacthelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/statushelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/timehelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
 	"go.uber.org/zap"
@@ -27,11 +31,17 @@ type VippsClient struct {
 	Secret               string
 	MerchantSerialNumber string // Added required field
 	httpClient           *http.Client
+	lookbackDays         int            // Days back transactions are fetched
+	location             *time.Location // Time zone of dates and times sent without one
 
 	// Token management
 	accessToken string
 	tokenExpiry time.Time
 	tokenMutex  sync.RWMutex
+
+	// Name of the transactions endpoint that worked last time, so later fetches skip probing
+	resolvedEndpoint string
+	endpointMutex    sync.RWMutex
 }
 
 type TokenResponse struct {
@@ -61,7 +71,40 @@ type VippsTransactionResponse struct {
 // Compile-time check to ensure VippsClient implements Transactions interface
 var _ interfaces.Transactions = (*VippsClient)(nil)
 
-func NewVippsClient(subscriptionKey, apiURL, clientID, secret, merchantSerialNumber string) *VippsClient {
+// Compile-time check to ensure VippsClient implements HealthChecker interface
+var _ interfaces.HealthChecker = (*VippsClient)(nil)
+
+// Option configures optional settings on a VippsClient
+type Option func(*VippsClient)
+
+// WithHTTPClient sets the HTTP client used for all Vipps requests. A nil client keeps the shared default.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(v *VippsClient) {
+		if httpClient != nil {
+			v.httpClient = httpClient
+		}
+	}
+}
+
+// WithLookbackDays sets how many days back transactions are fetched. Non-positive values keep the default.
+func WithLookbackDays(days int) Option {
+	return func(v *VippsClient) {
+		if days > 0 {
+			v.lookbackDays = days
+		}
+	}
+}
+
+// WithLocation sets the time zone dates and times without one are read in. A nil location keeps UTC.
+func WithLocation(loc *time.Location) Option {
+	return func(v *VippsClient) {
+		if loc != nil {
+			v.location = loc
+		}
+	}
+}
+
+func NewVippsClient(subscriptionKey, apiURL, clientID, secret, merchantSerialNumber string, opts ...Option) *VippsClient {
 	logger.Info("Initializing Vipps client",
 		zap.String("api_url", apiURL),
 		zap.String("client_id", clientID),
@@ -69,14 +112,22 @@ func NewVippsClient(subscriptionKey, apiURL, clientID, secret, merchantSerialNum
 		zap.Bool("has_subscription_key", subscriptionKey != ""),
 		zap.Bool("has_secret", secret != ""))
 
-	return &VippsClient{
+	client := &VippsClient{
 		SubscriptionKey:      subscriptionKey,
 		APIURL:               apiURL,
 		ClientID:             clientID,
 		Secret:               secret,
 		MerchantSerialNumber: merchantSerialNumber,
-		httpClient:           &http.Client{Timeout: 30 * time.Second},
+		httpClient:           httpclienthelpers.DefaultClient(),
+		lookbackDays:         consts.FETCH_LOOKBACK_DAYS_DEFAULT,
+		location:             time.UTC,
 	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client
 }
 
 func (v *VippsClient) getAccessToken(ctx context.Context) (string, error) {
@@ -97,6 +148,11 @@ func (v *VippsClient) getAccessToken(ctx context.Context) (string, error) {
 		return v.accessToken, nil
 	}
 
+	return v.fetchAccessToken(ctx)
+}
+
+// fetchAccessToken requests a new access token and stores it. The caller must hold tokenMutex for writing.
+func (v *VippsClient) fetchAccessToken(ctx context.Context) (string, error) {
 	logger.Info("Fetching new Vipps access token")
 
 	// Prepare the request
@@ -124,7 +180,7 @@ func (v *VippsClient) getAccessToken(ctx context.Context) (string, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		bodyString := string(bodyBytes)
+		bodyString := redacthelpers.Redact(string(bodyBytes))
 		logger.Error("Vipps token request failed",
 			zap.Int("status", resp.StatusCode),
 			zap.String("response_body", bodyString),
@@ -156,6 +212,15 @@ func (v *VippsClient) getAccessToken(ctx context.Context) (string, error) {
 	return v.accessToken, nil
 }
 
+// CheckHealth verifies Vipps is reachable and accepts the configured credentials by requesting a fresh access token
+func (v *VippsClient) CheckHealth(ctx context.Context) error {
+	v.tokenMutex.Lock()
+	defer v.tokenMutex.Unlock()
+
+	_, err := v.fetchAccessToken(ctx)
+	return err
+}
+
 func (v *VippsClient) makeAuthenticatedRequest(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
 	token, err := v.getAccessToken(ctx)
 	if err != nil {
@@ -234,115 +299,93 @@ func (v *VippsClient) makeAuthenticatedRequest(ctx context.Context, method, url
 	return resp, nil
 }
 
-func (v *VippsClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
-	logger.Info("Fetching transactions from Vipps", zap.Int("limit", limit))
+// vippsEndpoint is a candidate API endpoint for listing transactions
+type vippsEndpoint struct {
+	name          string // Stable name, used to remember the endpoint that works
+	path          string
+	supportsLimit bool
+}
 
-	// Calculate date range for the last 30 days
-	endDate := time.Now()
-	startDate := endDate.AddDate(0, 0, -30)
+// vippsMaxLimit is the most transactions the Vipps endpoints return per request
+const vippsMaxLimit = 100
 
-	// Format dates as required by Vipps API (YYYY-MM-DD)
-	since := startDate.Format("2006-01-02")
-	until := endDate.Format("2006-01-02")
+// errVippsEndpointNotFound is returned when an endpoint responds with 404, meaning the merchant doesn't use that API
+var errVippsEndpointNotFound = errors.New("endpoint not found")
 
+// vippsEndpoints lists the candidate endpoints for transactions between since and until, in the order they are tried
+func vippsEndpoints(since, until string) []vippsEndpoint {
 	// Try different Vipps API endpoints based on the official documentation
 	// Note: Vipps doesn't support direct transaction listing - you need specific order IDs
 	// or use the Reports API for settlement data
-	possibleEndpoints := []string{
+	return []vippsEndpoint{
 		// Reports API (recommended for transaction history)
-		fmt.Sprintf("/report/v1/transactions?from=%s&to=%s", since, until),
-		fmt.Sprintf("/report/v1/settlements?from=%s&to=%s", since, until),
+		{"report_transactions", fmt.Sprintf("/report/v1/transactions?from=%s&to=%s", since, until), true},
+		{"report_settlements", fmt.Sprintf("/report/v1/settlements?from=%s&to=%s", since, until), true},
 
 		// Recurring API (if using Vipps Recurring)
-		"/recurring/v2/agreements?status=ACTIVE",
+		{"recurring_agreements", "/recurring/v2/agreements?status=ACTIVE", false},
 
 		// ePayment API (requires specific order IDs, but let's try)
-		"/ecomm/v2/payments",
-		fmt.Sprintf("/ecomm/v2/payments?since=%s&until=%s", since, until),
+		{"ecomm_payments", "/ecomm/v2/payments", true},
+		{"ecomm_payments_range", fmt.Sprintf("/ecomm/v2/payments?since=%s&until=%s", since, until), true},
 
 		// Checkout API (newer Vipps product)
-		"/checkout/v3/sessions",
+		{"checkout_sessions", "/checkout/v3/sessions", false},
 	}
+}
 
-	var lastErr error
+// GetLatestTransactions fetches transactions from the endpoint that worked last time. Until one has worked,
+// or when the remembered endpoint starts returning 404, every candidate endpoint is probed in order.
+func (v *VippsClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
+	logger.Info("Fetching transactions from Vipps", zap.Int("limit", limit))
+	limit = min(limit, vippsMaxLimit)
 
-	// Try each endpoint until we find one that works
-	for i, endpoint := range possibleEndpoints {
-		// Add limit parameter if it makes sense for this endpoint
-		testEndpoint := endpoint
-		if limit > 0 && limit <= 100 && (i == 0 || i == 1 || i == 3 || i == 4) {
-			separator := "&"
-			if !strings.Contains(testEndpoint, "?") {
-				separator = "?"
+	// Calculate date range for the lookback window, in local dates so today isn't cut off before midnight UTC
+	endDate := time.Now().In(v.location)
+	startDate := endDate.AddDate(0, 0, -v.lookbackDays)
+
+	// Format dates as required by Vipps API (YYYY-MM-DD)
+	since := startDate.Format(timehelpers.DateLayout)
+	until := endDate.Format(timehelpers.DateLayout)
+
+	endpoints := vippsEndpoints(since, until)
+
+	if resolved := v.getResolvedEndpoint(); resolved != "" {
+		for _, endpoint := range endpoints {
+			if endpoint.name != resolved {
+				continue
 			}
-			testEndpoint += fmt.Sprintf("%slimit=%d", separator, limit)
-		}
 
-		url := fmt.Sprintf("%s%s", v.APIURL, testEndpoint)
-		logger.Info("Trying Vipps API endpoint",
-			zap.Int("attempt", i+1),
-			zap.String("url", url),
-			zap.String("endpoint", testEndpoint))
+			transactions, err := v.fetchFromEndpoint(ctx, endpoint, limit)
+			if !errors.Is(err, errVippsEndpointNotFound) {
+				return transactions, err
+			}
 
-		resp, err := v.makeAuthenticatedRequest(ctx, "GET", url, nil)
-		if err != nil {
-			logger.Warn("Failed to make request to endpoint",
-				zap.String("endpoint", testEndpoint),
-				zap.Error(err))
-			lastErr = err
-			continue
+			logger.Warn("Resolved Vipps endpoint is no longer available, probing all endpoints again",
+				zap.String("endpoint", endpoint.name))
+			break
 		}
-		defer resp.Body.Close()
+		v.setResolvedEndpoint("")
+	}
 
-		// If we get 404, try the next endpoint
-		if resp.StatusCode == http.StatusNotFound {
-			logger.Info("Endpoint not found, trying next", zap.String("endpoint", testEndpoint))
-			lastErr = fmt.Errorf("endpoint not found: %s", testEndpoint)
-			continue
-		}
+	var lastErr error
 
-		// If we get other errors, log them but continue trying
-		if resp.StatusCode != http.StatusOK {
-			bodyBytes, _ := io.ReadAll(resp.Body)
-			bodyString := string(bodyBytes)
-			logger.Warn("Endpoint returned error, trying next",
-				zap.String("endpoint", testEndpoint),
-				zap.Int("status", resp.StatusCode),
-				zap.String("response_body", bodyString))
-			lastErr = fmt.Errorf("endpoint %s returned status %d: %s", testEndpoint, resp.StatusCode, bodyString)
-			continue
-		}
+	// Try each endpoint until we find one that works
+	for i, endpoint := range endpoints {
+		logger.Info("Trying Vipps API endpoint",
+			zap.Int("attempt", i+1),
+			zap.String("endpoint", endpoint.name))
 
-		// Success! Parse the response
-		bodyBytes, err := io.ReadAll(resp.Body)
+		transactions, err := v.fetchFromEndpoint(ctx, endpoint, limit)
 		if err != nil {
-			logger.Error("Failed to read response body", zap.Error(err))
 			lastErr = err
 			continue
 		}
 
-		logger.Info("Successfully connected to Vipps endpoint",
-			zap.String("endpoint", testEndpoint),
-			zap.String("response_preview", string(bodyBytes[:minInt(200, len(bodyBytes))])))
-
-		// Try to parse as different response formats
-		transactions, parseErr := v.parseVippsResponse(bodyBytes, testEndpoint)
-		if parseErr != nil {
-			logger.Warn("Failed to parse response from endpoint",
-				zap.String("endpoint", testEndpoint),
-				zap.Error(parseErr))
-			lastErr = parseErr
-			continue
-		}
-
-		// Apply limit if we got more transactions than requested
-		if limit > 0 && len(transactions) > limit {
-			transactions = transactions[:limit]
-		}
-
-		logger.Info("Successfully fetched Vipps transactions",
-			zap.String("endpoint", testEndpoint),
-			zap.Int("count", len(transactions)))
+		v.setResolvedEndpoint(endpoint.name)
+		logger.Info("Selected Vipps API endpoint, later fetches will use it directly",
+			zap.String("endpoint", endpoint.name),
+			zap.String("path", endpoint.path))
 		return transactions, nil
 	}
 
@@ -352,6 +395,90 @@ func (v *VippsClient) GetLatestTransactions(ctx context.Context, limit int) ([]e
 		"This suggests your Vipps setup uses a different API product. Check your Vipps developer dashboard for the correct API endpoints.", lastErr)
 }
 
+// fetchFromEndpoint fetches and parses transactions from a single endpoint.
+// It returns errVippsEndpointNotFound when the endpoint responds with 404.
+func (v *VippsClient) fetchFromEndpoint(ctx context.Context, endpoint vippsEndpoint, limit int) ([]entities.Transaction, error) {
+	// Add limit parameter if it makes sense for this endpoint
+	path := endpoint.path
+	if endpoint.supportsLimit && limit > 0 {
+		separator := "&"
+		if !strings.Contains(path, "?") {
+			separator = "?"
+		}
+		path += fmt.Sprintf("%slimit=%d", separator, limit)
+	}
+
+	url := fmt.Sprintf("%s%s", v.APIURL, path)
+	resp, err := v.makeAuthenticatedRequest(ctx, "GET", url, nil)
+	if err != nil {
+		logger.Warn("Failed to make request to endpoint",
+			zap.String("endpoint", path),
+			zap.Error(err))
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// A 404 means the merchant doesn't use this API product
+	if resp.StatusCode == http.StatusNotFound {
+		logger.Info("Endpoint not found", zap.String("endpoint", path))
+		return nil, fmt.Errorf("%w: %s", errVippsEndpointNotFound, path)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		bodyString := redacthelpers.Redact(string(bodyBytes))
+		logger.Warn("Endpoint returned error",
+			zap.String("endpoint", path),
+			zap.Int("status", resp.StatusCode),
+			zap.String("response_body", bodyString))
+		return nil, fmt.Errorf("endpoint %s returned status %d: %s", path, resp.StatusCode, bodyString)
+	}
+
+	// Success! Parse the response
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Error("Failed to read response body", zap.Error(err))
+		return nil, err
+	}
+
+	logger.Info("Successfully connected to Vipps endpoint",
+		zap.String("endpoint", path),
+		zap.String("response_preview", string(bodyBytes[:minInt(200, len(bodyBytes))])))
+
+	// Try to parse as different response formats
+	transactions, err := v.parseVippsResponse(bodyBytes, path)
+	if err != nil {
+		logger.Warn("Failed to parse response from endpoint",
+			zap.String("endpoint", path),
+			zap.Error(err))
+		return nil, err
+	}
+
+	// Apply limit if we got more transactions than requested
+	if limit > 0 && len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+
+	logger.Info("Successfully fetched Vipps transactions",
+		zap.String("endpoint", path),
+		zap.Int("count", len(transactions)))
+	return transactions, nil
+}
+
+// getResolvedEndpoint returns the name of the endpoint that worked last time, or "" when none has
+func (v *VippsClient) getResolvedEndpoint() string {
+	v.endpointMutex.RLock()
+	defer v.endpointMutex.RUnlock()
+	return v.resolvedEndpoint
+}
+
+// setResolvedEndpoint remembers the endpoint to use for later fetches, "" forgets it
+func (v *VippsClient) setResolvedEndpoint(name string) {
+	v.endpointMutex.Lock()
+	defer v.endpointMutex.Unlock()
+	v.resolvedEndpoint = name
+}
+
 func (v *VippsClient) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
 	logger.Info("Fetching transaction by ID from Vipps", zap.String("id", id))
 
@@ -366,7 +493,7 @@ func (v *VippsClient) GetTransactionByID(ctx context.Context, id string) (entiti
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		return entities.Transaction{}, fmt.Errorf("transaction not found: %s", id)
+		return entities.Transaction{}, fmt.Errorf("%w: %s", interfaces.ErrTransactionNotFound, id)
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -434,6 +561,7 @@ func (v *VippsClient) parseVippsResponse(bodyBytes []byte, endpoint string) ([]e
 					Currency        string    `json:"currency"`
 					TransactionTime time.Time `json:"transactionTime"`
 					Status          string    `json:"status"`
+					Type            string    `json:"type"`
 					Description     string    `json:"description"`
 				} `json:"data"`
 			}
@@ -446,7 +574,7 @@ func (v *VippsClient) parseVippsResponse(bodyBytes []byte, endpoint string) ([]e
 						Source:          consts.PAYMENT_SOURCE_VIPPS,
 						Amount:          float64(tx.Amount) / 100,
 						Currency:        tx.Currency,
-						Status:          statushelpers.NormalizeTransactionStatus(tx.Status, consts.PAYMENT_SOURCE_VIPPS),
+						Status:          reportRowStatus(tx.Status, tx.Type, tx.Amount),
 						CreatedAt:       tx.TransactionTime,
 						TransactionType: "report_transaction",
 						Description:     tx.Description,
@@ -454,6 +582,9 @@ func (v *VippsClient) parseVippsResponse(bodyBytes []byte, endpoint string) ([]e
 						Metadata:        map[string]string{"provider": "vipps", "order_id": tx.OrderID, "source": "reports_api"},
 						CachedAt:        time.Now(),
 					}
+					if tx.Type != "" {
+						transaction.Metadata["report_type"] = tx.Type
+					}
 					transactions = append(transactions, transaction)
 				}
 				if len(transactions) > 0 {
@@ -472,13 +603,14 @@ func (v *VippsClient) parseVippsResponse(bodyBytes []byte, endpoint string) ([]e
 						TransactionID string `json:"transactionId"`
 						Amount        int    `json:"amount"`
 						OrderID       string `json:"orderId"`
+						Type          string `json:"type"`
 					} `json:"transactions"`
 				} `json:"settlements"`
 			}
 
 			if err := json.Unmarshal(bodyBytes, &settlementResp); err == nil && len(settlementResp.Settlements) > 0 {
 				for _, settlement := range settlementResp.Settlements {
-					settlementDate, _ := time.Parse("2006-01-02", settlement.Date)
+					settlementDate, _ := timehelpers.ParseTimestamp(settlement.Date, v.location)
 					for _, tx := range settlement.Transactions {
 						transaction := entities.Transaction{
 							ID:              fmt.Sprintf("vipps_settlement_%s_%s", settlement.SettlementID, tx.TransactionID),
@@ -486,7 +618,7 @@ func (v *VippsClient) parseVippsResponse(bodyBytes []byte, endpoint string) ([]e
 							Source:          consts.PAYMENT_SOURCE_VIPPS,
 							Amount:          float64(tx.Amount) / 100,
 							Currency:        settlement.Currency,
-							Status:          statushelpers.NormalizeTransactionStatus("SETTLED", consts.PAYMENT_SOURCE_VIPPS),
+							Status:          reportRowStatus("SETTLED", tx.Type, tx.Amount),
 							CreatedAt:       settlementDate,
 							TransactionType: "settlement_transaction",
 							Description:     fmt.Sprintf("Settlement %s", settlement.SettlementID),
@@ -494,6 +626,9 @@ func (v *VippsClient) parseVippsResponse(bodyBytes []byte, endpoint string) ([]e
 							Metadata:        map[string]string{"provider": "vipps", "order_id": tx.OrderID, "settlement_id": settlement.SettlementID, "source": "reports_api"},
 							CachedAt:        time.Now(),
 						}
+						if tx.Type != "" {
+							transaction.Metadata["report_type"] = tx.Type
+						}
 						transactions = append(transactions, transaction)
 					}
 				}
@@ -524,7 +659,7 @@ func (v *VippsClient) parseVippsResponse(bodyBytes []byte, endpoint string) ([]e
 			for _, agreement := range recurringResp.Agreements {
 				for _, charge := range agreement.Charges {
 					if charge.Status == "CHARGED" || charge.Status == "COMPLETED" {
-						dueTime, _ := time.Parse(time.RFC3339, charge.Due)
+						dueTime, _ := timehelpers.ParseTimestamp(charge.Due, v.location)
 						transaction := entities.Transaction{
 							ID:              fmt.Sprintf("vipps_recurring_%s_%s", agreement.ID, charge.ID),
 							ExternalID:      charge.ID,
@@ -563,7 +698,7 @@ func (v *VippsClient) parseVippsResponse(bodyBytes []byte, endpoint string) ([]e
 		if err := json.Unmarshal(bodyBytes, &checkoutResp); err == nil {
 			for _, session := range checkoutResp.Sessions {
 				if session.Status == "COMPLETED" || session.Status == "APPROVED" {
-					createdTime, _ := time.Parse(time.RFC3339, session.Created)
+					createdTime, _ := timehelpers.ParseTimestamp(session.Created, v.location)
 					transaction := entities.Transaction{
 						ID:              fmt.Sprintf("vipps_checkout_%s", session.SessionID),
 						ExternalID:      session.SessionID,
@@ -592,6 +727,20 @@ func (v *VippsClient) parseVippsResponse(bodyBytes []byte, endpoint string) ([]e
 		endpoint, string(bodyBytes[:minInt(500, len(bodyBytes))]))
 }
 
+// reportRowStatus returns the unified status of a Reports API row. Rows typed as refunds or cancellations and
+// rows with a negative amount reverse an earlier payment, so they are refunded or cancelled rather than succeeded
+// and never count as revenue. Other rows get the status reported for them.
+func reportRowStatus(status, rowType string, amount int) string {
+	switch typeStatus := statushelpers.NormalizeTransactionStatus(rowType, consts.PAYMENT_SOURCE_VIPPS); {
+	case typeStatus == consts.TRANSACTION_STATUS_REFUNDED || typeStatus == consts.TRANSACTION_STATUS_CANCELLED:
+		return typeStatus
+	case amount < 0:
+		return consts.TRANSACTION_STATUS_REFUNDED
+	default:
+		return statushelpers.NormalizeTransactionStatus(status, consts.PAYMENT_SOURCE_VIPPS)
+	}
+}
+
 // convertVippsTransactions converts VippsTransaction slice to entities.Transaction slice
 func (v *VippsClient) convertVippsTransactions(vippsTransactions []VippsTransaction) []entities.Transaction {
 	var transactions []entities.Transaction
@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
 )
 
 func TestVippsClient_getAccessToken(t *testing.T) {
@@ -69,6 +73,28 @@ func TestVippsClient_getAccessToken(t *testing.T) {
 	}
 }
 
+func TestVippsClient_getAccessToken_RedactsFailureBody(t *testing.T) {
+	// Vipps echoes the rejected credentials back on some token failures
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"invalid_client","client_secret":"` + r.Header.Get("client_secret") + `"}`))
+	}))
+	defer mockServer.Close()
+
+	client := NewVippsClient("test_subscription_key", mockServer.URL, "test_client_id", "very_secret_value", "123456")
+
+	_, err := client.getAccessToken(context.Background())
+	if err == nil {
+		t.Fatal("Expected the token request to fail")
+	}
+	if strings.Contains(err.Error(), "very_secret_value") {
+		t.Errorf("Expected the client secret to be masked, got %q", err.Error())
+	}
+	if !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("Expected the rest of the response body in the error, got %q", err.Error())
+	}
+}
+
 func TestVippsClient_tokenExpiry(t *testing.T) {
 	callCount := 0
 
@@ -120,6 +146,42 @@ func TestVippsClient_tokenExpiry(t *testing.T) {
 	}
 }
 
+func TestVippsClient_CheckHealth(t *testing.T) {
+	callCount := 0
+	status := http.StatusOK
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TokenResponse{ExpiresIn: "3600", AccessToken: "mock_access_token"})
+	}))
+	defer mockServer.Close()
+
+	client := NewVippsClient("test_api_key", mockServer.URL, "test_client_id", "test_secret", "123456")
+	ctx := context.Background()
+
+	if _, err := client.getAccessToken(ctx); err != nil {
+		t.Fatalf("Failed to get access token: %v", err)
+	}
+
+	// A cached token must not hide a provider that has stopped accepting the credentials
+	if err := client.CheckHealth(ctx); err != nil {
+		t.Fatalf("Expected healthy check, got %v", err)
+	}
+	if callCount != 2 {
+		t.Errorf("Expected the check to request a fresh token, got %d token requests", callCount)
+	}
+
+	status = http.StatusUnauthorized
+	if err := client.CheckHealth(ctx); err == nil {
+		t.Error("Expected check to fail when the token request is rejected")
+	}
+}
+
 func TestVippsClient_GetLatestTransactions(t *testing.T) {
 	// Create a mock server for token and transactions endpoints
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -197,3 +259,173 @@ func TestVippsClient_GetLatestTransactions(t *testing.T) {
 		}
 	}
 }
+
+func TestVippsClient_GetLatestTransactions_ResolvesEndpoint(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	workingPath := "/ecomm/v2/payments"
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/accesstoken/get" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(TokenResponse{TokenType: "Bearer", ExpiresIn: "3600", AccessToken: "token"})
+			return
+		}
+
+		mu.Lock()
+		requests[r.URL.Path]++
+		working := r.URL.Path == workingPath
+		mu.Unlock()
+
+		if !working {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(VippsTransactionResponse{Transactions: []VippsTransaction{
+			{TransactionID: "tx_1", Amount: 10000, Currency: "NOK", Status: "completed", TimeStamp: time.Now()},
+		}})
+	}))
+	defer mockServer.Close()
+
+	client := NewVippsClient("key", mockServer.URL, "id", "secret", "123456")
+	ctx := context.Background()
+
+	if _, err := client.GetLatestTransactions(ctx, 10); err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+	if client.getResolvedEndpoint() != "ecomm_payments" {
+		t.Fatalf("Expected ecomm_payments to be resolved, got %q", client.getResolvedEndpoint())
+	}
+
+	mu.Lock()
+	probed := requests["/report/v1/transactions"]
+	mu.Unlock()
+
+	// The second fetch goes straight to the resolved endpoint
+	if _, err := client.GetLatestTransactions(ctx, 10); err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+	mu.Lock()
+	if requests["/report/v1/transactions"] != probed || requests[workingPath] != 2 {
+		t.Errorf("Expected only the resolved endpoint to be requested again, got %v", requests)
+	}
+	// The resolved endpoint disappears, so the next fetch probes all endpoints again
+	workingPath = ""
+	mu.Unlock()
+
+	if _, err := client.GetLatestTransactions(ctx, 10); err == nil {
+		t.Fatal("Expected an error when no endpoint works")
+	}
+	if client.getResolvedEndpoint() != "" {
+		t.Errorf("Expected the resolved endpoint to be reset, got %q", client.getResolvedEndpoint())
+	}
+
+	mu.Lock()
+	workingPath = "/ecomm/v2/payments"
+	mu.Unlock()
+
+	if _, err := client.GetLatestTransactions(ctx, 10); err != nil {
+		t.Fatalf("Failed to get transactions after re-probing: %v", err)
+	}
+	if client.getResolvedEndpoint() != "ecomm_payments" {
+		t.Errorf("Expected ecomm_payments to be resolved again, got %q", client.getResolvedEndpoint())
+	}
+}
+
+func TestVippsClient_parseSettlementDateInLocation(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	client := NewVippsClient("key", "https://api.example.com", "id", "secret", "123456", WithLocation(oslo))
+	body := []byte(`{"settlements":[{"settlementId":"s1","currency":"NOK","date":"2025-06-02","transactions":[{"transactionId":"t1","amount":10000,"orderId":"o1"}]}]}`)
+
+	transactions, err := client.parseVippsResponse(body, "/report/v1/settlements?from=2025-06-01&to=2025-06-02")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(transactions) != 1 {
+		t.Fatalf("Expected 1 transaction, got %d", len(transactions))
+	}
+
+	// Midnight in Oslo is still the previous day in UTC, but the settlement belongs to June 2nd
+	createdAt := transactions[0].CreatedAt
+	if day := createdAt.In(oslo).Format("2006-01-02"); day != "2025-06-02" {
+		t.Errorf("Expected settlement on 2025-06-02 in Oslo, got %s", day)
+	}
+	if !createdAt.Equal(time.Date(2025, 6, 1, 22, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected settlement at Oslo midnight, got %s", createdAt.UTC())
+	}
+}
+
+func TestVippsClient_parseSettlementRefunds(t *testing.T) {
+	client := NewVippsClient("key", "https://api.example.com", "id", "secret", "123456")
+	body := []byte(`{"settlements":[{"settlementId":"s1","currency":"NOK","date":"2025-06-02","transactions":[
+		{"transactionId":"sale","amount":10000,"orderId":"o1","type":"SALE"},
+		{"transactionId":"refund","amount":-10000,"orderId":"o1","type":"REFUND"},
+		{"transactionId":"reversal","amount":-2500,"orderId":"o2"},
+		{"transactionId":"untyped","amount":5000,"orderId":"o3"}
+	]}]}`)
+
+	transactions, err := client.parseVippsResponse(body, "/report/v1/settlements?from=2025-06-01&to=2025-06-02")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(transactions) != 4 {
+		t.Fatalf("Expected 4 transactions, got %d", len(transactions))
+	}
+
+	expected := []struct {
+		status     string
+		reportType string
+	}{
+		{consts.TRANSACTION_STATUS_SUCCEEDED, "SALE"},
+		{consts.TRANSACTION_STATUS_REFUNDED, "REFUND"},
+		{consts.TRANSACTION_STATUS_REFUNDED, ""},
+		{consts.TRANSACTION_STATUS_SUCCEEDED, ""},
+	}
+	for i, want := range expected {
+		if transactions[i].Status != want.status {
+			t.Errorf("Transaction %s: expected status %q, got %q", transactions[i].ExternalID, want.status, transactions[i].Status)
+		}
+		if transactions[i].Metadata["report_type"] != want.reportType {
+			t.Errorf("Transaction %s: expected report type %q, got %q",
+				transactions[i].ExternalID, want.reportType, transactions[i].Metadata["report_type"])
+		}
+	}
+}
+
+func TestVippsClient_parseTransactionReportRefunds(t *testing.T) {
+	client := NewVippsClient("key", "https://api.example.com", "id", "secret", "123456")
+	body := []byte(`{"data":[
+		{"transactionId":"t1","orderId":"o1","amount":10000,"currency":"NOK","transactionTime":"2025-06-02T10:00:00Z","status":"CAPTURED","type":"CAPTURE"},
+		{"transactionId":"t2","orderId":"o1","amount":4000,"currency":"NOK","transactionTime":"2025-06-02T11:00:00Z","status":"CAPTURED","type":"REFUND"},
+		{"transactionId":"t3","orderId":"o2","amount":7500,"currency":"NOK","transactionTime":"2025-06-02T12:00:00Z","status":"CAPTURED","type":"CANCEL"},
+		{"transactionId":"t4","orderId":"o3","amount":-1500,"currency":"NOK","transactionTime":"2025-06-02T13:00:00Z","status":"CAPTURED"}
+	]}`)
+
+	transactions, err := client.parseVippsResponse(body, "/report/v1/transactions?from=2025-06-01&to=2025-06-02")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(transactions) != 4 {
+		t.Fatalf("Expected 4 transactions, got %d", len(transactions))
+	}
+
+	expected := []string{
+		consts.TRANSACTION_STATUS_SUCCEEDED,
+		consts.TRANSACTION_STATUS_REFUNDED,
+		consts.TRANSACTION_STATUS_CANCELLED,
+		consts.TRANSACTION_STATUS_REFUNDED,
+	}
+	for i, status := range expected {
+		if transactions[i].Status != status {
+			t.Errorf("Transaction %s: expected status %q, got %q", transactions[i].ExternalID, status, transactions[i].Status)
+		}
+	}
+	if transactions[1].Metadata["report_type"] != "REFUND" {
+		t.Errorf("Expected the report type in metadata, got %v", transactions[1].Metadata)
+	}
+}
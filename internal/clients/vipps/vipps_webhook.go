@@ -0,0 +1,180 @@
+package vipps
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/statushelpers"
+)
+
+// WebhookEvent is an ePayment webhook callback from Vipps
+type WebhookEvent struct {
+	MSN            string        `json:"msn"`
+	Reference      string        `json:"reference"`
+	PSPReference   string        `json:"pspReference"`
+	Name           string        `json:"name"` // Event name, e.g. AUTHORIZED, CAPTURED, REFUNDED
+	Amount         WebhookAmount `json:"amount"`
+	Timestamp      time.Time     `json:"timestamp"`
+	IdempotencyKey string        `json:"idempotencyKey"`
+	Success        bool          `json:"success"`
+}
+
+// WebhookAmount is the amount of a webhook event in minor units (øre)
+type WebhookAmount struct {
+	Currency string `json:"currency"`
+	Value    int64  `json:"value"`
+}
+
+// VerifyWebhookSignature validates the HMAC-SHA256 signature Vipps adds to webhook requests.
+// See https://developer.vippsmobilepay.com/docs/APIs/webhooks-api/request-authentication/
+func VerifyWebhookSignature(r *http.Request, body []byte, secret string) error {
+	// The content hash must match the body we actually received
+	contentHash := sha256.Sum256(body)
+	expectedContentHash := base64.StdEncoding.EncodeToString(contentHash[:])
+	if r.Header.Get("X-Ms-Content-Sha256") != expectedContentHash {
+		return fmt.Errorf("content hash mismatch")
+	}
+
+	date := r.Header.Get("X-Ms-Date")
+	if date == "" {
+		return fmt.Errorf("missing X-Ms-Date header")
+	}
+
+	authorization := r.Header.Get("Authorization")
+	_, signature, found := strings.Cut(authorization, "Signature=")
+	if !strings.HasPrefix(authorization, "HMAC-SHA256 ") || !found {
+		return fmt.Errorf("invalid Authorization header")
+	}
+
+	stringToSign := fmt.Sprintf("%s\n%s\n%s;%s;%s", r.Method, r.URL.RequestURI(), date, r.Host, expectedContentHash)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	expectedSignature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(signature), []byte(expectedSignature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	return nil
+}
+
+// ParseWebhookEvent parses a webhook payload and checks it names a payment and an event
+func ParseWebhookEvent(body []byte) (WebhookEvent, error) {
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return WebhookEvent{}, fmt.Errorf("failed to parse Vipps webhook: %w", err)
+	}
+
+	if event.Reference == "" || event.Name == "" {
+		return WebhookEvent{}, fmt.Errorf("Vipps webhook is missing reference or event name")
+	}
+
+	return event, nil
+}
+
+// TransactionID returns the ID of the payment the event belongs to. Events for the same payment share the
+// reference, so it is used as the transaction identity.
+func (e WebhookEvent) TransactionID() string {
+	return fmt.Sprintf("vipps_internal_%s", e.Reference)
+}
+
+// Apply returns the payment after the event, given the cached payment if found. An unsuccessful event only records
+// its outcome in metadata, unless it is the first event of a payment, which then gets the failed status. A refund
+// counts against the original amount: a partial one keeps the status and leaves the net amount, with the refunded
+// and original amounts in Metadata["refunded_amount"] and Metadata["original_amount"], and a full one gives the
+// refunded status. Without a cached payment the original amount is unknown, so a refund is recorded as refunded.
+func (e WebhookEvent) Apply(cached entities.Transaction, found bool) entities.Transaction {
+	amount := float64(e.Amount.Value) / 100 // Convert from øre to NOK
+
+	transaction := cached
+	if !found {
+		createdAt := e.Timestamp
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		transaction = entities.Transaction{
+			ID:              e.TransactionID(),
+			ExternalID:      e.Reference,
+			Source:          consts.PAYMENT_SOURCE_VIPPS,
+			Amount:          amount,
+			Currency:        e.Amount.Currency,
+			CreatedAt:       createdAt,
+			TransactionType: "mobile_payment",
+			PaymentMethod:   "vipps",
+		}
+	}
+
+	// Copy the metadata so the cached transaction isn't changed
+	metadata := make(map[string]string, len(transaction.Metadata)+6)
+	for key, value := range transaction.Metadata {
+		metadata[key] = value
+	}
+	metadata["provider"] = "vipps"
+	metadata["order_id"] = e.Reference
+	metadata["psp_reference"] = e.PSPReference
+	metadata["event"] = e.Name
+	metadata["event_success"] = strconv.FormatBool(e.Success)
+	metadata["source"] = "webhook"
+	transaction.Metadata = metadata
+	transaction.CachedAt = time.Now()
+
+	// The event name says which operation was attempted, success whether it went through
+	status := statushelpers.NormalizeTransactionStatus(e.Name, consts.PAYMENT_SOURCE_VIPPS)
+	switch {
+	case !e.Success:
+		// A failed capture, refund or cancel leaves the payment as it was
+		if !found || e.Name == "CREATED" || e.Name == "AUTHORIZED" {
+			transaction.Status = consts.TRANSACTION_STATUS_FAILED
+		}
+	case status == consts.TRANSACTION_STATUS_REFUNDED && found:
+		// Webhooks are delivered at least once, so a refund is only counted once per PSP reference
+		refunds := strings.Split(cached.Metadata["refund_psp_references"], ",")
+		if e.PSPReference == "" || !slices.Contains(refunds, e.PSPReference) {
+			applyRefund(&transaction, amount)
+			metadata["refund_psp_references"] = strings.Trim(cached.Metadata["refund_psp_references"]+","+e.PSPReference, ",")
+		}
+	case found && transaction.Status == consts.TRANSACTION_STATUS_REFUNDED:
+		// A late event must not undo a full refund
+	default:
+		transaction.Status = status
+		if _, refunded := metadata["refunded_amount"]; !refunded && amount > 0 {
+			transaction.Amount = amount
+		}
+	}
+
+	return transaction
+}
+
+// applyRefund counts a refund of amount against the original amount of a payment, adding up partial refunds
+func applyRefund(transaction *entities.Transaction, amount float64) {
+	original := transaction.Amount
+	refunded := amount
+	if value, err := strconv.ParseFloat(transaction.Metadata["original_amount"], 64); err == nil {
+		original = value
+	}
+	if value, err := strconv.ParseFloat(transaction.Metadata["refunded_amount"], 64); err == nil {
+		refunded += value
+	}
+
+	if refunded >= original {
+		transaction.Status = consts.TRANSACTION_STATUS_REFUNDED
+		transaction.Amount = original
+		delete(transaction.Metadata, "refunded_amount")
+		delete(transaction.Metadata, "original_amount")
+		return
+	}
+
+	transaction.Metadata["refunded_amount"] = strconv.FormatFloat(refunded, 'f', 2, 64)
+	transaction.Metadata["original_amount"] = strconv.FormatFloat(original, 'f', 2, 64)
+	transaction.Amount = original - refunded
+}
@@ -0,0 +1,161 @@
+package vipps
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+// newSignedWebhookRequest creates a webhook request signed the way Vipps signs callbacks
+func newSignedWebhookRequest(body, secret string) *http.Request {
+	req := httptest.NewRequest("POST", "https://api.example.com/v1/webhooks/vipps", strings.NewReader(body))
+
+	contentHash := sha256.Sum256([]byte(body))
+	encodedHash := base64.StdEncoding.EncodeToString(contentHash[:])
+	date := "Tue, 01 Jul 2025 12:00:00 GMT"
+
+	stringToSign := fmt.Sprintf("POST\n/v1/webhooks/vipps\n%s;%s;%s", date, req.Host, encodedHash)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req.Header.Set("X-Ms-Date", date)
+	req.Header.Set("X-Ms-Content-Sha256", encodedHash)
+	req.Header.Set("Authorization", "HMAC-SHA256 SignedHeaders=x-ms-date;host;x-ms-content-sha256&Signature="+signature)
+	return req
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := `{"reference":"order-1","name":"CAPTURED"}`
+
+	req := newSignedWebhookRequest(body, "test_secret")
+	if err := VerifyWebhookSignature(req, []byte(body), "test_secret"); err != nil {
+		t.Errorf("Expected valid signature, got error: %v", err)
+	}
+
+	req = newSignedWebhookRequest(body, "other_secret")
+	if err := VerifyWebhookSignature(req, []byte(body), "test_secret"); err == nil {
+		t.Error("Expected signature mismatch for wrong secret")
+	}
+
+	req = newSignedWebhookRequest(body, "test_secret")
+	if err := VerifyWebhookSignature(req, []byte(`{"reference":"order-1","name":"REFUNDED"}`), "test_secret"); err == nil {
+		t.Error("Expected content hash mismatch for tampered body")
+	}
+}
+
+func TestParseWebhookEvent(t *testing.T) {
+	body := `{
+		"msn": "123456",
+		"reference": "order-1",
+		"pspReference": "psp-1",
+		"name": "CAPTURED",
+		"amount": {"currency": "NOK", "value": 39000},
+		"timestamp": "2025-07-01T12:00:00Z",
+		"success": true
+	}`
+
+	event, err := ParseWebhookEvent([]byte(body))
+	if err != nil {
+		t.Fatalf("Failed to parse webhook event: %v", err)
+	}
+
+	transaction := event.Apply(entities.Transaction{}, false)
+	if transaction.ID != "vipps_internal_order-1" || transaction.ExternalID != "order-1" || event.TransactionID() != transaction.ID {
+		t.Errorf("Unexpected transaction identity %s/%s", transaction.ID, transaction.ExternalID)
+	}
+	if transaction.Amount != 390 {
+		t.Errorf("Expected amount 390, got %f", transaction.Amount)
+	}
+	if transaction.Status != consts.TRANSACTION_STATUS_SUCCEEDED {
+		t.Errorf("Expected status %s, got %s", consts.TRANSACTION_STATUS_SUCCEEDED, transaction.Status)
+	}
+
+	if _, err := ParseWebhookEvent([]byte(`{"name":"CAPTURED"}`)); err == nil {
+		t.Error("Expected error for webhook without reference")
+	}
+}
+
+func TestWebhookEvent_Apply(t *testing.T) {
+	captured := WebhookEvent{Reference: "order-1", PSPReference: "psp-1", Name: "CAPTURED", Amount: WebhookAmount{Currency: "NOK", Value: 40000}, Success: true}
+	payment := captured.Apply(entities.Transaction{}, false)
+
+	tests := []struct {
+		name             string
+		events           []WebhookEvent
+		expectedStatus   string
+		expectedAmount   float64
+		expectedRefunded string
+	}{
+		{
+			name:           "unsuccessful first event fails the payment",
+			expectedStatus: consts.TRANSACTION_STATUS_FAILED,
+			expectedAmount: 400,
+		},
+		{
+			name:           "unsuccessful refund leaves the payment",
+			events:         []WebhookEvent{{Reference: "order-1", PSPReference: "psp-2", Name: "REFUNDED", Amount: WebhookAmount{Value: 40000}}},
+			expectedStatus: consts.TRANSACTION_STATUS_SUCCEEDED,
+			expectedAmount: 400,
+		},
+		{
+			name:             "partial refund keeps the status with the net amount",
+			events:           []WebhookEvent{{Reference: "order-1", PSPReference: "psp-2", Name: "REFUNDED", Amount: WebhookAmount{Value: 15000}, Success: true}},
+			expectedStatus:   consts.TRANSACTION_STATUS_SUCCEEDED,
+			expectedAmount:   250,
+			expectedRefunded: "150.00",
+		},
+		{
+			name: "redelivered partial refund is counted once",
+			events: []WebhookEvent{
+				{Reference: "order-1", PSPReference: "psp-2", Name: "REFUNDED", Amount: WebhookAmount{Value: 15000}, Success: true},
+				{Reference: "order-1", PSPReference: "psp-2", Name: "REFUNDED", Amount: WebhookAmount{Value: 15000}, Success: true},
+			},
+			expectedStatus:   consts.TRANSACTION_STATUS_SUCCEEDED,
+			expectedAmount:   250,
+			expectedRefunded: "150.00",
+		},
+		{
+			name: "partial refunds adding up to the amount refund the payment",
+			events: []WebhookEvent{
+				{Reference: "order-1", PSPReference: "psp-2", Name: "REFUNDED", Amount: WebhookAmount{Value: 15000}, Success: true},
+				{Reference: "order-1", PSPReference: "psp-3", Name: "REFUNDED", Amount: WebhookAmount{Value: 25000}, Success: true},
+			},
+			expectedStatus: consts.TRANSACTION_STATUS_REFUNDED,
+			expectedAmount: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction := payment
+			if tt.events == nil {
+				failed := captured
+				failed.Success = false
+				transaction = failed.Apply(entities.Transaction{}, false)
+			}
+			for _, event := range tt.events {
+				transaction = event.Apply(transaction, true)
+			}
+
+			if transaction.Status != tt.expectedStatus || transaction.Amount != tt.expectedAmount {
+				t.Errorf("Expected %s with amount %.2f, got %s with %.2f", tt.expectedStatus, tt.expectedAmount, transaction.Status, transaction.Amount)
+			}
+			if got := transaction.Metadata["refunded_amount"]; got != tt.expectedRefunded {
+				t.Errorf("Expected refunded amount %q, got %q", tt.expectedRefunded, got)
+			}
+		})
+	}
+
+	if payment.Metadata["refunded_amount"] != "" {
+		t.Error("Expected applying events not to change the cached payment")
+	}
+}
@@ -7,11 +7,18 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httpclienthelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/redacthelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/statushelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/timehelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
 	"go.uber.org/zap"
@@ -24,46 +31,226 @@ type ZettleClient struct {
 	ClientID     string
 	ClientSecret string
 	httpClient   *http.Client
+	lookbackDays int            // Days back transactions are fetched
+	location     *time.Location // Time zone the fetch date range is expressed in
 
 	// Token management
 	accessToken string
 	tokenExpiry time.Time
+	tokenMutex  sync.RWMutex
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
 }
 
 type ZettlePayment struct {
-	UUID      string    `json:"uuid"`
-	Amount    int64     `json:"amount"` // Amount in øre
-	Currency  string    `json:"currency"`
-	Timestamp time.Time `json:"timestamp"`
-	Reference string    `json:"reference"`
-	CardType  string    `json:"cardType"`
+	UUID          string    `json:"uuid"`
+	PurchaseUUID1 string    `json:"purchaseUUID1"` // Time-based UUID that refunds and refunded purchases are linked by
+	Amount        int64     `json:"amount"`        // Amount in øre
+	Currency      string    `json:"currency"`
+	Timestamp     time.Time `json:"timestamp"`
+	Reference     string    `json:"reference"`
+	CardType      string    `json:"cardType"`
+
+	// Refunds are purchases of their own with a negative amount, linked to the purchase they refund
+	Refund                  bool     `json:"refund"`                   // This purchase refunds another one
+	Refunded                bool     `json:"refunded"`                 // This purchase has been (partially) refunded
+	RefundsPurchaseUUID     string   `json:"refundsPurchaseUUID1"`     // Purchase refunded by this refund
+	RefundedByPurchaseUUIDs []string `json:"refundedByPurchaseUUIDs1"` // Refunds of this purchase
 }
 
 type ZettlePaymentsResponse struct {
-	Purchases []ZettlePayment `json:"purchases"`
+	Purchases        []ZettlePayment `json:"purchases"`
+	LastPurchaseHash string          `json:"lastPurchaseHash"` // Pagination cursor for the next page
 }
 
+// zettleMaxPageSize is the maximum number of purchases Zettle returns per request
+const zettleMaxPageSize = 1000
+
 // Compile-time check to ensure ZettleClient implements Transactions interface
 var _ interfaces.Transactions = (*ZettleClient)(nil)
 
-func NewZettleClient(apiKey, apiURL, clientID, secret string) *ZettleClient {
+// Compile-time check to ensure ZettleClient implements HealthChecker interface
+var _ interfaces.HealthChecker = (*ZettleClient)(nil)
+
+// Option configures optional settings on a ZettleClient
+type Option func(*ZettleClient)
+
+// WithHTTPClient sets the HTTP client used for all Zettle requests. A nil client keeps the shared default.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(z *ZettleClient) {
+		if httpClient != nil {
+			z.httpClient = httpClient
+		}
+	}
+}
+
+// WithLookbackDays sets how many days back transactions are fetched. Non-positive values keep the default.
+func WithLookbackDays(days int) Option {
+	return func(z *ZettleClient) {
+		if days > 0 {
+			z.lookbackDays = days
+		}
+	}
+}
+
+// WithLocation sets the time zone the fetch date range is expressed in. A nil location keeps UTC.
+func WithLocation(loc *time.Location) Option {
+	return func(z *ZettleClient) {
+		if loc != nil {
+			z.location = loc
+		}
+	}
+}
+
+func NewZettleClient(apiKey, apiURL, clientID, secret string, opts ...Option) *ZettleClient {
 	logger.Info("Initializing Zettle client",
 		zap.String("api_url", apiURL),
 		zap.String("client_id", clientID),
 		zap.Bool("has_api_key", apiKey != ""),
 		zap.Bool("has_secret", secret != ""))
 
-	return &ZettleClient{
+	client := &ZettleClient{
 		APIKey:       apiKey,
 		APIURL:       apiURL,
 		OAuthURL:     "https://oauth.izettle.com", // Fixed OAuth URL
 		ClientID:     clientID,
 		ClientSecret: secret,
-		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		httpClient:   httpclienthelpers.DefaultClient(),
+		lookbackDays: consts.FETCH_LOOKBACK_DAYS_DEFAULT,
+		location:     time.UTC,
+	}
+
+	for _, opt := range opts {
+		opt(client)
 	}
+
+	return client
+}
+
+// getAccessToken exchanges the API key for an OAuth access token, reusing a cached token until shortly before it expires.
+// Documentation: https://developer.zettle.com/docs/get-started/user-guides/authorization/authorize-with-api-key
+func (z *ZettleClient) getAccessToken(ctx context.Context) (string, error) {
+	z.tokenMutex.RLock()
+	// Check if we have a valid token that doesn't expire in the next 5 minutes
+	if z.accessToken != "" && time.Now().Add(5*time.Minute).Before(z.tokenExpiry) {
+		token := z.accessToken
+		z.tokenMutex.RUnlock()
+		return token, nil
+	}
+	z.tokenMutex.RUnlock()
+
+	z.tokenMutex.Lock()
+	defer z.tokenMutex.Unlock()
+
+	// Double-check after acquiring write lock
+	if z.accessToken != "" && time.Now().Add(5*time.Minute).Before(z.tokenExpiry) {
+		return z.accessToken, nil
+	}
+
+	return z.fetchAccessToken(ctx)
+}
+
+// fetchAccessToken requests a new access token and stores it. The caller must hold tokenMutex for writing.
+func (z *ZettleClient) fetchAccessToken(ctx context.Context) (string, error) {
+	logger.Info("Fetching new Zettle access token")
+
+	// The API key is used as the assertion in the JWT bearer grant
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("client_id", z.ClientID)
+	form.Set("assertion", z.APIKey)
+
+	tokenURL := fmt.Sprintf("%s/token", z.OAuthURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := z.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to make token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		logger.Error("Zettle token request failed",
+			zap.Int("status", resp.StatusCode),
+			zap.String("response_body", redacthelpers.Redact(string(bodyBytes))),
+			zap.String("token_url", tokenURL))
+		return "", fmt.Errorf("token request failed with status %d", resp.StatusCode)
+	}
+
+	var tokenResp TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	if tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("token response did not contain an access token")
+	}
+
+	expiresIn := tokenResp.ExpiresIn
+	if expiresIn <= 0 {
+		logger.Warn("Missing expires_in in Zettle token response, using default 2 hours")
+		expiresIn = 7200 // Zettle tokens are valid for 2 hours
+	}
+
+	// Store the token and expiry
+	z.accessToken = tokenResp.AccessToken
+	z.tokenExpiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+
+	logger.Info("Successfully obtained Zettle access token",
+		zap.Time("expires_at", z.tokenExpiry),
+		zap.Int("expires_in_seconds", expiresIn))
+
+	return z.accessToken, nil
+}
+
+// CheckHealth verifies Zettle is reachable and accepts the configured credentials by requesting a fresh access token
+func (z *ZettleClient) CheckHealth(ctx context.Context) error {
+	z.tokenMutex.Lock()
+	defer z.tokenMutex.Unlock()
+
+	_, err := z.fetchAccessToken(ctx)
+	return err
 }
 
 func (z *ZettleClient) makeAuthenticatedRequest(ctx context.Context, method, requestURL string, body []byte) (*http.Response, error) {
+	resp, err := z.doAuthenticatedRequest(ctx, method, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// If we get 401, the token might have expired, try to refresh once
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+
+		logger.Info("Received 401, refreshing Zettle token and retrying")
+
+		// Clear the current token to force refresh
+		z.tokenMutex.Lock()
+		z.accessToken = ""
+		z.tokenExpiry = time.Time{}
+		z.tokenMutex.Unlock()
+
+		return z.doAuthenticatedRequest(ctx, method, requestURL, body)
+	}
+
+	return resp, nil
+}
+
+// doAuthenticatedRequest performs a single request with the current access token
+func (z *ZettleClient) doAuthenticatedRequest(ctx context.Context, method, requestURL string, body []byte) (*http.Response, error) {
+	token, err := z.getAccessToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+
 	var reqBody io.Reader
 	if body != nil {
 		reqBody = bytes.NewReader(body)
@@ -74,8 +261,7 @@ func (z *ZettleClient) makeAuthenticatedRequest(ctx context.Context, method, req
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	// Use API key authentication - most Zettle APIs use Bearer token with API key
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", z.APIKey))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := z.httpClient.Do(req)
@@ -89,43 +275,141 @@ func (z *ZettleClient) makeAuthenticatedRequest(ctx context.Context, method, req
 func (z *ZettleClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
 	logger.Info("Fetching transactions from Zettle", zap.Int("limit", limit))
 
-	// Calculate date range for the last 30 days
-	endDate := time.Now()
-	startDate := endDate.AddDate(0, 0, -30)
+	if limit <= 0 {
+		limit = zettleMaxPageSize
+	}
+
+	// Calculate date range for the lookback window, in local dates so today isn't cut off before midnight UTC
+	endDate := time.Now().In(z.location)
+	startDate := endDate.AddDate(0, 0, -z.lookbackDays)
+
+	var purchases []ZettlePayment
+	lastPurchaseHash := ""
+	seenHashes := make(map[string]bool)
+	pages := 0
+
+	// Follow the pagination hash until we have enough purchases or the results are exhausted
+	for len(purchases) < limit {
+		pageSize := min(limit-len(purchases), zettleMaxPageSize)
+
+		page, err := z.fetchPurchasesPage(ctx, startDate, endDate, pageSize, lastPurchaseHash)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, zp := range page.Purchases {
+			if len(purchases) >= limit {
+				break
+			}
+			purchases = append(purchases, zp)
+		}
+
+		pages++
+
+		if len(page.Purchases) == 0 || page.LastPurchaseHash == "" {
+			break
+		}
+
+		// Guard against the API returning the same cursor repeatedly
+		if seenHashes[page.LastPurchaseHash] {
+			logger.Warn("Zettle returned a repeated pagination hash, stopping",
+				zap.String("last_purchase_hash", page.LastPurchaseHash))
+			break
+		}
+		seenHashes[page.LastPurchaseHash] = true
+		lastPurchaseHash = page.LastPurchaseHash
+	}
+
+	refunded := z.refundedAmounts(ctx, purchases)
+	transactions := make([]entities.Transaction, 0, len(purchases))
+	for _, zp := range purchases {
+		transactions = append(transactions, purchaseToTransaction(zp, refunded[zp.UUID]))
+	}
+
+	logger.Info("Successfully fetched Zettle transactions",
+		zap.Int("count", len(transactions)),
+		zap.Int("pages", pages))
+	return transactions, nil
+}
+
+// refundedAmounts returns the refunded amount in øre of each refunded purchase, keyed by purchase UUID. Refunds
+// missing from purchases are looked up, and one that can't be is counted as a full refund so revenue isn't overstated.
+func (z *ZettleClient) refundedAmounts(ctx context.Context, purchases []ZettlePayment) map[string]int64 {
+	refunds := make(map[string]ZettlePayment)
+	for _, zp := range purchases {
+		if zp.Refund && zp.PurchaseUUID1 != "" {
+			refunds[zp.PurchaseUUID1] = zp
+		}
+	}
+
+	amounts := make(map[string]int64)
+	for _, zp := range purchases {
+		if zp.Refund || !zp.Refunded {
+			continue
+		}
 
+		if len(zp.RefundedByPurchaseUUIDs) == 0 {
+			logger.Warn("Zettle purchase is refunded without linked refunds, treating it as fully refunded",
+				zap.String("uuid", zp.UUID))
+			amounts[zp.UUID] = zp.Amount
+			continue
+		}
+
+		var total int64
+		for _, refundUUID := range zp.RefundedByPurchaseUUIDs {
+			refund, found := refunds[refundUUID]
+			if !found {
+				var err error
+				refund, err = z.fetchPurchase(ctx, refundUUID)
+				if err != nil {
+					logger.Warn("Failed to look up Zettle refund, treating the purchase as fully refunded",
+						zap.String("uuid", zp.UUID), zap.String("refund_uuid", refundUUID), zap.Error(err))
+					total = zp.Amount
+					break
+				}
+			}
+			// Refund purchases carry negative amounts
+			total += max(refund.Amount, -refund.Amount)
+		}
+		amounts[zp.UUID] = total
+	}
+
+	return amounts
+}
+
+// fetchPurchasesPage fetches a single page of purchases, continuing after lastPurchaseHash when set
+func (z *ZettleClient) fetchPurchasesPage(ctx context.Context, startDate, endDate time.Time, pageSize int, lastPurchaseHash string) (ZettlePaymentsResponse, error) {
 	// Format dates as required by Zettle API (YYYY-MM-DD)
-	startDateStr := startDate.Format("2006-01-02")
-	endDateStr := endDate.Format("2006-01-02")
+	startDateStr := startDate.Format(timehelpers.DateLayout)
+	endDateStr := endDate.Format(timehelpers.DateLayout)
 
 	// Use correct Zettle Purchase API endpoint with required parameters
 	// Documentation: https://developer.zettle.com/docs/api/purchase-retrieval
-	endpoint := fmt.Sprintf("/purchases/v2?startDate=%s&endDate=%s", startDateStr, endDateStr)
-
-	// Add limit parameter (Zettle typically supports up to 1000)
-	if limit > 0 {
-		if limit > 1000 {
-			limit = 1000 // Zettle API limit
-		}
-		endpoint += fmt.Sprintf("&limit=%d", limit)
+	query := url.Values{}
+	query.Set("startDate", startDateStr)
+	query.Set("endDate", endDateStr)
+	query.Set("limit", strconv.Itoa(pageSize))
+	query.Set("descending", "true")
+	if lastPurchaseHash != "" {
+		query.Set("lastPurchaseHash", lastPurchaseHash)
 	}
 
-	requestURL := fmt.Sprintf("%s%s", z.APIURL, endpoint)
+	requestURL := fmt.Sprintf("%s/purchases/v2?%s", z.APIURL, query.Encode())
 	logger.Info("Making Zettle API request",
 		zap.String("url", requestURL),
 		zap.String("base_url", z.APIURL),
-		zap.String("endpoint", endpoint),
 		zap.String("date_range", fmt.Sprintf("%s to %s", startDateStr, endDateStr)))
 
 	resp, err := z.makeAuthenticatedRequest(ctx, "GET", requestURL, nil)
 	if err != nil {
 		logger.Error("Failed to make Zettle API request", zap.Error(err))
-		return nil, fmt.Errorf("failed to fetch transactions from Zettle: %w", err)
+		return ZettlePaymentsResponse{}, fmt.Errorf("failed to fetch transactions from Zettle: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		bodyString := string(bodyBytes)
+		bodyString := redacthelpers.Redact(string(bodyBytes))
 		logger.Error("Zettle API returned error status",
 			zap.Int("status", resp.StatusCode),
 			zap.String("response_body", bodyString),
@@ -133,93 +417,105 @@ func (z *ZettleClient) GetLatestTransactions(ctx context.Context, limit int) ([]
 
 		// Handle specific Zettle error cases
 		if resp.StatusCode == 401 {
-			return nil, fmt.Errorf("Zettle authentication failed - check client credentials and access token")
+			return ZettlePaymentsResponse{}, fmt.Errorf("Zettle authentication failed - check client credentials and access token")
 		}
 		if resp.StatusCode == 404 {
-			return nil, fmt.Errorf("Zettle endpoint not found - check API URL: %s", z.APIURL)
+			return ZettlePaymentsResponse{}, fmt.Errorf("Zettle endpoint not found - check API URL: %s", z.APIURL)
 		}
 
-		return nil, fmt.Errorf("Zettle API returned status %d: %s", resp.StatusCode, bodyString)
+		return ZettlePaymentsResponse{}, fmt.Errorf("Zettle API returned status %d: %s", resp.StatusCode, bodyString)
 	}
 
 	var zettleResp ZettlePaymentsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&zettleResp); err != nil {
 		logger.Error("Failed to decode Zettle response", zap.Error(err))
-		return nil, fmt.Errorf("failed to decode Zettle response: %w", err)
+		return ZettlePaymentsResponse{}, fmt.Errorf("failed to decode Zettle response: %w", err)
 	}
 
-	var transactions []entities.Transaction
-	count := 0
+	return zettleResp, nil
+}
 
-	for _, zp := range zettleResp.Purchases {
-		if count >= limit {
-			break
-		}
+func (z *ZettleClient) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
+	logger.Info("Fetching transaction by ID from Zettle", zap.String("id", id))
 
-		transaction := entities.Transaction{
-			ID:              fmt.Sprintf("zettle_internal_%s", zp.UUID),
-			ExternalID:      zp.UUID,
-			Source:          consts.PAYMENT_SOURCE_ZETTLE,
-			Amount:          float64(zp.Amount) / 100, // Convert from øre to NOK
-			Currency:        zp.Currency,
-			Status:          statushelpers.NormalizeTransactionStatus("COMPLETED", consts.PAYMENT_SOURCE_ZETTLE),
-			CreatedAt:       zp.Timestamp,
-			TransactionType: "card_payment",
-			Description:     fmt.Sprintf("Zettle %s payment", zp.CardType),
-			PaymentMethod:   "card",
-			Metadata:        map[string]string{"provider": "zettle", "card_type": zp.CardType, "reference": zp.Reference},
-			CachedAt:        time.Now(),
-		}
-		transactions = append(transactions, transaction)
-		count++
+	zp, err := z.fetchPurchase(ctx, id)
+	if err != nil {
+		return entities.Transaction{}, err
 	}
 
-	logger.Info("Successfully fetched Zettle transactions", zap.Int("count", len(transactions)))
-	return transactions, nil
+	refunded := z.refundedAmounts(ctx, []ZettlePayment{zp})
+	return purchaseToTransaction(zp, refunded[zp.UUID]), nil
 }
 
-func (z *ZettleClient) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
-	logger.Info("Fetching transaction by ID from Zettle", zap.String("id", id))
-
+// fetchPurchase fetches a single purchase, returning ErrTransactionNotFound if Zettle doesn't know it
+func (z *ZettleClient) fetchPurchase(ctx context.Context, id string) (ZettlePayment, error) {
 	// Use Zettle Payments API to get specific purchase details
 	requestURL := fmt.Sprintf("%s/purchase/%s", z.APIURL, id)
 
 	resp, err := z.makeAuthenticatedRequest(ctx, "GET", requestURL, nil)
 	if err != nil {
 		logger.Error("Failed to make Zettle API request", zap.Error(err), zap.String("id", id))
-		return entities.Transaction{}, fmt.Errorf("failed to fetch transaction from Zettle: %w", err)
+		return ZettlePayment{}, fmt.Errorf("failed to fetch transaction from Zettle: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		return entities.Transaction{}, fmt.Errorf("transaction not found: %s", id)
+		return ZettlePayment{}, fmt.Errorf("%w: %s", interfaces.ErrTransactionNotFound, id)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		logger.Error("Zettle API returned error status", zap.Int("status", resp.StatusCode), zap.String("id", id))
-		return entities.Transaction{}, fmt.Errorf("Zettle API returned status %d", resp.StatusCode)
+		return ZettlePayment{}, fmt.Errorf("Zettle API returned status %d", resp.StatusCode)
 	}
 
 	var zp ZettlePayment
 	if err := json.NewDecoder(resp.Body).Decode(&zp); err != nil {
 		logger.Error("Failed to decode Zettle response", zap.Error(err), zap.String("id", id))
-		return entities.Transaction{}, fmt.Errorf("failed to decode Zettle response: %w", err)
+		return ZettlePayment{}, fmt.Errorf("failed to decode Zettle response: %w", err)
 	}
 
-	transaction := entities.Transaction{
+	return zp, nil
+}
+
+// purchaseToTransaction converts a Zettle purchase to a transaction, given the amount in øre refunded of it.
+// Fully refunded purchases and the refunds themselves get the refunded status, so neither counts as revenue.
+// Partially refunded purchases stay completed with only the net amount, so revenue leaves out the refunded part.
+// Their refunded and original amounts are kept in Metadata["refunded_amount"] and Metadata["original_amount"].
+func purchaseToTransaction(zp ZettlePayment, refundedAmount int64) entities.Transaction {
+	status := "COMPLETED"
+	transactionType := "card_payment"
+	description := fmt.Sprintf("Zettle %s payment", zp.CardType)
+	metadata := map[string]string{"provider": "zettle", "card_type": zp.CardType, "reference": zp.Reference}
+	amount := zp.Amount
+
+	switch {
+	case zp.Refund:
+		status = "REFUNDED"
+		transactionType = "card_refund"
+		description = fmt.Sprintf("Zettle %s refund", zp.CardType)
+		metadata["refunds_purchase"] = zp.RefundsPurchaseUUID
+	case refundedAmount > 0:
+		metadata["refunded_amount"] = strconv.FormatFloat(float64(refundedAmount)/100, 'f', 2, 64)
+		if refundedAmount >= zp.Amount {
+			status = "REFUNDED"
+		} else {
+			metadata["original_amount"] = strconv.FormatFloat(float64(zp.Amount)/100, 'f', 2, 64)
+			amount = zp.Amount - refundedAmount
+		}
+	}
+
+	return entities.Transaction{
 		ID:              fmt.Sprintf("zettle_internal_%s", zp.UUID),
 		ExternalID:      zp.UUID,
 		Source:          consts.PAYMENT_SOURCE_ZETTLE,
-		Amount:          float64(zp.Amount) / 100, // Convert from øre to NOK
+		Amount:          float64(amount) / 100, // Convert from øre to NOK
 		Currency:        zp.Currency,
-		Status:          statushelpers.NormalizeTransactionStatus("COMPLETED", consts.PAYMENT_SOURCE_ZETTLE),
+		Status:          statushelpers.NormalizeTransactionStatus(status, consts.PAYMENT_SOURCE_ZETTLE),
 		CreatedAt:       zp.Timestamp,
-		TransactionType: "card_payment",
-		Description:     fmt.Sprintf("Zettle %s payment", zp.CardType),
+		TransactionType: transactionType,
+		Description:     description,
 		PaymentMethod:   "card",
-		Metadata:        map[string]string{"provider": "zettle", "card_type": zp.CardType, "reference": zp.Reference},
+		Metadata:        metadata,
 		CachedAt:        time.Now(),
 	}
-
-	return transaction, nil
 }
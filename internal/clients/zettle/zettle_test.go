@@ -0,0 +1,343 @@
+package zettle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+)
+
+func TestZettleClient_getAccessToken(t *testing.T) {
+	var tokenCalls atomic.Int32
+
+	// Create a mock server to simulate the Zettle OAuth token endpoint
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/token" {
+			t.Errorf("Expected path /token, got %s", r.URL.Path)
+		}
+
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("Failed to parse token request form: %v", err)
+		}
+		if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("Unexpected grant_type %q", r.Form.Get("grant_type"))
+		}
+		if r.Form.Get("assertion") != "test_api_key" {
+			t.Errorf("Expected API key as assertion, got %q", r.Form.Get("assertion"))
+		}
+		if r.Form.Get("client_id") != "test_client_id" {
+			t.Errorf("Expected client_id test_client_id, got %q", r.Form.Get("client_id"))
+		}
+
+		tokenCalls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TokenResponse{AccessToken: "mock_zettle_token", ExpiresIn: 7200})
+	}))
+	defer mockServer.Close()
+
+	client := NewZettleClient("test_api_key", mockServer.URL, "test_client_id", "test_secret")
+	client.OAuthURL = mockServer.URL
+
+	ctx := context.Background()
+
+	token, err := client.getAccessToken(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get access token: %v", err)
+	}
+	if token != "mock_zettle_token" {
+		t.Errorf("Expected token 'mock_zettle_token', got '%s'", token)
+	}
+
+	// Second call should use the cached token
+	if _, err := client.getAccessToken(ctx); err != nil {
+		t.Fatalf("Failed to get cached access token: %v", err)
+	}
+	if tokenCalls.Load() != 1 {
+		t.Errorf("Expected 1 token request, got %d", tokenCalls.Load())
+	}
+}
+
+func TestZettleClient_RetriesOnUnauthorized(t *testing.T) {
+	var tokenCalls, apiCalls atomic.Int32
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			n := tokenCalls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "token_" + string(rune('0'+n)), ExpiresIn: 7200})
+			return
+		}
+
+		apiCalls.Add(1)
+		// Reject the first token to simulate a revoked token
+		if r.Header.Get("Authorization") != "Bearer token_2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ZettlePaymentsResponse{})
+	}))
+	defer mockServer.Close()
+
+	client := NewZettleClient("test_api_key", mockServer.URL, "test_client_id", "test_secret")
+	client.OAuthURL = mockServer.URL
+
+	if _, err := client.GetLatestTransactions(context.Background(), 10); err != nil {
+		t.Fatalf("Expected request to succeed after token refresh: %v", err)
+	}
+
+	if tokenCalls.Load() != 2 {
+		t.Errorf("Expected 2 token requests, got %d", tokenCalls.Load())
+	}
+	if apiCalls.Load() != 2 {
+		t.Errorf("Expected 2 API requests, got %d", apiCalls.Load())
+	}
+}
+
+func TestZettleClient_GetLatestTransactionsFollowsPagination(t *testing.T) {
+	var apiCalls atomic.Int32
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "mock_zettle_token", ExpiresIn: 7200})
+			return
+		}
+
+		apiCalls.Add(1)
+		var resp ZettlePaymentsResponse
+		switch r.URL.Query().Get("lastPurchaseHash") {
+		case "":
+			resp = ZettlePaymentsResponse{
+				Purchases:        []ZettlePayment{{UUID: "p1", Amount: 10000}, {UUID: "p2", Amount: 25050}},
+				LastPurchaseHash: "hash_1",
+			}
+		case "hash_1":
+			resp = ZettlePaymentsResponse{
+				Purchases: []ZettlePayment{{UUID: "p3", Amount: 500}},
+			}
+		default:
+			t.Errorf("Unexpected pagination hash %q", r.URL.Query().Get("lastPurchaseHash"))
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer mockServer.Close()
+
+	client := NewZettleClient("test_api_key", mockServer.URL, "test_client_id", "test_secret")
+	client.OAuthURL = mockServer.URL
+
+	transactions, err := client.GetLatestTransactions(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+
+	if len(transactions) != 3 {
+		t.Fatalf("Expected 3 transactions across pages, got %d", len(transactions))
+	}
+	if transactions[1].Amount != 250.50 || transactions[2].ID != "zettle_internal_p3" {
+		t.Errorf("Unexpected transactions %v", transactions)
+	}
+	if apiCalls.Load() != 2 {
+		t.Errorf("Expected 2 API requests, got %d", apiCalls.Load())
+	}
+}
+
+func TestZettleClient_GetLatestTransactionsStopsOnRepeatedHash(t *testing.T) {
+	var apiCalls atomic.Int32
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "mock_zettle_token", ExpiresIn: 7200})
+			return
+		}
+
+		// Always return the same cursor
+		n := apiCalls.Add(1)
+		json.NewEncoder(w).Encode(ZettlePaymentsResponse{
+			Purchases:        []ZettlePayment{{UUID: "p" + string(rune('0'+n))}},
+			LastPurchaseHash: "same_hash",
+		})
+	}))
+	defer mockServer.Close()
+
+	client := NewZettleClient("test_api_key", mockServer.URL, "test_client_id", "test_secret")
+	client.OAuthURL = mockServer.URL
+
+	transactions, err := client.GetLatestTransactions(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+	if len(transactions) != 2 {
+		t.Errorf("Expected 2 transactions, got %d", len(transactions))
+	}
+	if apiCalls.Load() != 2 {
+		t.Errorf("Expected 2 API requests, got %d", apiCalls.Load())
+	}
+}
+
+func TestZettleClient_GetLatestTransactionsUsesLookbackDays(t *testing.T) {
+	var startDate atomic.Value
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "mock_zettle_token", ExpiresIn: 7200})
+			return
+		}
+
+		startDate.Store(r.URL.Query().Get("startDate"))
+		json.NewEncoder(w).Encode(ZettlePaymentsResponse{})
+	}))
+	defer mockServer.Close()
+
+	client := NewZettleClient("test_api_key", mockServer.URL, "test_client_id", "test_secret", WithLookbackDays(90))
+	client.OAuthURL = mockServer.URL
+
+	if _, err := client.GetLatestTransactions(context.Background(), 10); err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+
+	expected := time.Now().AddDate(0, 0, -90).Format("2006-01-02")
+	if got, _ := startDate.Load().(string); got != expected {
+		t.Errorf("Expected start date %s, got %q", expected, got)
+	}
+}
+
+func TestWithLookbackDays_IgnoresNonPositive(t *testing.T) {
+	client := NewZettleClient("test_api_key", "http://localhost", "test_client_id", "test_secret", WithLookbackDays(0))
+	if client.lookbackDays != consts.FETCH_LOOKBACK_DAYS_DEFAULT {
+		t.Errorf("Expected default lookback %d, got %d", consts.FETCH_LOOKBACK_DAYS_DEFAULT, client.lookbackDays)
+	}
+}
+
+func TestZettleClient_GetLatestTransactionsDetectsRefunds(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/token":
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "mock_zettle_token", ExpiresIn: 7200})
+		case "/purchases/v2":
+			json.NewEncoder(w).Encode(ZettlePaymentsResponse{
+				Purchases: []ZettlePayment{
+					{UUID: "full", Amount: 10000, Refunded: true, RefundedByPurchaseUUIDs: []string{"r1-uuid1"}},
+					{UUID: "r1", PurchaseUUID1: "r1-uuid1", Amount: -10000, Refund: true, RefundsPurchaseUUID: "full"},
+					{UUID: "partial", Amount: 20000, Refunded: true, RefundedByPurchaseUUIDs: []string{"r2"}},
+					{UUID: "unknown", Amount: 5000, Refunded: true, RefundedByPurchaseUUIDs: []string{"missing"}},
+					{UUID: "paid", Amount: 3000},
+				},
+			})
+		case "/purchase/r2":
+			// Refund made outside the fetched window
+			json.NewEncoder(w).Encode(ZettlePayment{UUID: "r2", Amount: -7550, Refund: true, RefundsPurchaseUUID: "partial"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockServer.Close()
+
+	client := NewZettleClient("test_api_key", mockServer.URL, "test_client_id", "test_secret")
+	client.OAuthURL = mockServer.URL
+
+	transactions, err := client.GetLatestTransactions(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+	if len(transactions) != 5 {
+		t.Fatalf("Expected 5 transactions, got %d", len(transactions))
+	}
+
+	full, refund, partial, unknown, paid := transactions[0], transactions[1], transactions[2], transactions[3], transactions[4]
+
+	if full.Status != consts.TRANSACTION_STATUS_REFUNDED || full.Metadata["refunded_amount"] != "100.00" {
+		t.Errorf("Expected fully refunded purchase, got status %q and metadata %v", full.Status, full.Metadata)
+	}
+	if refund.Status != consts.TRANSACTION_STATUS_REFUNDED || refund.Amount != -100 || refund.Metadata["refunds_purchase"] != "full" {
+		t.Errorf("Expected negative refund linked to its purchase, got %+v", refund)
+	}
+	if partial.Status != consts.TRANSACTION_STATUS_SUCCEEDED || partial.Metadata["refunded_amount"] != "75.50" {
+		t.Errorf("Expected partially refunded purchase to stay succeeded with refunded amount, got status %q and metadata %v",
+			partial.Status, partial.Metadata)
+	}
+	if partial.Amount != 124.50 || partial.Metadata["original_amount"] != "200.00" {
+		t.Errorf("Expected partially refunded purchase to count its net amount, got %v and metadata %v", partial.Amount, partial.Metadata)
+	}
+	if unknown.Status != consts.TRANSACTION_STATUS_REFUNDED {
+		t.Errorf("Expected purchase with unknown refund to count as refunded, got %q", unknown.Status)
+	}
+	if _, found := paid.Metadata["refunded_amount"]; found || paid.Status != consts.TRANSACTION_STATUS_SUCCEEDED {
+		t.Errorf("Expected unrefunded purchase to stay succeeded, got status %q and metadata %v", paid.Status, paid.Metadata)
+	}
+}
+
+func TestZettleClient_GetLatestTransactionsMatchesRefundsInPage(t *testing.T) {
+	var lookups atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/token":
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "mock_zettle_token", ExpiresIn: 7200})
+		case "/purchases/v2":
+			// Links between refunds and purchases use purchaseUUID1, not uuid
+			json.NewEncoder(w).Encode(ZettlePaymentsResponse{
+				Purchases: []ZettlePayment{
+					{UUID: "p1", PurchaseUUID1: "p1-uuid1", Amount: 10000, Refunded: true, RefundedByPurchaseUUIDs: []string{"r1-uuid1"}},
+					{UUID: "r1", PurchaseUUID1: "r1-uuid1", Amount: -2500, Refund: true, RefundsPurchaseUUID: "p1-uuid1"},
+				},
+			})
+		default:
+			lookups.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockServer.Close()
+
+	client := NewZettleClient("test_api_key", mockServer.URL, "test_client_id", "test_secret")
+	client.OAuthURL = mockServer.URL
+
+	transactions, err := client.GetLatestTransactions(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+	if got := lookups.Load(); got != 0 {
+		t.Errorf("Expected the refund in the page to be used without a lookup, got %d lookups", got)
+	}
+	if purchase := transactions[0]; purchase.Status != consts.TRANSACTION_STATUS_SUCCEEDED || purchase.Amount != 75 {
+		t.Errorf("Expected a partially refunded purchase with net amount 75, got status %q and amount %v", purchase.Status, purchase.Amount)
+	}
+}
+
+func TestZettleClient_GetTransactionByIDDetectsRefunds(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/token":
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "mock_zettle_token", ExpiresIn: 7200})
+		case "/purchase/p1":
+			json.NewEncoder(w).Encode(ZettlePayment{UUID: "p1", Amount: 10000, Refunded: true, RefundedByPurchaseUUIDs: []string{"r1", "r2"}})
+		case "/purchase/r1":
+			json.NewEncoder(w).Encode(ZettlePayment{UUID: "r1", Amount: -4000, Refund: true, RefundsPurchaseUUID: "p1"})
+		case "/purchase/r2":
+			json.NewEncoder(w).Encode(ZettlePayment{UUID: "r2", Amount: -6000, Refund: true, RefundsPurchaseUUID: "p1"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockServer.Close()
+
+	client := NewZettleClient("test_api_key", mockServer.URL, "test_client_id", "test_secret")
+	client.OAuthURL = mockServer.URL
+
+	transaction, err := client.GetTransactionByID(context.Background(), "p1")
+	if err != nil {
+		t.Fatalf("Failed to get transaction: %v", err)
+	}
+	if transaction.Status != consts.TRANSACTION_STATUS_REFUNDED || transaction.Metadata["refunded_amount"] != "100.00" {
+		t.Errorf("Expected purchase refunded by two refunds, got status %q and metadata %v", transaction.Status, transaction.Metadata)
+	}
+}
@@ -2,12 +2,17 @@ package adminhandler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/mail"
+	"strings"
 
 	"github.com/rogerwesterbo/svennescamping-backend/internal/clients"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/middlewares"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
 	"go.uber.org/zap"
 )
 
@@ -17,15 +22,30 @@ type RoleAssignmentRequest struct {
 	Role  string `json:"role"`
 }
 
+// maxEmailLength is the longest email address allowed in a role assignment, the limit of RFC 5321
+const maxEmailLength = 254
+
+// validateEmail checks that an email is a plain address, without a display name or angle brackets,
+// and no longer than maxEmailLength
+func validateEmail(email string) error {
+	if len(email) > maxEmailLength {
+		return fmt.Errorf("must not be longer than %d characters", maxEmailLength)
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return errors.New("must be a plain address like name@example.com")
+	}
+	return nil
+}
+
 // ListUsersHandler returns all users and their roles (admin only)
 func ListUsersHandler(logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
 		user, ok := middlewares.GetUserFromContext(r.Context())
 		if !ok {
 			logger.Error("User not found in context")
-			httphelpers.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{
-				"error": "Authentication required",
-			})
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeAuthenticationRequired, "Authentication required")
 			return
 		}
 
@@ -34,10 +54,10 @@ func ListUsersHandler(logger *zap.Logger) http.HandlerFunc {
 			zap.String("admin_email", user.Email),
 		)
 
-		// This is a placeholder - in a real implementation, you'd fetch from a database
+		users := middlewares.GetRoleService().ListAllUsers()
 		response := map[string]interface{}{
-			"message":    "This endpoint would return all users and their roles",
-			"admin_user": user,
+			"users": users,
+			"count": len(users),
 		}
 
 		err := httphelpers.RespondWithJSON(w, http.StatusOK, response)
@@ -50,21 +70,18 @@ func ListUsersHandler(logger *zap.Logger) http.HandlerFunc {
 // AssignRoleHandler allows admins to assign roles to users
 func AssignRoleHandler(logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
 		user, ok := middlewares.GetUserFromContext(r.Context())
 		if !ok {
 			logger.Error("User not found in context")
-			httphelpers.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{
-				"error": "Authentication required",
-			})
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeAuthenticationRequired, "Authentication required")
 			return
 		}
 
 		var req RoleAssignmentRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			logger.Warn("Invalid role assignment request", zap.Error(err))
-			httphelpers.RespondWithJSON(w, http.StatusBadRequest, map[string]string{
-				"error": "Invalid request body",
-			})
+			httphelpers.RespondWithBodyError(w, err, "Invalid request body")
 			return
 		}
 
@@ -75,25 +92,48 @@ func AssignRoleHandler(logger *zap.Logger) http.HandlerFunc {
 				zap.String("role", req.Role),
 				zap.String("admin_email", user.Email),
 			)
-			httphelpers.RespondWithJSON(w, http.StatusBadRequest, map[string]string{
-				"error": "Invalid role. Valid roles are: admin, user, no_access",
-			})
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidRole,
+				fmt.Sprintf("Invalid role %q. Valid roles are: admin, editor, user, no_access", req.Role))
 			return
 		}
 
+		req.Email = strings.TrimSpace(req.Email)
+		if req.Email == "" {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeEmailRequired, "Email is required")
+			return
+		}
+		if err := validateEmail(req.Email); err != nil {
+			logger.Warn("Invalid email provided",
+				zap.Int("length", len(req.Email)),
+				zap.String("admin_email", user.Email),
+			)
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidEmail, "Invalid email: "+err.Error())
+			return
+		}
+
+		roleService := middlewares.GetRoleService()
+		if err := roleService.SetUserRole(req.Email, role); err != nil {
+			logger.Error("Failed to assign role", zap.Error(err), zap.String("target_email", req.Email))
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to save role assignment")
+			return
+		}
+
+		assignedRole, _ := roleService.GetAssignedRole(req.Email)
+
 		logger.Info("Admin assigned role",
 			zap.String("admin_id", user.ID),
 			zap.String("admin_email", user.Email),
 			zap.String("target_email", req.Email),
-			zap.String("assigned_role", req.Role),
+			zap.String("assigned_role", string(assignedRole)),
 		)
 
-		// In a real implementation, you'd update the database here
+		// The ADMIN_EMAILS and USER_EMAILS lists override assignments, so report the role that applies
 		response := map[string]interface{}{
-			"message":       "Role assignment would be saved to database",
-			"target_email":  req.Email,
-			"assigned_role": req.Role,
-			"assigned_by":   user.Email,
+			"message":        "Role assigned",
+			"target_email":   req.Email,
+			"assigned_role":  assignedRole,
+			"effective_role": roleService.GetUserRole(&entities.User{Email: req.Email}),
+			"assigned_by":    user.Email,
 		}
 
 		err := httphelpers.RespondWithJSON(w, http.StatusOK, response)
@@ -106,12 +146,11 @@ func AssignRoleHandler(logger *zap.Logger) http.HandlerFunc {
 // BackgroundFetcherStatusHandler returns the status of the background transaction fetcher
 func BackgroundFetcherStatusHandler(logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
 		user, ok := middlewares.GetUserFromContext(r.Context())
 		if !ok {
 			logger.Error("User not found in context")
-			httphelpers.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{
-				"error": "Authentication required",
-			})
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeAuthenticationRequired, "Authentication required")
 			return
 		}
 
@@ -128,31 +167,64 @@ func BackgroundFetcherStatusHandler(logger *zap.Logger) http.HandlerFunc {
 		response := map[string]interface{}{
 			"background_fetcher": map[string]interface{}{
 				"running":           isRunning,
-				"fetch_interval":    "5 minutes",
+				"fetch_interval":    clients.GetBackgroundFetchInterval().String(),
 				"providers_enabled": []string{},
+				"provider_stats":    clients.GetBackgroundFetchStats(),
 			},
 			"cache_stats": map[string]interface{}{
 				"total_transactions": len(cachedTransactions),
 			},
 		}
 
-		// Check which providers are enabled
-		var enabledProviders []string
-		if clients.StripeClient != nil {
-			enabledProviders = append(enabledProviders, "stripe")
+		// Providers that are configured and not disabled by their enabled setting, or mocked
+		response["background_fetcher"].(map[string]interface{})["providers_enabled"] = clients.EnabledProviders()
+
+		err := httphelpers.RespondWithJSON(w, http.StatusOK, response)
+		if err != nil {
+			logger.Error("Failed to send background fetcher status response", zap.Error(err))
+		}
+	}
+}
+
+// CacheStatsHandler returns a summary of the transaction cache contents for checking cache health
+// without exporting the transactions
+func CacheStatsHandler(logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+
+		statsProvider, ok := clients.Cache.(interfaces.CacheStatsProvider)
+		if !ok {
+			httphelpers.RespondWithErrorCode(w, http.StatusNotImplemented, httphelpers.ErrorCodeCacheStatsUnavailable,
+				"Cache statistics are not available for the configured cache")
+			return
 		}
-		if clients.VippsClient != nil {
-			enabledProviders = append(enabledProviders, "vipps")
+
+		err := httphelpers.RespondWithJSON(w, http.StatusOK, statsProvider.Stats())
+		if err != nil {
+			logger.Error("Failed to send cache stats response", zap.Error(err))
 		}
-		if clients.ZettleClient != nil {
-			enabledProviders = append(enabledProviders, "zettle")
+	}
+}
+
+// ProviderHealthHandler checks connectivity to each configured payment provider and reports the outcome and latency of each check
+func ProviderHealthHandler(logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+
+		results := clients.CheckProviderHealth(r.Context())
+		healthy := true
+		for _, result := range results {
+			healthy = healthy && result.OK
 		}
 
-		response["background_fetcher"].(map[string]interface{})["providers_enabled"] = enabledProviders
+		response := map[string]interface{}{
+			"healthy":   healthy,
+			"providers": results,
+		}
 
 		err := httphelpers.RespondWithJSON(w, http.StatusOK, response)
 		if err != nil {
-			logger.Error("Failed to send background fetcher status response", zap.Error(err))
+			logger.Error("Failed to send provider health response", zap.Error(err))
 		}
 	}
 }
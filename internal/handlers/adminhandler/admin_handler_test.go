@@ -0,0 +1,102 @@
+package adminhandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/middlewares"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"go.uber.org/zap"
+)
+
+// assignRole posts a role assignment as an admin, as the auth middleware would pass it on
+func assignRole(body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/admin/users/roles", strings.NewReader(body))
+	admin := &entities.User{ID: "admin", Email: "admin@example.com", Role: entities.RoleAdmin}
+	req = req.WithContext(context.WithValue(req.Context(), middlewares.UserKey, admin))
+
+	rec := httptest.NewRecorder()
+	AssignRoleHandler(zap.NewNop())(rec, req)
+	return rec
+}
+
+// errorResponse decodes the code and message of an error response
+func errorResponse(t *testing.T, rec *httptest.ResponseRecorder) (string, string) {
+	t.Helper()
+
+	var response httphelpers.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode error response %q: %v", rec.Body.String(), err)
+	}
+	return response.Error.Code, response.Error.Message
+}
+
+func TestAssignRoleHandler_InvalidEmail(t *testing.T) {
+	tests := []struct {
+		name         string
+		email        string
+		expectedCode string
+	}{
+		{"empty", "", httphelpers.ErrorCodeEmailRequired},
+		{"whitespace only", "   ", httphelpers.ErrorCodeEmailRequired},
+		{"missing at sign", "guest.example.com", httphelpers.ErrorCodeInvalidEmail},
+		{"missing local part", "@example.com", httphelpers.ErrorCodeInvalidEmail},
+		{"missing domain", "guest@", httphelpers.ErrorCodeInvalidEmail},
+		{"two addresses", "guest@example.com, other@example.com", httphelpers.ErrorCodeInvalidEmail},
+		{"display name", "Guest <guest@example.com>", httphelpers.ErrorCodeInvalidEmail},
+		{"inner whitespace", "gu est@example.com", httphelpers.ErrorCodeInvalidEmail},
+		{"oversized", strings.Repeat("a", 250) + "@example.com", httphelpers.ErrorCodeInvalidEmail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(RoleAssignmentRequest{Email: tt.email, Role: string(entities.RoleUser)})
+			rec := assignRole(string(body))
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status %d, got %d (%s)", http.StatusBadRequest, rec.Code, rec.Body.String())
+			}
+			if code, _ := errorResponse(t, rec); code != tt.expectedCode {
+				t.Errorf("Expected error code %q, got %q", tt.expectedCode, code)
+			}
+		})
+	}
+}
+
+func TestAssignRoleHandler_InvalidRole(t *testing.T) {
+	rec := assignRole(`{"email":"guest@example.com","role":"superuser"}`)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	code, message := errorResponse(t, rec)
+	if code != httphelpers.ErrorCodeInvalidRole {
+		t.Errorf("Expected error code %q, got %q", httphelpers.ErrorCodeInvalidRole, code)
+	}
+	if !strings.Contains(message, `"superuser"`) {
+		t.Errorf("Expected the invalid role in the message, got %q", message)
+	}
+}
+
+func TestAssignRoleHandler_TrimsEmail(t *testing.T) {
+	rec := assignRole(`{"email":"  guest@example.com\n","role":"editor"}`)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var response map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response["target_email"] != "guest@example.com" {
+		t.Errorf("Expected the trimmed email, got %q", response["target_email"])
+	}
+	if role, found := middlewares.GetRoleService().GetAssignedRole("guest@example.com"); !found || role != entities.RoleEditor {
+		t.Errorf("Expected the editor role stored for the trimmed email, got %q (found %v)", role, found)
+	}
+}
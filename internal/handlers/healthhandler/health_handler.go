@@ -3,12 +3,15 @@ package healthhandler
 import (
 	"net/http"
 
+	"github.com/rogerwesterbo/svennescamping-backend/internal/readiness"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
 	"go.uber.org/zap"
 )
 
+// HealthHandler is a liveness check that reports healthy as long as the server responds
 func HealthHandler(logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
 		logger.Info("Health check requested",
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
@@ -34,3 +37,25 @@ func HealthHandler(logger *zap.Logger) http.HandlerFunc {
 
 	}
 }
+
+// ReadyHandler reports whether the API can serve traffic, returning 503 with the failed checks until
+// settings, the price service and at least one payment client are initialized, and with WARM_CACHE_ON_START
+// until the initial provider fetch has completed.
+// Unlike HealthHandler it is meant for readiness probes, not liveness probes.
+func ReadyHandler(registry *readiness.Registry, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+
+		status := registry.Status()
+		statusCode := http.StatusOK
+		if !status.Ready {
+			statusCode = http.StatusServiceUnavailable
+			logger.Warn("Readiness check failed", zap.Strings("failed_checks", status.FailedChecks))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := httphelpers.RespondWithJSON(w, statusCode, status); err != nil {
+			logger.Error("Failed to send readiness response", zap.Error(err))
+		}
+	}
+}
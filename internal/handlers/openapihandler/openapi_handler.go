@@ -0,0 +1,34 @@
+package openapihandler
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"go.uber.org/zap"
+)
+
+// spec is the OpenAPI 3 document describing the routes set up in the routes package.
+// It is maintained by hand; the routes tests fail when a route or a documented entity field is missing from it.
+//
+//go:embed openapi.json
+var spec []byte
+
+// Spec returns the embedded OpenAPI document
+func Spec() []byte {
+	return spec
+}
+
+// OpenAPIHandler serves the OpenAPI document so frontend developers can see the parameters and schemas of every endpoint
+func OpenAPIHandler(logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(spec); err != nil {
+			logger.Error("Failed to send OpenAPI document", zap.Error(err))
+		}
+	}
+}
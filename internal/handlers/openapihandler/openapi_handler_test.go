@@ -0,0 +1,159 @@
+package openapihandler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"go.uber.org/zap"
+)
+
+// openAPIDocument is the part of the OpenAPI document the tests inspect
+type openAPIDocument struct {
+	OpenAPI    string `json:"openapi"`
+	Components struct {
+		SecuritySchemes map[string]struct {
+			Type   string `json:"type"`
+			Scheme string `json:"scheme"`
+		} `json:"securitySchemes"`
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func decodeSpec(t *testing.T) (openAPIDocument, map[string]any) {
+	t.Helper()
+
+	var doc openAPIDocument
+	if err := json.Unmarshal(Spec(), &doc); err != nil {
+		t.Fatalf("Failed to decode OpenAPI document: %v", err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(Spec(), &raw); err != nil {
+		t.Fatalf("Failed to decode OpenAPI document: %v", err)
+	}
+	return doc, raw
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	OpenAPIHandler(zap.NewNop())(rec, httptest.NewRequest("GET", "/openapi.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %s", contentType)
+	}
+	if rec.Body.String() != string(Spec()) {
+		t.Error("Expected the embedded OpenAPI document to be served")
+	}
+}
+
+func TestSpec_BearerAuth(t *testing.T) {
+	doc, _ := decodeSpec(t)
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got version %q", doc.OpenAPI)
+	}
+	scheme, ok := doc.Components.SecuritySchemes["bearerAuth"]
+	if !ok || scheme.Type != "http" || scheme.Scheme != "bearer" {
+		t.Errorf("Expected an HTTP bearer security scheme, got %+v", doc.Components.SecuritySchemes)
+	}
+}
+
+// TestSpec_EntitySchemas keeps the documented schemas in step with the JSON fields of the entities
+func TestSpec_EntitySchemas(t *testing.T) {
+	doc, _ := decodeSpec(t)
+
+	for name, entity := range map[string]any{
+		"Transaction":    entities.Transaction{},
+		"User":           entities.User{},
+		"UserRole":       entities.UserRole{},
+		"ProviderHealth": entities.ProviderHealth{},
+		"CacheStats":     entities.CacheStats{},
+	} {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("Schema %s is missing", name)
+			continue
+		}
+
+		var documented []string
+		for property := range schema.Properties {
+			documented = append(documented, property)
+		}
+		fields := jsonFields(reflect.TypeOf(entity))
+		slices.Sort(documented)
+		slices.Sort(fields)
+		if !slices.Equal(documented, fields) {
+			t.Errorf("Schema %s documents %v, but the entity has %v", name, documented, fields)
+		}
+	}
+}
+
+// TestSpec_RefsResolve checks every $ref points to a defined component
+func TestSpec_RefsResolve(t *testing.T) {
+	_, raw := decodeSpec(t)
+
+	var walk func(node any)
+	walk = func(node any) {
+		switch value := node.(type) {
+		case map[string]any:
+			if ref, ok := value["$ref"].(string); ok && !resolves(raw, ref) {
+				t.Errorf("Unresolved reference %s", ref)
+			}
+			for _, child := range value {
+				walk(child)
+			}
+		case []any:
+			for _, child := range value {
+				walk(child)
+			}
+		}
+	}
+	walk(raw)
+}
+
+// resolves reports whether a local reference like #/components/schemas/Transaction exists in the document
+func resolves(doc map[string]any, ref string) bool {
+	path, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return false
+	}
+
+	var node any = doc
+	for _, part := range strings.Split(path, "/") {
+		object, ok := node.(map[string]any)
+		if !ok {
+			return false
+		}
+		if node, ok = object[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonFields returns the JSON names of the exported fields of a struct type
+func jsonFields(structType reflect.Type) []string {
+	var fields []string
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
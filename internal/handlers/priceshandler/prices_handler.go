@@ -0,0 +1,185 @@
+package priceshandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/services/prices"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"go.uber.org/zap"
+)
+
+// ListPricesHandler returns all configured prices ordered by product name
+func ListPricesHandler(priceService *prices.PriceService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		if priceService == nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusServiceUnavailable, httphelpers.ErrorCodePriceServiceUnavailable, "Price service is not available")
+			return
+		}
+
+		priceList := priceService.GetAllPrices()
+		slices.SortStableFunc(priceList, func(a, b prices.Price) int {
+			return strings.Compare(strings.ToLower(a.Product), strings.ToLower(b.Product))
+		})
+
+		err := httphelpers.RespondWithJSON(w, http.StatusOK, priceList)
+		if err != nil {
+			logger.Error("Failed to send prices response", zap.Error(err))
+		}
+	}
+}
+
+// UpsertPriceRequest adds or updates a single price. Persist also writes the price list back to the CSV file.
+type UpsertPriceRequest struct {
+	Product  string  `json:"product"`
+	Price    float64 `json:"price"`
+	Currency string  `json:"currency"`
+	Persist  bool    `json:"persist"`
+}
+
+// UpsertPriceHandler adds or updates a single price at runtime (admin only)
+func UpsertPriceHandler(priceService *prices.PriceService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		if priceService == nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusServiceUnavailable, httphelpers.ErrorCodePriceServiceUnavailable, "Price service is not available")
+			return
+		}
+
+		var req UpsertPriceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httphelpers.RespondWithBodyError(w, err, "Invalid request body")
+			return
+		}
+
+		price := prices.Price{Product: req.Product, Price: req.Price, Currency: req.Currency}
+		if err := priceService.UpsertPrice(price); err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidPrice, err.Error())
+			return
+		}
+
+		updated, err := priceService.GetPriceByProduct(req.Product)
+		if err != nil {
+			logger.Error("Upserted price not found", zap.String("product", req.Product), zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to update price")
+			return
+		}
+
+		logger.Info("Upserted price",
+			zap.String("product", updated.Product),
+			zap.Float64("price", updated.Price),
+			zap.String("currency", updated.Currency),
+			zap.Bool("persist", req.Persist))
+
+		if req.Persist {
+			if err := priceService.SaveToCSV(); err != nil {
+				logger.Error("Failed to save prices to CSV", zap.Error(err))
+				httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodePriceNotPersisted, "Price updated in memory but failed to save to CSV")
+				return
+			}
+		}
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, updated)
+		if err != nil {
+			logger.Error("Failed to send upsert price response", zap.Error(err))
+		}
+	}
+}
+
+// ReloadPricesResponse is returned after the price list has been reloaded
+type ReloadPricesResponse struct {
+	Message string            `json:"message"`
+	Count   int               `json:"count"`
+	Skipped []prices.RowError `json:"skipped,omitempty"`
+}
+
+// ReloadPricesHandler re-reads the price CSV so seasonal price changes apply without a redeploy (admin only)
+func ReloadPricesHandler(priceService *prices.PriceService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		if priceService == nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusServiceUnavailable, httphelpers.ErrorCodePriceServiceUnavailable, "Price service is not available")
+			return
+		}
+
+		count, err := priceService.Reload()
+		if err != nil {
+			logger.Error("Failed to reload prices", zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to reload prices")
+			return
+		}
+
+		report := priceService.LastLoadReport()
+		logger.Info("Reloaded prices", zap.Int("count", count), zap.Int("skipped", len(report.Skipped)))
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, ReloadPricesResponse{
+			Message: "Prices reloaded successfully",
+			Count:   count,
+			Skipped: report.Skipped,
+		})
+		if err != nil {
+			logger.Error("Failed to send reload prices response", zap.Error(err))
+		}
+	}
+}
+
+// maxMatchPreviewItems is the largest batch a single match preview may contain
+const maxMatchPreviewItems = 1000
+
+// MatchPreviewItem is an amount and description to run through the product matcher
+type MatchPreviewItem struct {
+	Amount      float64 `json:"amount"`
+	Description string  `json:"description"`
+}
+
+// MatchPreviewResult is the product an item would be labelled with. Match is null when no product matches.
+type MatchPreviewResult struct {
+	MatchPreviewItem
+	Match *prices.ProductMatch `json:"match"`
+}
+
+// MatchPreviewHandler runs a batch of amounts and descriptions through the product matcher and returns
+// the match for each, in request order, without reading or changing cached transactions (admin only)
+func MatchPreviewHandler(priceService *prices.PriceService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		if priceService == nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusServiceUnavailable, httphelpers.ErrorCodePriceServiceUnavailable, "Price service is not available")
+			return
+		}
+
+		var items []MatchPreviewItem
+		if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+			httphelpers.RespondWithBodyError(w, err, "Invalid request body, expected a list of {amount, description}")
+			return
+		}
+		if len(items) > maxMatchPreviewItems {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidRequestBody,
+				fmt.Sprintf("Too many items, at most %d can be previewed at once", maxMatchPreviewItems))
+			return
+		}
+
+		results := make([]MatchPreviewResult, len(items))
+		matched := 0
+		for i, item := range items {
+			results[i] = MatchPreviewResult{
+				MatchPreviewItem: item,
+				Match:            priceService.MatchProduct(item.Amount, item.Description),
+			}
+			if results[i].Match != nil {
+				matched++
+			}
+		}
+
+		logger.Info("Previewed product matches", zap.Int("items", len(items)), zap.Int("matched", matched))
+
+		err := httphelpers.RespondWithJSON(w, http.StatusOK, results)
+		if err != nil {
+			logger.Error("Failed to send match preview response", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package priceshandler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/services/prices"
+	"go.uber.org/zap"
+)
+
+// newTestPriceService creates a price service from a temporary CSV file
+func newTestPriceService(t *testing.T, content string) *prices.PriceService {
+	t.Helper()
+
+	csvPath := filepath.Join(t.TempDir(), "prices.csv")
+	if err := os.WriteFile(csvPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test CSV file: %v", err)
+	}
+
+	service, err := prices.NewPriceService(csvPath)
+	if err != nil {
+		t.Fatalf("Failed to create PriceService: %v", err)
+	}
+	return service
+}
+
+func TestListPricesHandler(t *testing.T) {
+	service := newTestPriceService(t, "Product;Price;Currency\nCabin;650;NOK\nbed linen;75;NOK\nKayak;20;EUR")
+
+	rec := httptest.NewRecorder()
+	ListPricesHandler(service, zap.NewNop())(rec, httptest.NewRequest("GET", "/v1/prices", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var priceList []prices.Price
+	if err := json.NewDecoder(rec.Body).Decode(&priceList); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	expected := []string{"bed linen", "Cabin", "Kayak"}
+	if len(priceList) != len(expected) {
+		t.Fatalf("Expected %d prices, got %d", len(expected), len(priceList))
+	}
+	for i, product := range expected {
+		if priceList[i].Product != product {
+			t.Errorf("Expected %s at position %d, got %s", product, i, priceList[i].Product)
+		}
+	}
+	if priceList[2].Currency != "EUR" {
+		t.Errorf("Expected currency EUR for Kayak, got %s", priceList[2].Currency)
+	}
+}
+
+func TestUpsertPriceHandler(t *testing.T) {
+	service := newTestPriceService(t, "Product;Price;Currency\nCabin;650;NOK")
+	handler := UpsertPriceHandler(service, zap.NewNop())
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"new product", `{"product":"Family cabin","price":950,"currency":"NOK"}`, http.StatusOK},
+		{"negative price", `{"product":"Cabin","price":-5,"currency":"NOK"}`, http.StatusBadRequest},
+		{"invalid currency", `{"product":"Cabin","price":700,"currency":"NO"}`, http.StatusBadRequest},
+		{"invalid body", `not json`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest("PUT", "/v1/admin/prices", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d (%s)", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if price, err := service.GetPriceByProduct("Family cabin"); err != nil || price.Price != 950 {
+		t.Errorf("Expected new product to be matched immediately, got %v (err %v)", price, err)
+	}
+}
+
+func TestMatchPreviewHandler(t *testing.T) {
+	service := newTestPriceService(t, "Product;Price;Currency\nCabin;650;NOK\nBed linen;75;NOK")
+	handler := MatchPreviewHandler(service, zap.NewNop())
+
+	body := `[{"amount": 650, "description": "Booking"}, {"amount": 10, "description": "bed linnen"}, {"amount": 3, "description": "Ice cream"}]`
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("POST", "/v1/admin/prices/match-preview", strings.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var results []MatchPreviewResult
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	if m := results[0].Match; m == nil || m.Price.Product != "Cabin" || m.Strategy != prices.MatchStrategyExactPrice {
+		t.Errorf("Expected Cabin by exact price, got %+v", m)
+	}
+	if m := results[1].Match; m == nil || m.Price.Product != "Bed linen" || m.Strategy != prices.MatchStrategyFuzzyDescription {
+		t.Errorf("Expected Bed linen by description, got %+v", m)
+	}
+	if results[2].Match != nil || results[2].Description != "Ice cream" {
+		t.Errorf("Expected no match for the third item, got %+v", results[2])
+	}
+}
+
+func TestMatchPreviewHandler_InvalidBody(t *testing.T) {
+	service := newTestPriceService(t, "Product;Price;Currency\nCabin;650;NOK")
+	handler := MatchPreviewHandler(service, zap.NewNop())
+
+	tooMany := "[" + strings.Repeat(`{"amount": 1},`, maxMatchPreviewItems) + `{"amount": 1}]`
+	for name, body := range map[string]string{
+		"not a list": `{"amount": 650}`,
+		"too many":   tooMany,
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest("POST", "/v1/admin/prices/match-preview", strings.NewReader(body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
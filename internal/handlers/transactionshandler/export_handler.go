@@ -0,0 +1,172 @@
+package transactionshandler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/services"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"go.uber.org/zap"
+)
+
+// Export formats supported by ExportTransactionsHandler
+const (
+	exportFormatCSV  = "csv"
+	exportFormatXLSX = "xlsx"
+)
+
+var exportFormats = []string{exportFormatCSV, exportFormatXLSX}
+
+// exportContentTypes maps each export format to the content type it is served as
+var exportContentTypes = map[string]string{
+	exportFormatCSV:  "text/csv; charset=utf-8",
+	exportFormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportColumns is the header of a transaction export. Columns are only ever appended,
+// so imports into accounting software keep working.
+var exportColumns = []string{
+	"id",
+	"external_id",
+	"source",
+	"amount",
+	"currency",
+	"status",
+	"created_at",
+	"description",
+	"payment_method",
+	"transaction_type",
+	"customer_id",
+	"product",
+}
+
+// exportFlushEvery is how many rows are written between flushes, so large exports stream to the client
+const exportFlushEvery = 500
+
+// ExportTransactionsHandler serves GET /v1/transactions/export?format=csv|xlsx with the cached transactions,
+// filtered the same way as the JSON listing
+func ExportTransactionsHandler(transactionService *services.TransactionService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		ctx := r.Context()
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = exportFormatCSV
+		}
+		if !slices.Contains(exportFormats, format) {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter,
+				fmt.Sprintf("Invalid format '%s'. Valid formats are: %s", format, strings.Join(exportFormats, ", ")))
+			return
+		}
+
+		filter, err := parseTransactionFilter(r, transactionService.ReportLocation())
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+
+		transactions, err := transactionService.GetAllTransactions(ctx, filter)
+		if err != nil {
+			logger.Error("Failed to fetch transactions for export", zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to fetch transactions")
+			return
+		}
+
+		// The workbook is built before the status is sent, so a failure can still be reported
+		write := func(w http.ResponseWriter) error { return writeTransactionsCSV(w, transactions) }
+		if format == exportFormatXLSX {
+			workbook, err := buildTransactionsWorkbook(transactions)
+			if err != nil {
+				logger.Error("Failed to build transactions workbook", zap.Error(err))
+				httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to export transactions")
+				return
+			}
+			defer workbook.Close()
+			write = func(w http.ResponseWriter) error { return workbook.Write(w) }
+		}
+
+		filename := fmt.Sprintf("transactions-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+		w.Header().Set("Content-Type", exportContentTypes[format])
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+
+		// The status is sent, so errors from here on can only be logged
+		if err := write(w); err != nil {
+			logger.Error("Failed to write transactions export", zap.Error(err))
+			return
+		}
+
+		logger.Info("Transactions exported",
+			zap.String("format", format),
+			zap.Int("count", len(transactions)),
+		)
+	}
+}
+
+// writeTransactionsCSV writes the export header and one row per transaction
+func writeTransactionsCSV(w http.ResponseWriter, transactions []entities.Transaction) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return err
+	}
+
+	flusher, _ := w.(http.Flusher)
+	for i, transaction := range transactions {
+		if err := writer.Write(exportRow(transaction)); err != nil {
+			return err
+		}
+
+		if (i+1)%exportFlushEvery == 0 {
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// exportRow formats a transaction in the order of exportColumns.
+// Amounts use a dot decimal separator and times are RFC3339 in UTC. Text from customers and providers is
+// escaped with escapeCSVCell, the amount and time are formatted here and left as they are.
+func exportRow(transaction entities.Transaction) []string {
+	product := ""
+	if transaction.Product != nil {
+		product = *transaction.Product
+	}
+
+	return []string{
+		escapeCSVCell(transaction.ID),
+		escapeCSVCell(transaction.ExternalID),
+		escapeCSVCell(transaction.Source),
+		strconv.FormatFloat(transaction.Amount, 'f', 2, 64),
+		escapeCSVCell(transaction.Currency),
+		escapeCSVCell(transaction.Status),
+		transaction.CreatedAt.UTC().Format(time.RFC3339),
+		escapeCSVCell(transaction.Description),
+		escapeCSVCell(transaction.PaymentMethod),
+		escapeCSVCell(transaction.TransactionType),
+		escapeCSVCell(transaction.CustomerID),
+		escapeCSVCell(product),
+	}
+}
+
+// escapeCSVCell prefixes a value with a quote when spreadsheet programs would otherwise open it as a formula
+func escapeCSVCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,214 @@
+package transactionshandler
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/cache"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/repository"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/services"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+)
+
+// newExportTestService returns a transaction service over a cache holding the given transactions
+func newExportTestService(transactions ...entities.Transaction) *services.TransactionService {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	for _, transaction := range transactions {
+		c.SetTransaction(transaction.ID, transaction, 1*time.Hour)
+	}
+	return services.NewTransactionService(repository.NewTransactionRepository(c, nil, nil, nil))
+}
+
+func TestExportTransactionsHandler_CSV(t *testing.T) {
+	service := newExportTestService(
+		entities.Transaction{
+			ID:          "stripe_internal_ch_1",
+			Source:      "stripe",
+			Amount:      1234.5,
+			Currency:    "NOK",
+			Status:      "succeeded",
+			CreatedAt:   time.Date(2025, 6, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60)),
+			Description: "Cabin, two nights",
+		},
+		entities.Transaction{
+			ID:        "vipps_internal_order_1",
+			Source:    "vipps",
+			Amount:    75,
+			Currency:  "NOK",
+			Status:    "succeeded",
+			CreatedAt: time.Date(2025, 5, 1, 8, 0, 0, 0, time.UTC),
+		},
+	)
+
+	rec := httptest.NewRecorder()
+	ExportTransactionsHandler(service, zap.NewNop())(rec, httptest.NewRequest("GET", "/v1/transactions/export?format=csv&source=stripe", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+		t.Errorf("Expected a CSV content type, got %q", contentType)
+	}
+	if disposition := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment; filename=") ||
+		!strings.HasSuffix(disposition, `.csv"`) {
+		t.Errorf("Expected an attachment with a .csv filename, got %q", disposition)
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected a header and one filtered row, got %d records", len(records))
+	}
+	if !slices.Equal(records[0], exportColumns) {
+		t.Errorf("Unexpected header: %v", records[0])
+	}
+
+	row := records[1]
+	if row[0] != "stripe_internal_ch_1" || row[3] != "1234.50" || row[6] != "2025-06-01T10:30:00Z" || row[7] != "Cabin, two nights" {
+		t.Errorf("Unexpected row: %v", row)
+	}
+}
+
+func TestExportRow_EscapesFormulas(t *testing.T) {
+	product := "@SUM(A1:A2)"
+	row := exportRow(entities.Transaction{
+		ID:          "stripe_internal_ch_1",
+		Amount:      -50,
+		Description: "=HYPERLINK(\"http://evil.example\")",
+		CustomerID:  "+47 123",
+		Status:      "\tsucceeded",
+		Currency:    "\rNOK",
+		Product:     &product,
+	})
+
+	expected := map[int]string{
+		0:  "stripe_internal_ch_1",
+		3:  "-50.00",
+		4:  "'\rNOK",
+		5:  "'\tsucceeded",
+		7:  "'=HYPERLINK(\"http://evil.example\")",
+		10: "'+47 123",
+		11: "'@SUM(A1:A2)",
+	}
+	for column, want := range expected {
+		if row[column] != want {
+			t.Errorf("Expected %s to be %q, got %q", exportColumns[column], want, row[column])
+		}
+	}
+	if escapeCSVCell("-1") != "'-1" {
+		t.Error("Expected text starting with a minus sign to be escaped")
+	}
+}
+
+func TestExportTransactionsHandler_XLSX(t *testing.T) {
+	created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := newExportTestService(
+		entities.Transaction{ID: "zettle_1", Source: "zettle", Amount: 20, Currency: "NOK", Status: "succeeded", CreatedAt: created},
+		entities.Transaction{ID: "stripe_1", Source: "stripe", Amount: 650, Currency: "NOK", Status: "succeeded", CreatedAt: created},
+		entities.Transaction{ID: "stripe_2", Source: "stripe", Amount: 75.5, Currency: "NOK", Status: "refunded", CreatedAt: created.Add(time.Hour)},
+	)
+
+	rec := httptest.NewRecorder()
+	ExportTransactionsHandler(service, zap.NewNop())(rec, httptest.NewRequest("GET", "/v1/transactions/export?format=xlsx", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != exportContentTypes[exportFormatXLSX] {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+	if disposition := rec.Header().Get("Content-Disposition"); !strings.HasSuffix(disposition, `.xlsx"`) {
+		t.Errorf("Expected an .xlsx filename, got %q", disposition)
+	}
+
+	f, err := excelize.OpenReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to open workbook: %v", err)
+	}
+	defer f.Close()
+
+	if sheets := f.GetSheetList(); !slices.Equal(sheets, []string{"stripe", "zettle"}) {
+		t.Fatalf("Expected one sheet per source in source order, got %v", sheets)
+	}
+
+	rows, err := f.GetRows("stripe")
+	if err != nil {
+		t.Fatalf("Failed to read stripe sheet: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("Expected a header, two transactions and a totals row, got %d rows", len(rows))
+	}
+	if rows[1][0] != "stripe_2" || rows[2][0] != "stripe_1" {
+		t.Errorf("Expected transactions newest first, got %v and %v", rows[1][0], rows[2][0])
+	}
+	// The refunded transaction doesn't count towards the total
+	if rows[3][0] != "Total" || rows[3][2] != "650.00" || rows[3][3] != "NOK" {
+		t.Errorf("Unexpected totals row: %v", rows[3])
+	}
+	if formula, _ := f.GetCellFormula("stripe", "C4"); formula != `SUMIFS(C2:C3,E2:E3,"succeeded")` {
+		t.Errorf("Expected the total to be a SUMIFS formula over successful rows, got %q", formula)
+	}
+}
+
+func TestExportTransactionsHandler_XLSXMixedCurrencies(t *testing.T) {
+	created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := newExportTestService(
+		entities.Transaction{ID: "stripe_1", Source: "stripe", Amount: 650, Currency: "NOK", Status: "succeeded", CreatedAt: created},
+		entities.Transaction{ID: "stripe_2", Source: "stripe", Amount: 20, Currency: "EUR", Status: "succeeded", CreatedAt: created},
+		entities.Transaction{ID: "stripe_3", Source: "stripe", Amount: 30, Currency: "USD", Status: "failed", CreatedAt: created},
+	)
+
+	rec := httptest.NewRecorder()
+	ExportTransactionsHandler(service, zap.NewNop())(rec, httptest.NewRequest("GET", "/v1/transactions/export?format=xlsx", nil))
+
+	f, err := excelize.OpenReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to open workbook: %v", err)
+	}
+	defer f.Close()
+
+	if total, _ := f.GetCellValue("stripe", "C5"); total != "" {
+		t.Errorf("Expected no total for mixed currencies, got %q", total)
+	}
+	if formula, _ := f.GetCellFormula("stripe", "C5"); formula != "" {
+		t.Errorf("Expected no total formula for mixed currencies, got %q", formula)
+	}
+}
+
+func TestGroupBySource(t *testing.T) {
+	sources, bySource := groupBySource([]entities.Transaction{
+		{ID: "1", Source: "paypal"},
+		{ID: "2", Source: "zettle"},
+		{ID: "3", Source: "vipps"},
+		{ID: "4", Source: "zettle"},
+	})
+
+	if !slices.Equal(sources, []string{"vipps", "zettle", "paypal"}) {
+		t.Errorf("Unexpected source order: %v", sources)
+	}
+	if len(bySource["zettle"]) != 2 || bySource["zettle"][0].ID != "2" {
+		t.Errorf("Expected zettle transactions to keep their order, got %v", bySource["zettle"])
+	}
+}
+
+func TestExportTransactionsHandler_InvalidParameters(t *testing.T) {
+	service := newExportTestService(entities.Transaction{ID: "stripe_internal_ch_1", Source: "stripe"})
+
+	for _, query := range []string{"format=pdf", "format=csv&source=paypal", "format=csv&from=yesterday"} {
+		rec := httptest.NewRecorder()
+		ExportTransactionsHandler(service, zap.NewNop())(rec, httptest.NewRequest("GET", "/v1/transactions/export?"+query, nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %q, got %d", http.StatusBadRequest, query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package transactionshandler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/statushelpers"
+	"github.com/xuri/excelize/v2"
+)
+
+// xlsxColumns is the header of each sheet in an XLSX export
+var xlsxColumns = []any{"id", "source", "amount", "currency", "status", "created_at", "product"}
+
+// xlsxAmountColumn is the column holding amounts, summed in the totals row
+const xlsxAmountColumn = "C"
+
+// xlsxStatusColumn is the column holding statuses, only successful transactions count in the totals row
+const xlsxStatusColumn = "E"
+
+// xlsxEmptySheet names the only sheet of an export without transactions
+const xlsxEmptySheet = "Transactions"
+
+// buildTransactionsWorkbook builds a workbook with one sheet per payment source, each ending in a totals row
+// of the successful transactions. The total is left empty when they are in more than one currency.
+// Sheets are written with excelize's stream writer, which spills large sheets to temporary files instead of
+// holding them in memory. The caller must close the returned file.
+func buildTransactionsWorkbook(transactions []entities.Transaction) (*excelize.File, error) {
+	f := excelize.NewFile()
+	if err := writeWorkbookSheets(f, transactions); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// writeWorkbookSheets writes the per-source sheets of a transactions workbook
+func writeWorkbookSheets(f *excelize.File, transactions []entities.Transaction) error {
+	amountStyle, err := f.NewStyle(&excelize.Style{NumFmt: 2}) // 0.00
+	if err != nil {
+		return err
+	}
+	dateFormat := "yyyy-mm-dd hh:mm:ss"
+	dateStyle, err := f.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat})
+	if err != nil {
+		return err
+	}
+	boldStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	boldAmountStyle, err := f.NewStyle(&excelize.Style{NumFmt: 2, Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	sources, bySource := groupBySource(transactions)
+	if len(sources) == 0 {
+		sources = []string{xlsxEmptySheet}
+	}
+
+	// A new workbook comes with one sheet, which becomes the first source's sheet
+	defaultSheet := f.GetSheetName(0)
+	for i, source := range sources {
+		if i == 0 {
+			if err := f.SetSheetName(defaultSheet, source); err != nil {
+				return err
+			}
+		} else if _, err := f.NewSheet(source); err != nil {
+			return err
+		}
+
+		sw, err := f.NewStreamWriter(source)
+		if err != nil {
+			return err
+		}
+		if err := sw.SetColWidth(1, 1, 36); err != nil {
+			return err
+		}
+		if err := sw.SetColWidth(6, 7, 20); err != nil {
+			return err
+		}
+		if err := sw.SetRow("A1", xlsxColumns, excelize.RowOpts{StyleID: boldStyle}); err != nil {
+			return err
+		}
+
+		rows := bySource[source]
+		total := 0.0
+		currencies := map[string]bool{}
+		for j, transaction := range rows {
+			product := ""
+			if transaction.Product != nil {
+				product = *transaction.Product
+			}
+
+			row := []any{
+				transaction.ID,
+				transaction.Source,
+				excelize.Cell{StyleID: amountStyle, Value: transaction.Amount},
+				transaction.Currency,
+				transaction.Status,
+				excelize.Cell{StyleID: dateStyle, Value: transaction.CreatedAt.UTC()},
+				product,
+			}
+			if err := sw.SetRow(fmt.Sprintf("A%d", j+2), row); err != nil {
+				return err
+			}
+
+			if statushelpers.IsSuccessfulStatus(transaction.Status) {
+				total += transaction.Amount
+				currencies[transaction.Currency] = true
+			}
+		}
+
+		// Amounts in different currencies can't be added up, so the total is only shown for a single currency
+		totalRow := len(rows) + 2
+		var totalCell, totalCurrency any
+		switch {
+		case len(currencies) > 1:
+		case len(currencies) == 0:
+			totalCell = excelize.Cell{StyleID: boldAmountStyle, Value: 0.0}
+		default:
+			for currency := range currencies {
+				totalCurrency = currency
+			}
+			totalCell = excelize.Cell{
+				StyleID: boldAmountStyle,
+				Value:   total,
+				Formula: fmt.Sprintf(`SUMIFS(%s2:%s%d,%s2:%s%d,"%s")`,
+					xlsxAmountColumn, xlsxAmountColumn, totalRow-1,
+					xlsxStatusColumn, xlsxStatusColumn, totalRow-1, consts.TRANSACTION_STATUS_SUCCEEDED),
+			}
+		}
+		if err := sw.SetRow(fmt.Sprintf("A%d", totalRow), []any{
+			excelize.Cell{StyleID: boldStyle, Value: "Total"}, nil, totalCell, totalCurrency,
+		}); err != nil {
+			return err
+		}
+
+		if err := sw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	f.SetActiveSheet(0)
+	return nil
+}
+
+// groupBySource splits transactions by payment source, keeping their order within a source.
+// Known sources come in the order of consts.ValidPaymentSources, any others after them alphabetically.
+func groupBySource(transactions []entities.Transaction) ([]string, map[string][]entities.Transaction) {
+	bySource := make(map[string][]entities.Transaction)
+	for _, transaction := range transactions {
+		source := transaction.Source
+		if source == "" {
+			source = "unknown"
+		}
+		bySource[source] = append(bySource[source], transaction)
+	}
+
+	sources := make([]string, 0, len(bySource))
+	for source := range bySource {
+		sources = append(sources, source)
+	}
+	slices.SortFunc(sources, func(a, b string) int {
+		ia, ib := slices.Index(consts.ValidPaymentSources, a), slices.Index(consts.ValidPaymentSources, b)
+		switch {
+		case ia >= 0 && ib >= 0:
+			return ia - ib
+		case ia >= 0:
+			return -1
+		case ib >= 0:
+			return 1
+		default:
+			return strings.Compare(a, b)
+		}
+	})
+
+	return sources, bySource
+}
@@ -0,0 +1,100 @@
+package transactionshandler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+	"go.uber.org/zap"
+)
+
+// streamHeartbeatInterval is how often a comment is sent on an idle stream so proxies don't close the connection
+const streamHeartbeatInterval = 15 * time.Second
+
+// TransactionStreamHandler serves GET /v1/transactions/stream as Server-Sent Events, sending a "transaction"
+// event with the transaction as JSON whenever a new transaction is added to the cache
+func TransactionStreamHandler(notifier interfaces.CacheNotifier, logger *zap.Logger) http.HandlerFunc {
+	return transactionStreamHandler(notifier, logger, streamHeartbeatInterval)
+}
+
+func transactionStreamHandler(notifier interfaces.CacheNotifier, logger *zap.Logger, heartbeatInterval time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		if notifier == nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusServiceUnavailable, httphelpers.ErrorCodeServiceUnavailable, "Transaction stream is not available")
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		// The stream stays open far longer than the server's write timeout allows
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			logger.Warn("Failed to clear write deadline for transaction stream", zap.Error(err))
+		}
+
+		// Subscribe before sending headers so no transaction added after the client connected is missed
+		events, unsubscribe := notifier.Subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		// Stop nginx-style proxies from buffering the stream
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			logger.Error("Transaction stream requires a flushable response writer", zap.Error(err))
+			return
+		}
+
+		logger.Info("Transaction stream opened")
+		defer logger.Info("Transaction stream closed")
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		// Shutdown doesn't cancel requests, so end the stream when the server starts shutting down
+		shuttingDown := httphelpers.ShutdownSignal(r.Context())
+
+		for {
+			var err error
+			select {
+			case <-r.Context().Done():
+				return
+			case <-shuttingDown:
+				return
+			case event, ok := <-events:
+				if !ok {
+					// Dropped for falling behind; the client reconnects and resumes from new transactions
+					logger.Warn("Transaction stream subscriber fell behind and was dropped")
+					return
+				}
+				if event.Type != entities.CacheEventSet || !event.Created {
+					continue
+				}
+				transaction := event.Transaction
+				data, marshalErr := json.Marshal(transaction)
+				if marshalErr != nil {
+					logger.Error("Failed to encode streamed transaction", zap.String("id", transaction.ID), zap.Error(marshalErr))
+					continue
+				}
+				_, err = fmt.Fprintf(w, "event: transaction\ndata: %s\n\n", data)
+			case <-heartbeat.C:
+				_, err = fmt.Fprint(w, ": heartbeat\n\n")
+			}
+
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				// The client went away
+				logger.Debug("Failed to write to transaction stream", zap.Error(err))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package transactionshandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/cache"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"go.uber.org/zap"
+)
+
+// readStreamLine returns the next non-empty line of the stream, failing the test if none arrives in time
+func readStreamLine(t *testing.T, lines <-chan string) string {
+	t.Helper()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("Stream closed unexpectedly")
+			}
+			if line != "" {
+				return line
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for stream data")
+		}
+	}
+}
+
+func openTransactionStream(t *testing.T, server *httptest.Server) (*http.Response, <-chan string) {
+	t.Helper()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	lines := make(chan string, 64)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return resp, lines
+}
+
+func TestTransactionStreamHandler_SendsNewTransactions(t *testing.T) {
+	c := cache.NewObservableCache(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute))
+	server := httptest.NewServer(transactionStreamHandler(c, zap.NewNop(), time.Hour))
+	// Registered before the stream is opened so the response body is closed first and the handler can return
+	t.Cleanup(server.Close)
+
+	resp, lines := openTransactionStream(t, server)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %q", contentType)
+	}
+
+	c.SetTransaction("tx_1", entities.Transaction{ID: "tx_1", Source: "vipps", Amount: 250}, time.Hour)
+
+	if line := readStreamLine(t, lines); line != "event: transaction" {
+		t.Fatalf("Expected transaction event, got %q", line)
+	}
+	line := readStreamLine(t, lines)
+	data, found := strings.CutPrefix(line, "data: ")
+	if !found {
+		t.Fatalf("Expected data line, got %q", line)
+	}
+	var transaction entities.Transaction
+	if err := json.Unmarshal([]byte(data), &transaction); err != nil {
+		t.Fatalf("Failed to decode streamed transaction: %v", err)
+	}
+	if transaction.ID != "tx_1" || transaction.Amount != 250 {
+		t.Errorf("Unexpected streamed transaction: %+v", transaction)
+	}
+}
+
+func TestTransactionStreamHandler_Heartbeat(t *testing.T) {
+	c := cache.NewObservableCache(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute))
+	server := httptest.NewServer(transactionStreamHandler(c, zap.NewNop(), 10*time.Millisecond))
+	t.Cleanup(server.Close)
+
+	_, lines := openTransactionStream(t, server)
+
+	if line := readStreamLine(t, lines); line != ": heartbeat" {
+		t.Errorf("Expected heartbeat comment, got %q", line)
+	}
+}
+
+func TestTransactionStreamHandler_EndsOnShutdown(t *testing.T) {
+	c := cache.NewObservableCache(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute))
+	shuttingDown := make(chan struct{})
+	handler := transactionStreamHandler(c, zap.NewNop(), time.Hour)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(httphelpers.WithShutdown(r.Context(), shuttingDown)))
+	}))
+	t.Cleanup(server.Close)
+
+	_, lines := openTransactionStream(t, server)
+	close(shuttingDown)
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-lines:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expected the stream to end when the server shuts down")
+		}
+	}
+}
+
+func TestTransactionStreamHandler_NoNotifier(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/transactions/stream", nil)
+	rr := httptest.NewRecorder()
+
+	TransactionStreamHandler(nil, zap.NewNop())(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+}
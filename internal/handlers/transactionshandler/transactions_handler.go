@@ -1,81 +1,697 @@
 package transactionshandler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/gorilla/mux"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/services"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/statushelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/timehelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+	"go.uber.org/zap"
 )
 
+// TransactionsPageResponse is the paginated response returned by TransactionsHandler
+// Warnings lists providers that failed to return transactions when the listed ones are only partial.
+// Limit is the page size that was applied, lower than the requested limit when it exceeded the maximum.
+type TransactionsPageResponse struct {
+	Transactions []entities.Transaction     `json:"transactions"`
+	NextCursor   string                     `json:"next_cursor,omitempty"`
+	Warnings     []entities.ProviderWarning `json:"warnings,omitempty"`
+	Limit        int                        `json:"limit"`
+}
+
 func TransactionsHandler(transactionService *services.TransactionService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		// Get limit from query parameter, default to 25
-		limitStr := r.URL.Query().Get("limit")
-		limit := consts.TRANSACTION_LIMIT_DEFAULT
+		limit, err := parseLimitParam(r.URL.Query())
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter, err.Error())
+			return
+		}
 
-		if limitStr != "" {
-			if parsedLimit, err := strconv.Atoi(limitStr); err == nil {
-				limit = parsedLimit
-			}
+		filter, err := parseTransactionFilter(r, transactionService.ReportLocation())
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter, err.Error())
+			return
 		}
 
-		transactions, err := transactionService.GetTransactions(ctx, limit)
+		// Continue from a previous page if a cursor is given
+		cursor := r.URL.Query().Get("cursor")
+
+		// Partial results from the providers that succeeded are returned with warnings,
+		// only a failure of every provider is an error
+		result, nextCursor, err := transactionService.GetTransactionsPage(ctx, filter, cursor, limit)
+		if errors.Is(err, interfaces.ErrAllProvidersFailed) {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadGateway, httphelpers.ErrorCodeProvidersUnavailable, "Failed to fetch transactions from any payment provider")
+			return
+		}
 		if err != nil {
-			httphelpers.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch transactions")
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to fetch transactions")
 			return
 		}
 
-		err = httphelpers.RespondWithJSON(w, http.StatusOK, transactions)
+		transactions := result.Items
+		if transactions == nil {
+			transactions = []entities.Transaction{}
+		}
+
+		response := TransactionsPageResponse{
+			Transactions: transactions,
+			NextCursor:   nextCursor,
+			Warnings:     result.Warnings,
+			Limit:        limit,
+		}
+
+		// The dashboard polls this endpoint, so unchanged pages are answered with 304 Not Modified
+		err = httphelpers.RespondWithJSONETag(w, r, response)
 		if err != nil {
-			httphelpers.RespondWithError(w, http.StatusInternalServerError, "Failed to respond with transactions")
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to respond with transactions")
 			return
 		}
 	}
 }
 
-func TransactionByIDHandler(transactionService *services.TransactionService) http.HandlerFunc {
+// SearchTransactionsHandler serves GET /v1/transactions/search?q= with the newest cached transactions whose
+// description, external ID or metadata contains the query, ignoring case
+func SearchTransactionsHandler(transactionService *services.TransactionService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		// Extract ID from URL path (you might want to use a router like gorilla/mux for this)
-		id := r.URL.Query().Get("id")
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeMissingParameter, "Query parameter 'q' is required")
+			return
+		}
+
+		limit, err := parseLimitParam(r.URL.Query())
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+
+		transactions, err := transactionService.SearchTransactions(ctx, query, limit)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to search transactions")
+			return
+		}
+
+		if transactions == nil {
+			transactions = []entities.Transaction{}
+		}
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, TransactionsPageResponse{Transactions: transactions, Limit: limit})
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to respond with transactions")
+			return
+		}
+	}
+}
+
+// TransactionsCountResponse is the response returned by TransactionsCountHandler
+type TransactionsCountResponse struct {
+	Count int `json:"count"`
+}
+
+// TransactionsCountHandler serves GET /v1/transactions/count with the number of cached transactions matching
+// the same filters as the listing, for badges that don't need the transactions themselves
+func TransactionsCountHandler(transactionService *services.TransactionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		filter, err := parseTransactionFilter(r, transactionService.ReportLocation())
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+
+		count, err := transactionService.CountTransactions(ctx, filter)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to count transactions")
+			return
+		}
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, TransactionsCountResponse{Count: count})
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to respond with count")
+			return
+		}
+	}
+}
+
+// LatestTransactionsHandler serves GET /v1/transactions/latest with the newest cached transaction of each configured
+// source, keyed by source, for displays that only show the last payment received. Sources without cached
+// transactions are left out.
+func LatestTransactionsHandler(transactionService *services.TransactionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		latest, err := transactionService.GetLatestTransactionBySource(ctx)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to get latest transactions")
+			return
+		}
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, latest)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to respond with latest transactions")
+			return
+		}
+	}
+}
+
+// TransactionsSummaryHandler returns aggregate totals for the cached transactions.
+// With ?convert=true the revenue is also converted to the converter's base currency.
+func TransactionsSummaryHandler(transactionService *services.TransactionService, converter *services.CurrencyConverter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		filter, err := parseTransactionFilter(r, transactionService.ReportLocation())
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+
+		summaryConverter, err := parseConvertParam(r, converter)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+
+		summary, err := transactionService.GetTransactionsSummary(ctx, filter, summaryConverter)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to summarize transactions")
+			return
+		}
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, summary)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to respond with summary")
+			return
+		}
+	}
+}
+
+// RevenueByProductHandler serves GET /v1/reports/revenue-by-product with the revenue of succeeded
+// transactions per matched product, highest first. With ?convert=true the revenue is also converted to the
+// converter's base currency.
+func RevenueByProductHandler(transactionService *services.TransactionService, converter *services.CurrencyConverter, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		ctx := r.Context()
+
+		filter, err := parseTransactionFilter(r, transactionService.ReportLocation())
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+
+		reportConverter, err := parseConvertParam(r, converter)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+
+		report, err := transactionService.GetRevenueByProduct(ctx, filter, reportConverter)
+		if err != nil {
+			logger.Error("Failed to build revenue by product report", zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to build revenue report")
+			return
+		}
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, report)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to respond with revenue report")
+			return
+		}
+	}
+}
+
+// RevenueTimeseriesHandler serves GET /v1/reports/timeseries?interval=day|week|month&from=&to= with the count
+// and revenue of succeeded transactions per period. Periods and plain from/to dates are aligned to midnight in the
+// report time zone, and the source and amount filters of the listing apply.
+func RevenueTimeseriesHandler(transactionService *services.TransactionService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		ctx := r.Context()
+
+		interval := entities.TimeseriesInterval(r.URL.Query().Get("interval"))
+		if interval == "" {
+			interval = entities.TimeseriesIntervalDay
+		}
+		if !slices.Contains(entities.ValidTimeseriesIntervals, interval) {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter,
+				fmt.Sprintf("Invalid interval '%s'. Valid intervals are: day, week, month", interval))
+			return
+		}
+
+		if r.URL.Query().Get("from") == "" || r.URL.Query().Get("to") == "" {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeMissingParameter, "Query parameters 'from' and 'to' are required")
+			return
+		}
+
+		filter, err := parseTransactionFilter(r, transactionService.ReportLocation())
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter, err.Error())
+			return
+		}
+
+		report, err := transactionService.GetRevenueTimeseries(ctx, filter, interval)
+		if errors.Is(err, services.ErrTimeseriesRangeTooLarge) {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidParameter,
+				fmt.Sprintf("The range spans more than %d periods, use a larger interval or a shorter range", services.MaxTimeseriesBuckets))
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to build revenue timeseries", zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to build revenue timeseries")
+			return
+		}
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, report)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to respond with revenue timeseries")
+			return
+		}
+	}
+}
+
+// TransactionByIDHandler serves GET /v1/transactions/{id}. The legacy /v1/transactions/by-id?id= form
+// is still accepted but deprecated.
+func TransactionByIDHandler(transactionService *services.TransactionService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		ctx := r.Context()
+
+		id := mux.Vars(r)["id"]
+		if id == "" {
+			id = r.URL.Query().Get("id")
+			if id != "" {
+				logger.Warn("Deprecated transaction lookup by query parameter, use /v1/transactions/{id} instead",
+					zap.String("path", r.URL.Path))
+				w.Header().Set("Deprecation", "true")
+			}
+		}
 		if id == "" {
-			httphelpers.RespondWithError(w, http.StatusBadRequest, "Transaction ID is required")
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeMissingParameter, "Transaction ID is required")
 			return
 		}
 
 		transaction, err := transactionService.GetTransactionByID(ctx, id)
+		if errors.Is(err, interfaces.ErrTransactionNotFound) {
+			httphelpers.RespondWithErrorCode(w, http.StatusNotFound, httphelpers.ErrorCodeTransactionNotFound, fmt.Sprintf("Transaction '%s' not found", id))
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to fetch transaction", zap.String("id", id), zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to fetch transaction")
+			return
+		}
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, transaction)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to respond with transaction")
+			return
+		}
+	}
+}
+
+// RefreshTransactionHandler serves POST /v1/transactions/{id}/refresh, re-fetching a single transaction from
+// the providers to get its latest status, e.g. when a charge is disputed
+func RefreshTransactionHandler(transactionService *services.TransactionService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		ctx := r.Context()
+
+		id := mux.Vars(r)["id"]
+		if id == "" {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeMissingParameter, "Transaction ID is required")
+			return
+		}
+
+		transaction, err := transactionService.RefreshTransaction(ctx, id)
+		if errors.Is(err, interfaces.ErrTransactionNotFound) {
+			httphelpers.RespondWithErrorCode(w, http.StatusNotFound, httphelpers.ErrorCodeTransactionNotFound, fmt.Sprintf("Transaction '%s' not found", id))
+			return
+		}
 		if err != nil {
-			httphelpers.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch transaction")
+			logger.Error("Failed to refresh transaction", zap.String("id", id), zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusBadGateway, httphelpers.ErrorCodeProvidersUnavailable, "Failed to refresh transaction from the payment providers")
 			return
 		}
 
+		logger.Info("Refreshed transaction from provider", zap.String("id", id), zap.String("status", transaction.Status))
+
 		err = httphelpers.RespondWithJSON(w, http.StatusOK, transaction)
 		if err != nil {
-			httphelpers.RespondWithError(w, http.StatusInternalServerError, "Failed to respond with transaction")
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to respond with transaction")
 			return
 		}
 	}
 }
 
+// UpdateTransactionRequest is the body accepted by UpdateTransactionHandler
+type UpdateTransactionRequest struct {
+	// Notes replaces the staff notes; an empty or blank string removes them
+	Notes *string `json:"notes"`
+}
+
+// UpdateTransactionHandler serves PATCH /v1/transactions/{id}, updating the staff notes of a transaction.
+// Notes are kept in the annotation store, so they survive re-fetches from the providers.
+func UpdateTransactionHandler(transactionService *services.TransactionService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		ctx := r.Context()
+
+		id := mux.Vars(r)["id"]
+		if id == "" {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeMissingParameter, "Transaction ID is required")
+			return
+		}
+
+		var req UpdateTransactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httphelpers.RespondWithBodyError(w, err, "Invalid request body")
+			return
+		}
+		if req.Notes == nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidNotes, "Field 'notes' is required")
+			return
+		}
+
+		notes := strings.TrimSpace(*req.Notes)
+		if length := utf8.RuneCountInString(notes); length > consts.TRANSACTION_NOTES_MAX_LENGTH {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidNotes,
+				fmt.Sprintf("Notes must be at most %d characters, got %d", consts.TRANSACTION_NOTES_MAX_LENGTH, length))
+			return
+		}
+		var update *string
+		if notes != "" {
+			update = &notes
+		}
+
+		transaction, err := transactionService.UpdateTransactionNotes(ctx, id, update)
+		if errors.Is(err, interfaces.ErrTransactionNotFound) {
+			httphelpers.RespondWithErrorCode(w, http.StatusNotFound, httphelpers.ErrorCodeTransactionNotFound, fmt.Sprintf("Transaction '%s' not found", id))
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to update transaction notes", zap.String("id", id), zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to update transaction")
+			return
+		}
+
+		logger.Info("Updated transaction notes", zap.String("id", id), zap.Bool("has_notes", update != nil))
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, transaction)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to respond with transaction")
+			return
+		}
+	}
+}
+
+// DeleteTransactionHandler serves DELETE /v1/transactions/{id}, evicting a single transaction from the cache
+func DeleteTransactionHandler(transactionService *services.TransactionService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		ctx := r.Context()
+
+		id := mux.Vars(r)["id"]
+		if id == "" {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeMissingParameter, "Transaction ID is required")
+			return
+		}
+
+		err := transactionService.DeleteTransaction(ctx, id)
+		if errors.Is(err, interfaces.ErrTransactionNotFound) {
+			httphelpers.RespondWithErrorCode(w, http.StatusNotFound, httphelpers.ErrorCodeTransactionNotFound, fmt.Sprintf("Transaction '%s' not found", id))
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to delete transaction", zap.String("id", id), zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to delete transaction")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ArchiveTransactionHandler serves POST /v1/transactions/{id}/archive, hiding a transaction from listings
+// while keeping it available by ID and with ?include_archived=true
+func ArchiveTransactionHandler(transactionService *services.TransactionService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		ctx := r.Context()
+
+		id := mux.Vars(r)["id"]
+		if id == "" {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeMissingParameter, "Transaction ID is required")
+			return
+		}
+
+		transaction, err := transactionService.ArchiveTransaction(ctx, id)
+		if errors.Is(err, interfaces.ErrTransactionNotFound) {
+			httphelpers.RespondWithErrorCode(w, http.StatusNotFound, httphelpers.ErrorCodeTransactionNotFound, fmt.Sprintf("Transaction '%s' not found", id))
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to archive transaction", zap.String("id", id), zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to archive transaction")
+			return
+		}
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, transaction)
+		if err != nil {
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to respond with transaction")
+			return
+		}
+	}
+}
+
+// RefreshCacheResponse is the response returned by RefreshCacheHandler
+type RefreshCacheResponse struct {
+	Message string `json:"message"`
+	entities.RefreshResult
+}
+
+// RefreshCacheHandler serves POST /v1/transactions/refresh-cache, fetching the latest transactions from all providers
 func RefreshCacheHandler(transactionService *services.TransactionService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		err := transactionService.RefreshCache(ctx)
+		// Overlapping refreshes share one provider fetch, and a repeat within the cooldown returns the
+		// previous result with cached set, so double clicks don't multiply provider load
+		result, err := transactionService.RefreshCache(ctx)
+		if errors.Is(err, interfaces.ErrAllProvidersFailed) {
+			httphelpers.RespondWithErrorCode(w, http.StatusBadGateway, httphelpers.ErrorCodeProvidersUnavailable, "Failed to fetch transactions from any payment provider")
+			return
+		}
 		if err != nil {
-			httphelpers.RespondWithError(w, http.StatusInternalServerError, "Failed to refresh cache")
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to refresh cache")
 			return
 		}
 
-		err = httphelpers.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Cache refreshed successfully"})
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, RefreshCacheResponse{
+			Message:       "Cache refreshed successfully",
+			RefreshResult: result,
+		})
 		if err != nil {
-			httphelpers.RespondWithError(w, http.StatusInternalServerError, "Failed to respond")
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to respond")
 			return
 		}
 	}
 }
+
+// parseTransactionFilter builds a transaction filter from the query parameters.
+// Supported parameters are the repeatable status and source, from/to as RFC3339 or YYYY-MM-DD,
+// min_amount/max_amount as inclusive amount bounds, and meta.<key>=<value> requiring the metadata key to be present
+// with exactly that value (case-sensitive, several meta parameters must all match), and include_archived=true to list
+// archived transactions too. Plain dates start at midnight in loc.
+func parseTransactionFilter(r *http.Request, loc *time.Location) (entities.TransactionFilter, error) {
+	query := r.URL.Query()
+
+	// Optional repeatable status filter, e.g. ?status=succeeded&status=refunded
+	statuses := query["status"]
+	for _, status := range statuses {
+		if !statushelpers.IsValidStatus(status) {
+			return entities.TransactionFilter{}, fmt.Errorf(
+				"Invalid status '%s'. Valid statuses are: %s", status, strings.Join(consts.ValidTransactionStatuses, ", "))
+		}
+	}
+
+	// Optional repeatable source filter, e.g. ?source=vipps&source=zettle
+	sources := query["source"]
+	for _, source := range sources {
+		if !slices.Contains(consts.ValidPaymentSources, source) {
+			return entities.TransactionFilter{}, fmt.Errorf(
+				"Invalid source '%s'. Valid sources are: %s", source, strings.Join(consts.ValidPaymentSources, ", "))
+		}
+	}
+
+	filter := entities.TransactionFilter{
+		Statuses: statuses,
+		Sources:  sources,
+	}
+
+	if fromStr := query.Get("from"); fromStr != "" {
+		from, _, err := parseDateParam(fromStr, loc)
+		if err != nil {
+			return entities.TransactionFilter{}, fmt.Errorf("Invalid 'from' date: %s", fromStr)
+		}
+		filter.From = from
+	}
+
+	if toStr := query.Get("to"); toStr != "" {
+		to, dateOnly, err := parseDateParam(toStr, loc)
+		if err != nil {
+			return entities.TransactionFilter{}, fmt.Errorf("Invalid 'to' date: %s", toStr)
+		}
+		// A plain date includes the whole day
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = to
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return entities.TransactionFilter{}, fmt.Errorf("'from' must be before 'to'")
+	}
+
+	minAmount, err := parseAmountParam(query, "min_amount")
+	if err != nil {
+		return entities.TransactionFilter{}, err
+	}
+	maxAmount, err := parseAmountParam(query, "max_amount")
+	if err != nil {
+		return entities.TransactionFilter{}, err
+	}
+	if minAmount != nil && maxAmount != nil && *minAmount > *maxAmount {
+		return entities.TransactionFilter{}, fmt.Errorf("'min_amount' must not be greater than 'max_amount'")
+	}
+	filter.MinAmount = minAmount
+	filter.MaxAmount = maxAmount
+
+	metadata, err := parseMetadataParams(query)
+	if err != nil {
+		return entities.TransactionFilter{}, err
+	}
+	filter.Metadata = metadata
+
+	if includeArchivedStr := query.Get("include_archived"); includeArchivedStr != "" {
+		includeArchived, err := strconv.ParseBool(includeArchivedStr)
+		if err != nil {
+			return entities.TransactionFilter{}, fmt.Errorf("Invalid 'include_archived' value: %s", includeArchivedStr)
+		}
+		filter.IncludeArchived = includeArchived
+	}
+
+	return filter, nil
+}
+
+// metadataParamPrefix marks query parameters filtering on a metadata key, e.g. ?meta.order_id=1234
+const metadataParamPrefix = "meta."
+
+// parseMetadataParams collects the meta.<key>=<value> query parameters, returning nil when there are none.
+// Values are compared exactly, so they are not trimmed or lowercased.
+func parseMetadataParams(query url.Values) (map[string]string, error) {
+	var metadata map[string]string
+	for name, values := range query {
+		key, ok := strings.CutPrefix(name, metadataParamPrefix)
+		if !ok {
+			continue
+		}
+		if key == "" {
+			return nil, fmt.Errorf("Invalid metadata filter '%s', expected meta.<key>=<value>", name)
+		}
+		if len(values) > 1 {
+			return nil, fmt.Errorf("Metadata filter '%s' may only be given once", name)
+		}
+
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[key] = values[0]
+	}
+	return metadata, nil
+}
+
+// parseLimitParam returns the page size from the limit query parameter, the default when it is absent.
+// Values that aren't whole numbers or are below the minimum are rejected, values above the maximum are capped.
+func parseLimitParam(query url.Values) (int, error) {
+	value := query.Get("limit")
+	if value == "" {
+		return consts.TRANSACTION_LIMIT_DEFAULT, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid 'limit': %s is not a whole number", value)
+	}
+	if limit < consts.TRANSACTION_LIMIT_MIN {
+		return 0, fmt.Errorf("Invalid 'limit': must be at least %d", consts.TRANSACTION_LIMIT_MIN)
+	}
+	return min(limit, consts.TRANSACTION_LIMIT_MAX), nil
+}
+
+// parseAmountParam parses an optional non-negative amount query parameter, returning nil when it is absent
+func parseAmountParam(query url.Values, name string) (*float64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return nil, fmt.Errorf("Invalid '%s': %s is not a number", name, value)
+	}
+	if amount < 0 {
+		return nil, fmt.Errorf("Invalid '%s': must not be negative", name)
+	}
+	return &amount, nil
+}
+
+// parseConvertParam returns the converter when the request asks for conversion with ?convert=true, otherwise nil
+func parseConvertParam(r *http.Request, converter *services.CurrencyConverter) (*services.CurrencyConverter, error) {
+	value := r.URL.Query().Get("convert")
+	if value == "" {
+		return nil, nil
+	}
+
+	convert, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid 'convert' value: %s", value)
+	}
+	if !convert {
+		return nil, nil
+	}
+	if converter == nil {
+		return nil, fmt.Errorf("Currency conversion is not configured")
+	}
+	return converter, nil
+}
+
+// parseDateParam parses a date as RFC3339 or YYYY-MM-DD, reporting whether it was a plain date.
+// Plain dates and times without a zone are read in loc.
+func parseDateParam(value string, loc *time.Location) (time.Time, bool, error) {
+	t, err := timehelpers.ParseTimestamp(value, loc)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t, timehelpers.IsDate(value), nil
+}
@@ -0,0 +1,742 @@
+package transactionshandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/cache"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/repository"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/services"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+	"go.uber.org/zap"
+)
+
+// fakeLookupClient is a provider client whose lookups return a fixed error
+type fakeLookupClient struct {
+	err error
+}
+
+func (f *fakeLookupClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
+	return nil, nil
+}
+
+func (f *fakeLookupClient) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
+	return entities.Transaction{}, f.err
+}
+
+// newTestRouter serves TransactionByIDHandler the way routes.go registers it
+func newTestRouter(client interfaces.Transactions, transactions ...entities.Transaction) *mux.Router {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	for _, transaction := range transactions {
+		c.SetTransaction(transaction.ID, transaction, 1*time.Hour)
+	}
+
+	service := services.NewTransactionService(repository.NewTransactionRepository(c, client, nil, nil))
+	handler := TransactionByIDHandler(service, zap.NewNop())
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/transactions/by-id", handler).Methods("GET")
+	router.HandleFunc("/v1/transactions/{id:.*}", handler).Methods("GET")
+	return router
+}
+
+func TestTransactionByIDHandler(t *testing.T) {
+	notFound := &fakeLookupClient{err: fmt.Errorf("%w: missing", interfaces.ErrTransactionNotFound)}
+	router := newTestRouter(notFound, entities.Transaction{ID: "vipps_internal_order/1"})
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{"path variable with slash", "/v1/transactions/vipps_internal_order/1", http.StatusOK},
+		{"deprecated query parameter", "/v1/transactions/by-id?id=vipps_internal_order/1", http.StatusOK},
+		{"not found", "/v1/transactions/missing", http.StatusNotFound},
+		{"missing id", "/v1/transactions/by-id", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d (%s)", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestTransactionByIDHandler_ProviderError(t *testing.T) {
+	router := newTestRouter(&fakeLookupClient{err: errors.New("connection refused")})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/transactions/ch_123", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
+
+func TestDeleteTransactionHandler(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	c.SetTransaction("stripe_internal_ch_1", entities.Transaction{ID: "stripe_internal_ch_1"}, 1*time.Hour)
+
+	service := services.NewTransactionService(repository.NewTransactionRepository(c, nil, nil, nil))
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/transactions/{id:.*}", DeleteTransactionHandler(service, zap.NewNop())).Methods("DELETE")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("DELETE", "/v1/transactions/stripe_internal_ch_1", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	if _, found := c.GetTransaction("stripe_internal_ch_1"); found {
+		t.Error("Expected transaction to be evicted from cache")
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("DELETE", "/v1/transactions/stripe_internal_ch_1", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an already evicted transaction, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestTransactionsCountHandler(t *testing.T) {
+	created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	for _, transaction := range []entities.Transaction{
+		{ID: "stripe_1", Source: "stripe", Status: "succeeded", CreatedAt: created},
+		{ID: "stripe_2", Source: "stripe", Status: "pending", CreatedAt: created},
+		{ID: "vipps_1", Source: "vipps", Status: "succeeded", CreatedAt: created.AddDate(0, 0, -1)},
+	} {
+		c.SetTransaction(transaction.ID, transaction, 1*time.Hour)
+	}
+	service := services.NewTransactionService(repository.NewTransactionRepository(c, nil, nil, nil))
+
+	tests := []struct {
+		query    string
+		expected int
+	}{
+		{"", 3},
+		{"?from=2025-06-01&to=2025-06-01", 2},
+		{"?source=stripe&status=succeeded", 1},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		TransactionsCountHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions/count"+tt.query, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for %q, got %d", http.StatusOK, tt.query, rec.Code)
+		}
+		var response TransactionsCountResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Count != tt.expected {
+			t.Errorf("Expected count %d for %q, got %d", tt.expected, tt.query, response.Count)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	TransactionsCountHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions/count?status=bogus", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid filter, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestLatestTransactionsHandler(t *testing.T) {
+	created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	for _, transaction := range []entities.Transaction{
+		{ID: "stripe_1", Source: "stripe", CreatedAt: created.Add(-time.Hour)},
+		{ID: "stripe_2", Source: "stripe", CreatedAt: created},
+		{ID: "zettle_1", Source: "zettle", CreatedAt: created.Add(-2 * time.Hour)},
+		{ID: "zettle_2", Source: "zettle", CreatedAt: created, Archived: true},
+	} {
+		c.SetTransaction(transaction.ID, transaction, 1*time.Hour)
+	}
+	// Vipps is configured but has nothing cached
+	client := &fakeLookupClient{}
+	service := services.NewTransactionService(repository.NewTransactionRepository(c, client, client, client))
+
+	rec := httptest.NewRecorder()
+	LatestTransactionsHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions/latest", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var response map[string]entities.Transaction
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response) != 2 {
+		t.Errorf("Expected a transaction for Stripe and Zettle only, got %v", response)
+	}
+	if response["stripe"].ID != "stripe_2" {
+		t.Errorf("Expected the newest Stripe transaction, got %q", response["stripe"].ID)
+	}
+	if response["zettle"].ID != "zettle_1" {
+		t.Errorf("Expected the newest unarchived Zettle transaction, got %q", response["zettle"].ID)
+	}
+}
+
+func TestTransactionsCountHandler_ReportTimezone(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	for _, transaction := range []entities.Transaction{
+		// 23:30 Oslo time on June 1st and 00:30 Oslo time on June 2nd, both June 1st in UTC
+		{ID: "evening", CreatedAt: time.Date(2025, 6, 1, 21, 30, 0, 0, time.UTC)},
+		{ID: "after_midnight", CreatedAt: time.Date(2025, 6, 1, 22, 30, 0, 0, time.UTC)},
+	} {
+		c.SetTransaction(transaction.ID, transaction, 1*time.Hour)
+	}
+	service := services.NewTransactionService(repository.NewTransactionRepository(c, nil, nil, nil), services.WithReportLocation(oslo))
+
+	tests := []struct {
+		query    string
+		expected int
+	}{
+		{"?from=2025-06-01&to=2025-06-01", 1},
+		{"?from=2025-06-02&to=2025-06-02", 1},
+		{"?from=2025-06-01T22:00:00Z", 1},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		TransactionsCountHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions/count"+tt.query, nil))
+
+		var response TransactionsCountResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Count != tt.expected {
+			t.Errorf("Expected count %d for %q, got %d", tt.expected, tt.query, response.Count)
+		}
+	}
+}
+
+func TestTransactionsHandler_AmountFilter(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	for _, transaction := range []entities.Transaction{
+		{ID: "stripe_1", Source: "stripe", Status: "succeeded", Amount: 1500},
+		{ID: "stripe_2", Source: "stripe", Status: "pending", Amount: 2000},
+		{ID: "zettle_1", Source: "zettle", Status: "succeeded", Amount: 20},
+		{ID: "vipps_1", Source: "vipps", Status: "succeeded", Amount: 1000},
+	} {
+		c.SetTransaction(transaction.ID, transaction, 1*time.Hour)
+	}
+	service := services.NewTransactionService(repository.NewTransactionRepository(c, nil, nil, nil))
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"?min_amount=1000", []string{"stripe_1", "stripe_2", "vipps_1"}},
+		{"?max_amount=50", []string{"zettle_1"}},
+		{"?min_amount=1000&max_amount=1500", []string{"stripe_1", "vipps_1"}},
+		{"?min_amount=1000&source=stripe&status=succeeded", []string{"stripe_1"}},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		TransactionsHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions"+tt.query, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for %q, got %d", http.StatusOK, tt.query, rec.Code)
+		}
+		var response TransactionsPageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		var ids []string
+		for _, transaction := range response.Transactions {
+			ids = append(ids, transaction.ID)
+		}
+		slices.Sort(ids)
+		if !slices.Equal(ids, tt.expected) {
+			t.Errorf("Expected %v for %q, got %v", tt.expected, tt.query, ids)
+		}
+	}
+
+	for _, query := range []string{"?min_amount=abc", "?max_amount=-5", "?min_amount=NaN", "?min_amount=100&max_amount=10"} {
+		rec := httptest.NewRecorder()
+		TransactionsHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %q, got %d", http.StatusBadRequest, query, rec.Code)
+		}
+	}
+}
+
+func TestTransactionsHandler_MetadataFilter(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	for _, transaction := range []entities.Transaction{
+		{ID: "stripe_1", Source: "stripe", Metadata: map[string]string{"order_id": "1234", "site": "A12"}},
+		{ID: "stripe_2", Source: "stripe", Metadata: map[string]string{"order_id": "1234", "site": "B3"}},
+		{ID: "vipps_1", Source: "vipps", Metadata: map[string]string{"order_id": "5678", "site": ""}},
+		{ID: "zettle_1", Source: "zettle"},
+	} {
+		c.SetTransaction(transaction.ID, transaction, 1*time.Hour)
+	}
+	service := services.NewTransactionService(repository.NewTransactionRepository(c, nil, nil, nil))
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"?meta.order_id=1234", []string{"stripe_1", "stripe_2"}},
+		{"?meta.order_id=1234&meta.site=B3", []string{"stripe_2"}},
+		// Values are matched exactly and case-sensitively
+		{"?meta.site=a12", nil},
+		// An empty value only matches transactions that have the key
+		{"?meta.site=", []string{"vipps_1"}},
+		{"?meta.order_id=1234&source=vipps", nil},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		TransactionsHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions"+tt.query, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for %q, got %d", http.StatusOK, tt.query, rec.Code)
+		}
+		var response TransactionsPageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		var ids []string
+		for _, transaction := range response.Transactions {
+			ids = append(ids, transaction.ID)
+		}
+		slices.Sort(ids)
+		if !slices.Equal(ids, tt.expected) {
+			t.Errorf("Expected %v for %q, got %v", tt.expected, tt.query, ids)
+		}
+	}
+
+	for _, query := range []string{"?meta.=1234", "?meta.order_id=1234&meta.order_id=5678"} {
+		rec := httptest.NewRecorder()
+		TransactionsHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %q, got %d", http.StatusBadRequest, query, rec.Code)
+		}
+	}
+}
+
+func TestArchiveTransactionHandler(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	c.SetTransaction("stripe_1", entities.Transaction{ID: "stripe_1", Source: "stripe"}, 1*time.Hour)
+	c.SetTransaction("stripe_2", entities.Transaction{ID: "stripe_2", Source: "stripe"}, 1*time.Hour)
+	notFound := &fakeLookupClient{err: fmt.Errorf("%w: missing", interfaces.ErrTransactionNotFound)}
+	service := services.NewTransactionService(repository.NewTransactionRepository(c, notFound, nil, nil))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/transactions", TransactionsHandler(service)).Methods("GET")
+	router.HandleFunc("/v1/transactions/{id:.*}/archive", ArchiveTransactionHandler(service, zap.NewNop())).Methods("POST")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/transactions/stripe_1/archive", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var archived entities.Transaction
+	if err := json.Unmarshal(rec.Body.Bytes(), &archived); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if archived.ID != "stripe_1" || !archived.Archived {
+		t.Errorf("Expected archived stripe_1, got %+v", archived)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/transactions/missing/archive", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown transaction, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"stripe_2"}},
+		{"?include_archived=false", []string{"stripe_2"}},
+		{"?include_archived=true", []string{"stripe_1", "stripe_2"}},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/transactions"+tt.query, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for %q, got %d", http.StatusOK, tt.query, rec.Code)
+		}
+		var response TransactionsPageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		var ids []string
+		for _, transaction := range response.Transactions {
+			ids = append(ids, transaction.ID)
+		}
+		slices.Sort(ids)
+		if !slices.Equal(ids, tt.expected) {
+			t.Errorf("Expected %v for %q, got %v", tt.expected, tt.query, ids)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/transactions?include_archived=maybe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid include_archived, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestUpdateTransactionHandler_Notes(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	c.SetTransaction("stripe_1", entities.Transaction{ID: "stripe_1", Source: "stripe"}, 1*time.Hour)
+	notFound := &fakeLookupClient{err: fmt.Errorf("%w: missing", interfaces.ErrTransactionNotFound)}
+	service := services.NewTransactionService(repository.NewTransactionRepository(c, notFound, nil, nil))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/transactions", TransactionsHandler(service)).Methods("GET")
+	router.HandleFunc("/v1/transactions/{id:.*}", TransactionByIDHandler(service, zap.NewNop())).Methods("GET")
+	router.HandleFunc("/v1/transactions/{id:.*}", UpdateTransactionHandler(service, zap.NewNop())).Methods("PATCH")
+
+	patch := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("PATCH", path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := patch("/v1/transactions/stripe_1", `{"notes": "  Guest paid extra for late checkout "}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	// The note shows up in both the single-get and the listing
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/transactions/stripe_1", nil))
+	var transaction entities.Transaction
+	if err := json.Unmarshal(rec.Body.Bytes(), &transaction); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if transaction.Notes == nil || *transaction.Notes != "Guest paid extra for late checkout" {
+		t.Errorf("Expected the trimmed note on the transaction, got %v", transaction.Notes)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/transactions", nil))
+	var page TransactionsPageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(page.Transactions) != 1 || page.Transactions[0].Notes == nil {
+		t.Errorf("Expected the note in the listing, got %+v", page.Transactions)
+	}
+
+	// An empty note removes it
+	rec = patch("/v1/transactions/stripe_1", `{"notes": ""}`)
+	var cleared entities.Transaction
+	if err := json.Unmarshal(rec.Body.Bytes(), &cleared); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rec.Code != http.StatusOK || cleared.Notes != nil {
+		t.Errorf("Expected the note to be removed, got status %d and %v", rec.Code, cleared.Notes)
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		body         string
+		expectedCode int
+	}{
+		{"missing notes", "/v1/transactions/stripe_1", `{}`, http.StatusBadRequest},
+		{"too long", "/v1/transactions/stripe_1", `{"notes": "` + strings.Repeat("å", consts.TRANSACTION_NOTES_MAX_LENGTH+1) + `"}`, http.StatusBadRequest},
+		{"invalid body", "/v1/transactions/stripe_1", `{"notes":`, http.StatusBadRequest},
+		{"unknown transaction", "/v1/transactions/missing", `{"notes": "test"}`, http.StatusNotFound},
+		{"at max length", "/v1/transactions/stripe_1", `{"notes": "` + strings.Repeat("å", consts.TRANSACTION_NOTES_MAX_LENGTH) + `"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := patch(tt.path, tt.body); rec.Code != tt.expectedCode {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedCode, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if _, found := c.GetAnnotation("missing"); found {
+		t.Error("Expected no annotation to be written for an unknown transaction")
+	}
+}
+
+func TestTransactionsHandler_ETag(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	c.SetTransaction("stripe_1", entities.Transaction{ID: "stripe_1", Source: "stripe", Amount: 100}, 1*time.Hour)
+	handler := TransactionsHandler(services.NewTransactionService(repository.NewTransactionRepository(c, nil, nil, nil)))
+
+	get := func(query, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/transactions"+query, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	rec := get("", "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("Expected 200 with a weak ETag, got %d and %q", rec.Code, etag)
+	}
+
+	if rec := get("", etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("Expected 304 without a body for an unchanged listing, got %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+
+	// A different filter gives a different result and ETag
+	if rec := get("?source=vipps", etag); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a differently filtered listing, got %d", rec.Code)
+	}
+
+	c.SetTransaction("stripe_2", entities.Transaction{ID: "stripe_2", Source: "stripe", Amount: 200}, 1*time.Hour)
+	rec = get("", etag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("Expected 200 with a new ETag after the cache changed, got %d and %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestTransactionsHandler_Limit(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	for i := range 3 {
+		id := fmt.Sprintf("stripe_%d", i)
+		c.SetTransaction(id, entities.Transaction{ID: id, Source: "stripe"}, 1*time.Hour)
+	}
+	service := services.NewTransactionService(repository.NewTransactionRepository(c, nil, nil, nil))
+
+	tests := []struct {
+		query         string
+		expectedLimit int
+		expectedCount int
+	}{
+		{"", consts.TRANSACTION_LIMIT_DEFAULT, 3},
+		{"?limit=2", 2, 2},
+		{fmt.Sprintf("?limit=%d", consts.TRANSACTION_LIMIT_MAX+1), consts.TRANSACTION_LIMIT_MAX, 3},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		TransactionsHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions"+tt.query, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for %q, got %d", http.StatusOK, tt.query, rec.Code)
+		}
+		var response TransactionsPageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Limit != tt.expectedLimit || len(response.Transactions) != tt.expectedCount {
+			t.Errorf("Expected limit %d and %d transactions for %q, got %d and %d",
+				tt.expectedLimit, tt.expectedCount, tt.query, response.Limit, len(response.Transactions))
+		}
+	}
+
+	for _, query := range []string{"?limit=abc", "?limit=-1", "?limit=0", "?limit=2.5"} {
+		rec := httptest.NewRecorder()
+		TransactionsHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %q, got %d", http.StatusBadRequest, query, rec.Code)
+		}
+	}
+}
+
+func TestRevenueTimeseriesHandler(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	// Just after midnight in Oslo, still the previous day in UTC
+	c.SetTransaction("vipps_1", entities.Transaction{
+		ID: "vipps_1", Source: "vipps", Status: "succeeded", Amount: 300, CreatedAt: time.Date(2025, 6, 30, 22, 30, 0, 0, time.UTC),
+	}, 1*time.Hour)
+	service := services.NewTransactionService(repository.NewTransactionRepository(c, nil, nil, nil), services.WithReportLocation(oslo))
+	handler := RevenueTimeseriesHandler(service, zap.NewNop())
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/v1/reports/timeseries?interval=month&from=2025-06-01&to=2025-07-31", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var report entities.RevenueTimeseriesReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(report.Buckets) != 2 || report.Buckets[0].Count != 0 || report.Buckets[1].Count != 1 {
+		t.Errorf("Expected the transaction in July only, got %+v", report.Buckets)
+	}
+
+	for _, query := range []string{"?interval=year&from=2025-06-01&to=2025-06-30", "?from=2025-06-01", "?from=2025-06-30&to=2025-06-01"} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("GET", "/v1/reports/timeseries"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %q, got %d", http.StatusBadRequest, query, rec.Code)
+		}
+	}
+}
+
+func TestSearchTransactionsHandler(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	c.SetTransaction("vipps_1", entities.Transaction{ID: "vipps_1", ExternalID: "ORDER-42"}, 1*time.Hour)
+	c.SetTransaction("vipps_2", entities.Transaction{ID: "vipps_2", ExternalID: "ORDER-43"}, 1*time.Hour)
+	service := services.NewTransactionService(repository.NewTransactionRepository(c, nil, nil, nil))
+
+	rec := httptest.NewRecorder()
+	SearchTransactionsHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions/search?q=order-42", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response TransactionsPageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Transactions) != 1 || response.Transactions[0].ID != "vipps_1" {
+		t.Errorf("Expected only vipps_1, got %v", response.Transactions)
+	}
+
+	rec = httptest.NewRecorder()
+	SearchTransactionsHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions/search?q=+", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without a query, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+// fakeListClient is a provider client whose listings return a fixed result
+type fakeListClient struct {
+	transactions []entities.Transaction
+	err          error
+}
+
+func (f *fakeListClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
+	return f.transactions, f.err
+}
+
+func (f *fakeListClient) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
+	return entities.Transaction{}, interfaces.ErrTransactionNotFound
+}
+
+func TestTransactionsHandler_PartialProviderFailure(t *testing.T) {
+	stripe := &fakeListClient{transactions: []entities.Transaction{{ID: "stripe_1", Source: "stripe"}}}
+	failing := &fakeListClient{err: errors.New("connection refused")}
+	service := services.NewTransactionService(repository.NewTransactionRepository(
+		cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), stripe, nil, failing))
+
+	rec := httptest.NewRecorder()
+	TransactionsHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var response TransactionsPageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Transactions) != 1 || response.Transactions[0].ID != "stripe_1" {
+		t.Errorf("Expected the Stripe transaction, got %v", response.Transactions)
+	}
+	if len(response.Warnings) != 1 || response.Warnings[0].Source != "zettle" {
+		t.Errorf("Expected a single Zettle warning, got %v", response.Warnings)
+	}
+}
+
+func TestTransactionsHandler_AllProvidersFailed(t *testing.T) {
+	failing := &fakeListClient{err: errors.New("connection refused")}
+	service := services.NewTransactionService(repository.NewTransactionRepository(
+		cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), failing, failing, nil))
+
+	rec := httptest.NewRecorder()
+	TransactionsHandler(service)(rec, httptest.NewRequest("GET", "/v1/transactions", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got %d", http.StatusBadGateway, rec.Code)
+	}
+}
+
+func TestRefreshCacheHandler(t *testing.T) {
+	stripe := &fakeListClient{transactions: []entities.Transaction{{ID: "stripe_1", Source: "stripe"}}}
+	service := services.NewTransactionService(repository.NewTransactionRepository(
+		cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), stripe, nil, nil, repository.WithRefreshCooldown(time.Hour)))
+
+	for i, expectCached := range []bool{false, true} {
+		rec := httptest.NewRecorder()
+		RefreshCacheHandler(service)(rec, httptest.NewRequest("POST", "/v1/transactions/refresh-cache", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Refresh %d: expected status %d, got %d", i, http.StatusOK, rec.Code)
+		}
+
+		var response RefreshCacheResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Cached != expectCached || response.Transactions != 1 {
+			t.Errorf("Refresh %d: expected cached=%v with 1 transaction, got %+v", i, expectCached, response)
+		}
+	}
+
+	failing := &fakeListClient{err: errors.New("connection refused")}
+	failingService := services.NewTransactionService(repository.NewTransactionRepository(
+		cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), failing, nil, nil))
+	rec := httptest.NewRecorder()
+	RefreshCacheHandler(failingService)(rec, httptest.NewRequest("POST", "/v1/transactions/refresh-cache", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected status %d when every provider fails, got %d", http.StatusBadGateway, rec.Code)
+	}
+}
+
+func TestRefreshTransactionHandler(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	c.SetTransaction("vipps_internal_order/1", entities.Transaction{ID: "vipps_internal_order/1", Status: "pending"}, 1*time.Hour)
+
+	tests := []struct {
+		name           string
+		client         interfaces.Transactions
+		expectedStatus int
+	}{
+		{"not found at provider", &fakeLookupClient{err: fmt.Errorf("%w: missing", interfaces.ErrTransactionNotFound)}, http.StatusNotFound},
+		{"provider unreachable", &fakeLookupClient{err: errors.New("connection refused")}, http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := services.NewTransactionService(repository.NewTransactionRepository(c, tt.client, nil, nil))
+			router := mux.NewRouter()
+			router.HandleFunc("/v1/transactions/{id:.*}/refresh", RefreshTransactionHandler(service, zap.NewNop())).Methods("POST")
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/transactions/vipps_internal_order/1/refresh", nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/rogerwesterbo/svennescamping-backend/internal/middlewares"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
 	"go.uber.org/zap"
 )
@@ -11,6 +12,7 @@ import (
 // UserHandler returns the authenticated user's information
 func UserHandler(logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
 		// Extract user from context (set by auth middleware)
 		user, ok := middlewares.GetUserFromContext(r.Context())
 		if !ok {
@@ -18,9 +20,7 @@ func UserHandler(logger *zap.Logger) http.HandlerFunc {
 				zap.String("path", r.URL.Path),
 				zap.String("method", r.Method),
 			)
-			httphelpers.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{
-				"error": "User information not available",
-			})
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeUserUnavailable, "User information not available")
 			return
 		}
 
@@ -49,3 +49,44 @@ func UserHandler(logger *zap.Logger) http.HandlerFunc {
 		)
 	}
 }
+
+// PermissionsResponse describes what the authenticated user is allowed to do
+type PermissionsResponse struct {
+	Role        entities.Role         `json:"role"`
+	RoleLevel   int                   `json:"role_level"`
+	HasAccess   bool                  `json:"has_access"`
+	Permissions []entities.Permission `json:"permissions"`
+}
+
+// PermissionsHandler returns the authenticated user's role and the permissions it grants,
+// so the frontend can gate UI without duplicating the permission map
+func PermissionsHandler(logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		user, ok := middlewares.GetUserFromContext(r.Context())
+		if !ok {
+			logger.Error("User not found in context",
+				zap.String("path", r.URL.Path),
+				zap.String("method", r.Method),
+			)
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeUserUnavailable, "User information not available")
+			return
+		}
+
+		permissions := append([]entities.Permission{}, entities.RolePermissions[user.Role]...)
+
+		response := PermissionsResponse{
+			Role:        user.Role,
+			RoleLevel:   user.Role.Level(),
+			HasAccess:   user.HasAccess(),
+			Permissions: permissions,
+		}
+
+		if err := httphelpers.RespondWithJSON(w, http.StatusOK, response); err != nil {
+			logger.Error("Failed to send permissions response",
+				zap.Error(err),
+				zap.String("userID", user.ID),
+			)
+		}
+	}
+}
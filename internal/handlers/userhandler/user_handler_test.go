@@ -0,0 +1,92 @@
+package userhandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/middlewares"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"go.uber.org/zap"
+)
+
+// requestAs builds a request carrying the given user, as the auth middleware would
+func requestAs(user *entities.User) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/v1/user/permissions", nil)
+	return req.WithContext(context.WithValue(req.Context(), middlewares.UserKey, user))
+}
+
+func TestPermissionsHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		role      entities.Role
+		hasAccess bool
+		allowed   []entities.Permission
+		denied    []entities.Permission
+	}{
+		{
+			name:      "admin",
+			role:      entities.RoleAdmin,
+			hasAccess: true,
+			allowed:   []entities.Permission{entities.PermissionManageUsers, entities.PermissionRefreshTransactions},
+		},
+		{
+			name:      "editor",
+			role:      entities.RoleEditor,
+			hasAccess: true,
+			allowed:   []entities.Permission{entities.PermissionReadTransactions, entities.PermissionRefreshTransactions},
+			denied:    []entities.Permission{entities.PermissionManageUsers},
+		},
+		{
+			name:      "no access",
+			role:      entities.RoleNoAccess,
+			hasAccess: false,
+			denied:    []entities.Permission{entities.PermissionReadOwnProfile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			PermissionsHandler(zap.NewNop())(rec, requestAs(&entities.User{ID: "1", Email: "someone@test.com", Role: tt.role}))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+
+			var response PermissionsResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if response.Role != tt.role || response.RoleLevel != tt.role.Level() || response.HasAccess != tt.hasAccess {
+				t.Errorf("Unexpected role info: %+v", response)
+			}
+			if response.Permissions == nil {
+				t.Error("Expected permissions to be a list, got null")
+			}
+			for _, p := range tt.allowed {
+				if !slices.Contains(response.Permissions, p) {
+					t.Errorf("Expected permission %s to be listed", p)
+				}
+			}
+			for _, p := range tt.denied {
+				if slices.Contains(response.Permissions, p) {
+					t.Errorf("Expected permission %s not to be listed", p)
+				}
+			}
+		})
+	}
+}
+
+func TestPermissionsHandler_MissingUser(t *testing.T) {
+	rec := httptest.NewRecorder()
+	PermissionsHandler(zap.NewNop())(rec, httptest.NewRequest(http.MethodGet, "/v1/user/permissions", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
@@ -0,0 +1,149 @@
+package webhookhandler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/clients/stripe"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/clients/vipps"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/services"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"github.com/spf13/viper"
+	stripego "github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/webhook"
+	"go.uber.org/zap"
+)
+
+// maxWebhookBodyBytes limits the size of webhook payloads we are willing to read
+const maxWebhookBodyBytes = 65536
+
+// StripeWebhookHandler receives Stripe events and writes charges into the cache immediately
+func StripeWebhookHandler(transactionService *services.TransactionService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		webhookSecret := viper.GetString(consts.STRIPE_WEBHOOKKEY)
+		if webhookSecret == "" {
+			logger.Error("Stripe webhook received but no webhook secret is configured")
+			httphelpers.RespondWithErrorCode(w, http.StatusServiceUnavailable, httphelpers.ErrorCodeWebhookNotConfigured, "Stripe webhook is not configured")
+			return
+		}
+
+		payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyBytes))
+		if err != nil {
+			logger.Warn("Failed to read Stripe webhook body", zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidRequestBody, "Failed to read request body")
+			return
+		}
+
+		// Verify the signature before trusting anything in the payload
+		event, err := webhook.ConstructEventWithOptions(payload, r.Header.Get("Stripe-Signature"), webhookSecret,
+			webhook.ConstructEventOptions{IgnoreAPIVersionMismatch: true})
+		if err != nil {
+			logger.Warn("Invalid Stripe webhook signature",
+				zap.String("remote_addr", r.RemoteAddr),
+				zap.Int("payload_size", len(payload)),
+				zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidSignature, "Invalid signature")
+			return
+		}
+
+		switch event.Type {
+		case "charge.succeeded", "charge.refunded":
+			var ch stripego.Charge
+			if err := json.Unmarshal(event.Data.Raw, &ch); err != nil {
+				logger.Warn("Failed to parse charge from Stripe webhook",
+					zap.String("event_id", event.ID),
+					zap.String("event_type", string(event.Type)),
+					zap.Error(err))
+				httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidWebhookPayload, "Invalid charge payload")
+				return
+			}
+
+			// Polling lists payment intents in payment_intent mode, so the charge must be stored under its intent
+			transaction := stripe.ChargeToTransaction(&ch)
+			if viper.GetString(consts.STRIPE_OBJECT_TYPE) == consts.STRIPE_OBJECT_TYPE_PAYMENT_INTENT {
+				transaction = stripe.ChargeToPaymentIntentTransaction(&ch)
+			}
+			if err := transactionService.UpsertTransaction(r.Context(), transaction); err != nil {
+				logger.Error("Failed to store transaction from Stripe webhook",
+					zap.String("event_id", event.ID),
+					zap.Error(err))
+				httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to store transaction")
+				return
+			}
+
+			logger.Info("Stored transaction from Stripe webhook",
+				zap.String("event_id", event.ID),
+				zap.String("event_type", string(event.Type)),
+				zap.String("transaction_id", transaction.ID),
+				zap.String("status", transaction.Status))
+		default:
+			// Acknowledge other events so Stripe doesn't keep retrying them
+			logger.Debug("Ignoring Stripe webhook event",
+				zap.String("event_id", event.ID),
+				zap.String("event_type", string(event.Type)))
+		}
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, map[string]bool{"received": true})
+		if err != nil {
+			logger.Error("Failed to send Stripe webhook response", zap.Error(err))
+		}
+	}
+}
+
+// VippsWebhookHandler receives Vipps ePayment webhook callbacks and upserts the payment into the cache
+func VippsWebhookHandler(transactionService *services.TransactionService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := httphelpers.RequestLogger(r, logger)
+		webhookSecret := viper.GetString(consts.VIPPS_WEBHOOK_SECRET)
+		if webhookSecret == "" {
+			logger.Error("Vipps webhook received but no webhook secret is configured")
+			httphelpers.RespondWithErrorCode(w, http.StatusServiceUnavailable, httphelpers.ErrorCodeWebhookNotConfigured, "Vipps webhook is not configured")
+			return
+		}
+
+		payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyBytes))
+		if err != nil {
+			logger.Warn("Failed to read Vipps webhook body", zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidRequestBody, "Failed to read request body")
+			return
+		}
+
+		if err := vipps.VerifyWebhookSignature(r, payload, webhookSecret); err != nil {
+			logger.Warn("Invalid Vipps webhook signature",
+				zap.String("remote_addr", r.RemoteAddr),
+				zap.Int("payload_size", len(payload)),
+				zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidSignature, "Invalid signature")
+			return
+		}
+
+		event, err := vipps.ParseWebhookEvent(payload)
+		if err != nil {
+			logger.Warn("Failed to parse Vipps webhook", zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusBadRequest, httphelpers.ErrorCodeInvalidWebhookPayload, "Invalid webhook payload")
+			return
+		}
+
+		// The event changes the cached payment, e.g. a refund counts against its amount
+		if err := transactionService.UpdateTransaction(r.Context(), event.TransactionID(), event.Apply); err != nil {
+			logger.Error("Failed to store transaction from Vipps webhook",
+				zap.String("external_id", event.Reference),
+				zap.Error(err))
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Failed to store transaction")
+			return
+		}
+
+		logger.Info("Stored transaction from Vipps webhook",
+			zap.String("transaction_id", event.TransactionID()),
+			zap.String("event", event.Name),
+			zap.Bool("success", event.Success))
+
+		err = httphelpers.RespondWithJSON(w, http.StatusOK, map[string]bool{"received": true})
+		if err != nil {
+			logger.Error("Failed to send Vipps webhook response", zap.Error(err))
+		}
+	}
+}
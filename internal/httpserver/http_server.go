@@ -1,56 +1,121 @@
 package httpserver
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/routes"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
+var (
+	serverMu sync.Mutex
+	server   *http.Server
+)
+
+// Start runs the HTTP server until Shutdown is called
 func Start() {
 	isDevelopment := viper.GetBool(consts.DEVELOPMENT)
 
-	// Initialize the global logger with colored output
-	err := logger.InitLogger(isDevelopment)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
-	}
-	defer logger.Sync()
-
 	router := mux.NewRouter()
 	// Setup routes with logger
 	routes.SetupRoutes(router, logger.GetLogger())
 
-	host := "localhost"
 	if isDevelopment {
 		logger.Info("Running in development mode")
 	} else {
 		logger.Info("Running in production mode")
-		host = ""
 	}
 
-	port := "8888"
-	url := fmt.Sprintf("%s:%s", host, port)
-	server := &http.Server{
-		Handler:      router,
-		Addr:         url,
-		ReadTimeout:  20 * time.Second, // Changed from Millisecond to Second
-		WriteTimeout: 20 * time.Second, // Changed from Millisecond to Second
+	address, err := listenAddress(isDevelopment)
+	if err != nil {
+		logger.Fatal("Invalid HTTP server configuration", zap.Error(err))
+	}
+
+	srv := newServer(router, address)
+
+	serverMu.Lock()
+	server = srv
+	serverMu.Unlock()
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		logger.Fatal("HTTP server failed to start", zap.String("address", address), zap.Error(err))
 	}
 
 	logger.Info("Starting HTTP server",
-		zap.String("address", url),
-		zap.String("port", port),
+		zap.String("address", listener.Addr().String()),
 		zap.Bool("development", isDevelopment),
 	)
 
-	if err := server.ListenAndServe(); err != nil {
+	// Serve returns ErrServerClosed as soon as Shutdown is called
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Fatal("HTTP server failed to start", zap.Error(err))
 	}
 }
+
+// newServer creates the HTTP server. Requests can wait on httphelpers.ShutdownSignal, which is closed when
+// Shutdown is called, so long-lived streams end instead of holding up the shutdown.
+func newServer(handler http.Handler, address string) *http.Server {
+	shuttingDown := make(chan struct{})
+	srv := &http.Server{
+		Handler:      handler,
+		Addr:         address,
+		ReadTimeout:  20 * time.Second, // Changed from Millisecond to Second
+		WriteTimeout: 20 * time.Second, // Changed from Millisecond to Second
+		BaseContext: func(net.Listener) context.Context {
+			return httphelpers.WithShutdown(context.Background(), shuttingDown)
+		},
+	}
+	srv.RegisterOnShutdown(sync.OnceFunc(func() { close(shuttingDown) }))
+	return srv
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests to finish.
+// When the context expires first, the remaining connections are closed forcibly.
+func Shutdown(ctx context.Context) error {
+	serverMu.Lock()
+	srv := server
+	serverMu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		if closeErr := srv.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+		return fmt.Errorf("failed to shut down HTTP server gracefully: %w", err)
+	}
+
+	return nil
+}
+
+// listenAddress builds the address to listen on from the HOST and PORT settings.
+// Without a HOST the server listens on localhost in development and on all interfaces in production.
+func listenAddress(isDevelopment bool) (string, error) {
+	host := viper.GetString(consts.HOST)
+	if host == "" && isDevelopment {
+		host = "localhost"
+	}
+
+	portValue := viper.GetString(consts.PORT)
+	port, err := strconv.Atoi(portValue)
+	if err != nil || port < 1 || port > 65535 {
+		return "", fmt.Errorf("invalid %s '%s': must be a number between 1 and 65535", consts.PORT, portValue)
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
@@ -0,0 +1,153 @@
+package httpserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"github.com/spf13/viper"
+)
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		name          string
+		host          string
+		port          string
+		isDevelopment bool
+		want          string
+		wantErr       bool
+	}{
+		{name: "development default host", port: "8888", isDevelopment: true, want: "localhost:8888"},
+		{name: "production default host", port: "8888", want: ":8888"},
+		{name: "configured host", host: "0.0.0.0", port: "9000", isDevelopment: true, want: "0.0.0.0:9000"},
+		{name: "non-numeric port", port: "http", wantErr: true},
+		{name: "port out of range", port: "70000", wantErr: true},
+		{name: "zero port", port: "0", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			viper.Set(consts.HOST, tc.host)
+			viper.Set(consts.PORT, tc.port)
+			t.Cleanup(viper.Reset)
+
+			got, err := listenAddress(tc.isDevelopment)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("listenAddress() = %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("listenAddress() error = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("listenAddress() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+// startTestServer serves a handler that takes the given time to respond and registers it for Shutdown
+func startTestServer(t *testing.T, delay time.Duration) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	srv := newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Like a stream, a request that takes long ends early when the server shuts down
+		if delay < 0 {
+			<-httphelpers.ShutdownSignal(r.Context())
+		}
+		time.Sleep(delay)
+		w.WriteHeader(http.StatusOK)
+	}), listener.Addr().String())
+	serverMu.Lock()
+	server = srv
+	serverMu.Unlock()
+	t.Cleanup(func() {
+		serverMu.Lock()
+		server = nil
+		serverMu.Unlock()
+	})
+
+	go srv.Serve(listener)
+	return "http://" + listener.Addr().String()
+}
+
+func TestShutdown_DrainsInFlightRequests(t *testing.T) {
+	url := startTestServer(t, 100*time.Millisecond)
+
+	result := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		result <- err
+	}()
+	time.Sleep(20 * time.Millisecond) // Let the request reach the handler
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if err := <-result; err != nil {
+		t.Errorf("Expected the in-flight request to complete, got %v", err)
+	}
+}
+
+func TestShutdown_Timeout(t *testing.T) {
+	url := startTestServer(t, 2*time.Second)
+
+	go func() {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Shutdown(ctx); err == nil {
+		t.Error("Expected an error when in-flight requests outlive the timeout")
+	}
+}
+
+func TestShutdown_EndsStreams(t *testing.T) {
+	url := startTestServer(t, -1)
+
+	result := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		result <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		t.Fatalf("Expected the stream to end on shutdown, got %v", err)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("Expected the stream to complete, got %v", err)
+	}
+}
+
+func TestShutdown_NotStarted(t *testing.T) {
+	if err := Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() error = %v, want nil before Start", err)
+	}
+}
@@ -3,15 +3,23 @@ package middlewares
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rogerwesterbo/svennescamping-backend/internal/services"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httpclienthelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/redacthelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -20,16 +28,44 @@ type UserContextKey string
 
 const UserKey UserContextKey = "user"
 
+// authRequestTimeout bounds each call to Google so a hung endpoint can't block requests
+const authRequestTimeout = 10 * time.Second
+
+// Google endpoints used to verify opaque access tokens, variables so tests can point them at a fake server
+var (
+	googleTokenInfoURL = "https://www.googleapis.com/oauth2/v1/tokeninfo"
+	googleUserInfoURL  = "https://www.googleapis.com/oauth2/v2/userinfo"
+)
+
+// googleUserInfoBackoff is the delay before the first userinfo retry, doubled per attempt. A variable so tests can shorten it.
+var googleUserInfoBackoff = 200 * time.Millisecond
+
+// errUserInfoTransient marks userinfo failures worth retrying: network errors, timeouts and server errors
+var errUserInfoTransient = errors.New("transient failure")
+
+// authHTTPClient is used for all calls to Google
+var authHTTPClient = httpclienthelpers.NewClient(authRequestTimeout)
+
+// SetHTTPClient replaces the HTTP client used for calls to Google. A nil client is ignored.
+func SetHTTPClient(httpClient *http.Client) {
+	if httpClient != nil {
+		authHTTPClient = httpClient
+	}
+}
+
 // Global role service instance (initialized after settings)
 var roleService *services.RoleService
 
-// InitializeRoleService initializes the role service after settings are loaded
+// InitializeRoleService initializes the role service after settings are loaded. It exits if the role settings are invalid.
 func InitializeRoleService() {
+	if _, err := services.DefaultRoleFromSettings(); err != nil {
+		logger.Fatal("Invalid role configuration", zap.Error(err))
+	}
 	roleService = services.NewRoleService()
 }
 
-// getRoleService returns the role service instance
-func getRoleService() *services.RoleService {
+// GetRoleService returns the role service instance
+func GetRoleService() *services.RoleService {
 	if roleService == nil {
 		// Fallback: create a new instance if not initialized (shouldn't happen in normal flow)
 		roleService = services.NewRoleService()
@@ -37,58 +73,56 @@ func getRoleService() *services.RoleService {
 	return roleService
 }
 
-// AuthMiddleware verifies Google OAuth access tokens
+// AuthMiddleware verifies Google OAuth access tokens and Google-signed ID tokens
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Extract the Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			logger.Warn("Missing Authorization header",
+			logger.WithContext(r.Context()).Warn("Missing Authorization header",
 				zap.String("path", r.URL.Path),
 				zap.String("method", r.Method),
 			)
-			httphelpers.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{
-				"error": "Missing Authorization header",
-			})
+			httphelpers.RespondWithErrorCode(w, http.StatusUnauthorized, httphelpers.ErrorCodeMissingAuthorization, "Missing Authorization header")
 			return
 		}
 
 		// Check if the header starts with "Bearer "
 		if !strings.HasPrefix(authHeader, "Bearer ") {
-			logger.Warn("Invalid Authorization header format",
+			logger.WithContext(r.Context()).Warn("Invalid Authorization header format",
 				zap.String("path", r.URL.Path),
 				zap.String("method", r.Method),
 			)
-			httphelpers.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{
-				"error": "Invalid Authorization header format",
-			})
+			httphelpers.RespondWithErrorCode(w, http.StatusUnauthorized, httphelpers.ErrorCodeInvalidAuthorization, "Invalid Authorization header format")
 			return
 		}
 
 		// Extract the token
 		accessToken := strings.TrimPrefix(authHeader, "Bearer ")
 		if accessToken == "" {
-			logger.Warn("Empty access token",
+			logger.WithContext(r.Context()).Warn("Empty access token",
 				zap.String("path", r.URL.Path),
 				zap.String("method", r.Method),
 			)
-			httphelpers.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{
-				"error": "Empty access token",
-			})
+			httphelpers.RespondWithErrorCode(w, http.StatusUnauthorized, httphelpers.ErrorCodeInvalidAuthorization, "Empty access token")
 			return
 		}
 
-		// Verify the token with Google
-		user, err := verifyGoogleAccessToken(accessToken)
+		// ID tokens (JWTs) are verified offline; opaque access tokens with Google, or from a cached verification
+		var user *entities.User
+		var err error
+		if isJWT(accessToken) {
+			user, err = authenticateIDToken(r.Context(), accessToken)
+		} else {
+			user, err = authenticateAccessToken(r.Context(), accessToken)
+		}
 		if err != nil {
-			logger.Warn("Token verification failed",
+			logger.WithContext(r.Context()).Warn("Token verification failed",
 				zap.String("path", r.URL.Path),
 				zap.String("method", r.Method),
 				zap.Error(err),
 			)
-			httphelpers.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{
-				"error": "Invalid or expired access token",
-			})
+			httphelpers.RespondWithErrorCode(w, http.StatusUnauthorized, httphelpers.ErrorCodeInvalidToken, "Invalid or expired access token")
 			return
 		}
 
@@ -96,7 +130,7 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		ctx := context.WithValue(r.Context(), UserKey, user)
 		r = r.WithContext(ctx)
 
-		logger.Info("User authenticated successfully",
+		logger.WithContext(r.Context()).Info("User authenticated successfully",
 			zap.String("userID", user.ID),
 			zap.String("email", user.Email),
 			zap.String("path", r.URL.Path),
@@ -107,32 +141,38 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// verifyGoogleAccessToken verifies the access token with Google's tokeninfo endpoint
-func verifyGoogleAccessToken(accessToken string) (*entities.User, error) {
+// verifyGoogleAccessToken verifies the access token with Google's tokeninfo endpoint.
+// It also returns how long the token remains valid.
+func verifyGoogleAccessToken(ctx context.Context, accessToken string) (*entities.User, time.Duration, error) {
 	// Use Google's tokeninfo endpoint to verify the access token
-	url := fmt.Sprintf("https://www.googleapis.com/oauth2/v1/tokeninfo?access_token=%s", accessToken)
+	tokenInfoURL := googleTokenInfoURL + "?access_token=" + url.QueryEscape(accessToken)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenInfoURL, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
 
-	resp, err := http.Get(url)
+	resp, err := authHTTPClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to verify token: %w", err)
+		return nil, 0, fmt.Errorf("failed to verify token: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("token verification failed: status %d, body: %s", resp.StatusCode, string(body))
+		return nil, 0, fmt.Errorf("token verification failed: status %d, body: %s", resp.StatusCode, redacthelpers.Redact(string(body)))
 	}
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read verification response: %w", err)
+		return nil, 0, fmt.Errorf("failed to read verification response: %w", err)
 	}
 
 	// Parse the tokeninfo response
 	var tokenInfo map[string]interface{}
 	if err := json.Unmarshal(body, &tokenInfo); err != nil {
-		return nil, fmt.Errorf("failed to parse token info: %w", err)
+		return nil, 0, fmt.Errorf("failed to parse token info: %w", err)
 	}
 
 	// Extract user information from tokeninfo
@@ -144,39 +184,79 @@ func verifyGoogleAccessToken(accessToken string) (*entities.User, error) {
 
 	// If we have a user_id but no email, try to get user profile from Google+ API
 	if user.ID != "" {
-		// Try to get additional user info using the access token
-		userInfo, err := getUserInfoFromGoogle(accessToken)
+		// Try to get additional user info using the access token. Without it the user may have no email,
+		// so no role, but the token itself is valid.
+		userInfo, err := getUserInfoWithRetry(ctx, accessToken)
 		if err == nil {
 			user.Email = userInfo.Email
 			user.Name = userInfo.Name
 			user.Picture = userInfo.Picture
+		} else {
+			logger.WithContext(ctx).Warn("Failed to get Google user info, continuing with the token info only",
+				zap.String("user_id", user.ID),
+				zap.Bool("has_email", user.Email != ""),
+				zap.Error(err),
+			)
 		}
 	}
 
-	// Assign role based on user information
-	user.Role = getRoleService().GetUserRole(user)
+	expiresIn := time.Duration(getIntFromMap(tokenInfo, "expires_in")) * time.Second
 
-	return user, nil
+	return user, expiresIn, nil
 }
 
-// getUserInfoFromGoogle fetches additional user information from Google's userinfo endpoint
-func getUserInfoFromGoogle(accessToken string) (*entities.User, error) {
-	url := "https://www.googleapis.com/oauth2/v2/userinfo"
+// getUserInfoWithRetry fetches user information from Google, retrying transient failures with a doubling backoff
+// up to GOOGLE_USERINFO_MAX_ATTEMPTS attempts in total
+func getUserInfoWithRetry(ctx context.Context, accessToken string) (*entities.User, error) {
+	maxAttempts := max(viper.GetInt(consts.GOOGLE_USERINFO_MAX_ATTEMPTS), 1)
+	backoff := googleUserInfoBackoff
 
-	req, err := http.NewRequest("GET", url, nil)
+	for attempt := 1; ; attempt++ {
+		userInfo, err := getUserInfoFromGoogle(ctx, accessToken)
+		if err == nil {
+			return userInfo, nil
+		}
+		if !errors.Is(err, errUserInfoTransient) || attempt >= maxAttempts {
+			return nil, fmt.Errorf("attempt %d of %d: %w", attempt, maxAttempts, err)
+		}
+
+		logger.WithContext(ctx).Debug("Retrying Google user info",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("attempt %d of %d: %w", attempt, maxAttempts, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// getUserInfoFromGoogle fetches additional user information from Google's userinfo endpoint
+func getUserInfoFromGoogle(ctx context.Context, accessToken string) (*entities.User, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, googleUserInfoURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := authHTTPClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user info: %w", err)
+		// A cancelled request is not retried, the caller gave up
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to get user info: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get user info: %w: %w", errUserInfoTransient, err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("failed to get user info: %w: status %d", errUserInfoTransient, resp.StatusCode)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("failed to get user info: status %d", resp.StatusCode)
 	}
@@ -217,6 +297,19 @@ func getStringFromMap(m map[string]interface{}, key string) string {
 	return ""
 }
 
+func getIntFromMap(m map[string]interface{}, key string) int {
+	if val, ok := m[key]; ok {
+		switch v := val.(type) {
+		case float64:
+			return int(v)
+		case string:
+			i, _ := strconv.Atoi(v)
+			return i
+		}
+	}
+	return 0
+}
+
 func getBoolFromMap(m map[string]interface{}, key string) bool {
 	if val, ok := m[key]; ok {
 		if b, ok := val.(bool); ok {
@@ -0,0 +1,192 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/spf13/viper"
+)
+
+// fakeGoogle points the Google endpoints at a test server and uses a client with the given timeout
+func fakeGoogle(t *testing.T, timeout time.Duration, handler http.HandlerFunc) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	previousTokenInfoURL, previousUserInfoURL, previousClient := googleTokenInfoURL, googleUserInfoURL, authHTTPClient
+	googleTokenInfoURL = server.URL + "/tokeninfo"
+	googleUserInfoURL = server.URL + "/userinfo"
+	SetHTTPClient(&http.Client{Timeout: timeout})
+
+	t.Cleanup(func() {
+		server.Close()
+		googleTokenInfoURL, googleUserInfoURL, authHTTPClient = previousTokenInfoURL, previousUserInfoURL, previousClient
+	})
+}
+
+func TestVerifyGoogleAccessToken(t *testing.T) {
+	fakeGoogle(t, time.Second, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tokeninfo":
+			if r.URL.Query().Get("access_token") != "valid-token" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"user_id": "1234", "email": "guest@example.com", "verified_email": true, "expires_in": 3599}`))
+		case "/userinfo":
+			if r.Header.Get("Authorization") != "Bearer valid-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"id": "1234", "email": "guest@example.com", "name": "Guest", "picture": "https://example.com/guest.png"}`))
+		}
+	})
+
+	user, expiresIn, err := verifyGoogleAccessToken(context.Background(), "valid-token")
+	if err != nil {
+		t.Fatalf("verifyGoogleAccessToken() error = %v", err)
+	}
+	if user.ID != "1234" || user.Email != "guest@example.com" || user.Name != "Guest" || !user.Verified {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+	if expiresIn != 3599*time.Second {
+		t.Errorf("Expected expiry of 3599s, got %v", expiresIn)
+	}
+
+	if _, _, err := verifyGoogleAccessToken(context.Background(), "invalid-token"); err == nil {
+		t.Error("Expected an error for a token Google rejects")
+	}
+}
+
+// userInfoRetries allows the given userinfo attempts without waiting between them
+func userInfoRetries(t *testing.T, attempts int) {
+	t.Helper()
+
+	previousBackoff, previousAttempts := googleUserInfoBackoff, viper.Get(consts.GOOGLE_USERINFO_MAX_ATTEMPTS)
+	googleUserInfoBackoff = time.Millisecond
+	viper.Set(consts.GOOGLE_USERINFO_MAX_ATTEMPTS, attempts)
+	t.Cleanup(func() {
+		googleUserInfoBackoff = previousBackoff
+		viper.Set(consts.GOOGLE_USERINFO_MAX_ATTEMPTS, previousAttempts)
+	})
+}
+
+func TestVerifyGoogleAccessToken_RetriesUserInfo(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int
+		failureStatus int
+		expectedCalls int32
+		expectedEmail string
+	}{
+		{"recovers from server errors", 2, http.StatusServiceUnavailable, 3, "staff@example.com"},
+		{"gives up after max attempts", 5, http.StatusBadGateway, 3, ""},
+		{"does not retry client errors", 5, http.StatusForbidden, 1, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userInfoRetries(t, 3)
+
+			var userInfoCalls atomic.Int32
+			fakeGoogle(t, time.Second, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/tokeninfo":
+					// Token info without the email, which only the userinfo endpoint has
+					w.Write([]byte(`{"user_id": "1234", "expires_in": 3599}`))
+				case "/userinfo":
+					if int(userInfoCalls.Add(1)) <= tt.failures {
+						w.WriteHeader(tt.failureStatus)
+						return
+					}
+					w.Write([]byte(`{"id": "1234", "email": "staff@example.com", "name": "Staff"}`))
+				}
+			})
+
+			user, _, err := verifyGoogleAccessToken(context.Background(), "valid-token")
+			if err != nil {
+				t.Fatalf("Expected the partial user on userinfo failures, got error %v", err)
+			}
+			if user.ID != "1234" || user.Email != tt.expectedEmail {
+				t.Errorf("Expected user 1234 with email %q, got %+v", tt.expectedEmail, user)
+			}
+			if userInfoCalls.Load() != tt.expectedCalls {
+				t.Errorf("Expected %d userinfo calls, got %d", tt.expectedCalls, userInfoCalls.Load())
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleAccessToken_ServerError(t *testing.T) {
+	fakeGoogle(t, time.Second, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	if _, _, err := verifyGoogleAccessToken(context.Background(), "valid-token"); err == nil {
+		t.Error("Expected an error when Google fails")
+	}
+}
+
+func TestVerifyGoogleAccessToken_SlowGoogle(t *testing.T) {
+	release := make(chan struct{})
+	fakeGoogle(t, 50*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(release)
+
+	start := time.Now()
+	if _, _, err := verifyGoogleAccessToken(context.Background(), "valid-token"); err == nil {
+		t.Error("Expected an error when Google doesn't respond in time")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the client timeout to stop the request, took %v", elapsed)
+	}
+}
+
+func TestVerifyGoogleAccessToken_ContextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	fakeGoogle(t, time.Minute, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, _, err := verifyGoogleAccessToken(ctx, "valid-token"); err == nil {
+		t.Error("Expected an error when the request context is cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected context cancellation to stop the request, took %v", elapsed)
+	}
+}
+
+func TestAuthMiddleware_UnauthorizedWhenGoogleFails(t *testing.T) {
+	fakeGoogle(t, time.Second, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	handler := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected the request not to reach the handler")
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/user", nil)
+	req.Header.Set("Authorization", "Bearer uncached-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
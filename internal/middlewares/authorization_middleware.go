@@ -15,27 +15,23 @@ func RequireRole(requiredRole entities.Role) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user, ok := GetUserFromContext(r.Context())
 			if !ok {
-				logger.Error("User not found in context for role check",
+				logger.WithContext(r.Context()).Error("User not found in context for role check",
 					zap.String("path", r.URL.Path),
 					zap.String("required_role", string(requiredRole)),
 				)
-				httphelpers.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{
-					"error": "Authentication required",
-				})
+				httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeAuthenticationRequired, "Authentication required")
 				return
 			}
 
 			if user.Role != requiredRole {
-				logger.Warn("Insufficient permissions",
+				logger.WithContext(r.Context()).Warn("Insufficient permissions",
 					zap.String("user_id", user.ID),
 					zap.String("user_email", user.Email),
 					zap.String("user_role", string(user.Role)),
 					zap.String("required_role", string(requiredRole)),
 					zap.String("path", r.URL.Path),
 				)
-				httphelpers.RespondWithJSON(w, http.StatusForbidden, map[string]string{
-					"error": "Insufficient permissions",
-				})
+				httphelpers.RespondWithErrorCode(w, http.StatusForbidden, httphelpers.ErrorCodeInsufficientPermissions, "Insufficient permissions")
 				return
 			}
 
@@ -50,27 +46,23 @@ func RequirePermission(requiredPermission entities.Permission) func(http.Handler
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user, ok := GetUserFromContext(r.Context())
 			if !ok {
-				logger.Error("User not found in context for permission check",
+				logger.WithContext(r.Context()).Error("User not found in context for permission check",
 					zap.String("path", r.URL.Path),
 					zap.String("required_permission", string(requiredPermission)),
 				)
-				httphelpers.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{
-					"error": "Authentication required",
-				})
+				httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeAuthenticationRequired, "Authentication required")
 				return
 			}
 
 			if !user.HasPermission(requiredPermission) {
-				logger.Warn("Insufficient permissions",
+				logger.WithContext(r.Context()).Warn("Insufficient permissions",
 					zap.String("user_id", user.ID),
 					zap.String("user_email", user.Email),
 					zap.String("user_role", string(user.Role)),
 					zap.String("required_permission", string(requiredPermission)),
 					zap.String("path", r.URL.Path),
 				)
-				httphelpers.RespondWithJSON(w, http.StatusForbidden, map[string]string{
-					"error": "Insufficient permissions",
-				})
+				httphelpers.RespondWithErrorCode(w, http.StatusForbidden, httphelpers.ErrorCodeInsufficientPermissions, "Insufficient permissions")
 				return
 			}
 
@@ -85,31 +77,27 @@ func RequireMinimumRole(minimumRole entities.Role) func(http.Handler) http.Handl
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user, ok := GetUserFromContext(r.Context())
 			if !ok {
-				logger.Error("User not found in context for minimum role check",
+				logger.WithContext(r.Context()).Error("User not found in context for minimum role check",
 					zap.String("path", r.URL.Path),
 					zap.String("minimum_role", string(minimumRole)),
 				)
-				httphelpers.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{
-					"error": "Authentication required",
-				})
+				httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeAuthenticationRequired, "Authentication required")
 				return
 			}
 
-			// Role hierarchy: admin > user > no_access
+			// Role hierarchy: admin > editor > user > no_access
 			userLevel := getRoleLevel(user.Role)
 			requiredLevel := getRoleLevel(minimumRole)
 
 			if userLevel < requiredLevel {
-				logger.Warn("Insufficient role level",
+				logger.WithContext(r.Context()).Warn("Insufficient role level",
 					zap.String("user_id", user.ID),
 					zap.String("user_email", user.Email),
 					zap.String("user_role", string(user.Role)),
 					zap.String("minimum_role", string(minimumRole)),
 					zap.String("path", r.URL.Path),
 				)
-				httphelpers.RespondWithJSON(w, http.StatusForbidden, map[string]string{
-					"error": "Insufficient permissions",
-				})
+				httphelpers.RespondWithErrorCode(w, http.StatusForbidden, httphelpers.ErrorCodeInsufficientPermissions, "Insufficient permissions")
 				return
 			}
 
@@ -124,25 +112,21 @@ func RequireAccess() func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user, ok := GetUserFromContext(r.Context())
 			if !ok {
-				logger.Error("User not found in context for access check",
+				logger.WithContext(r.Context()).Error("User not found in context for access check",
 					zap.String("path", r.URL.Path),
 				)
-				httphelpers.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{
-					"error": "Authentication required",
-				})
+				httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeAuthenticationRequired, "Authentication required")
 				return
 			}
 
 			if !user.HasAccess() {
-				logger.Warn("User has no access",
+				logger.WithContext(r.Context()).Warn("User has no access",
 					zap.String("user_id", user.ID),
 					zap.String("user_email", user.Email),
 					zap.String("user_role", string(user.Role)),
 					zap.String("path", r.URL.Path),
 				)
-				httphelpers.RespondWithJSON(w, http.StatusForbidden, map[string]string{
-					"error": "Access denied",
-				})
+				httphelpers.RespondWithErrorCode(w, http.StatusForbidden, httphelpers.ErrorCodeAccessDenied, "Access denied")
 				return
 			}
 
@@ -153,14 +137,5 @@ func RequireAccess() func(http.Handler) http.Handler {
 
 // getRoleLevel returns the numeric level of a role for hierarchy comparison
 func getRoleLevel(role entities.Role) int {
-	switch role {
-	case entities.RoleAdmin:
-		return 3
-	case entities.RoleUser:
-		return 2
-	case entities.RoleNoAccess:
-		return 1
-	default:
-		return 0
-	}
+	return role.Level()
 }
@@ -0,0 +1,63 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+func TestGetRoleLevel_Ordering(t *testing.T) {
+	ordered := []entities.Role{
+		entities.RoleNoAccess,
+		entities.RoleUser,
+		entities.RoleEditor,
+		entities.RoleAdmin,
+	}
+
+	for i := 1; i < len(ordered); i++ {
+		lower, higher := ordered[i-1], ordered[i]
+		if getRoleLevel(lower) >= getRoleLevel(higher) {
+			t.Errorf("Expected %s to rank below %s", lower, higher)
+		}
+	}
+
+	if getRoleLevel(entities.Role("unknown")) >= getRoleLevel(entities.RoleNoAccess) {
+		t.Error("Expected an unknown role to rank below no_access")
+	}
+}
+
+func TestRequireMinimumRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		minimum  entities.Role
+		role     entities.Role
+		expected int
+	}{
+		{"editor meets user minimum", entities.RoleUser, entities.RoleEditor, http.StatusOK},
+		{"editor meets editor minimum", entities.RoleEditor, entities.RoleEditor, http.StatusOK},
+		{"user below editor minimum", entities.RoleEditor, entities.RoleUser, http.StatusForbidden},
+		{"editor below admin minimum", entities.RoleAdmin, entities.RoleEditor, http.StatusForbidden},
+		{"admin meets editor minimum", entities.RoleEditor, entities.RoleAdmin, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireMinimumRole(tt.minimum)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			user := &entities.User{ID: "1", Email: "someone@test.com", Role: tt.role}
+			req = req.WithContext(context.WithValue(req.Context(), UserKey, user))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// MaxBodyBytes limits request bodies to limit bytes. Requests declaring a larger Content-Length are rejected with
+// 413 right away; for other requests reading past the limit fails, which handlers report as 413 with
+// httphelpers.RespondWithBodyError.
+func MaxBodyBytes(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				logger.WithContext(r.Context()).Warn("Request body too large",
+					zap.String("path", r.URL.Path),
+					zap.Int64("content_length", r.ContentLength),
+					zap.Int64("limit", limit),
+				)
+				httphelpers.RespondWithErrorCode(w, http.StatusRequestEntityTooLarge, httphelpers.ErrorCodeRequestTooLarge,
+					fmt.Sprintf("Request body must not be larger than %d bytes", limit))
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BodyLimitMiddleware limits request bodies to MAX_REQUEST_BODY_BYTES, falling back to the default when it is not positive
+func BodyLimitMiddleware() func(http.Handler) http.Handler {
+	limit := viper.GetInt64(consts.MAX_REQUEST_BODY_BYTES)
+	if limit <= 0 {
+		logger.Warn("Invalid maximum request body size, using default",
+			zap.String("key", consts.MAX_REQUEST_BODY_BYTES),
+			zap.Int64("value", limit),
+			zap.Int64("default", consts.MAX_REQUEST_BODY_BYTES_DEFAULT))
+		limit = consts.MAX_REQUEST_BODY_BYTES_DEFAULT
+	}
+	return MaxBodyBytes(limit)
+}
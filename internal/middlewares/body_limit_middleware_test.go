@@ -0,0 +1,60 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+)
+
+func TestMaxBodyBytes(t *testing.T) {
+	// Decodes the body like the JSON handlers do
+	handler := MaxBodyBytes(16)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			httphelpers.RespondWithBodyError(w, err, "Invalid request body")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		body           string
+		hideLength     bool
+		expectedStatus int
+	}{
+		{"within limit", `{"a":"b"}`, false, http.StatusOK},
+		{"declared too large", `{"a":"` + strings.Repeat("x", 32) + `"}`, false, http.StatusRequestEntityTooLarge},
+		// Chunked bodies have no Content-Length, so the limit applies while reading
+		{"read past limit", `{"a":"` + strings.Repeat("x", 32) + `"}`, true, http.StatusRequestEntityTooLarge},
+		{"invalid within limit", `not json`, false, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.hideLength {
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest("POST", "/v1/admin/assign-role", body)
+			if tt.hideLength {
+				req.ContentLength = -1
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus == http.StatusRequestEntityTooLarge && !strings.Contains(rec.Body.String(), httphelpers.ErrorCodeRequestTooLarge) {
+				t.Errorf("Expected error code %s, got %s", httphelpers.ErrorCodeRequestTooLarge, rec.Body.String())
+			}
+		})
+	}
+}
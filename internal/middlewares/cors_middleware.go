@@ -2,6 +2,7 @@ package middlewares
 
 import (
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
@@ -10,68 +11,134 @@ import (
 	"go.uber.org/zap"
 )
 
-// CORSMiddleware handles Cross-Origin Resource Sharing (CORS) headers
+// CORSConfig is the CORS policy of a group of routes
+type CORSConfig struct {
+	// Origins allowed to make requests, where "*" allows any origin
+	Origins []string
+	Methods []string
+	Headers []string
+	// AllowCredentials lets browsers send credentials. The request origin is then echoed instead of "*",
+	// which browsers reject for credentialed requests.
+	AllowCredentials bool
+}
+
+// CORSConfigFromSettings returns the policy for the authenticated API, read from CORS_ORIGINS, CORS_METHODS and
+// CORS_HEADERS. Credentials are allowed, since the API is called with an Authorization header.
+func CORSConfigFromSettings() CORSConfig {
+	return CORSConfig{
+		Origins:          splitCORSList(viper.GetString(consts.CORS_ORIGINS)),
+		Methods:          splitCORSList(viper.GetString(consts.CORS_METHODS)),
+		Headers:          splitCORSList(viper.GetString(consts.CORS_HEADERS)),
+		AllowCredentials: true,
+	}
+}
+
+// PublicCORSConfig returns the policy for public read-only routes such as /health, allowing the origins in
+// CORS_PUBLIC_ORIGINS without credentials
+func PublicCORSConfig() CORSConfig {
+	return CORSConfig{
+		Origins: splitCORSList(viper.GetString(consts.CORS_PUBLIC_ORIGINS)),
+		Methods: []string{http.MethodGet, http.MethodOptions},
+		Headers: splitCORSList(viper.GetString(consts.CORS_HEADERS)),
+	}
+}
+
+// CORSMiddleware handles Cross-Origin Resource Sharing (CORS) headers with a single policy read from the settings
+// on every request (see CORSConfigFromSettings). Routes needing distinct policies use CORSMiddlewareWithConfig.
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get allowed origins from environment variable
-		originsStr := viper.GetString(consts.CORS_ORIGINS)
-		origins := strings.Split(originsStr, ";")
+		CORSMiddlewareWithConfig(CORSConfigFromSettings())(next).ServeHTTP(w, r)
+	})
+}
 
-		// Trim whitespace from origins
-		for i, origin := range origins {
-			origins[i] = strings.TrimSpace(origin)
-		}
+// CORSMiddlewareWithConfig handles CORS headers with the given policy and answers preflight requests itself,
+// so it must run before middlewares that would reject them, such as authentication.
+// Any origin is only allowed when "*" is configured explicitly.
+func CORSMiddlewareWithConfig(cfg CORSConfig) func(http.Handler) http.Handler {
+	wildcard := slices.Contains(cfg.Origins, "*")
 
-		// Get the origin from the request
-		requestOrigin := r.Header.Get("Origin")
-
-		// Debug logging
-		logger.Debug("CORS check",
-			zap.String("requestOrigin", requestOrigin),
-			zap.Strings("allowedOrigins", origins),
-			zap.String("method", r.Method),
-			zap.String("path", r.URL.Path),
-		)
-
-		// Check if the request origin is allowed
-		allowedOrigin := ""
-		for _, origin := range origins {
-			if origin == requestOrigin || origin == "*" {
-				allowedOrigin = origin
-				break
-			}
-		}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Get the origin from the request
+			requestOrigin := r.Header.Get("Origin")
 
-		// Always set CORS headers regardless of origin for better compatibility
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Max-Age", "300") // Cache preflight response for 5 minutes
-
-		// Set CORS headers - always set the origin header for valid origins
-		if allowedOrigin != "" {
-			w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
-			logger.Debug("CORS allowed", zap.String("origin", allowedOrigin))
-		} else if requestOrigin != "" {
-			// Origin not allowed - log for debugging but still allow for development
-			logger.Warn("CORS rejected - origin not in allowed list",
-				zap.String("origin", requestOrigin),
-				zap.Strings("allowedOrigins", origins),
+			// Debug logging
+			logger.WithContext(r.Context()).Debug("CORS check",
+				zap.String("requestOrigin", requestOrigin),
+				zap.Strings("allowedOrigins", cfg.Origins),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
 			)
-			// For development, you might want to allow all origins temporarily
-			// Uncomment the next line if you want to allow all origins for debugging
-			// w.Header().Set("Access-Control-Allow-Origin", "*")
-		} else {
-			// No origin header (e.g., same-origin requests, Postman, curl)
-			logger.Debug("No origin header in request")
-		}
 
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+			// The response depends on the request origin, so caches must not share it between origins
+			w.Header().Add("Vary", "Origin")
+
+			// Always set CORS headers regardless of origin for better compatibility
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(cfg.Methods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(cfg.Headers, ", "))
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			w.Header().Set("Access-Control-Max-Age", "300") // Cache preflight response for 5 minutes
+
+			// With credentials, browsers reject "*" as the allowed origin, so the request origin is echoed instead,
+			// also when it is allowed through a wildcard. Disallowed origins get no allowed origin at all.
+			if cfg.allowsOrigin(requestOrigin) {
+				allowOrigin := requestOrigin
+				if wildcard && !cfg.AllowCredentials {
+					allowOrigin = "*"
+				}
+				w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+				logger.WithContext(r.Context()).Debug("CORS allowed", zap.String("origin", requestOrigin))
+			} else if requestOrigin != "" {
+				// Origin not allowed - log for debugging. List "*" in the origins to allow all origins.
+				logger.WithContext(r.Context()).Warn("CORS rejected - origin not in allowed list",
+					zap.String("origin", requestOrigin),
+					zap.Strings("allowedOrigins", cfg.Origins),
+				)
+			} else {
+				// No origin header (e.g., same-origin requests, Postman, curl)
+				logger.WithContext(r.Context()).Debug("No origin header in request")
+			}
+
+			// Handle preflight requests
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowsOrigin checks if the request origin is allowed by the policy
+func (cfg CORSConfig) allowsOrigin(requestOrigin string) bool {
+	if requestOrigin == "" {
+		return false
+	}
+
+	for _, origin := range cfg.Origins {
+		if origin == requestOrigin {
+			return true
+		}
+		// With credentials, the opaque "null" origin of sandboxed pages and local files must be listed explicitly
+		if origin == "*" && (requestOrigin != "null" || !cfg.AllowCredentials) {
+			return true
 		}
+	}
+	return false
+}
 
-		next.ServeHTTP(w, r)
-	})
+// splitCORSList splits a semicolon-separated setting, trimming whitespace and dropping empty entries
+// so a stray separator never allows an empty origin
+func splitCORSList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
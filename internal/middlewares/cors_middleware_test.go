@@ -0,0 +1,168 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/spf13/viper"
+)
+
+// setCORSConfig sets the CORS settings for a test, restoring the previous values afterwards
+func setCORSConfig(t *testing.T, origins, methods, headers string) {
+	t.Helper()
+
+	for key, value := range map[string]string{
+		consts.CORS_ORIGINS: origins,
+		consts.CORS_METHODS: methods,
+		consts.CORS_HEADERS: headers,
+	} {
+		previous := viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, previous) })
+	}
+}
+
+// serveCORS sends a request with the given method and Origin header (none when empty) through CORSMiddleware
+func serveCORS(method, origin string) *httptest.ResponseRecorder {
+	handler := CORSMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(method, "/v1/transactions", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORSMiddleware_ConfiguredMethodsAndHeaders(t *testing.T) {
+	setCORSConfig(t, "http://localhost:5173", " GET; PATCH ;;OPTIONS", "Content-Type;X-Client-Version")
+
+	rec := serveCORS("OPTIONS", "http://localhost:5173")
+
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, PATCH, OPTIONS" {
+		t.Errorf("Expected the configured methods, got %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, X-Client-Version" {
+		t.Errorf("Expected the configured headers, got %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "http://localhost:5173" {
+		t.Errorf("Expected the allowed origin, got %q", got)
+	}
+}
+
+func TestCORSMiddleware_WildcardOnlyWhenConfigured(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     string
+		expectAllow bool
+	}{
+		{"listed origin only", "http://localhost:5173", false},
+		// A trailing separator must not turn into an implicit wildcard
+		{"empty entries", "http://localhost:5173;;", false},
+		{"nothing configured", "", false},
+		{"explicit wildcard", "http://localhost:5173;*", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCORSConfig(t, tt.origins, "GET", "Content-Type")
+
+			rec := serveCORS("GET", "https://evil.example.com")
+			allowed := rec.Header().Get("Access-Control-Allow-Origin") != ""
+			if allowed != tt.expectAllow {
+				t.Errorf("Expected origin allowed to be %v, got header %q", tt.expectAllow, rec.Header().Get("Access-Control-Allow-Origin"))
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware_CredentialedOrigin(t *testing.T) {
+	tests := []struct {
+		name           string
+		origins        string
+		requestOrigin  string
+		expectedOrigin string
+	}{
+		{"listed origin is echoed", "http://localhost:5173;https://camping.example.com", "https://camping.example.com", "https://camping.example.com"},
+		// Credentials are allowed, so a wildcard must never be sent as "*"
+		{"wildcard echoes the origin", "*", "https://camping.example.com", "https://camping.example.com"},
+		{"origin not allowed", "http://localhost:5173", "https://evil.example.com", ""},
+		{"origin differing in scheme", "https://localhost:5173", "http://localhost:5173", ""},
+		{"no origin header", "*", "", ""},
+		{"null origin with wildcard", "*", "null", ""},
+		{"null origin listed", "null", "null", "null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCORSConfig(t, tt.origins, "GET", "Content-Type")
+
+			for _, method := range []string{"GET", "OPTIONS"} {
+				rec := serveCORS(method, tt.requestOrigin)
+
+				values, present := rec.Header()["Access-Control-Allow-Origin"]
+				if tt.expectedOrigin == "" && present {
+					t.Errorf("%s: expected no Access-Control-Allow-Origin header, got %q", method, values)
+				}
+				if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+					t.Errorf("%s: expected Access-Control-Allow-Origin %q, got %q", method, tt.expectedOrigin, got)
+				}
+				if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+					t.Errorf("%s: expected credentials to be allowed, got %q", method, got)
+				}
+				if got := rec.Header().Values("Vary"); !slices.Contains(got, "Origin") {
+					t.Errorf("%s: expected Vary: Origin, got %q", method, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware_KeepsExistingVary(t *testing.T) {
+	setCORSConfig(t, "*", "GET", "Content-Type")
+
+	handler := CORSMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Vary", "Accept-Encoding")
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if got := rec.Header().Values("Vary"); !slices.Equal(got, []string{"Accept-Encoding", "Origin"}) {
+		t.Errorf("Expected Vary to be extended, got %q", got)
+	}
+}
+
+func TestCORSMiddlewareWithConfig_WithoutCredentials(t *testing.T) {
+	handler := CORSMiddlewareWithConfig(CORSConfig{
+		Origins: []string{"*"},
+		Methods: []string{"GET", "OPTIONS"},
+		Headers: []string{"Content-Type"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, origin := range []string{"https://status.example.com", "null"} {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		// Without credentials a wildcard can be sent as is
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("Expected Access-Control-Allow-Origin * for %q, got %q", origin, got)
+		}
+		if _, present := rec.Header()["Access-Control-Allow-Credentials"]; present {
+			t.Errorf("Expected no Access-Control-Allow-Credentials header for %q", origin)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, OPTIONS" {
+			t.Errorf("Expected the configured methods, got %q", got)
+		}
+	}
+}
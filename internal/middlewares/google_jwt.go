@@ -0,0 +1,230 @@
+package middlewares
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/spf13/viper"
+)
+
+const (
+	googleJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+	// defaultJWKSCacheTTL is used when Google's response has no Cache-Control max-age
+	defaultJWKSCacheTTL = time.Hour
+	// minJWKSRefreshInterval limits refetching for unknown key IDs, so forged tokens can't flood Google
+	minJWKSRefreshInterval = time.Minute
+	// jwtClockSkew tolerates small clock differences when checking expiry
+	jwtClockSkew = time.Minute
+)
+
+// googleIssuers are the issuers Google uses for ID tokens
+var googleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+var maxAgePattern = regexp.MustCompile(`max-age=(\d+)`)
+
+// isJWT reports whether a bearer token is a JWT (three base64url segments) rather than an opaque access token
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// jwksCache holds Google's public signing keys, refetched when they expire or an unknown key ID shows up
+type jwksCache struct {
+	mu          sync.Mutex
+	url         string
+	keys        map[string]*rsa.PublicKey
+	expiresAt   time.Time
+	lastFetched time.Time
+}
+
+// googleKeys caches Google's ID token signing keys
+var googleKeys = &jwksCache{url: googleJWKSURL}
+
+// key returns the public key with the given key ID
+func (c *jwksCache) key(ctx context.Context, kid string, now time.Time) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, known := c.keys[kid]
+	expired := now.After(c.expiresAt)
+	// Google rotates keys, so an unknown key ID may be new; refetch, but not too often
+	if expired || (!known && now.Sub(c.lastFetched) >= minJWKSRefreshInterval) {
+		if err := c.refresh(ctx, now); err != nil {
+			if known {
+				// Keep using the known key while Google is unreachable
+				return key, nil
+			}
+			return nil, err
+		}
+		key, known = c.keys[kid]
+	}
+
+	if !known {
+		return nil, fmt.Errorf("unknown signing key '%s'", kid)
+	}
+	return key, nil
+}
+
+// refresh fetches the key set. Must be called with mu held.
+func (c *jwksCache) refresh(ctx context.Context, now time.Time) error {
+	c.lastFetched = now
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := authHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch signing keys: status %d", resp.StatusCode)
+	}
+
+	var keySet struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&keySet); err != nil {
+		return fmt.Errorf("failed to parse signing keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		key, err := parseRSAPublicKey(jwk.N, jwk.E)
+		if err != nil {
+			return fmt.Errorf("invalid signing key '%s': %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+
+	ttl := defaultJWKSCacheTTL
+	if match := maxAgePattern.FindStringSubmatch(resp.Header.Get("Cache-Control")); match != nil {
+		if seconds, err := strconv.Atoi(match[1]); err == nil {
+			ttl = time.Duration(seconds) * time.Second
+		}
+	}
+
+	c.keys = keys
+	c.expiresAt = now.Add(ttl)
+	return nil
+}
+
+// parseRSAPublicKey builds an RSA public key from the base64url-encoded JWK modulus and exponent
+func parseRSAPublicKey(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	exponent, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(modulus),
+		E: int(new(big.Int).SetBytes(exponent).Int64()),
+	}, nil
+}
+
+// verifyGoogleIDToken verifies a Google-signed ID token offline and returns its claims.
+// The signature is checked against Google's published keys, and iss, aud and exp are validated.
+func verifyGoogleIDToken(ctx context.Context, token string, clientID string, keys *jwksCache, now time.Time) (*entities.GoogleTokenClaims, error) {
+	if clientID == "" {
+		return nil, fmt.Errorf("%s is not configured, cannot verify ID tokens", consts.GOOGLE_CLIENT_ID)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed ID token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid ID token header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported ID token algorithm '%s'", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token signature: %w", err)
+	}
+
+	key, err := keys.key(ctx, header.Kid, now)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("invalid ID token signature: %w", err)
+	}
+
+	var claims entities.GoogleTokenClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token claims: %w", err)
+	}
+
+	if !slices.Contains(googleIssuers, claims.Issuer) {
+		return nil, fmt.Errorf("unexpected ID token issuer '%s'", claims.Issuer)
+	}
+	if claims.Audience != clientID {
+		return nil, fmt.Errorf("ID token was issued for another client")
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(jwtClockSkew)) {
+		return nil, fmt.Errorf("ID token expired")
+	}
+
+	return &claims, nil
+}
+
+// decodeJWTSegment decodes a base64url-encoded JSON segment of a JWT
+func decodeJWTSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// authenticateIDToken returns the user for a Google ID token verified offline
+func authenticateIDToken(ctx context.Context, token string) (*entities.User, error) {
+	claims, err := verifyGoogleIDToken(ctx, token, viper.GetString(consts.GOOGLE_CLIENT_ID), googleKeys, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	user := claims.ToUser()
+	user.Role = GetRoleService().GetUserRole(user)
+	return user, nil
+}
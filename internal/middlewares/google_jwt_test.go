@@ -0,0 +1,157 @@
+package middlewares
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testClientID = "test-client.apps.googleusercontent.com"
+
+// newTestJWKS serves the public part of a new RSA key under the key ID "test-key"
+func newTestJWKS(t *testing.T) (*rsa.PrivateKey, *jwksCache, *atomic.Int32) {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "public, max-age=600")
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": "test-key",
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return privateKey, &jwksCache{url: server.URL}, &fetches
+}
+
+// signTestJWT creates an RS256 JWT with the given header and claims
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, header, claims map[string]any) string {
+	t.Helper()
+
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to encode JWT segment: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signingInput := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign JWT: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyGoogleIDToken(t *testing.T) {
+	privateKey, keys, fetches := newTestJWKS(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	validHeader := map[string]any{"alg": "RS256", "kid": "test-key"}
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"sub":            "1234",
+			"email":          "guest@example.com",
+			"email_verified": true,
+			"aud":            testClientID,
+			"iss":            "https://accounts.google.com",
+			"exp":            now.Add(time.Hour).Unix(),
+		}
+	}
+	withClaim := func(key string, value any) map[string]any {
+		claims := validClaims()
+		claims[key] = value
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", signTestJWT(t, privateKey, validHeader, validClaims()), ""},
+		{"wrong audience", signTestJWT(t, privateKey, validHeader, withClaim("aud", "other-client")), "another client"},
+		{"wrong issuer", signTestJWT(t, privateKey, validHeader, withClaim("iss", "https://evil.example.com")), "issuer"},
+		{"expired", signTestJWT(t, privateKey, validHeader, withClaim("exp", now.Add(-time.Hour).Unix())), "expired"},
+		{"signed by another key", signTestJWT(t, otherKey, validHeader, validClaims()), "signature"},
+		{"unknown key ID", signTestJWT(t, privateKey, map[string]any{"alg": "RS256", "kid": "other"}, validClaims()), "unknown signing key"},
+		{"unsigned", signTestJWT(t, privateKey, map[string]any{"alg": "none", "kid": "test-key"}, validClaims()), "algorithm"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := verifyGoogleIDToken(context.Background(), tc.token, testClientID, keys, now)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyGoogleIDToken(context.Background(), ) error = %v", err)
+			}
+
+			user := claims.ToUser()
+			if user.ID != "1234" || user.Email != "guest@example.com" || !user.Verified {
+				t.Errorf("Unexpected user: %+v", user)
+			}
+		})
+	}
+
+	// The key set is cached, and unknown key IDs refetch it at most once a minute
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("Expected 1 key set fetch, got %d", got)
+	}
+
+	unknownKeyToken := signTestJWT(t, privateKey, map[string]any{"alg": "RS256", "kid": "rotated"}, validClaims())
+	verifyGoogleIDToken(context.Background(), unknownKeyToken, testClientID, keys, now.Add(minJWKSRefreshInterval))
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("Expected an unknown key ID to refetch the key set after a minute, got %d fetches", got)
+	}
+}
+
+func TestVerifyGoogleIDToken_MissingClientID(t *testing.T) {
+	privateKey, keys, _ := newTestJWKS(t)
+	token := signTestJWT(t, privateKey, map[string]any{"alg": "RS256", "kid": "test-key"}, map[string]any{})
+
+	if _, err := verifyGoogleIDToken(context.Background(), token, "", keys, time.Now()); err == nil {
+		t.Error("Expected an error when no client ID is configured")
+	}
+}
+
+func TestIsJWT(t *testing.T) {
+	if !isJWT("header.claims.signature") {
+		t.Error("Expected a three-segment token to be a JWT")
+	}
+	if isJWT("ya29.a0AfH6SMBx") {
+		t.Error("Expected an opaque access token not to be a JWT")
+	}
+}
@@ -11,11 +11,11 @@ import (
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		logger.Info(fmt.Sprintf("Started %s %s", r.Method, r.URL.Path))
+		logger.WithContext(r.Context()).Info(fmt.Sprintf("Started %s %s", r.Method, r.URL.Path))
 
 		// Call the next handler
 		next.ServeHTTP(w, r)
 
-		logger.Info(fmt.Sprintf("Completed %s in %v", r.URL.Path, time.Since(start)))
+		logger.WithContext(r.Context()).Info(fmt.Sprintf("Completed %s in %v", r.URL.Path, time.Since(start)))
 	})
 }
@@ -0,0 +1,277 @@
+package middlewares
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// minIdleBucketTTL is the shortest time a bucket is kept after its last request
+const minIdleBucketTTL = time.Minute
+
+// RateLimiter is a token bucket rate limiter with one bucket per client key.
+// Buckets that have been idle long enough to refill completely are evicted, so memory stays bounded
+// by the number of recently active clients.
+type RateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // Tokens added per second
+	burst     float64 // Bucket capacity
+	idleTTL   time.Duration
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+
+	// Proxies whose forwarded client IP is used instead of the remote address
+	trustedProxies []netip.Prefix
+}
+
+// RateLimiterOption configures optional behavior on a RateLimiter
+type RateLimiterOption func(*RateLimiter)
+
+// WithTrustedProxies limits requests from the given proxies by the client IP they forward in
+// X-Forwarded-For or X-Real-IP, instead of by the proxy's own address
+func WithTrustedProxies(proxies []netip.Prefix) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.trustedProxies = proxies
+	}
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// NewRateLimiter creates a rate limiter allowing rps requests per second per key with bursts of up to burst requests
+func NewRateLimiter(rps float64, burst int, opts ...RateLimiterOption) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	// A bucket idle for burst/rps seconds is full again, so dropping it loses nothing
+	idleTTL := time.Duration(float64(burst) / rps * float64(time.Second))
+	idleTTL = max(idleTTL, minIdleBucketTTL)
+
+	limiter := &RateLimiter{
+		rate:    rps,
+		burst:   float64(burst),
+		idleTTL: idleTTL,
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(limiter)
+	}
+	return limiter
+}
+
+// Allow takes a token from the key's bucket. When the bucket is empty it returns false
+// and how long until the next token is available.
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	rl.evictIdle(now)
+
+	bucket, exists := rl.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: rl.burst, lastSeen: now}
+		rl.buckets[key] = bucket
+	}
+
+	elapsed := now.Sub(bucket.lastSeen).Seconds()
+	bucket.tokens = math.Min(rl.burst, bucket.tokens+elapsed*rl.rate)
+	bucket.lastSeen = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / rl.rate * float64(time.Second))
+		return false, wait
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// evictIdle drops idle buckets, sweeping at most once per idle TTL. Must be called with mu held.
+func (rl *RateLimiter) evictIdle(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.idleTTL {
+		return
+	}
+	rl.lastSweep = now
+
+	for key, bucket := range rl.buckets {
+		if now.Sub(bucket.lastSeen) >= rl.idleTTL {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// Middleware rejects requests over the limit with 429 Too Many Requests and a Retry-After header.
+// Requests are limited per authenticated user, falling back to the client IP, so it must run after AuthMiddleware.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return rl.limit(next, rl.rateLimitKey)
+}
+
+// IPMiddleware is like Middleware but always limits per client IP, so it can run before AuthMiddleware
+// and keep unauthenticated floods from reaching token validation
+func (rl *RateLimiter) IPMiddleware(next http.Handler) http.Handler {
+	return rl.limit(next, rl.clientIPKey)
+}
+
+// limit rejects requests over the limit of the client identified by key
+func (rl *RateLimiter) limit(next http.Handler, key func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := key(r)
+
+		allowed, retryAfter := rl.Allow(key)
+		if !allowed {
+			logger.WithContext(r.Context()).Warn("Rate limit exceeded",
+				zap.String("key", key),
+				zap.String("path", r.URL.Path),
+				zap.Duration("retry_after", retryAfter),
+			)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			httphelpers.RespondWithErrorCode(w, http.StatusTooManyRequests, httphelpers.ErrorCodeRateLimited, "Too many requests")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKey identifies the client of a request by user ID, or by client IP when unauthenticated
+func (rl *RateLimiter) rateLimitKey(r *http.Request) string {
+	if user, ok := GetUserFromContext(r.Context()); ok && user.ID != "" {
+		return "user:" + user.ID
+	}
+	return rl.clientIPKey(r)
+}
+
+// clientIPKey identifies the client of a request by IP
+func (rl *RateLimiter) clientIPKey(r *http.Request) string {
+	return "ip:" + clientIP(r, rl.trustedProxies)
+}
+
+// clientIP returns the IP of the client making a request. Behind a trusted proxy the remote address is the proxy's,
+// so the client is the last X-Forwarded-For hop that isn't a trusted proxy, or X-Real-IP without X-Forwarded-For.
+// Headers from other clients are ignored, since anyone can set them.
+func clientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host, trustedProxies) {
+		return host
+	}
+
+	client := ""
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		client = hop
+		if !isTrustedProxy(hop, trustedProxies) {
+			break
+		}
+	}
+	if client == "" {
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+			if _, err := netip.ParseAddr(realIP); err == nil {
+				client = realIP
+			}
+		}
+	}
+	if client == "" {
+		return host
+	}
+	return client
+}
+
+// isTrustedProxy reports whether ip is within one of the trusted proxy ranges
+func isTrustedProxy(ip string, trustedProxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a semicolon-separated list of IPs and CIDR ranges, like the TRUSTED_PROXIES setting
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: must be an IP or CIDR range", item)
+		}
+		addr = addr.Unmap()
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return proxies, nil
+}
+
+// trustedProxiesFromSettings returns the proxies in TRUSTED_PROXIES, exiting on an invalid entry
+func trustedProxiesFromSettings() []netip.Prefix {
+	proxies, err := ParseTrustedProxies(viper.GetString(consts.TRUSTED_PROXIES))
+	if err != nil {
+		logger.Fatal("Invalid "+consts.TRUSTED_PROXIES, zap.Error(err))
+	}
+	return proxies
+}
+
+// RateLimitMiddleware limits requests per client to RATE_LIMIT_RPS with bursts of RATE_LIMIT_BURST.
+// Rate limiting is disabled when RATE_LIMIT_RPS is not positive.
+func RateLimitMiddleware() func(http.Handler) http.Handler {
+	rps := viper.GetFloat64(consts.RATE_LIMIT_RPS)
+	if rps <= 0 {
+		logger.Info("Rate limiting disabled")
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	burst := viper.GetInt(consts.RATE_LIMIT_BURST)
+	logger.Info("Rate limiting enabled", zap.Float64("rps", rps), zap.Int("burst", burst))
+	return NewRateLimiter(rps, burst, WithTrustedProxies(trustedProxiesFromSettings())).Middleware
+}
+
+// IPRateLimitMiddleware limits requests per remote IP to RATE_LIMIT_IP_RPS with bursts of RATE_LIMIT_IP_BURST.
+// It runs before authentication, so the limit should allow for several users behind one address. Behind a proxy
+// it needs TRUSTED_PROXIES, or all clients share the proxy's limit. It is disabled when RATE_LIMIT_IP_RPS is not positive.
+func IPRateLimitMiddleware() func(http.Handler) http.Handler {
+	rps := viper.GetFloat64(consts.RATE_LIMIT_IP_RPS)
+	if rps <= 0 {
+		logger.Info("IP rate limiting disabled")
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	burst := viper.GetInt(consts.RATE_LIMIT_IP_BURST)
+	logger.Info("IP rate limiting enabled", zap.Float64("rps", rps), zap.Int("burst", burst))
+	return NewRateLimiter(rps, burst, WithTrustedProxies(trustedProxiesFromSettings())).IPMiddleware
+}
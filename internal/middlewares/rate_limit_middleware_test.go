@@ -0,0 +1,188 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+// newTestRateLimiter returns a rate limiter driven by a manual clock
+func newTestRateLimiter(rps float64, burst int) (*RateLimiter, *time.Time) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(rps, burst)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter, now := newTestRateLimiter(2, 3)
+
+	for i := range 3 {
+		if allowed, _ := limiter.Allow("a"); !allowed {
+			t.Fatalf("Expected request %d within the burst to be allowed", i+1)
+		}
+	}
+
+	allowed, retryAfter := limiter.Allow("a")
+	if allowed || retryAfter != 500*time.Millisecond {
+		t.Errorf("Expected request over the burst to be rejected with a 500ms wait, got %v/%v", allowed, retryAfter)
+	}
+
+	// Other keys have their own bucket
+	if allowed, _ := limiter.Allow("b"); !allowed {
+		t.Error("Expected a different key to be allowed")
+	}
+
+	*now = now.Add(500 * time.Millisecond)
+	if allowed, _ := limiter.Allow("a"); !allowed {
+		t.Error("Expected a request to be allowed after a token is refilled")
+	}
+}
+
+func TestRateLimiter_EvictsIdleBuckets(t *testing.T) {
+	limiter, now := newTestRateLimiter(10, 10)
+
+	limiter.Allow("a")
+	limiter.Allow("b")
+
+	*now = now.Add(minIdleBucketTTL)
+	limiter.Allow("c")
+
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Expected idle buckets to be evicted, got %d buckets", len(limiter.buckets))
+	}
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	limiter, _ := newTestRateLimiter(1, 1)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/transactions", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		if userID != "" {
+			req = req.WithContext(context.WithValue(req.Context(), UserKey, &entities.User{ID: userID}))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := request("user-1"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected first request to pass, got %d", rec.Code)
+	}
+
+	rec := request("user-1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", got)
+	}
+
+	// Another user and an unauthenticated client are limited separately
+	if rec := request("user-2"); rec.Code != http.StatusOK {
+		t.Errorf("Expected another user to pass, got %d", rec.Code)
+	}
+	if rec := request(""); rec.Code != http.StatusOK {
+		t.Errorf("Expected an unauthenticated client to pass, got %d", rec.Code)
+	}
+}
+
+func TestRateLimiter_IPMiddlewareBehindProxy(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8; 192.168.1.1")
+	if err != nil {
+		t.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+	limiter, _ := newTestRateLimiter(1, 1)
+	limiter.trustedProxies = proxies
+	handler := limiter.IPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(remoteAddr string, headers map[string]string) int {
+		req := httptest.NewRequest("GET", "/v1/transactions", nil)
+		req.RemoteAddr = remoteAddr
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Clients behind the ingress are limited separately
+	ingress := "10.1.2.3:4567"
+	if code := request(ingress, map[string]string{"X-Forwarded-For": "203.0.113.1"}); code != http.StatusOK {
+		t.Fatalf("Expected the first client to pass, got %d", code)
+	}
+	if code := request(ingress, map[string]string{"X-Forwarded-For": "203.0.113.2, 192.168.1.1"}); code != http.StatusOK {
+		t.Errorf("Expected a second client through two proxies to pass, got %d", code)
+	}
+	if code := request(ingress, map[string]string{"X-Real-IP": "203.0.113.3"}); code != http.StatusOK {
+		t.Errorf("Expected a client forwarded by X-Real-IP to pass, got %d", code)
+	}
+
+	// A spoofed leftmost hop doesn't hide the client the proxy saw
+	if code := request(ingress, map[string]string{"X-Forwarded-For": "198.51.100.9, 203.0.113.1"}); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the first client to be limited, got %d", code)
+	}
+
+	// Forwarding headers from untrusted clients are ignored
+	if code := request("203.0.113.50:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}); code != http.StatusOK {
+		t.Fatalf("Expected a direct client to pass, got %d", code)
+	}
+	if code := request("203.0.113.50:1234", map[string]string{"X-Forwarded-For": "198.51.100.2"}); code != http.StatusTooManyRequests {
+		t.Errorf("Expected a direct client to be limited by its own address, got %d", code)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 10.0.0.0/8;;::1 ")
+	if err != nil || len(proxies) != 2 {
+		t.Fatalf("Expected 2 trusted proxies, got %v (%v)", proxies, err)
+	}
+	if !isTrustedProxy("10.20.30.40", proxies) || !isTrustedProxy("::1", proxies) || isTrustedProxy("11.0.0.1", proxies) {
+		t.Errorf("Unexpected trusted proxy matches for %v", proxies)
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/8;ingress"); err == nil {
+		t.Error("Expected an error for an entry that isn't an IP or range")
+	}
+}
+
+func TestRateLimiter_IPMiddleware(t *testing.T) {
+	limiter, _ := newTestRateLimiter(1, 1)
+	handler := limiter.IPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(remoteAddr, userID string) int {
+		req := httptest.NewRequest("GET", "/v1/transactions", nil)
+		req.RemoteAddr = remoteAddr
+		if userID != "" {
+			req = req.WithContext(context.WithValue(req.Context(), UserKey, &entities.User{ID: userID}))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := request("10.0.0.1:1234", ""); code != http.StatusOK {
+		t.Fatalf("Expected first request to pass, got %d", code)
+	}
+
+	// The limit is per IP, whichever user makes the request
+	if code := request("10.0.0.1:5678", "user-1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d from the same IP, got %d", http.StatusTooManyRequests, code)
+	}
+	if code := request("10.0.0.2:1234", ""); code != http.StatusOK {
+		t.Errorf("Expected another IP to pass, got %d", code)
+	}
+}
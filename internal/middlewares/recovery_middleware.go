@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// RecoveryMiddleware turns a panicking handler into a 500 response with a generic error, logging the panic
+// and its stack. It must be the outermost middleware so it also covers the other middlewares.
+// http.ErrAbortHandler is re-panicked, since it deliberately aborts the response.
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+
+			// Running outside RequestIDMiddleware, the request ID is only on the response headers
+			logger.GetLogger().Error("Recovered from panic in handler",
+				zap.String("request_id", w.Header().Get(RequestIDHeader)),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("panic", fmt.Sprint(recovered)),
+				zap.ByteString("stack", debug.Stack()))
+
+			// If the handler already started the response, this can't change the status anymore
+			w.Header().Set("Content-Type", "application/json")
+			httphelpers.RespondWithErrorCode(w, http.StatusInternalServerError, httphelpers.ErrorCodeInternal, "Internal server error")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,65 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httphelpers"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(RecoveryMiddleware)
+	router.Use(RequestIDMiddleware)
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		var service *struct{ name string }
+		_ = service.name // nil dereference
+	})
+	router.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/panic", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected a JSON response, got Content-Type %q", contentType)
+	}
+	if rec.Header().Get(RequestIDHeader) == "" {
+		t.Error("Expected the request ID header to be kept")
+	}
+
+	var response httphelpers.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Error.Code != httphelpers.ErrorCodeInternal {
+		t.Errorf("Expected error code %q, got %q", httphelpers.ErrorCodeInternal, response.Error.Code)
+	}
+
+	// The server keeps serving after a panic
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/ok", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d after recovering, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestRecoveryMiddleware_RepanicsAbortHandler(t *testing.T) {
+	handler := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Errorf("Expected http.ErrAbortHandler to be re-panicked, got %v", recovered)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
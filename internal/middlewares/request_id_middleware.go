@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+)
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits client-provided request IDs so they can't flood the logs
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware tags each request with an ID, taken from the X-Request-ID header or generated.
+// The ID is stored in the request context for logger.WithContext and echoed in the response header.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		r = r.WithContext(logger.ContextWithRequestID(r.Context(), requestID))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isValidRequestID accepts non-empty IDs of printable ASCII, so client values can't break log lines
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random 128-bit request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var contextID string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contextID = logger.RequestIDFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		wantSame bool
+	}{
+		{"generated", "", false},
+		{"from header", "abc-123", true},
+		{"invalid header", "abc 123\n", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.header != "" {
+				req.Header.Set(RequestIDHeader, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			responseID := rec.Header().Get(RequestIDHeader)
+			if responseID == "" || responseID != contextID {
+				t.Fatalf("Expected the response header %q to match the context ID %q", responseID, contextID)
+			}
+			if (responseID == tc.header) != tc.wantSame {
+				t.Errorf("Unexpected request ID %q for header %q", responseID, tc.header)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+// maxTokenCacheTTL caps how long a verification is reused, so revoked tokens stop working reasonably fast
+const maxTokenCacheTTL = 15 * time.Minute
+
+// verifiedTokens caches users of verified access tokens, keyed by a hash of the token
+var verifiedTokens = cache.New(maxTokenCacheTTL, 10*time.Minute)
+
+// authenticateAccessToken returns the user for an access token. Tokens are verified with Google once
+// and the result is reused until the token expires. Roles are assigned on every call so role changes
+// apply immediately.
+func authenticateAccessToken(ctx context.Context, accessToken string) (*entities.User, error) {
+	key := tokenCacheKey(accessToken)
+
+	var user entities.User
+	if cached, found := verifiedTokens.Get(key); found {
+		user = cached.(entities.User)
+	} else {
+		verified, expiresIn, err := verifyGoogleAccessToken(ctx, accessToken)
+		if err != nil {
+			return nil, err
+		}
+		user = *verified
+
+		if ttl := min(expiresIn, maxTokenCacheTTL); ttl > 0 {
+			verifiedTokens.Set(key, user, ttl)
+		}
+	}
+
+	user.Role = GetRoleService().GetUserRole(&user)
+	return &user, nil
+}
+
+// tokenCacheKey hashes the token so raw tokens are never kept in memory longer than the request
+func tokenCacheKey(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:])
+}
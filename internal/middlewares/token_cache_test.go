@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+func TestAuthenticateAccessToken_CacheHit(t *testing.T) {
+	token := "cached-token"
+	verifiedTokens.Set(tokenCacheKey(token), entities.User{ID: "123", Email: "guest@example.com", Verified: true}, time.Minute)
+	t.Cleanup(func() { verifiedTokens.Delete(tokenCacheKey(token)) })
+
+	// A cache hit must not call Google, which would fail for this token
+	user, err := authenticateAccessToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("authenticateAccessToken() error = %v", err)
+	}
+	if user.ID != "123" || user.Email != "guest@example.com" {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+	if user.Role == "" {
+		t.Error("Expected a role to be assigned on cache hit")
+	}
+
+	// Callers get their own copy
+	user.Email = "changed@example.com"
+	cached, _ := verifiedTokens.Get(tokenCacheKey(token))
+	if cached.(entities.User).Email != "guest@example.com" {
+		t.Error("Expected the cached user to be unaffected by changes to the returned user")
+	}
+}
+
+func TestTokenCacheKey(t *testing.T) {
+	key := tokenCacheKey("secret")
+	if key == "secret" || len(key) != 64 {
+		t.Errorf("Expected a hex SHA-256 key, got %q", key)
+	}
+	if key != tokenCacheKey("secret") || key == tokenCacheKey("other") {
+		t.Error("Expected keys to be stable and distinct per token")
+	}
+}
+
+func TestGetIntFromMap(t *testing.T) {
+	m := map[string]interface{}{"number": float64(3599), "string": "120", "invalid": "abc"}
+
+	if got := getIntFromMap(m, "number"); got != 3599 {
+		t.Errorf("Expected 3599, got %d", got)
+	}
+	if got := getIntFromMap(m, "string"); got != 120 {
+		t.Errorf("Expected 120, got %d", got)
+	}
+	if got := getIntFromMap(m, "invalid") + getIntFromMap(m, "missing"); got != 0 {
+		t.Errorf("Expected 0 for invalid and missing values, got %d", got)
+	}
+}
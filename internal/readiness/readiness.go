@@ -0,0 +1,67 @@
+package readiness
+
+import (
+	"slices"
+	"sync"
+)
+
+// Checks that must pass before the API is ready to serve traffic
+const (
+	CheckSettings       = "settings"
+	CheckPriceService   = "price_service"
+	CheckPaymentClients = "payment_clients"
+	// CheckCacheWarm is only registered when WARM_CACHE_ON_START is enabled
+	CheckCacheWarm = "cache_warm"
+)
+
+// Registry tracks the state of a fixed set of readiness checks. Checks start out failed.
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]bool
+}
+
+// Status is the outcome of all readiness checks
+type Status struct {
+	Ready        bool     `json:"ready"`
+	FailedChecks []string `json:"failed_checks,omitempty"`
+}
+
+// Default is the registry the application reports its startup progress to
+var Default = NewRegistry(CheckSettings, CheckPriceService, CheckPaymentClients)
+
+// NewRegistry creates a registry with the given checks, all initially failed
+func NewRegistry(checks ...string) *Registry {
+	registry := &Registry{checks: make(map[string]bool, len(checks))}
+	for _, check := range checks {
+		registry.checks[check] = false
+	}
+	return registry
+}
+
+// Set records whether a check passes. Unknown checks are added to the registry.
+func (r *Registry) Set(check string, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[check] = ok
+}
+
+// Status returns whether all checks pass and the sorted names of those that don't
+func (r *Registry) Status() Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var failed []string
+	for check, ok := range r.checks {
+		if !ok {
+			failed = append(failed, check)
+		}
+	}
+	slices.Sort(failed)
+
+	return Status{Ready: len(failed) == 0, FailedChecks: failed}
+}
+
+// Set records whether a check in the default registry passes
+func Set(check string, ok bool) {
+	Default.Set(check, ok)
+}
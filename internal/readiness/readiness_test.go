@@ -0,0 +1,31 @@
+package readiness
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry(CheckSettings, CheckPriceService)
+
+	status := registry.Status()
+	if status.Ready || !slices.Equal(status.FailedChecks, []string{CheckPriceService, CheckSettings}) {
+		t.Errorf("Expected both checks to fail initially, got %+v", status)
+	}
+
+	registry.Set(CheckSettings, true)
+	status = registry.Status()
+	if status.Ready || !slices.Equal(status.FailedChecks, []string{CheckPriceService}) {
+		t.Errorf("Expected only the price service check to fail, got %+v", status)
+	}
+
+	registry.Set(CheckPriceService, true)
+	if status := registry.Status(); !status.Ready || len(status.FailedChecks) != 0 {
+		t.Errorf("Expected registry to be ready, got %+v", status)
+	}
+
+	registry.Set(CheckPriceService, false)
+	if status := registry.Status(); status.Ready {
+		t.Errorf("Expected registry to be unready after a check fails, got %+v", status)
+	}
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+// DedupeConfig controls how transactions recorded by more than one provider are collapsed
+type DedupeConfig struct {
+	// Window is the maximum time between two transactions to consider them the same. Zero disables deduplication.
+	Window time.Duration
+	// PreferredSources lists sources from most to least preferred. Unlisted sources rank last.
+	PreferredSources []string
+}
+
+// Enabled reports whether deduplication is turned on
+func (c DedupeConfig) Enabled() bool {
+	return c.Window > 0
+}
+
+// DedupeTransactions collapses transactions from different sources that share amount and currency and were
+// created within Window of each other, keeping the one from the most preferred source.
+// A transaction is never merged with another from the same source. The result is ordered by CreatedAt ascending.
+func (c DedupeConfig) DedupeTransactions(transactions []entities.Transaction) []entities.Transaction {
+	if !c.Enabled() || len(transactions) < 2 {
+		return transactions
+	}
+
+	sorted := slices.Clone(transactions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+
+	type group struct {
+		kept    entities.Transaction
+		first   time.Time
+		sources map[string]bool
+	}
+
+	var groups []*group
+	for _, transaction := range sorted {
+		var match *group
+		// Only groups started within the window can match, and they are at the end of the list
+		for i := len(groups) - 1; i >= 0; i-- {
+			candidate := groups[i]
+			if transaction.CreatedAt.Sub(candidate.first) > c.Window {
+				break
+			}
+			if !candidate.sources[transaction.Source] &&
+				candidate.kept.Amount == transaction.Amount &&
+				strings.EqualFold(candidate.kept.Currency, transaction.Currency) {
+				match = candidate
+				break
+			}
+		}
+
+		if match == nil {
+			groups = append(groups, &group{
+				kept:    transaction,
+				first:   transaction.CreatedAt,
+				sources: map[string]bool{transaction.Source: true},
+			})
+			continue
+		}
+
+		match.sources[transaction.Source] = true
+		if c.sourceRank(transaction.Source) < c.sourceRank(match.kept.Source) {
+			match.kept = transaction
+		}
+	}
+
+	result := make([]entities.Transaction, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, g.kept)
+	}
+	return result
+}
+
+// sourceRank returns the position of a source in the preferred order, with unlisted sources last
+func (c DedupeConfig) sourceRank(source string) int {
+	if rank := slices.Index(c.PreferredSources, source); rank >= 0 {
+		return rank
+	}
+	return len(c.PreferredSources)
+}
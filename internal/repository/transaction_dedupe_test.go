@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/cache"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+func TestDedupeTransactions_WindowBoundaries(t *testing.T) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	config := DedupeConfig{
+		Window:           2 * time.Minute,
+		PreferredSources: []string{consts.PAYMENT_SOURCE_STRIPE, consts.PAYMENT_SOURCE_ZETTLE},
+	}
+
+	tests := []struct {
+		name     string
+		offset   time.Duration
+		expected int
+	}{
+		{"same time", 0, 1},
+		{"inside window", 1 * time.Minute, 1},
+		{"exactly at window", 2 * time.Minute, 1},
+		{"just outside window", 2*time.Minute + time.Nanosecond, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions := []entities.Transaction{
+				{ID: "zettle_1", Source: consts.PAYMENT_SOURCE_ZETTLE, Amount: 390, Currency: "NOK", CreatedAt: base},
+				{ID: "stripe_1", Source: consts.PAYMENT_SOURCE_STRIPE, Amount: 390, Currency: "nok", CreatedAt: base.Add(tt.offset)},
+			}
+
+			deduped := config.DedupeTransactions(transactions)
+			if len(deduped) != tt.expected {
+				t.Fatalf("Expected %d transactions, got %d", tt.expected, len(deduped))
+			}
+			if tt.expected == 1 && deduped[0].ID != "stripe_1" {
+				t.Errorf("Expected preferred Stripe transaction to be kept, got %s", deduped[0].ID)
+			}
+		})
+	}
+}
+
+func TestDedupeTransactions_OnlyAcrossSources(t *testing.T) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	config := DedupeConfig{
+		Window:           2 * time.Minute,
+		PreferredSources: []string{consts.PAYMENT_SOURCE_ZETTLE},
+	}
+
+	transactions := []entities.Transaction{
+		// Two genuine purchases of the same item in the same shop
+		{ID: "stripe_1", Source: consts.PAYMENT_SOURCE_STRIPE, Amount: 100, Currency: "NOK", CreatedAt: base},
+		{ID: "stripe_2", Source: consts.PAYMENT_SOURCE_STRIPE, Amount: 100, Currency: "NOK", CreatedAt: base.Add(30 * time.Second)},
+		// The same booking recorded in Zettle
+		{ID: "zettle_1", Source: consts.PAYMENT_SOURCE_ZETTLE, Amount: 100, Currency: "NOK", CreatedAt: base.Add(10 * time.Second)},
+		// Different amount and different currency are never merged
+		{ID: "vipps_1", Source: consts.PAYMENT_SOURCE_VIPPS, Amount: 200, Currency: "NOK", CreatedAt: base},
+		{ID: "vipps_2", Source: consts.PAYMENT_SOURCE_VIPPS, Amount: 100, Currency: "EUR", CreatedAt: base},
+	}
+
+	deduped := config.DedupeTransactions(transactions)
+
+	ids := make(map[string]bool)
+	for _, transaction := range deduped {
+		ids[transaction.ID] = true
+	}
+
+	expected := []string{"zettle_1", "stripe_2", "vipps_1", "vipps_2"}
+	if len(deduped) != len(expected) {
+		t.Fatalf("Expected %d transactions, got %d (%v)", len(expected), len(deduped), ids)
+	}
+	for _, id := range expected {
+		if !ids[id] {
+			t.Errorf("Expected %s to be kept, got %v", id, ids)
+		}
+	}
+}
+
+func TestDedupeTransactions_Disabled(t *testing.T) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	transactions := []entities.Transaction{
+		{ID: "a", Source: consts.PAYMENT_SOURCE_STRIPE, Amount: 100, Currency: "NOK", CreatedAt: base},
+		{ID: "b", Source: consts.PAYMENT_SOURCE_ZETTLE, Amount: 100, Currency: "NOK", CreatedAt: base},
+	}
+
+	if deduped := (DedupeConfig{}).DedupeTransactions(transactions); len(deduped) != 2 {
+		t.Errorf("Expected no deduplication with a zero window, got %d transactions", len(deduped))
+	}
+}
+
+func TestGetTransactions_Dedupe(t *testing.T) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	for _, transaction := range []entities.Transaction{
+		{ID: "stripe_1", Source: consts.PAYMENT_SOURCE_STRIPE, Amount: 100, Currency: "NOK", CreatedAt: base},
+		{ID: "zettle_1", Source: consts.PAYMENT_SOURCE_ZETTLE, Amount: 100, Currency: "NOK", CreatedAt: base.Add(5 * time.Second)},
+	} {
+		c.SetTransaction(transaction.ID, transaction, 1*time.Hour)
+	}
+
+	repo := NewTransactionRepository(c, nil, nil, nil, WithDedupe(DedupeConfig{
+		Window:           1 * time.Minute,
+		PreferredSources: []string{consts.PAYMENT_SOURCE_ZETTLE},
+	}))
+
+	result, err := repo.GetTransactions(context.Background(), entities.TransactionFilter{}, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions returned error: %v", err)
+	}
+	transactions := result.Items
+	if len(transactions) != 1 || transactions[0].ID != "zettle_1" {
+		t.Errorf("Expected only the preferred Zettle transaction, got %v", transactions)
+	}
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+const (
+	// DefaultRefreshCooldown is how long a successful refresh is reused before the providers are fetched again
+	DefaultRefreshCooldown = 10 * time.Second
+	// DefaultFallbackRefreshTimeout is how long a request waits for the refresh of an empty cache
+	DefaultFallbackRefreshTimeout = 10 * time.Second
+)
+
+// refreshCall is a refresh in flight that concurrent callers wait on
+type refreshCall struct {
+	done   chan struct{}
+	result entities.RefreshResult
+	err    error
+}
+
+// refreshGuard coalesces concurrent refreshes into one fetch and reuses a successful result for a cooldown
+type refreshGuard struct {
+	mu       sync.Mutex
+	inflight *refreshCall
+	last     *entities.RefreshResult
+}
+
+// WithRefreshCooldown sets how long a successful refresh is reused before the providers are fetched again.
+// Zero disables the cooldown, while concurrent refreshes are still coalesced.
+func WithRefreshCooldown(cooldown time.Duration) Option {
+	return func(r *TransactionRepository) {
+		if cooldown >= 0 {
+			r.refreshCooldown = cooldown
+		}
+	}
+}
+
+// RefreshCache fetches the latest transactions from all configured providers into the cache. Concurrent calls
+// share one fetch, and within the cooldown after a successful refresh its result is returned with Cached set.
+// It only fails when every configured provider failed or the context is done before the fetch completes.
+func (r *TransactionRepository) RefreshCache(ctx context.Context) (entities.RefreshResult, error) {
+	return r.refresh(ctx, true)
+}
+
+// refresh runs or joins a provider fetch. The fetch is detached from the caller's cancellation so one caller
+// giving up doesn't fail the others; each caller stops waiting when its own context is done.
+func (r *TransactionRepository) refresh(ctx context.Context, allowCached bool) (entities.RefreshResult, error) {
+	r.refreshGuard.mu.Lock()
+	if last := r.refreshGuard.last; allowCached && last != nil && time.Since(last.RefreshedAt) < r.refreshCooldown {
+		result := *last
+		result.Cached = true
+		r.refreshGuard.mu.Unlock()
+		return result, nil
+	}
+
+	call := r.refreshGuard.inflight
+	if call == nil {
+		call = &refreshCall{done: make(chan struct{})}
+		r.refreshGuard.inflight = call
+		go r.runRefresh(context.WithoutCancel(ctx), call)
+	}
+	r.refreshGuard.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.result, call.err
+	case <-ctx.Done():
+		return entities.RefreshResult{}, ctx.Err()
+	}
+}
+
+// runRefresh performs the fetch for a refresh call and publishes its result
+func (r *TransactionRepository) runRefresh(ctx context.Context, call *refreshCall) {
+	count, warnings, err := r.refreshCache(ctx)
+	call.result = entities.RefreshResult{
+		Transactions: count,
+		Warnings:     warnings,
+		RefreshedAt:  time.Now(),
+	}
+	call.err = err
+
+	r.refreshGuard.mu.Lock()
+	r.refreshGuard.inflight = nil
+	// Only successful refreshes are reused, so a failed one can be retried straight away
+	if err == nil {
+		result := call.result
+		r.refreshGuard.last = &result
+	}
+	r.refreshGuard.mu.Unlock()
+
+	close(call.done)
+}
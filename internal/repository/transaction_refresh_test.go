@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/cache"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+)
+
+// blockingListClient counts listings and holds each one until release is closed
+type blockingListClient struct {
+	calls   atomic.Int32
+	release chan struct{}
+	err     error
+}
+
+func (f *blockingListClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
+	f.calls.Add(1)
+	<-f.release
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []entities.Transaction{{ID: "stripe_1", Source: "stripe"}}, nil
+}
+
+func (f *blockingListClient) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
+	return entities.Transaction{}, interfaces.ErrTransactionNotFound
+}
+
+func TestRefreshCache_CoalescesConcurrentCalls(t *testing.T) {
+	client := &blockingListClient{release: make(chan struct{})}
+	repo := NewTransactionRepository(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), client, nil, nil)
+
+	const callers = 5
+	results := make([]entities.RefreshResult, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = repo.RefreshCache(context.Background())
+		}()
+	}
+
+	// Let every caller join before the fetch completes
+	for client.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(client.release)
+	wg.Wait()
+
+	if calls := client.calls.Load(); calls != 1 {
+		t.Errorf("Expected one provider fetch, got %d", calls)
+	}
+	for i := 0; i < callers; i++ {
+		if errs[i] != nil {
+			t.Fatalf("Caller %d: unexpected error: %v", i, errs[i])
+		}
+		if results[i].Transactions != 1 || !results[i].RefreshedAt.Equal(results[0].RefreshedAt) {
+			t.Errorf("Caller %d: expected the shared result, got %+v", i, results[i])
+		}
+	}
+}
+
+func TestRefreshCache_Cooldown(t *testing.T) {
+	client := &blockingListClient{release: make(chan struct{})}
+	close(client.release)
+	repo := NewTransactionRepository(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), client, nil, nil,
+		WithRefreshCooldown(time.Hour))
+
+	first, err := repo.RefreshCache(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.Cached {
+		t.Error("Expected the first refresh not to be cached")
+	}
+
+	second, err := repo.RefreshCache(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !second.Cached || !second.RefreshedAt.Equal(first.RefreshedAt) {
+		t.Errorf("Expected the previous result marked cached, got %+v", second)
+	}
+	if calls := client.calls.Load(); calls != 1 {
+		t.Errorf("Expected one provider fetch within the cooldown, got %d", calls)
+	}
+}
+
+func TestRefreshCache_FailureIsNotReused(t *testing.T) {
+	client := &blockingListClient{release: make(chan struct{}), err: errors.New("connection refused")}
+	close(client.release)
+	repo := NewTransactionRepository(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), client, nil, nil,
+		WithRefreshCooldown(time.Hour))
+
+	for i := 0; i < 2; i++ {
+		if _, err := repo.RefreshCache(context.Background()); !errors.Is(err, interfaces.ErrAllProvidersFailed) {
+			t.Fatalf("Expected ErrAllProvidersFailed, got %v", err)
+		}
+	}
+	if calls := client.calls.Load(); calls != 2 {
+		t.Errorf("Expected a failed refresh to be retried, got %d fetches", calls)
+	}
+}
+
+func TestRefreshCache_CallerCancellationDoesNotAbortFetch(t *testing.T) {
+	client := &blockingListClient{release: make(chan struct{})}
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	repo := NewTransactionRepository(c, client, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := repo.RefreshCache(ctx)
+		done <- err
+	}()
+
+	for client.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancelled caller to get context.Canceled, got %v", err)
+	}
+
+	// A caller joining later shares the fetch that is still running
+	close(client.release)
+	result, err := repo.RefreshCache(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Transactions != 1 {
+		t.Errorf("Expected the fetch to complete, got %+v", result)
+	}
+	if _, found := c.GetTransaction("stripe_1"); !found {
+		t.Error("Expected the fetched transaction in the cache")
+	}
+}
+
+func TestGetTransactions_FallbackRefreshTimeout(t *testing.T) {
+	client := &blockingListClient{release: make(chan struct{})}
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	repo := NewTransactionRepository(c, client, nil, nil, WithFallbackRefreshTimeout(20*time.Millisecond))
+
+	start := time.Now()
+	result, err := repo.GetTransactions(context.Background(), entities.TransactionFilter{}, 10)
+	if err != nil {
+		t.Fatalf("Expected the timed out fallback to return what is cached, got %v", err)
+	}
+	if len(result.Items) != 0 {
+		t.Errorf("Expected no transactions before the refresh completes, got %d", len(result.Items))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the request to return after the fallback timeout, took %s", elapsed)
+	}
+
+	// The refresh keeps running and fills the cache for later requests
+	close(client.release)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, found := c.GetTransaction("stripe_1"); found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the background refresh to fill the cache")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -2,12 +2,18 @@ package repository
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/statushelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
 	"go.uber.org/zap"
@@ -18,6 +24,59 @@ type TransactionRepository struct {
 	stripeClient interfaces.Transactions
 	vippsClient  interfaces.Transactions
 	zettleClient interfaces.Transactions
+	dedupe       DedupeConfig
+	ttl          time.Duration
+	batchSize    int
+
+	refreshGuard    refreshGuard
+	refreshCooldown time.Duration
+	// Longest a request waits for the refresh of an empty cache
+	fallbackRefreshTimeout time.Duration
+
+	annotationMu sync.Mutex
+
+	// upsertMu serializes upserts with each other and with caching the transactions of a refresh
+	upsertMu sync.Mutex
+	// polled maps the payment reference of each polled transaction to its ID, by source
+	polled map[string]map[string]string
+}
+
+// Option configures optional behavior on a TransactionRepository
+type Option func(*TransactionRepository)
+
+// WithDedupe collapses transactions recorded by more than one provider when listing
+func WithDedupe(config DedupeConfig) Option {
+	return func(r *TransactionRepository) {
+		r.dedupe = config
+	}
+}
+
+// WithFallbackRefreshTimeout sets how long a request waits for the refresh of an empty cache before
+// returning what is cached. Non-positive values keep the default.
+func WithFallbackRefreshTimeout(timeout time.Duration) Option {
+	return func(r *TransactionRepository) {
+		if timeout > 0 {
+			r.fallbackRefreshTimeout = timeout
+		}
+	}
+}
+
+// WithTTL sets how long transactions written to the cache are kept
+func WithTTL(ttl time.Duration) Option {
+	return func(r *TransactionRepository) {
+		if ttl > 0 {
+			r.ttl = ttl
+		}
+	}
+}
+
+// WithFetchBatchSize sets how many transactions are fetched from each provider when the cache is refreshed
+func WithFetchBatchSize(size int) Option {
+	return func(r *TransactionRepository) {
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
 }
 
 // Compile-time check to ensure TransactionRepository implements TransactionRepository interface
@@ -28,35 +87,41 @@ func NewTransactionRepository(
 	stripeClient interfaces.Transactions,
 	vippsClient interfaces.Transactions,
 	zettleClient interfaces.Transactions,
+	opts ...Option,
 ) *TransactionRepository {
-	return &TransactionRepository{
+	repository := &TransactionRepository{
 		cache:        cache,
 		stripeClient: stripeClient,
 		vippsClient:  vippsClient,
 		zettleClient: zettleClient,
-	}
-}
+		ttl:          consts.CACHE_TTL_DEFAULT,
+		batchSize:    consts.FETCH_BATCH_SIZE_DEFAULT,
+		polled:       make(map[string]map[string]string),
 
-func (r *TransactionRepository) GetTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
-	// Validate limit
-	if limit < consts.TRANSACTION_LIMIT_MIN {
-		limit = consts.TRANSACTION_LIMIT_DEFAULT
+		refreshCooldown:        DefaultRefreshCooldown,
+		fallbackRefreshTimeout: DefaultFallbackRefreshTimeout,
 	}
-	if limit > consts.TRANSACTION_LIMIT_MAX {
-		limit = consts.TRANSACTION_LIMIT_MAX
+
+	for _, opt := range opts {
+		opt(repository)
 	}
 
-	// Get all cached transactions
-	cachedTransactions := r.cache.GetTransactions("")
+	return repository
+}
+
+// GetTransactions returns up to limit transactions matching the filter, newest first. The result carries
+// warnings for providers that failed when an empty cache had to be refreshed.
+func (r *TransactionRepository) GetTransactions(ctx context.Context, filter entities.TransactionFilter, limit int) (entities.TransactionsResult, error) {
+	limit = normalizeLimit(limit)
 
-	// Sort by CreatedAt descending (newest first)
-	sort.Slice(cachedTransactions, func(i, j int) bool {
-		return cachedTransactions[i].CreatedAt.After(cachedTransactions[j].CreatedAt)
-	})
+	cachedTransactions, warnings, err := r.getSortedTransactions(ctx, filter)
+	if err != nil {
+		return entities.TransactionsResult{Items: []entities.Transaction{}}, err
+	}
 
 	// Return the requested limit from cache
 	if len(cachedTransactions) >= limit {
-		return cachedTransactions[:limit], nil
+		return entities.TransactionsResult{Items: cachedTransactions[:limit], Warnings: warnings}, nil
 	}
 
 	// If we don't have enough cached data, return what we have
@@ -65,116 +130,538 @@ func (r *TransactionRepository) GetTransactions(ctx context.Context, limit int)
 		logger.Info("Returning partial transaction data from cache",
 			zap.Int("available", len(cachedTransactions)),
 			zap.Int("requested", limit))
-		return cachedTransactions, nil
 	}
+	return entities.TransactionsResult{Items: cachedTransactions, Warnings: warnings}, nil
+}
+
+// GetTransactionsPage returns up to limit transactions matching the filter and following the given cursor,
+// together with the cursor for the next page. An empty or invalid cursor starts from the newest.
+// The returned next cursor is empty when there are no more transactions.
+func (r *TransactionRepository) GetTransactionsPage(ctx context.Context, filter entities.TransactionFilter, cursor string, limit int) (entities.TransactionsResult, string, error) {
+	limit = normalizeLimit(limit)
 
-	// If cache is completely empty, try to refresh once as fallback
-	logger.Warn("Cache is empty, performing one-time refresh as fallback")
-	err := r.RefreshCache(ctx)
+	cachedTransactions, warnings, err := r.getSortedTransactions(ctx, filter)
 	if err != nil {
-		logger.Error("Failed to refresh cache as fallback", zap.Error(err))
-		return []entities.Transaction{}, fmt.Errorf("no transactions available and failed to refresh cache: %w", err)
+		return entities.TransactionsResult{Items: []entities.Transaction{}}, "", err
 	}
 
-	// Get updated cached transactions after refresh
-	cachedTransactions = r.cache.GetTransactions("")
+	start := 0
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			logger.Warn("Invalid transactions cursor, starting from newest", zap.Error(err))
+		} else {
+			// Transactions are sorted, so find the first one ordered after the cursor position
+			start = sort.Search(len(cachedTransactions), func(i int) bool {
+				return transactionLess(after, cachedTransactions[i])
+			})
+		}
+	}
 
-	// Sort by CreatedAt descending (newest first)
-	sort.Slice(cachedTransactions, func(i, j int) bool {
-		return cachedTransactions[i].CreatedAt.After(cachedTransactions[j].CreatedAt)
-	})
+	end := start + limit
+	if end >= len(cachedTransactions) {
+		return entities.TransactionsResult{Items: cachedTransactions[start:], Warnings: warnings}, "", nil
+	}
 
-	// Return the requested limit
-	if len(cachedTransactions) > limit {
-		return cachedTransactions[:limit], nil
+	page := cachedTransactions[start:end]
+	return entities.TransactionsResult{Items: page, Warnings: warnings}, encodeCursor(page[len(page)-1]), nil
+}
+
+// GetAllTransactions returns all cached transactions matching the filter, sorted newest first
+func (r *TransactionRepository) GetAllTransactions(ctx context.Context, filter entities.TransactionFilter) ([]entities.Transaction, error) {
+	transactions, _, err := r.getSortedTransactions(ctx, filter)
+	return transactions, err
+}
+
+// CountTransactions returns the number of cached transactions matching the filter, without sorting them
+func (r *TransactionRepository) CountTransactions(ctx context.Context, filter entities.TransactionFilter) (int, error) {
+	transactions, _, err := r.getFilteredTransactions(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return len(transactions), nil
+}
+
+// GetLatestTransactionBySource returns the newest cached transaction of each configured provider, keyed by source.
+// It only reads the cache, so providers without cached transactions are left out, and archived transactions
+// are skipped like in listings.
+func (r *TransactionRepository) GetLatestTransactionBySource(ctx context.Context) (map[string]entities.Transaction, error) {
+	sources := []struct {
+		source string
+		client interfaces.Transactions
+	}{
+		{consts.PAYMENT_SOURCE_STRIPE, r.stripeClient},
+		{consts.PAYMENT_SOURCE_VIPPS, r.vippsClient},
+		{consts.PAYMENT_SOURCE_ZETTLE, r.zettleClient},
+	}
+
+	var filter entities.TransactionFilter
+	latest := make(map[string]entities.Transaction)
+	for _, source := range sources {
+		if source.client == nil {
+			continue
+		}
+
+		for _, transaction := range r.annotate(r.cache.GetTransactionsBySource(source.source)) {
+			if !filter.Matches(transaction) {
+				continue
+			}
+			if current, found := latest[source.source]; !found || transactionLess(transaction, current) {
+				latest[source.source] = transaction
+			}
+		}
+	}
+
+	return latest, nil
+}
+
+// SearchTransactions returns up to limit cached transactions, newest first, whose description, external ID
+// or metadata values contain the query, ignoring case
+func (r *TransactionRepository) SearchTransactions(ctx context.Context, query string, limit int) ([]entities.Transaction, error) {
+	limit = normalizeLimit(limit)
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	cachedTransactions, _, err := r.getSortedTransactions(ctx, entities.TransactionFilter{})
+	if err != nil {
+		return []entities.Transaction{}, err
+	}
+
+	results := make([]entities.Transaction, 0, limit)
+	for _, transaction := range cachedTransactions {
+		if !matchesSearch(transaction, query) {
+			continue
+		}
+		results = append(results, transaction)
+		if len(results) == limit {
+			break
+		}
+	}
+
+	return results, nil
+}
+
+// matchesSearch checks if a lowercase query is contained in a transaction's searchable fields
+func matchesSearch(transaction entities.Transaction, query string) bool {
+	if strings.Contains(strings.ToLower(transaction.Description), query) ||
+		strings.Contains(strings.ToLower(transaction.ExternalID), query) {
+		return true
+	}
+	for _, value := range transaction.Metadata {
+		if strings.Contains(strings.ToLower(value), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// getSortedTransactions returns all cached transactions matching the filter, sorted newest first,
+// and the warnings of the fallback refresh
+func (r *TransactionRepository) getSortedTransactions(ctx context.Context, filter entities.TransactionFilter) ([]entities.Transaction, []entities.ProviderWarning, error) {
+	filtered, warnings, err := r.getFilteredTransactions(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sortTransactions(filtered)
+	return filtered, warnings, nil
+}
+
+// loadTransactions reads the cached transactions the filter can match. A source filter only reads those
+// sources, unless deduplication needs every source to pick which copy of a duplicate to keep.
+func (r *TransactionRepository) loadTransactions(filter entities.TransactionFilter) []entities.Transaction {
+	if len(filter.Sources) == 0 || r.dedupe.Enabled() {
+		return r.annotate(r.cache.GetTransactions(""))
+	}
+
+	var transactions []entities.Transaction
+	for i, source := range filter.Sources {
+		// A source repeated in the query would otherwise list its transactions twice
+		if slices.Contains(filter.Sources[:i], source) {
+			continue
+		}
+		transactions = append(transactions, r.cache.GetTransactionsBySource(source)...)
+	}
+	return r.annotate(transactions)
+}
+
+// annotate merges the separately stored annotations into the cached transactions
+func (r *TransactionRepository) annotate(transactions []entities.Transaction) []entities.Transaction {
+	annotations := r.cache.GetAnnotations()
+	if len(annotations) == 0 {
+		return transactions
+	}
+
+	for i, transaction := range transactions {
+		if annotation, found := annotations[transaction.ID]; found {
+			transactions[i] = annotation.Apply(transaction)
+		}
+	}
+	return transactions
+}
+
+// annotateOne merges the stored annotation, if any, into a single transaction
+func (r *TransactionRepository) annotateOne(transaction entities.Transaction) entities.Transaction {
+	annotation, _ := r.cache.GetAnnotation(transaction.ID)
+	return annotation.Apply(transaction)
+}
+
+// cacheTransaction writes the provider-derived fields of a transaction to the cache; annotations stay in their own store
+func (r *TransactionRepository) cacheTransaction(transaction entities.Transaction) {
+	r.cache.SetTransaction(transaction.ID, transaction.WithoutAnnotations(), r.ttl)
+}
+
+// getFilteredTransactions returns all cached transactions matching the filter in no particular order.
+// If the cache is completely empty, it performs a one-time refresh as fallback and returns a warning
+// for each provider that failed. It only fails when every provider failed.
+func (r *TransactionRepository) getFilteredTransactions(ctx context.Context, filter entities.TransactionFilter) ([]entities.Transaction, []entities.ProviderWarning, error) {
+	cachedTransactions := r.loadTransactions(filter)
+
+	var warnings []entities.ProviderWarning
+	if len(cachedTransactions) == 0 && len(r.cache.GetTransactions("")) == 0 {
+		// If cache is completely empty, try to refresh once as fallback
+		// The background fetcher should be populating the cache automatically
+		logger.Warn("Cache is empty, performing one-time refresh as fallback")
+		// Joins a refresh already in flight, but never reuses an earlier result since the cache is empty.
+		// The wait is bounded so a slow provider can't hang the request; the refresh itself keeps running
+		// and fills the cache for later requests.
+		refreshCtx, cancel := context.WithTimeout(ctx, r.fallbackRefreshTimeout)
+		result, err := r.refresh(refreshCtx, false)
+		cancel()
+		warnings = result.Warnings
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			logger.Warn("Fallback refresh timed out, returning what is cached",
+				zap.Duration("timeout", r.fallbackRefreshTimeout))
+			err = nil
+		}
+		if err != nil {
+			logger.Error("Failed to refresh cache as fallback", zap.Error(err))
+			return nil, nil, fmt.Errorf("no transactions available and failed to refresh cache: %w", err)
+		}
+
+		// Get updated cached transactions after refresh
+		cachedTransactions = r.loadTransactions(filter)
+	}
+
+	// Collapse cross-provider duplicates before filtering, so a source filter can't bring a duplicate back
+	cachedTransactions = r.dedupe.DedupeTransactions(cachedTransactions)
+
+	// Filter before sorting so limits apply to the matching transactions only
+	filtered := make([]entities.Transaction, 0, len(cachedTransactions))
+	for _, transaction := range cachedTransactions {
+		if filter.Matches(transaction) {
+			filtered = append(filtered, transaction)
+		}
 	}
-	return cachedTransactions, nil
+
+	return filtered, warnings, nil
 }
 
 func (r *TransactionRepository) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
 	// First check cache
 	if transaction, found := r.cache.GetTransaction(id); found {
-		return transaction, nil
+		return r.annotateOne(transaction), nil
 	}
 
 	// If not in cache, try to find it from each provider
-	// Try Stripe first (check if it looks like a Stripe ID)
-	if r.stripeClient != nil {
-		transaction, err := r.stripeClient.GetTransactionByID(ctx, id)
-		if err == nil {
-			// Cache the transaction
-			r.cache.SetTransaction(transaction.ID, transaction, 24*time.Hour)
-			return transaction, nil
-		}
-		logger.Debug("Transaction not found in Stripe", zap.String("id", id), zap.Error(err))
+	return r.fetchTransactionByID(ctx, id)
+}
+
+// RefreshTransaction looks up a transaction from the providers, bypassing the cache,
+// and overwrites the cached entry with the result
+func (r *TransactionRepository) RefreshTransaction(ctx context.Context, id string) (entities.Transaction, error) {
+	return r.fetchTransactionByID(ctx, id)
+}
+
+// fetchTransactionByID looks up a transaction from each provider, Stripe first, and caches the first match
+func (r *TransactionRepository) fetchTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
+	providers := []struct {
+		name   string
+		client interfaces.Transactions
+	}{
+		{consts.PAYMENT_SOURCE_STRIPE, r.stripeClient},
+		{consts.PAYMENT_SOURCE_VIPPS, r.vippsClient},
+		{consts.PAYMENT_SOURCE_ZETTLE, r.zettleClient},
 	}
 
-	// Try Vipps
-	if r.vippsClient != nil {
-		transaction, err := r.vippsClient.GetTransactionByID(ctx, id)
-		if err == nil {
-			// Cache the transaction
-			r.cache.SetTransaction(transaction.ID, transaction, 24*time.Hour)
-			return transaction, nil
+	// Remember the first real failure, so an unreachable provider isn't reported as a missing transaction
+	var providerErr error
+	for _, provider := range providers {
+		if provider.client == nil {
+			continue
 		}
-		logger.Debug("Transaction not found in Vipps", zap.String("id", id), zap.Error(err))
-	}
 
-	// Try Zettle
-	if r.zettleClient != nil {
-		transaction, err := r.zettleClient.GetTransactionByID(ctx, id)
+		transaction, err := provider.client.GetTransactionByID(ctx, id)
 		if err == nil {
 			// Cache the transaction
-			r.cache.SetTransaction(transaction.ID, transaction, 24*time.Hour)
-			return transaction, nil
+			r.cacheTransaction(transaction)
+			return r.annotateOne(transaction), nil
+		}
+
+		if errors.Is(err, interfaces.ErrTransactionNotFound) {
+			logger.Debug("Transaction not found in provider", zap.String("provider", provider.name), zap.String("id", id))
+			continue
 		}
-		logger.Debug("Transaction not found in Zettle", zap.String("id", id), zap.Error(err))
+
+		logger.Warn("Failed to look up transaction in provider",
+			zap.String("provider", provider.name), zap.String("id", id), zap.Error(err))
+		if providerErr == nil {
+			providerErr = fmt.Errorf("failed to look up transaction in %s: %w", provider.name, err)
+		}
+	}
+
+	if providerErr != nil {
+		return entities.Transaction{}, providerErr
 	}
 
-	return entities.Transaction{}, fmt.Errorf("transaction with ID %s not found", id)
+	return entities.Transaction{}, fmt.Errorf("%w: %s", interfaces.ErrTransactionNotFound, id)
 }
 
-func (r *TransactionRepository) RefreshCache(ctx context.Context) error {
-	var allTransactions []entities.Transaction
+// DeleteTransaction evicts a single transaction from the cache, returning ErrTransactionNotFound if it isn't cached.
+// The transaction reappears on the next refresh if the provider still reports it.
+func (r *TransactionRepository) DeleteTransaction(ctx context.Context, id string) error {
+	if _, found := r.cache.GetTransaction(id); !found {
+		return fmt.Errorf("%w: %s", interfaces.ErrTransactionNotFound, id)
+	}
 
-	// Fetch from Stripe
-	if r.stripeClient != nil {
-		stripeTransactions, err := r.stripeClient.GetLatestTransactions(ctx, 100) // Fetch more for cache
-		if err != nil {
-			logger.Error("Failed to fetch Stripe transactions", zap.Error(err))
-		} else {
-			allTransactions = append(allTransactions, stripeTransactions...)
-			logger.Info("Fetched Stripe transactions", zap.Int("count", len(stripeTransactions)))
+	r.cache.DeleteTransaction(id)
+	logger.Info("Evicted transaction from cache", zap.String("id", id))
+	return nil
+}
+
+// ArchiveTransaction hides a transaction from listings without removing it, returning the archived transaction
+func (r *TransactionRepository) ArchiveTransaction(ctx context.Context, id string) (entities.Transaction, error) {
+	transaction, err := r.AnnotateTransaction(ctx, id, func(annotation *entities.TransactionAnnotation) {
+		annotation.Archived = true
+	})
+	if err != nil {
+		return entities.Transaction{}, err
+	}
+
+	logger.Info("Archived transaction", zap.String("id", transaction.ID))
+	return transaction, nil
+}
+
+// AnnotateTransaction applies update to the annotation of an existing transaction and returns the annotated
+// transaction. Annotations are stored apart from the cached transaction, so they survive re-fetches and cache expiry.
+func (r *TransactionRepository) AnnotateTransaction(ctx context.Context, id string, update func(*entities.TransactionAnnotation)) (entities.Transaction, error) {
+	transaction, err := r.GetTransactionByID(ctx, id)
+	if err != nil {
+		return entities.Transaction{}, err
+	}
+
+	// Serialize read-modify-write so concurrent edits of different fields don't drop each other
+	r.annotationMu.Lock()
+	defer r.annotationMu.Unlock()
+
+	annotation, _ := r.cache.GetAnnotation(transaction.ID)
+	update(&annotation)
+	annotation.TransactionCreatedAt = transaction.CreatedAt
+	r.cache.SetAnnotation(transaction.ID, annotation)
+	return annotation.Apply(transaction), nil
+}
+
+// UpsertTransaction writes a single transaction received outside the fetch cycle, e.g. from a webhook, into the cache.
+// It replaces the entry with the same ID and keeps its CreatedAt, but a final status (e.g. succeeded) is never
+// overwritten by a late, non-final one, and a succeeded payment is never marked failed. A payment the provider
+// listing reports under another ID is left to that entry, so it isn't counted twice.
+func (r *TransactionRepository) UpsertTransaction(ctx context.Context, transaction entities.Transaction) error {
+	if transaction.ID == "" {
+		return fmt.Errorf("transaction ID is required")
+	}
+
+	return r.UpdateTransaction(ctx, transaction.ID, func(entities.Transaction, bool) entities.Transaction {
+		return transaction
+	})
+}
+
+// UpdateTransaction upserts what update returns for the cached transaction with id, where found reports whether
+// it is cached, with the rules of UpsertTransaction. The update runs under the upsert lock, so it sees the latest entry.
+func (r *TransactionRepository) UpdateTransaction(ctx context.Context, id string, update func(cached entities.Transaction, found bool) entities.Transaction) error {
+	// Serialize read-modify-write so concurrent deliveries for a payment can't both pass the status checks
+	r.upsertMu.Lock()
+	defer r.upsertMu.Unlock()
+
+	existing, found := r.cache.GetTransaction(id)
+	transaction := update(existing, found)
+	if transaction.ID != id {
+		return fmt.Errorf("transaction ID %q doesn't match %q", transaction.ID, id)
+	}
+
+	if polledID, found := r.polled[transaction.Source][paymentReference(transaction)]; found && polledID != transaction.ID {
+		logger.Debug("Ignoring update of a payment the provider listing reports",
+			zap.String("id", transaction.ID),
+			zap.String("polled_id", polledID))
+		return nil
+	}
+
+	if found {
+		outOfOrder := statushelpers.IsFinalStatus(existing.Status) && !statushelpers.IsFinalStatus(transaction.Status)
+		// A failed attempt to change a payment doesn't undo its success
+		failedAfterSuccess := existing.Status == consts.TRANSACTION_STATUS_SUCCEEDED && transaction.Status == consts.TRANSACTION_STATUS_FAILED
+		if outOfOrder || failedAfterSuccess {
+			logger.Debug("Ignoring out-of-order transaction update",
+				zap.String("id", existing.ID),
+				zap.String("current_status", existing.Status),
+				zap.String("incoming_status", transaction.Status))
+			return nil
+		}
+
+		// Later events of a payment carry their own time, which must not move the payment to another date
+		if !existing.CreatedAt.IsZero() {
+			transaction.CreatedAt = existing.CreatedAt
 		}
 	}
 
-	// Fetch from Vipps
-	if r.vippsClient != nil {
-		vippsTransactions, err := r.vippsClient.GetLatestTransactions(ctx, 100)
-		if err != nil {
-			logger.Error("Failed to fetch Vipps transactions", zap.Error(err))
-		} else {
-			allTransactions = append(allTransactions, vippsTransactions...)
-			logger.Info("Fetched Vipps transactions", zap.Int("count", len(vippsTransactions)))
+	r.cacheTransaction(transaction)
+	return nil
+}
+
+// paymentReference returns what identifies the payment of a transaction within its source. For Vipps that is the
+// order ID, which webhook events carry as reference and report rows in Metadata["order_id"], otherwise the ExternalID.
+func paymentReference(transaction entities.Transaction) string {
+	if orderID := transaction.Metadata["order_id"]; transaction.Source == consts.PAYMENT_SOURCE_VIPPS && orderID != "" {
+		return orderID
+	}
+	return transaction.ExternalID
+}
+
+// webhookTransactionID returns the ID webhooks cache a payment under
+func webhookTransactionID(source, reference string) string {
+	return fmt.Sprintf("%s_internal_%s", source, reference)
+}
+
+// indexPolled records the payment references of the transactions polled from source, and evicts webhook entries
+// of payments the listing reports under another ID. Must be called with upsertMu held.
+func (r *TransactionRepository) indexPolled(source string, transactions []entities.Transaction) {
+	references := make(map[string]string, len(transactions))
+	for _, transaction := range transactions {
+		reference := paymentReference(transaction)
+		if reference == "" {
+			continue
+		}
+		if _, found := references[reference]; !found {
+			references[reference] = transaction.ID
+		}
+
+		webhookID := webhookTransactionID(source, reference)
+		if webhookID == transaction.ID {
+			continue
+		}
+		if cached, found := r.cache.GetTransaction(webhookID); found && cached.Metadata["source"] == "webhook" {
+			r.cache.DeleteTransaction(webhookID)
+			logger.Debug("Replaced webhook transaction with the polled one",
+				zap.String("id", webhookID),
+				zap.String("polled_id", transaction.ID))
 		}
 	}
+	r.polled[source] = references
+}
 
-	// Fetch from Zettle
-	if r.zettleClient != nil {
-		zettleTransactions, err := r.zettleClient.GetLatestTransactions(ctx, 100)
+// refreshCache fetches the latest transactions from all configured providers into the cache and returns
+// how many were fetched and a warning for each provider that failed. It returns ErrAllProvidersFailed
+// when none of them succeeded.
+func (r *TransactionRepository) refreshCache(ctx context.Context) (int, []entities.ProviderWarning, error) {
+	providers := []struct {
+		name   string
+		source string
+		client interfaces.Transactions
+	}{
+		{"Stripe", consts.PAYMENT_SOURCE_STRIPE, r.stripeClient},
+		{"Vipps", consts.PAYMENT_SOURCE_VIPPS, r.vippsClient},
+		{"Zettle", consts.PAYMENT_SOURCE_ZETTLE, r.zettleClient},
+	}
+
+	var allTransactions []entities.Transaction
+	var warnings []entities.ProviderWarning
+	configured := 0
+	fetched := make(map[string][]entities.Transaction, len(providers))
+
+	for _, provider := range providers {
+		if provider.client == nil {
+			continue
+		}
+		configured++
+
+		transactions, err := provider.client.GetLatestTransactions(ctx, r.batchSize)
 		if err != nil {
-			logger.Error("Failed to fetch Zettle transactions", zap.Error(err))
-		} else {
-			allTransactions = append(allTransactions, zettleTransactions...)
-			logger.Info("Fetched Zettle transactions", zap.Int("count", len(zettleTransactions)))
+			logger.Error("Failed to fetch "+provider.name+" transactions", zap.Error(err))
+			warnings = append(warnings, entities.ProviderWarning{
+				Source:  provider.source,
+				Message: fmt.Sprintf("failed to fetch %s transactions", provider.name),
+			})
+			continue
 		}
+
+		allTransactions = append(allTransactions, transactions...)
+		fetched[provider.source] = transactions
+		logger.Info("Fetched "+provider.name+" transactions", zap.Int("count", len(transactions)))
+	}
+
+	if configured > 0 && len(warnings) == configured {
+		return 0, warnings, interfaces.ErrAllProvidersFailed
 	}
 
-	// Cache all transactions with 24-hour expiration
+	r.upsertMu.Lock()
 	for _, transaction := range allTransactions {
-		r.cache.SetTransaction(transaction.ID, transaction, 24*time.Hour)
+		r.cacheTransaction(transaction)
+	}
+	for source, transactions := range fetched {
+		r.indexPolled(source, transactions)
 	}
+	r.upsertMu.Unlock()
 
 	logger.Info("Refreshed transaction cache", zap.Int("total_transactions", len(allTransactions)))
-	return nil
+	return len(allTransactions), warnings, nil
+}
+
+// normalizeLimit clamps the limit to the allowed transaction limits
+func normalizeLimit(limit int) int {
+	if limit < consts.TRANSACTION_LIMIT_MIN {
+		return consts.TRANSACTION_LIMIT_DEFAULT
+	}
+	if limit > consts.TRANSACTION_LIMIT_MAX {
+		return consts.TRANSACTION_LIMIT_MAX
+	}
+	return limit
+}
+
+// sortTransactions sorts transactions by CreatedAt descending (newest first), breaking ties on ID
+func sortTransactions(transactions []entities.Transaction) {
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactionLess(transactions[i], transactions[j])
+	})
+}
+
+// transactionLess reports whether a is ordered before b (newest first, then by ID)
+func transactionLess(a, b entities.Transaction) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+// encodeCursor builds an opaque cursor from the position of a transaction
+func encodeCursor(transaction entities.Transaction) string {
+	raw := fmt.Sprintf("%s|%s", transaction.CreatedAt.UTC().Format(time.RFC3339Nano), transaction.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor into a transaction holding only CreatedAt and ID
+func decodeCursor(cursor string) (entities.Transaction, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return entities.Transaction{}, fmt.Errorf("failed to decode cursor: %w", err)
+	}
+
+	createdAtStr, id, found := strings.Cut(string(raw), "|")
+	if !found || id == "" {
+		return entities.Transaction{}, fmt.Errorf("malformed cursor")
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtStr)
+	if err != nil {
+		return entities.Transaction{}, fmt.Errorf("invalid cursor timestamp: %w", err)
+	}
+
+	return entities.Transaction{ID: id, CreatedAt: createdAt}, nil
 }
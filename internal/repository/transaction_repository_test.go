@@ -0,0 +1,599 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/cache"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/clients/vipps"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+)
+
+// newTestRepository creates a repository backed by an in-memory cache holding the given transactions
+func newTestRepository(t *testing.T, transactions []entities.Transaction) *TransactionRepository {
+	t.Helper()
+
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	for _, transaction := range transactions {
+		c.SetTransaction(transaction.ID, transaction, 1*time.Hour)
+	}
+
+	return NewTransactionRepository(c, nil, nil, nil)
+}
+
+func TestGetTransactionsPage(t *testing.T) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	repo := newTestRepository(t, []entities.Transaction{
+		{ID: "a", CreatedAt: base},
+		{ID: "b", CreatedAt: base}, // Same timestamp as "a", must break tie on ID
+		{ID: "c", CreatedAt: base.Add(1 * time.Minute)},
+		{ID: "d", CreatedAt: base.Add(-1 * time.Minute)},
+		{ID: "e", CreatedAt: base.Add(2 * time.Minute)},
+	})
+
+	ctx := context.Background()
+	expectedOrder := []string{"e", "c", "a", "b", "d"}
+
+	var seen []string
+	cursor := ""
+	for range 10 {
+		result, nextCursor, err := repo.GetTransactionsPage(ctx, entities.TransactionFilter{}, cursor, 2)
+		if err != nil {
+			t.Fatalf("GetTransactionsPage returned error: %v", err)
+		}
+		page := result.Items
+		for _, transaction := range page {
+			seen = append(seen, transaction.ID)
+		}
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+
+	if len(seen) != len(expectedOrder) {
+		t.Fatalf("Expected %d transactions across pages, got %d (%v)", len(expectedOrder), len(seen), seen)
+	}
+	for i, id := range expectedOrder {
+		if seen[i] != id {
+			t.Errorf("Expected transaction %s at position %d, got %s", id, i, seen[i])
+		}
+	}
+}
+
+func TestGetTransactionsPage_InvalidCursor(t *testing.T) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	repo := newTestRepository(t, []entities.Transaction{
+		{ID: "a", CreatedAt: base},
+		{ID: "b", CreatedAt: base.Add(1 * time.Minute)},
+	})
+
+	result, nextCursor, err := repo.GetTransactionsPage(context.Background(), entities.TransactionFilter{}, "not-a-valid-cursor", 10)
+	if err != nil {
+		t.Fatalf("GetTransactionsPage returned error: %v", err)
+	}
+	page := result.Items
+
+	if len(page) != 2 || page[0].ID != "b" {
+		t.Errorf("Expected invalid cursor to start from newest, got %v", page)
+	}
+	if nextCursor != "" {
+		t.Errorf("Expected empty next cursor on last page, got %q", nextCursor)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	transaction := entities.Transaction{
+		ID:        "stripe_internal_ch_123",
+		CreatedAt: time.Date(2025, 7, 1, 12, 30, 15, 123456789, time.UTC),
+	}
+
+	decoded, err := decodeCursor(encodeCursor(transaction))
+	if err != nil {
+		t.Fatalf("decodeCursor returned error: %v", err)
+	}
+
+	if decoded.ID != transaction.ID || !decoded.CreatedAt.Equal(transaction.CreatedAt) {
+		t.Errorf("Expected %s/%v, got %s/%v", transaction.ID, transaction.CreatedAt, decoded.ID, decoded.CreatedAt)
+	}
+}
+
+func TestGetTransactions_StatusFilter(t *testing.T) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	repo := newTestRepository(t, []entities.Transaction{
+		{ID: "a", CreatedAt: base, Status: consts.TRANSACTION_STATUS_SUCCEEDED},
+		{ID: "b", CreatedAt: base.Add(1 * time.Minute), Status: consts.TRANSACTION_STATUS_PENDING},
+		{ID: "c", CreatedAt: base.Add(2 * time.Minute), Status: consts.TRANSACTION_STATUS_REFUNDED},
+		{ID: "d", CreatedAt: base.Add(3 * time.Minute), Status: consts.TRANSACTION_STATUS_UNKNOWN},
+	})
+
+	filter := entities.TransactionFilter{
+		Statuses: []string{consts.TRANSACTION_STATUS_SUCCEEDED, consts.TRANSACTION_STATUS_REFUNDED},
+	}
+
+	result, err := repo.GetTransactions(context.Background(), filter, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions returned error: %v", err)
+	}
+	transactions := result.Items
+
+	if len(transactions) != 2 {
+		t.Fatalf("Expected 2 transactions, got %d", len(transactions))
+	}
+	if transactions[0].ID != "c" || transactions[1].ID != "a" {
+		t.Errorf("Expected transactions [c a], got [%s %s]", transactions[0].ID, transactions[1].ID)
+	}
+}
+
+func TestGetTransactions_SourceFilterAppliesBeforeLimit(t *testing.T) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	repo := newTestRepository(t, []entities.Transaction{
+		{ID: "a", CreatedAt: base, Source: consts.PAYMENT_SOURCE_ZETTLE},
+		{ID: "b", CreatedAt: base.Add(1 * time.Minute), Source: consts.PAYMENT_SOURCE_VIPPS},
+		{ID: "c", CreatedAt: base.Add(2 * time.Minute), Source: consts.PAYMENT_SOURCE_STRIPE},
+		{ID: "d", CreatedAt: base.Add(3 * time.Minute), Source: consts.PAYMENT_SOURCE_STRIPE},
+	})
+
+	filter := entities.TransactionFilter{
+		Sources: []string{consts.PAYMENT_SOURCE_ZETTLE, consts.PAYMENT_SOURCE_VIPPS},
+	}
+
+	result, err := repo.GetTransactions(context.Background(), filter, 2)
+	if err != nil {
+		t.Fatalf("GetTransactions returned error: %v", err)
+	}
+	transactions := result.Items
+
+	if len(transactions) != 2 {
+		t.Fatalf("Expected 2 transactions, got %d", len(transactions))
+	}
+	if transactions[0].ID != "b" || transactions[1].ID != "a" {
+		t.Errorf("Expected transactions [b a], got [%s %s]", transactions[0].ID, transactions[1].ID)
+	}
+}
+
+func TestCountTransactions(t *testing.T) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	repo := newTestRepository(t, []entities.Transaction{
+		{ID: "a", CreatedAt: base.Add(-24 * time.Hour), Source: consts.PAYMENT_SOURCE_STRIPE},
+		{ID: "b", CreatedAt: base, Source: consts.PAYMENT_SOURCE_VIPPS},
+		{ID: "c", CreatedAt: base.Add(1 * time.Hour), Source: consts.PAYMENT_SOURCE_STRIPE},
+	})
+
+	tests := []struct {
+		name     string
+		filter   entities.TransactionFilter
+		expected int
+	}{
+		{"no filter", entities.TransactionFilter{}, 3},
+		{"today", entities.TransactionFilter{From: base, To: base.Add(24 * time.Hour)}, 2},
+		{"today from stripe", entities.TransactionFilter{From: base, Sources: []string{consts.PAYMENT_SOURCE_STRIPE}}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := repo.CountTransactions(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("CountTransactions returned error: %v", err)
+			}
+			if count != tt.expected {
+				t.Errorf("Expected %d transactions, got %d", tt.expected, count)
+			}
+		})
+	}
+}
+
+func TestSearchTransactions(t *testing.T) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	repo := newTestRepository(t, []entities.Transaction{
+		{ID: "a", CreatedAt: base, Description: "Cabin booking ORDER-1234"},
+		{ID: "b", CreatedAt: base.Add(1 * time.Minute), ExternalID: "order-1234-b"},
+		{ID: "c", CreatedAt: base.Add(2 * time.Minute), Metadata: map[string]string{"reference": "Order-1234"}},
+		{ID: "d", CreatedAt: base.Add(3 * time.Minute), Description: "Shower", Metadata: map[string]string{"order-1234": "key only"}},
+	})
+	ctx := context.Background()
+
+	transactions, err := repo.SearchTransactions(ctx, "order-1234", 10)
+	if err != nil {
+		t.Fatalf("SearchTransactions returned error: %v", err)
+	}
+	if len(transactions) != 3 || transactions[0].ID != "c" || transactions[1].ID != "b" || transactions[2].ID != "a" {
+		t.Fatalf("Expected transactions [c b a], got %v", transactions)
+	}
+
+	limited, _ := repo.SearchTransactions(ctx, "ORDER", 2)
+	if len(limited) != 2 || limited[0].ID != "c" {
+		t.Errorf("Expected the 2 newest matches, got %v", limited)
+	}
+
+	none, _ := repo.SearchTransactions(ctx, "kayak", 10)
+	if len(none) != 0 {
+		t.Errorf("Expected no matches, got %v", none)
+	}
+}
+
+func TestUpsertTransaction_ReplacesByID(t *testing.T) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	repo := newTestRepository(t, []entities.Transaction{
+		{ID: "zettle_internal_order-1", ExternalID: "order-1", Source: consts.PAYMENT_SOURCE_ZETTLE, CreatedAt: base},
+	})
+	ctx := context.Background()
+
+	captured := entities.Transaction{ID: "vipps_internal_order-1", ExternalID: "order-1", Source: consts.PAYMENT_SOURCE_VIPPS, CreatedAt: base, Status: consts.TRANSACTION_STATUS_SUCCEEDED}
+	for range 2 {
+		if err := repo.UpsertTransaction(ctx, captured); err != nil {
+			t.Fatalf("UpsertTransaction returned error: %v", err)
+		}
+	}
+
+	result, _ := repo.GetTransactions(ctx, entities.TransactionFilter{Sources: []string{consts.PAYMENT_SOURCE_VIPPS}}, 10)
+	transactions := result.Items
+	if len(transactions) != 1 || transactions[0].ID != captured.ID {
+		t.Fatalf("Expected a single Vipps transaction, got %v", transactions)
+	}
+
+	// A late, non-final event must not overwrite the final status
+	late := captured
+	late.Status = consts.TRANSACTION_STATUS_PROCESSING
+	if err := repo.UpsertTransaction(ctx, late); err != nil {
+		t.Fatalf("UpsertTransaction returned error: %v", err)
+	}
+
+	transaction, _ := repo.GetTransactionByID(ctx, captured.ID)
+	if transaction.Status != consts.TRANSACTION_STATUS_SUCCEEDED {
+		t.Errorf("Expected status to stay %s, got %s", consts.TRANSACTION_STATUS_SUCCEEDED, transaction.Status)
+	}
+
+	// A later event keeps the payment on its original date
+	refunded := captured
+	refunded.Status = consts.TRANSACTION_STATUS_REFUNDED
+	refunded.CreatedAt = base.Add(72 * time.Hour)
+	if err := repo.UpsertTransaction(ctx, refunded); err != nil {
+		t.Fatalf("UpsertTransaction returned error: %v", err)
+	}
+	transaction, _ = repo.GetTransactionByID(ctx, captured.ID)
+	if transaction.Status != consts.TRANSACTION_STATUS_REFUNDED || !transaction.CreatedAt.Equal(base) {
+		t.Errorf("Expected a refunded transaction created at %v, got %s created at %v", base, transaction.Status, transaction.CreatedAt)
+	}
+
+	// Other sources sharing the external ID are left alone
+	if _, err := repo.GetTransactionByID(ctx, "zettle_internal_order-1"); err != nil {
+		t.Errorf("Expected Zettle transaction to remain cached: %v", err)
+	}
+}
+
+func TestUpsertTransaction_PolledVippsPaymentCountedOnce(t *testing.T) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	reportRow := entities.Transaction{
+		ID:         "vipps_report_tx-1",
+		ExternalID: "tx-1",
+		Source:     consts.PAYMENT_SOURCE_VIPPS,
+		Amount:     390,
+		Status:     consts.TRANSACTION_STATUS_SUCCEEDED,
+		CreatedAt:  base,
+		Metadata:   map[string]string{"order_id": "order-1", "source": "reports_api"},
+	}
+	webhook := entities.Transaction{
+		ID:         "vipps_internal_order-1",
+		ExternalID: "order-1",
+		Source:     consts.PAYMENT_SOURCE_VIPPS,
+		Amount:     390,
+		Status:     consts.TRANSACTION_STATUS_SUCCEEDED,
+		CreatedAt:  base,
+		Metadata:   map[string]string{"order_id": "order-1", "source": "webhook"},
+	}
+	vipps := &fakeListClient{}
+	repo := NewTransactionRepository(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), nil, vipps, nil, WithRefreshCooldown(0))
+	ctx := context.Background()
+
+	expectOnly := func(id string) {
+		t.Helper()
+		result, err := repo.GetTransactions(ctx, entities.TransactionFilter{}, 10)
+		if err != nil {
+			t.Fatalf("GetTransactions returned error: %v", err)
+		}
+		if len(result.Items) != 1 || result.Items[0].ID != id {
+			t.Errorf("Expected only %s, got %v", id, result.Items)
+		}
+	}
+
+	// The webhook entry stands in for the payment until the listing reports it
+	if err := repo.UpsertTransaction(ctx, webhook); err != nil {
+		t.Fatalf("UpsertTransaction returned error: %v", err)
+	}
+	expectOnly(webhook.ID)
+
+	vipps.transactions = []entities.Transaction{reportRow}
+	if _, err := repo.RefreshCache(ctx); err != nil {
+		t.Fatalf("RefreshCache returned error: %v", err)
+	}
+	expectOnly(reportRow.ID)
+
+	// Later events of a polled payment are left to the listing
+	if err := repo.UpsertTransaction(ctx, webhook); err != nil {
+		t.Fatalf("UpsertTransaction returned error: %v", err)
+	}
+	expectOnly(reportRow.ID)
+}
+
+func TestUpdateTransaction_UnsuccessfulVippsEventKeepsPayment(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	ctx := context.Background()
+
+	apply := func(body string) {
+		t.Helper()
+		event, err := vipps.ParseWebhookEvent([]byte(body))
+		if err != nil {
+			t.Fatalf("Failed to parse webhook event: %v", err)
+		}
+		if err := repo.UpdateTransaction(ctx, event.TransactionID(), event.Apply); err != nil {
+			t.Fatalf("UpdateTransaction returned error: %v", err)
+		}
+	}
+
+	apply(`{"reference": "order-1", "name": "CAPTURED", "amount": {"currency": "NOK", "value": 39000}, "success": true}`)
+	apply(`{"reference": "order-1", "name": "REFUNDED", "amount": {"currency": "NOK", "value": 39000}, "success": false}`)
+
+	transaction, _ := repo.GetTransactionByID(ctx, "vipps_internal_order-1")
+	if transaction.Status != consts.TRANSACTION_STATUS_SUCCEEDED || transaction.Amount != 390 {
+		t.Errorf("Expected the payment to stay succeeded with 390, got %s with %.2f", transaction.Status, transaction.Amount)
+	}
+	if transaction.Metadata["event"] != "REFUNDED" || transaction.Metadata["event_success"] != "false" {
+		t.Errorf("Expected the outcome of the refund in metadata, got %v", transaction.Metadata)
+	}
+
+	// A succeeded payment is never marked failed, whatever the update says
+	failed := transaction
+	failed.Status = consts.TRANSACTION_STATUS_FAILED
+	if err := repo.UpsertTransaction(ctx, failed); err != nil {
+		t.Fatalf("UpsertTransaction returned error: %v", err)
+	}
+	transaction, _ = repo.GetTransactionByID(ctx, "vipps_internal_order-1")
+	if transaction.Status != consts.TRANSACTION_STATUS_SUCCEEDED {
+		t.Errorf("Expected status to stay %s, got %s", consts.TRANSACTION_STATUS_SUCCEEDED, transaction.Status)
+	}
+}
+
+// fakeLookupClient is a provider client whose lookups return a fixed result
+type fakeLookupClient struct {
+	transaction entities.Transaction
+	err         error
+}
+
+func (f *fakeLookupClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
+	return nil, nil
+}
+
+func (f *fakeLookupClient) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
+	return f.transaction, f.err
+}
+
+func TestGetTransactionByID_NotFound(t *testing.T) {
+	notFound := &fakeLookupClient{err: fmt.Errorf("%w: missing", interfaces.ErrTransactionNotFound)}
+	repo := NewTransactionRepository(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), notFound, nil, notFound)
+
+	_, err := repo.GetTransactionByID(context.Background(), "missing")
+	if !errors.Is(err, interfaces.ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+}
+
+func TestGetTransactionByID_ProviderError(t *testing.T) {
+	notFound := &fakeLookupClient{err: fmt.Errorf("%w: missing", interfaces.ErrTransactionNotFound)}
+	failing := &fakeLookupClient{err: errors.New("connection refused")}
+	repo := NewTransactionRepository(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), notFound, failing, nil)
+
+	_, err := repo.GetTransactionByID(context.Background(), "missing")
+	if err == nil || errors.Is(err, interfaces.ErrTransactionNotFound) {
+		t.Errorf("Expected a provider error, got %v", err)
+	}
+
+	// A later provider finding the transaction still wins over an earlier failure
+	found := &fakeLookupClient{transaction: entities.Transaction{ID: "zettle_internal_1"}}
+	repo = NewTransactionRepository(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), failing, nil, found)
+
+	transaction, err := repo.GetTransactionByID(context.Background(), "1")
+	if err != nil || transaction.ID != "zettle_internal_1" {
+		t.Errorf("Expected transaction from Zettle, got %v (err %v)", transaction, err)
+	}
+}
+
+// fakeListClient is a provider client whose listings return a fixed result
+type fakeListClient struct {
+	transactions []entities.Transaction
+	err          error
+	limit        int // Limit of the last listing
+}
+
+func (f *fakeListClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
+	f.limit = limit
+	return f.transactions, f.err
+}
+
+func (f *fakeListClient) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
+	return entities.Transaction{}, interfaces.ErrTransactionNotFound
+}
+
+func TestGetTransactions_PartialProviderFailure(t *testing.T) {
+	stripe := &fakeListClient{transactions: []entities.Transaction{{ID: "stripe_1", Source: consts.PAYMENT_SOURCE_STRIPE}}}
+	failing := &fakeListClient{err: errors.New("connection refused")}
+	repo := NewTransactionRepository(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), stripe, failing, nil)
+
+	result, err := repo.GetTransactions(context.Background(), entities.TransactionFilter{}, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions returned error: %v", err)
+	}
+
+	if len(result.Items) != 1 || result.Items[0].ID != "stripe_1" {
+		t.Errorf("Expected the Stripe transaction, got %v", result.Items)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Source != consts.PAYMENT_SOURCE_VIPPS {
+		t.Errorf("Expected a single Vipps warning, got %v", result.Warnings)
+	}
+}
+
+func TestRefreshCache_FetchBatchSize(t *testing.T) {
+	client := &fakeListClient{}
+
+	repo := NewTransactionRepository(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), client, nil, nil)
+	if _, err := repo.RefreshCache(context.Background()); err != nil {
+		t.Fatalf("RefreshCache returned error: %v", err)
+	}
+	if client.limit != consts.FETCH_BATCH_SIZE_DEFAULT {
+		t.Errorf("Expected the default batch size %d, got %d", consts.FETCH_BATCH_SIZE_DEFAULT, client.limit)
+	}
+
+	repo = NewTransactionRepository(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), client, nil, nil,
+		WithFetchBatchSize(250))
+	if _, err := repo.RefreshCache(context.Background()); err != nil {
+		t.Fatalf("RefreshCache returned error: %v", err)
+	}
+	if client.limit != 250 {
+		t.Errorf("Expected the configured batch size 250, got %d", client.limit)
+	}
+}
+
+func TestGetTransactions_AllProvidersFailed(t *testing.T) {
+	failing := &fakeListClient{err: errors.New("connection refused")}
+	repo := NewTransactionRepository(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute), failing, nil, failing)
+
+	_, err := repo.GetTransactions(context.Background(), entities.TransactionFilter{}, 10)
+	if !errors.Is(err, interfaces.ErrAllProvidersFailed) {
+		t.Errorf("Expected ErrAllProvidersFailed, got %v", err)
+	}
+
+	if _, err := repo.RefreshCache(context.Background()); !errors.Is(err, interfaces.ErrAllProvidersFailed) {
+		t.Errorf("Expected RefreshCache to return ErrAllProvidersFailed, got %v", err)
+	}
+}
+
+func TestRefreshTransaction_BypassesCache(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	c.SetTransaction("stripe_ch_1", entities.Transaction{ID: "stripe_ch_1", Status: consts.TRANSACTION_STATUS_SUCCEEDED}, 1*time.Hour)
+
+	disputed := &fakeLookupClient{transaction: entities.Transaction{ID: "stripe_ch_1", Status: consts.TRANSACTION_STATUS_REFUNDED}}
+	repo := NewTransactionRepository(c, disputed, nil, nil)
+	ctx := context.Background()
+
+	transaction, err := repo.RefreshTransaction(ctx, "stripe_ch_1")
+	if err != nil {
+		t.Fatalf("RefreshTransaction returned error: %v", err)
+	}
+	if transaction.Status != consts.TRANSACTION_STATUS_REFUNDED {
+		t.Errorf("Expected the provider status, got %q", transaction.Status)
+	}
+
+	cached, _ := repo.GetTransactionByID(ctx, "stripe_ch_1")
+	if cached.Status != consts.TRANSACTION_STATUS_REFUNDED {
+		t.Errorf("Expected the cache entry to be overwritten, got status %q", cached.Status)
+	}
+
+	notFound := &fakeLookupClient{err: fmt.Errorf("%w: missing", interfaces.ErrTransactionNotFound)}
+	repo = NewTransactionRepository(c, notFound, nil, nil)
+	if _, err := repo.RefreshTransaction(ctx, "stripe_ch_1"); !errors.Is(err, interfaces.ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound even though the transaction is cached, got %v", err)
+	}
+}
+
+func TestGetTransactions_SourceFilterUsesSourceField(t *testing.T) {
+	repo := newTestRepository(t, []entities.Transaction{
+		// IDs that would fool a key substring match
+		{ID: "vipps_refund_of_stripe", Source: consts.PAYMENT_SOURCE_STRIPE, CreatedAt: time.Now()},
+		{ID: "tx_2", Source: consts.PAYMENT_SOURCE_VIPPS, CreatedAt: time.Now()},
+	})
+
+	filter := entities.TransactionFilter{Sources: []string{consts.PAYMENT_SOURCE_VIPPS, consts.PAYMENT_SOURCE_VIPPS}}
+	result, err := repo.GetTransactions(context.Background(), filter, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Items) != 1 || result.Items[0].ID != "tx_2" {
+		t.Errorf("Expected only tx_2, got %v", result.Items)
+	}
+}
+
+func TestGetTransactions_EmptySourceDoesNotRefresh(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	c.SetTransaction("stripe_1", entities.Transaction{ID: "stripe_1", Source: consts.PAYMENT_SOURCE_STRIPE}, 1*time.Hour)
+	client := &blockingListClient{release: make(chan struct{})}
+	close(client.release)
+	repo := NewTransactionRepository(c, client, nil, nil)
+
+	filter := entities.TransactionFilter{Sources: []string{consts.PAYMENT_SOURCE_ZETTLE}}
+	result, err := repo.GetTransactions(context.Background(), filter, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Items) != 0 {
+		t.Errorf("Expected no Zettle transactions, got %v", result.Items)
+	}
+	if calls := client.calls.Load(); calls != 0 {
+		t.Errorf("Expected no fallback refresh while the cache holds other sources, got %d fetches", calls)
+	}
+}
+
+func TestArchiveTransaction_SurvivesRefresh(t *testing.T) {
+	stripe := &fakeListClient{transactions: []entities.Transaction{
+		{ID: "stripe_1", Source: consts.PAYMENT_SOURCE_STRIPE, CreatedAt: time.Now()},
+		{ID: "stripe_2", Source: consts.PAYMENT_SOURCE_STRIPE, CreatedAt: time.Now()},
+	}}
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	repo := NewTransactionRepository(c, stripe, nil, nil)
+	ctx := context.Background()
+
+	if _, _, err := repo.refreshCache(ctx); err != nil {
+		t.Fatalf("refreshCache returned error: %v", err)
+	}
+
+	archived, err := repo.ArchiveTransaction(ctx, "stripe_1")
+	if err != nil {
+		t.Fatalf("ArchiveTransaction returned error: %v", err)
+	}
+	if !archived.Archived {
+		t.Error("Expected the returned transaction to be archived")
+	}
+
+	// The provider never reports the flag, so a re-fetch overwrites the cached entry without it
+	if _, _, err := repo.refreshCache(ctx); err != nil {
+		t.Fatalf("refreshCache returned error: %v", err)
+	}
+
+	result, err := repo.GetTransactions(ctx, entities.TransactionFilter{}, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions returned error: %v", err)
+	}
+	if len(result.Items) != 1 || result.Items[0].ID != "stripe_2" {
+		t.Errorf("Expected only stripe_2 by default, got %v", result.Items)
+	}
+
+	result, err = repo.GetTransactions(ctx, entities.TransactionFilter{IncludeArchived: true}, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions returned error: %v", err)
+	}
+	if len(result.Items) != 2 {
+		t.Errorf("Expected both transactions with IncludeArchived, got %v", result.Items)
+	}
+
+	transaction, err := repo.GetTransactionByID(ctx, "stripe_1")
+	if err != nil || !transaction.Archived {
+		t.Errorf("Expected stripe_1 to still be archived, got %v (err %v)", transaction, err)
+	}
+}
+
+func TestArchiveTransaction_NotFound(t *testing.T) {
+	notFound := &fakeLookupClient{err: fmt.Errorf("%w: missing", interfaces.ErrTransactionNotFound)}
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	repo := NewTransactionRepository(c, notFound, nil, nil)
+
+	if _, err := repo.ArchiveTransaction(context.Background(), "missing"); !errors.Is(err, interfaces.ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+	if _, found := c.GetAnnotation("missing"); found {
+		t.Error("Expected an unknown transaction not to be archived")
+	}
+}
@@ -7,9 +7,13 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/handlers/adminhandler"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/handlers/healthhandler"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/handlers/openapihandler"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/handlers/priceshandler"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/handlers/transactionshandler"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/handlers/userhandler"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/handlers/webhookhandler"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/middlewares"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/readiness"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/services"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
 	"go.uber.org/zap"
@@ -28,17 +32,32 @@ func addCORSPreflightHandlers(router *mux.Router) {
 	router.Methods("OPTIONS").HandlerFunc(corsPreflightHandler)
 }
 
+// isAPIPath checks if a path belongs to the /v1 API rather than the public routes
+func isAPIPath(path string) bool {
+	return path == "/v1" || strings.HasPrefix(path, "/v1/")
+}
+
 // SetupRoutes configures all the routes for the application
 func SetupRoutes(router *mux.Router, logger *zap.Logger) {
-	router.Use(middlewares.CORSMiddleware)
+	// Recover from panics outermost, so a panicking handler or middleware gets a clean 500
+	router.Use(middlewares.RecoveryMiddleware)
+	// Tag requests with an ID next so every log line for the request can be correlated
+	router.Use(middlewares.RequestIDMiddleware)
 	router.Use(middlewares.LoggingMiddleware)
 	router.Use(middlewares.ContentTypeMiddleware)
 
-	// Handle OPTIONS requests globally for CORS preflight
-	addCORSPreflightHandlers(router)
+	// Public routes are everything outside /v1. They allow any origin (CORS_PUBLIC_ORIGINS) without credentials,
+	// while the API below is restricted to the configured origins.
+	public := router.MatcherFunc(func(r *http.Request, _ *mux.RouteMatch) bool {
+		return !isAPIPath(r.URL.Path)
+	}).Subrouter()
+	public.Use(middlewares.CORSMiddlewareWithConfig(middlewares.PublicCORSConfig()))
+
+	// Handle OPTIONS requests on public routes for CORS preflight
+	addCORSPreflightHandlers(public)
 
 	// Root endpoint - simple response for basic connectivity check
-	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	public.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			http.NotFound(w, r)
 			return
@@ -50,7 +69,7 @@ func SetupRoutes(router *mux.Router, logger *zap.Logger) {
 
 	// ACME challenge endpoint for Let's Encrypt cert-manager
 	// This allows cert-manager to place challenge files that can be served
-	router.PathPrefix("/.well-known/acme-challenge/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	public.PathPrefix("/.well-known/acme-challenge/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Extract the token from the URL path
 		token := r.URL.Path[len("/.well-known/acme-challenge/"):]
 		if token == "" {
@@ -64,35 +83,94 @@ func SetupRoutes(router *mux.Router, logger *zap.Logger) {
 	}).Methods("GET")
 
 	// Health check endpoint (unprotected)
-	router.HandleFunc("/health", healthhandler.HealthHandler(logger)).Methods("GET")
+	public.HandleFunc("/health", healthhandler.HealthHandler(logger)).Methods("GET")
+	// Readiness check endpoint (unprotected), fails until startup has completed
+	public.HandleFunc("/ready", healthhandler.ReadyHandler(readiness.Default, logger)).Methods("GET")
+	// OpenAPI document of all routes (unprotected, it only describes the API)
+	public.HandleFunc("/openapi.json", openapihandler.OpenAPIHandler(logger)).Methods("GET")
+
+	// Webhook endpoints - called by payment providers, so they are not protected by Google OAuth.
+	// Registered before the v1 subrouter so they match first.
+	webhooksRouter := router.PathPrefix("/v1/webhooks").Subrouter()
+	webhooksRouter.HandleFunc("/stripe", webhookhandler.StripeWebhookHandler(services.GlobalTransactionService, logger)).Methods("POST")
+	webhooksRouter.HandleFunc("/vipps", webhookhandler.VippsWebhookHandler(services.GlobalTransactionService, logger)).Methods("POST")
 
 	// v1 API routes (protected with auth middleware)
 	v1 := router.PathPrefix("/v1").Subrouter()
 
+	// Restrict CORS to the configured origins first, so preflight requests are answered before authentication
+	v1.Use(middlewares.CORSMiddlewareWithConfig(middlewares.CORSConfigFromSettings()))
+
 	// Handle OPTIONS requests for v1 routes as well
 	addCORSPreflightHandlers(v1)
 
+	// Limit request bodies before any handler decodes them
+	v1.Use(middlewares.BodyLimitMiddleware())
+
+	// Rate limit per IP before authentication, so unauthenticated floods don't reach token validation
+	v1.Use(middlewares.IPRateLimitMiddleware())
+
 	v1.Use(middlewares.AuthMiddleware)
 
+	// Rate limit per authenticated user, so it runs after authentication
+	v1.Use(middlewares.RateLimitMiddleware())
+
 	// Basic access check - user must have any access (not no_access role)
 	v1.Use(middlewares.RequireAccess())
 
 	// User endpoint - accessible to all authenticated users with access
 	v1.HandleFunc("/user", userhandler.UserHandler(logger)).Methods("GET")
+	v1.HandleFunc("/user/permissions", userhandler.PermissionsHandler(logger)).Methods("GET")
+
+	// Price list - accessible to all authenticated users with access
+	v1.HandleFunc("/prices", priceshandler.ListPricesHandler(services.PriceService, logger)).Methods("GET")
 
 	// Transaction endpoints - require user role or higher
 	transactionsRouter := v1.PathPrefix("/transactions").Subrouter()
 	transactionsRouter.Use(middlewares.RequireMinimumRole(entities.RoleUser))
 	transactionsRouter.HandleFunc("", transactionshandler.TransactionsHandler(services.GlobalTransactionService)).Methods("GET")
-	transactionsRouter.HandleFunc("/by-id", transactionshandler.TransactionByIDHandler(services.GlobalTransactionService)).Methods("GET")
-	transactionsRouter.HandleFunc("/refresh-cache", transactionshandler.RefreshCacheHandler(services.GlobalTransactionService)).Methods("POST")
-
-	// Admin endpoints - require admin role
+	transactionsRouter.HandleFunc("/summary", transactionshandler.TransactionsSummaryHandler(services.GlobalTransactionService, services.GlobalCurrencyConverter)).Methods("GET")
+	transactionsRouter.HandleFunc("/search", transactionshandler.SearchTransactionsHandler(services.GlobalTransactionService)).Methods("GET")
+	transactionsRouter.HandleFunc("/count", transactionshandler.TransactionsCountHandler(services.GlobalTransactionService)).Methods("GET")
+	transactionsRouter.HandleFunc("/latest", transactionshandler.LatestTransactionsHandler(services.GlobalTransactionService)).Methods("GET")
+	transactionsRouter.HandleFunc("/export", transactionshandler.ExportTransactionsHandler(services.GlobalTransactionService, logger)).Methods("GET")
+	transactionsRouter.HandleFunc("/stream", transactionshandler.TransactionStreamHandler(services.GlobalCacheNotifier, logger)).Methods("GET")
+	// Deprecated: use /v1/transactions/{id}
+	transactionsRouter.HandleFunc("/by-id", transactionshandler.TransactionByIDHandler(services.GlobalTransactionService, logger)).Methods("GET")
+	// Refreshing the cache fetches from every provider, so like re-fetching a single transaction from its provider it requires the refresh permission (editor or admin)
+	transactionsRouter.Handle("/refresh-cache", middlewares.RequirePermission(entities.PermissionRefreshTransactions)(
+		transactionshandler.RefreshCacheHandler(services.GlobalTransactionService))).Methods("POST")
+	transactionsRouter.Handle("/{id:.*}/refresh", middlewares.RequirePermission(entities.PermissionRefreshTransactions)(
+		transactionshandler.RefreshTransactionHandler(services.GlobalTransactionService, logger))).Methods("POST")
+	// Archiving hides a transaction from listings and requires admin role
+	transactionsRouter.Handle("/{id:.*}/archive", middlewares.RequireRole(entities.RoleAdmin)(
+		transactionshandler.ArchiveTransactionHandler(services.GlobalTransactionService, logger))).Methods("POST")
+	// Registered after the fixed paths above; the pattern allows provider IDs containing slashes
+	transactionsRouter.HandleFunc("/{id:.*}", transactionshandler.TransactionByIDHandler(services.GlobalTransactionService, logger)).Methods("GET")
+	// Editing the notes of a transaction requires editor role or higher
+	transactionsRouter.Handle("/{id:.*}", middlewares.RequireMinimumRole(entities.RoleEditor)(
+		transactionshandler.UpdateTransactionHandler(services.GlobalTransactionService, logger))).Methods("PATCH")
+	// Evicting a transaction from the cache requires admin role
+	transactionsRouter.Handle("/{id:.*}", middlewares.RequireRole(entities.RoleAdmin)(
+		transactionshandler.DeleteTransactionHandler(services.GlobalTransactionService, logger))).Methods("DELETE")
+
+	// Reports - require user role or higher, like the transactions they are built from
+	reportsRouter := v1.PathPrefix("/reports").Subrouter()
+	reportsRouter.Use(middlewares.RequireMinimumRole(entities.RoleUser))
+	reportsRouter.HandleFunc("/revenue-by-product", transactionshandler.RevenueByProductHandler(services.GlobalTransactionService, services.GlobalCurrencyConverter, logger)).Methods("GET")
+	reportsRouter.HandleFunc("/timeseries", transactionshandler.RevenueTimeseriesHandler(services.GlobalTransactionService, logger)).Methods("GET")
+
+	// Admin endpoints - require admin role (assign-role grants roles, so this must never be weaker)
 	adminRouter := v1.PathPrefix("/admin").Subrouter()
-	adminRouter.Use(middlewares.RequireRole(entities.RoleUser))
+	adminRouter.Use(middlewares.RequireRole(entities.RoleAdmin))
 	adminRouter.HandleFunc("/users", adminhandler.ListUsersHandler(logger)).Methods("GET")
 	adminRouter.HandleFunc("/assign-role", adminhandler.AssignRoleHandler(logger)).Methods("POST")
 	adminRouter.HandleFunc("/background-fetcher-status", adminhandler.BackgroundFetcherStatusHandler(logger)).Methods("GET")
+	adminRouter.HandleFunc("/cache/stats", adminhandler.CacheStatsHandler(logger)).Methods("GET")
+	adminRouter.HandleFunc("/providers/health", adminhandler.ProviderHealthHandler(logger)).Methods("GET")
+	adminRouter.HandleFunc("/prices", priceshandler.UpsertPriceHandler(services.PriceService, logger)).Methods("PUT")
+	adminRouter.HandleFunc("/prices/reload", priceshandler.ReloadPricesHandler(services.PriceService, logger)).Methods("POST")
+	adminRouter.HandleFunc("/prices/match-preview", priceshandler.MatchPreviewHandler(services.PriceService, logger)).Methods("POST")
 
 	// Catch-all handler for unmatched routes - must be last
 	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,243 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/handlers/openapihandler"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/middlewares"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// fakeGoogleTransport answers Google token verification calls, mapping access tokens to emails
+type fakeGoogleTransport map[string]string
+
+func (f fakeGoogleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := req.URL.Query().Get("access_token")
+	if token == "" {
+		token = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	}
+
+	email, ok := f[token]
+	status, body := http.StatusBadRequest, `{"error": "invalid_token"}`
+	if ok {
+		status = http.StatusOK
+		body = `{"user_id": "` + token + `", "id": "` + token + `", "email": "` + email + `", "verified_email": true, "expires_in": 3600}`
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// newTestRouter sets up all routes with a fake Google that knows an admin and a regular user token
+func newTestRouter(t *testing.T) *mux.Router {
+	t.Helper()
+
+	viper.Set(consts.ADMIN_EMAILS, "admin@test.com")
+	viper.Set(consts.USER_EMAILS, "user@test.com")
+	t.Cleanup(viper.Reset)
+
+	middlewares.InitializeRoleService()
+	middlewares.SetHTTPClient(&http.Client{Transport: fakeGoogleTransport{
+		"admin-token": "admin@test.com",
+		"user-token":  "user@test.com",
+	}})
+
+	router := mux.NewRouter()
+	SetupRoutes(router, zap.NewNop())
+	return router
+}
+
+func serve(router *mux.Router, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminRoutes_RequireAdminRole(t *testing.T) {
+	router := newTestRouter(t)
+
+	rec := serve(router, "POST", "/v1/admin/assign-role", "user-token", `{"email": "user@test.com", "role": "admin"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a regular user to get %d on assign-role, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	rec = serve(router, "POST", "/v1/admin/assign-role", "admin-token", `{"email": "guest@test.com", "role": "user"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected an admin to get %d on assign-role, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdminRoutes_AllGated(t *testing.T) {
+	router := newTestRouter(t)
+
+	// Every route under /v1/admin must reject regular users before reaching the handler
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(path, "/v1/admin/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		for _, method := range methods {
+			if method == http.MethodOptions {
+				continue
+			}
+			if rec := serve(router, method, path, "user-token", "{}"); rec.Code != http.StatusForbidden {
+				t.Errorf("Expected %s %s to return %d for a regular user, got %d", method, path, http.StatusForbidden, rec.Code)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk routes: %v", err)
+	}
+}
+
+func TestDeleteTransaction_RequiresAdminRole(t *testing.T) {
+	router := newTestRouter(t)
+
+	if rec := serve(router, "DELETE", "/v1/transactions/stripe_internal_ch_1", "user-token", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a regular user to get %d when deleting a transaction, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestRefreshCache_RequiresRefreshPermission(t *testing.T) {
+	router := newTestRouter(t)
+
+	if rec := serve(router, "POST", "/v1/transactions/refresh-cache", "user-token", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a regular user to get %d when refreshing the cache, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+// pathParamPattern strips the regular expressions from mux path variables, e.g. {id:.*} becomes {id}
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+func TestOpenAPISpec_DocumentsAllRoutes(t *testing.T) {
+	router := newTestRouter(t)
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openapihandler.Spec(), &spec); err != nil {
+		t.Fatalf("Failed to decode OpenAPI document: %v", err)
+	}
+
+	documented := 0
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		// The root and ACME challenge routes serve infrastructure, not API clients
+		if err != nil || path == "/" || strings.HasPrefix(path, "/.well-known/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Prefix routes without methods are subrouters and catch-alls, not endpoints
+			return nil
+		}
+
+		path = pathParamPattern.ReplaceAllString(path, "{$1}")
+		for _, method := range methods {
+			if method == http.MethodOptions {
+				continue
+			}
+			if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+				t.Errorf("Route %s %s is missing from the OpenAPI document", method, path)
+				continue
+			}
+			documented++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk routes: %v", err)
+	}
+	if documented == 0 {
+		t.Fatal("Expected routes to be documented")
+	}
+}
+
+func TestOpenAPIRoute_Unprotected(t *testing.T) {
+	router := newTestRouter(t)
+
+	rec := serve(router, "GET", "/openapi.json", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d without a token, got %d", http.StatusOK, rec.Code)
+	}
+	if !json.Valid(rec.Body.Bytes()) {
+		t.Error("Expected the OpenAPI document to be valid JSON")
+	}
+}
+
+func TestIPRateLimit_BeforeAuthentication(t *testing.T) {
+	viper.Set(consts.RATE_LIMIT_IP_RPS, 1)
+	viper.Set(consts.RATE_LIMIT_IP_BURST, 1)
+	router := newTestRouter(t)
+
+	// An invalid token fails authentication, and a flood of them is limited before reaching Google
+	if rec := serve(router, "GET", "/v1/user", "invalid-token", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	if rec := serve(router, "GET", "/v1/user", "invalid-token", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+}
+
+func TestCORS_PublicAndAPIPolicies(t *testing.T) {
+	viper.Set(consts.CORS_ORIGINS, "https://app.example.com")
+	viper.Set(consts.CORS_PUBLIC_ORIGINS, "*")
+	router := newTestRouter(t)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		origin         string
+		expectedStatus int
+		expectedOrigin string
+	}{
+		{"public route allows any origin", "GET", "/health", "https://status.example.com", http.StatusOK, "*"},
+		{"public preflight", "OPTIONS", "/openapi.json", "https://status.example.com", http.StatusOK, "*"},
+		// Preflight requests carry no token, so they must be answered before authentication
+		{"api preflight from the SPA", "OPTIONS", "/v1/transactions", "https://app.example.com", http.StatusOK, "https://app.example.com"},
+		{"api preflight from another origin", "OPTIONS", "/v1/transactions", "https://status.example.com", http.StatusOK, ""},
+		{"api request from another origin", "GET", "/v1/user", "https://status.example.com", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			if tt.method != "OPTIONS" {
+				req.Header.Set("Authorization", "Bearer user-token")
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tt.expectedOrigin, got)
+			}
+		})
+	}
+}
@@ -2,24 +2,88 @@ package services
 
 import (
 	"context"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
 	"go.uber.org/zap"
 )
 
+// ProviderStats holds fetch statistics for a single provider
+type ProviderStats struct {
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastFetchCount      int        `json:"last_fetch_count"`
+	LastFetchDuration   string     `json:"last_fetch_duration,omitempty"`
+}
+
 type BackgroundFetcher struct {
 	cache        interfaces.Cache
 	stripeClient interfaces.Transactions
 	vippsClient  interfaces.Transactions
 	zettleClient interfaces.Transactions
 	interval     time.Duration
-	stopChan     chan struct{}
-	wg           sync.WaitGroup
-	running      bool
-	mu           sync.RWMutex
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	ttl          time.Duration
+	batchSize    int
+	// Annotations of transactions created longer ago than this are pruned, as those are no longer fetched
+	annotationRetention time.Duration
+	stopChan            chan struct{}
+	wg                  sync.WaitGroup
+	running             bool
+	mu                  sync.RWMutex
+
+	// Cancels the context of in-flight fetches, so stopping doesn't wait out slow provider calls
+	cancel context.CancelFunc
+
+	// Goroutines started by the fetcher that haven't returned yet, by name, reported when a stop times out
+	active   map[string]int
+	activeMu sync.Mutex
+
+	// Per-provider fetch statistics
+	stats   map[string]*ProviderStats
+	statsMu sync.RWMutex
+
+	// Closed once the initial fetch from all providers has completed
+	initialFetchDone chan struct{}
+	initialFetchOnce sync.Once
+}
+
+// BackgroundFetcherOption configures optional settings on a BackgroundFetcher
+type BackgroundFetcherOption func(*BackgroundFetcher)
+
+// WithTransactionTTL sets how long fetched transactions are kept in the cache
+func WithTransactionTTL(ttl time.Duration) BackgroundFetcherOption {
+	return func(bf *BackgroundFetcher) {
+		if ttl > 0 {
+			bf.ttl = ttl
+		}
+	}
+}
+
+// WithBatchSize sets how many transactions are fetched from each provider per fetch
+func WithBatchSize(size int) BackgroundFetcherOption {
+	return func(bf *BackgroundFetcher) {
+		if size > 0 {
+			bf.batchSize = size
+		}
+	}
+}
+
+// WithAnnotationRetention sets how long after its transaction was created an annotation is kept.
+// It should match the fetch lookback window.
+func WithAnnotationRetention(retention time.Duration) BackgroundFetcherOption {
+	return func(bf *BackgroundFetcher) {
+		if retention > 0 {
+			bf.annotationRetention = retention
+		}
+	}
 }
 
 func NewBackgroundFetcher(
@@ -28,15 +92,34 @@ func NewBackgroundFetcher(
 	vippsClient interfaces.Transactions,
 	zettleClient interfaces.Transactions,
 	interval time.Duration,
+	baseBackoff time.Duration,
+	maxBackoff time.Duration,
+	opts ...BackgroundFetcherOption,
 ) *BackgroundFetcher {
-	return &BackgroundFetcher{
+	bf := &BackgroundFetcher{
 		cache:        cache,
 		stripeClient: stripeClient,
 		vippsClient:  vippsClient,
 		zettleClient: zettleClient,
 		interval:     interval,
+		baseBackoff:  baseBackoff,
+		maxBackoff:   maxBackoff,
+		ttl:          consts.CACHE_TTL_DEFAULT,
+		batchSize:    consts.FETCH_BATCH_SIZE_DEFAULT,
 		stopChan:     make(chan struct{}),
+		stats:        make(map[string]*ProviderStats),
+		active:       make(map[string]int),
+
+		annotationRetention: time.Duration(consts.FETCH_LOOKBACK_DAYS_DEFAULT) * 24 * time.Hour,
+
+		initialFetchDone: make(chan struct{}),
 	}
+
+	for _, opt := range opts {
+		opt(bf)
+	}
+
+	return bf
 }
 
 func (bf *BackgroundFetcher) Start(ctx context.Context) {
@@ -49,41 +132,96 @@ func (bf *BackgroundFetcher) Start(ctx context.Context) {
 	}
 
 	bf.running = true
+	ctx, bf.cancel = context.WithCancel(ctx)
 	logger.Info("Starting background transaction fetcher", zap.Duration("interval", bf.interval))
 
 	// Start goroutines for each provider
 	if bf.stripeClient != nil {
-		bf.wg.Add(1)
-		go bf.fetchFromProvider(ctx, "stripe", bf.stripeClient)
+		bf.goTracked("stripe", func() { bf.fetchFromProvider(ctx, "stripe", bf.stripeClient) })
 	}
 
 	if bf.vippsClient != nil {
-		bf.wg.Add(1)
-		go bf.fetchFromProvider(ctx, "vipps", bf.vippsClient)
+		bf.goTracked("vipps", func() { bf.fetchFromProvider(ctx, "vipps", bf.vippsClient) })
 	}
 
 	if bf.zettleClient != nil {
-		bf.wg.Add(1)
-		go bf.fetchFromProvider(ctx, "zettle", bf.zettleClient)
+		bf.goTracked("zettle", func() { bf.fetchFromProvider(ctx, "zettle", bf.zettleClient) })
 	}
 
 	// Initial fetch on startup
-	go bf.performInitialFetch(ctx)
+	bf.goTracked("initial_fetch", func() { bf.performInitialFetch(ctx) })
 }
 
+// Stop stops fetching and waits for the fetcher's goroutines to return
 func (bf *BackgroundFetcher) Stop() {
+	bf.Shutdown(context.Background())
+}
+
+// Shutdown stops fetching, cancelling in-flight provider calls, and waits for the fetcher's goroutines to return
+// until the context is done. If the wait is aborted, the goroutines still running are logged and the context
+// error is returned.
+func (bf *BackgroundFetcher) Shutdown(ctx context.Context) error {
 	bf.mu.Lock()
 	defer bf.mu.Unlock()
 
 	if !bf.running {
-		return
+		return nil
 	}
 
 	logger.Info("Stopping background transaction fetcher")
 	close(bf.stopChan)
-	bf.wg.Wait()
+	bf.cancel()
 	bf.running = false
-	logger.Info("Background transaction fetcher stopped")
+
+	stopped := make(chan struct{})
+	go func() {
+		bf.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		logger.Info("Background transaction fetcher stopped")
+		return nil
+	case <-ctx.Done():
+		logger.Warn("Gave up waiting for the background transaction fetcher to stop",
+			zap.Strings("running", bf.activeGoroutines()),
+			zap.Error(ctx.Err()))
+		return ctx.Err()
+	}
+}
+
+// goTracked runs fn in a goroutine that Stop waits for, tracked by name until it returns
+func (bf *BackgroundFetcher) goTracked(name string, fn func()) {
+	bf.wg.Add(1)
+	bf.activeMu.Lock()
+	bf.active[name]++
+	bf.activeMu.Unlock()
+
+	go func() {
+		defer bf.wg.Done()
+		defer func() {
+			bf.activeMu.Lock()
+			defer bf.activeMu.Unlock()
+			if bf.active[name]--; bf.active[name] <= 0 {
+				delete(bf.active, name)
+			}
+		}()
+		fn()
+	}()
+}
+
+// activeGoroutines returns the sorted names of the fetcher's goroutines that haven't returned yet
+func (bf *BackgroundFetcher) activeGoroutines() []string {
+	bf.activeMu.Lock()
+	defer bf.activeMu.Unlock()
+
+	names := make([]string, 0, len(bf.active))
+	for name := range bf.active {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
 }
 
 func (bf *BackgroundFetcher) IsRunning() bool {
@@ -92,6 +230,58 @@ func (bf *BackgroundFetcher) IsRunning() bool {
 	return bf.running
 }
 
+// Interval returns the configured interval between fetches
+func (bf *BackgroundFetcher) Interval() time.Duration {
+	return bf.interval
+}
+
+// Stats returns a copy of the fetch statistics for each provider
+func (bf *BackgroundFetcher) Stats() map[string]ProviderStats {
+	bf.statsMu.RLock()
+	defer bf.statsMu.RUnlock()
+
+	result := make(map[string]ProviderStats, len(bf.stats))
+	for provider, stats := range bf.stats {
+		result[provider] = *stats
+	}
+	return result
+}
+
+// recordSuccess updates the statistics for a provider after a successful fetch
+func (bf *BackgroundFetcher) recordSuccess(providerName string, count int, duration time.Duration) {
+	bf.statsMu.Lock()
+	defer bf.statsMu.Unlock()
+
+	stats := bf.getOrCreateStats(providerName)
+	now := time.Now()
+	stats.LastSuccess = &now
+	stats.ConsecutiveFailures = 0
+	stats.LastFetchCount = count
+	stats.LastFetchDuration = duration.String()
+}
+
+// recordFailure updates the statistics for a provider after a failed fetch
+func (bf *BackgroundFetcher) recordFailure(providerName string, err error) {
+	bf.statsMu.Lock()
+	defer bf.statsMu.Unlock()
+
+	stats := bf.getOrCreateStats(providerName)
+	stats.LastError = err.Error()
+	now := time.Now()
+	stats.LastErrorAt = &now
+	stats.ConsecutiveFailures++
+}
+
+// getOrCreateStats returns the statistics entry for a provider, caller must hold statsMu
+func (bf *BackgroundFetcher) getOrCreateStats(providerName string) *ProviderStats {
+	stats, exists := bf.stats[providerName]
+	if !exists {
+		stats = &ProviderStats{}
+		bf.stats[providerName] = stats
+	}
+	return stats
+}
+
 func (bf *BackgroundFetcher) performInitialFetch(ctx context.Context) {
 	logger.Info("Performing initial data fetch from all providers")
 
@@ -124,23 +314,63 @@ func (bf *BackgroundFetcher) performInitialFetch(ctx context.Context) {
 
 	wg.Wait()
 	logger.Info("Initial data fetch completed")
+
+	bf.initialFetchOnce.Do(func() {
+		close(bf.initialFetchDone)
+	})
 }
 
-func (bf *BackgroundFetcher) fetchFromProvider(ctx context.Context, providerName string, client interfaces.Transactions) {
-	defer bf.wg.Done()
+// InitialFetchDone returns a channel that is closed once the initial fetch from all providers has completed,
+// whether or not the providers returned transactions
+func (bf *BackgroundFetcher) InitialFetchDone() <-chan struct{} {
+	return bf.initialFetchDone
+}
 
-	ticker := time.NewTicker(bf.interval)
-	defer ticker.Stop()
+// WaitForInitialFetch blocks until the initial fetch has completed, the timeout elapses or the context is done.
+// It reports whether the initial fetch completed.
+func (bf *BackgroundFetcher) WaitForInitialFetch(ctx context.Context, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-bf.initialFetchDone:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (bf *BackgroundFetcher) fetchFromProvider(ctx context.Context, providerName string, client interfaces.Transactions) {
+	timer := time.NewTimer(bf.interval)
+	defer timer.Stop()
 
 	logger.Info("Started background fetcher for provider", zap.String("provider", providerName))
 
+	// Consecutive failures for this provider only, so one outage doesn't slow down the others
+	failures := 0
+
 	for {
 		select {
 		case <-bf.stopChan:
 			logger.Info("Stopping background fetcher for provider", zap.String("provider", providerName))
 			return
-		case <-ticker.C:
-			bf.fetchTransactions(ctx, providerName, client)
+		case <-timer.C:
+			if err := bf.fetchTransactions(ctx, providerName, client); err != nil {
+				failures++
+			} else {
+				failures = 0
+			}
+
+			delay := bf.nextDelay(failures)
+			if failures > 0 {
+				logger.Warn("Backing off provider after failed fetch",
+					zap.String("provider", providerName),
+					zap.Int("consecutive_failures", failures),
+					zap.Duration("next_attempt_in", delay))
+			}
+			timer.Reset(delay)
 		case <-ctx.Done():
 			logger.Info("Context cancelled, stopping background fetcher for provider", zap.String("provider", providerName))
 			return
@@ -148,7 +378,29 @@ func (bf *BackgroundFetcher) fetchFromProvider(ctx context.Context, providerName
 	}
 }
 
-func (bf *BackgroundFetcher) fetchTransactions(ctx context.Context, providerName string, client interfaces.Transactions) {
+// nextDelay returns the wait before the next fetch: the normal interval after a success,
+// and an exponentially growing delay capped at maxBackoff after consecutive failures
+func (bf *BackgroundFetcher) nextDelay(failures int) time.Duration {
+	if failures == 0 || bf.baseBackoff <= 0 {
+		return bf.interval
+	}
+
+	delay := bf.baseBackoff
+	for i := 1; i < failures && delay < bf.maxBackoff; i++ {
+		delay *= 2
+	}
+	if bf.maxBackoff > 0 && delay > bf.maxBackoff {
+		delay = bf.maxBackoff
+	}
+
+	// Backoff should never fetch more often than the normal interval
+	if delay < bf.interval {
+		return bf.interval
+	}
+	return delay
+}
+
+func (bf *BackgroundFetcher) fetchTransactions(ctx context.Context, providerName string, client interfaces.Transactions) error {
 	startTime := time.Now()
 	logger.Debug("Fetching transactions from provider", zap.String("provider", providerName))
 
@@ -156,25 +408,55 @@ func (bf *BackgroundFetcher) fetchTransactions(ctx context.Context, providerName
 	fetchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	transactions, err := client.GetLatestTransactions(fetchCtx, 100) // Fetch up to 100 transactions
+	transactions, err := client.GetLatestTransactions(fetchCtx, bf.batchSize)
 	if err != nil {
 		logger.Error("Failed to fetch transactions from provider",
 			zap.String("provider", providerName),
 			zap.Error(err))
-		return
+		bf.recordFailure(providerName, err)
+		return err
 	}
 
-	// Cache all transactions with 24-hour expiration
+	// Cache all transactions with the configured expiration. Only provider-derived fields are written,
+	// annotations are kept in their own store and merged in by the repository on read.
 	cached := 0
 	for _, transaction := range transactions {
-		bf.cache.SetTransaction(transaction.ID, transaction, 24*time.Hour)
+		bf.cache.SetTransaction(transaction.ID, transaction.WithoutAnnotations(), bf.ttl)
 		cached++
 	}
 
+	bf.pruneAnnotations()
+
 	duration := time.Since(startTime)
+	bf.recordSuccess(providerName, len(transactions), duration)
 	logger.Info("Successfully fetched and cached transactions",
 		zap.String("provider", providerName),
 		zap.Int("count", len(transactions)),
 		zap.Int("cached", cached),
 		zap.Duration("duration", duration))
+
+	return nil
+}
+
+// pruneAnnotations deletes the annotations of transactions that have left the lookback window. Annotations
+// written before their transaction's creation time was recorded fall back to the cached transaction, if any.
+func (bf *BackgroundFetcher) pruneAnnotations() {
+	cutoff := time.Now().Add(-bf.annotationRetention)
+	pruned := 0
+	for key, annotation := range bf.cache.GetAnnotations() {
+		createdAt := annotation.TransactionCreatedAt
+		if createdAt.IsZero() {
+			if transaction, found := bf.cache.GetTransaction(key); found {
+				createdAt = transaction.CreatedAt
+			}
+		}
+		if !createdAt.IsZero() && createdAt.Before(cutoff) {
+			bf.cache.DeleteAnnotation(key)
+			pruned++
+		}
+	}
+
+	if pruned > 0 {
+		logger.Info("Pruned annotations outside the lookback window", zap.Int("pruned", pruned))
+	}
 }
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/cache"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/repository"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/spf13/viper"
+)
+
+// fakeTransactionsClient is a provider client returning canned results
+type fakeTransactionsClient struct {
+	mu           sync.Mutex
+	transactions []entities.Transaction
+	err          error
+	calls        int
+	limit        int // Limit of the last fetch
+}
+
+func (f *fakeTransactionsClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	f.limit = limit
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.transactions, nil
+}
+
+func (f *fakeTransactionsClient) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
+	return entities.Transaction{}, errors.New("not implemented")
+}
+
+func (f *fakeTransactionsClient) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func TestBackgroundFetcher_Stats(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	client := &fakeTransactionsClient{err: errors.New("provider unavailable")}
+	bf := NewBackgroundFetcher(c, nil, client, nil, time.Minute, time.Minute, 30*time.Minute)
+
+	ctx := context.Background()
+	bf.fetchTransactions(ctx, "vipps", client)
+	bf.fetchTransactions(ctx, "vipps", client)
+
+	stats := bf.Stats()["vipps"]
+	if stats.ConsecutiveFailures != 2 {
+		t.Errorf("Expected 2 consecutive failures, got %d", stats.ConsecutiveFailures)
+	}
+	if stats.LastError != "provider unavailable" {
+		t.Errorf("Expected last error 'provider unavailable', got %q", stats.LastError)
+	}
+	if stats.LastErrorAt == nil || stats.LastSuccess != nil {
+		t.Errorf("Expected only an error timestamp, got %+v", stats)
+	}
+
+	client.setErr(nil)
+	client.transactions = []entities.Transaction{{ID: "tx1"}, {ID: "tx2"}}
+	bf.fetchTransactions(ctx, "vipps", client)
+
+	stats = bf.Stats()["vipps"]
+	if stats.ConsecutiveFailures != 0 {
+		t.Errorf("Expected failures to reset after success, got %d", stats.ConsecutiveFailures)
+	}
+	if stats.LastSuccess == nil {
+		t.Errorf("Expected last success to be recorded")
+	}
+	if stats.LastFetchCount != 2 {
+		t.Errorf("Expected last fetch count 2, got %d", stats.LastFetchCount)
+	}
+}
+
+func TestBackgroundFetcher_BatchSize(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	client := &fakeTransactionsClient{}
+
+	bf := NewBackgroundFetcher(c, nil, client, nil, time.Minute, time.Minute, 30*time.Minute)
+	bf.fetchTransactions(context.Background(), "vipps", client)
+	if client.limit != consts.FETCH_BATCH_SIZE_DEFAULT {
+		t.Errorf("Expected the default batch size %d, got %d", consts.FETCH_BATCH_SIZE_DEFAULT, client.limit)
+	}
+
+	bf = NewBackgroundFetcher(c, nil, client, nil, time.Minute, time.Minute, 30*time.Minute, WithBatchSize(500))
+	bf.fetchTransactions(context.Background(), "vipps", client)
+	if client.limit != 500 {
+		t.Errorf("Expected the configured batch size 500, got %d", client.limit)
+	}
+}
+
+func TestFetchBatchSize(t *testing.T) {
+	previous := viper.Get(consts.FETCH_BATCH_SIZE)
+	t.Cleanup(func() { viper.Set(consts.FETCH_BATCH_SIZE, previous) })
+
+	tests := []struct {
+		value    any
+		expected int
+	}{
+		{250, 250},
+		{"50", 50},
+		{0, consts.FETCH_BATCH_SIZE_DEFAULT},
+		{-5, consts.FETCH_BATCH_SIZE_DEFAULT},
+		{"not a number", consts.FETCH_BATCH_SIZE_DEFAULT},
+		{5000, consts.FETCH_BATCH_SIZE_MAX},
+	}
+
+	for _, tt := range tests {
+		viper.Set(consts.FETCH_BATCH_SIZE, tt.value)
+		if size := FetchBatchSize(); size != tt.expected {
+			t.Errorf("FetchBatchSize() with %v = %d, want %d", tt.value, size, tt.expected)
+		}
+	}
+}
+
+func TestBackgroundFetcher_NextDelay(t *testing.T) {
+	bf := NewBackgroundFetcher(nil, nil, nil, nil, 2*time.Minute, 1*time.Minute, 30*time.Minute)
+
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 0, expected: 2 * time.Minute},  // Normal interval after success
+		{failures: 1, expected: 2 * time.Minute},  // Backoff never shorter than the interval
+		{failures: 2, expected: 2 * time.Minute},  // 1m * 2
+		{failures: 3, expected: 4 * time.Minute},  // 1m * 4
+		{failures: 5, expected: 16 * time.Minute}, // 1m * 16
+		{failures: 6, expected: 30 * time.Minute}, // Capped
+		{failures: 100, expected: 30 * time.Minute},
+	}
+
+	for _, test := range tests {
+		result := bf.nextDelay(test.failures)
+		if result != test.expected {
+			t.Errorf("nextDelay(%d) = %v, want %v", test.failures, result, test.expected)
+		}
+	}
+}
+
+func TestBackgroundFetcher_StopDuringBackoff(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	client := &fakeTransactionsClient{err: errors.New("provider unavailable")}
+	bf := NewBackgroundFetcher(c, nil, client, nil, 10*time.Millisecond, time.Hour, time.Hour)
+
+	bf.Start(context.Background())
+
+	// Wait until the periodic fetch has failed and the provider is backing off
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		bf.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Stop to return promptly during backoff")
+	}
+}
+
+// blockingTransactionsClient is a provider client whose fetches hang until released, ignoring the context
+type blockingTransactionsClient struct {
+	fakeTransactionsClient
+	release chan struct{}
+}
+
+func (b *blockingTransactionsClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
+	<-b.release
+	return nil, nil
+}
+
+// slowTransactionsClient is a provider client whose fetches take a long time unless the context is cancelled
+type slowTransactionsClient struct {
+	fakeTransactionsClient
+	started chan struct{}
+}
+
+func (s *slowTransactionsClient) GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
+	close(s.started)
+	select {
+	case <-time.After(30 * time.Second):
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestBackgroundFetcher_StopCancelsInFlightFetch(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	client := &slowTransactionsClient{started: make(chan struct{})}
+	bf := NewBackgroundFetcher(c, nil, client, nil, time.Hour, time.Minute, 30*time.Minute)
+
+	// The parent context is never cancelled, like when the caller only stops the fetcher
+	bf.Start(context.Background())
+	select {
+	case <-client.started:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the initial fetch to start")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		bf.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Stop to cancel the in-flight fetch and return promptly")
+	}
+	if running := bf.activeGoroutines(); len(running) != 0 {
+		t.Errorf("Expected all goroutines to have returned, got %v", running)
+	}
+}
+
+func TestBackgroundFetcher_ShutdownTimesOut(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	client := &blockingTransactionsClient{release: make(chan struct{})}
+	defer close(client.release)
+	bf := NewBackgroundFetcher(c, nil, client, nil, time.Hour, time.Minute, 30*time.Minute)
+
+	bf.Start(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := bf.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the shutdown to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the shutdown to give up after the timeout, took %v", elapsed)
+	}
+	if running := bf.activeGoroutines(); len(running) != 1 || running[0] != "initial_fetch" {
+		t.Errorf("Expected the stuck initial fetch to be reported, got %v", running)
+	}
+	if bf.IsRunning() {
+		t.Error("Expected the fetcher to be stopped")
+	}
+}
+
+func TestBackgroundFetcher_TransactionTTL(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	client := &fakeTransactionsClient{transactions: []entities.Transaction{{ID: "tx1"}}}
+	bf := NewBackgroundFetcher(c, nil, client, nil, time.Minute, time.Minute, 30*time.Minute,
+		WithTransactionTTL(50*time.Millisecond))
+
+	bf.fetchTransactions(context.Background(), "vipps", client)
+	if _, found := c.GetTransaction("tx1"); !found {
+		t.Fatal("Expected fetched transaction to be cached")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, found := c.GetTransaction("tx1"); found {
+		t.Error("Expected fetched transaction to expire after the configured TTL")
+	}
+}
+
+func TestBackgroundFetcher_WaitForInitialFetch(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	client := &fakeTransactionsClient{transactions: []entities.Transaction{{ID: "vipps_1"}}}
+	bf := NewBackgroundFetcher(c, nil, client, nil, time.Hour, time.Minute, 30*time.Minute)
+	ctx := context.Background()
+
+	if bf.WaitForInitialFetch(ctx, 10*time.Millisecond) {
+		t.Fatal("Expected the wait to time out before the initial fetch")
+	}
+
+	bf.Start(ctx)
+	defer bf.Stop()
+
+	if !bf.WaitForInitialFetch(ctx, 5*time.Second) {
+		t.Fatal("Expected the initial fetch to complete")
+	}
+	if _, found := c.GetTransaction("vipps_1"); !found {
+		t.Error("Expected the cache to be warm after the initial fetch")
+	}
+
+	// Waiting again returns immediately once the initial fetch has completed
+	if !bf.WaitForInitialFetch(ctx, time.Millisecond) {
+		t.Error("Expected a later wait to see the completed initial fetch")
+	}
+}
+
+func TestBackgroundFetcher_PreservesAnnotations(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	client := &fakeTransactionsClient{transactions: []entities.Transaction{{ID: "tx1", Status: "pending"}}}
+	bf := NewBackgroundFetcher(c, nil, client, nil, time.Minute, time.Minute, 30*time.Minute)
+	repo := repository.NewTransactionRepository(c, nil, nil, nil)
+	ctx := context.Background()
+
+	bf.fetchTransactions(ctx, "vipps", client)
+	if _, err := repo.ArchiveTransaction(ctx, "tx1"); err != nil {
+		t.Fatalf("ArchiveTransaction returned error: %v", err)
+	}
+
+	// The re-fetch overwrites the cached transaction with the provider's latest state
+	client.transactions = []entities.Transaction{{ID: "tx1", Status: "succeeded"}}
+	bf.fetchTransactions(ctx, "vipps", client)
+
+	transaction, err := repo.GetTransactionByID(ctx, "tx1")
+	if err != nil {
+		t.Fatalf("GetTransactionByID returned error: %v", err)
+	}
+	if transaction.Status != "succeeded" {
+		t.Errorf("Expected the re-fetched status, got %q", transaction.Status)
+	}
+	if !transaction.Archived {
+		t.Error("Expected the annotation to survive the re-fetch")
+	}
+
+	// Only provider-derived fields are cached, so the annotation store stays the single source of manual state
+	if cached, _ := c.GetTransaction("tx1"); cached.Archived {
+		t.Error("Expected the cached transaction to carry no annotations")
+	}
+}
+
+func TestBackgroundFetcher_PrunesAnnotationsOutsideLookback(t *testing.T) {
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	client := &fakeTransactionsClient{}
+	bf := NewBackgroundFetcher(c, nil, client, nil, time.Minute, time.Minute, 30*time.Minute, WithAnnotationRetention(24*time.Hour))
+
+	c.SetAnnotation("recent", entities.TransactionAnnotation{Archived: true, TransactionCreatedAt: time.Now().Add(-time.Hour)})
+	c.SetAnnotation("old", entities.TransactionAnnotation{Archived: true, TransactionCreatedAt: time.Now().Add(-48 * time.Hour)})
+	// Annotations without a recorded creation time are judged by the cached transaction
+	c.SetTransaction("legacy_old", entities.Transaction{ID: "legacy_old", CreatedAt: time.Now().Add(-48 * time.Hour)}, time.Hour)
+	c.SetAnnotation("legacy_old", entities.TransactionAnnotation{Archived: true})
+	c.SetAnnotation("legacy_uncached", entities.TransactionAnnotation{Archived: true})
+
+	bf.fetchTransactions(context.Background(), "vipps", client)
+
+	for key, expected := range map[string]bool{"recent": true, "old": false, "legacy_old": false, "legacy_uncached": true} {
+		if _, found := c.GetAnnotation(key); found != expected {
+			t.Errorf("Expected annotation %q kept=%t, got %t", key, expected, found)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// CurrencyConverter converts amounts to a base currency using static rates
+type CurrencyConverter struct {
+	base string
+	// Amount of the base currency per unit of each currency, keyed by uppercase currency code
+	rates map[string]float64
+}
+
+// NewCurrencyConverter creates a converter to the base currency. The base currency always converts at rate 1.
+func NewCurrencyConverter(base string, rates map[string]float64) *CurrencyConverter {
+	base = strings.ToUpper(strings.TrimSpace(base))
+
+	converter := &CurrencyConverter{
+		base:  base,
+		rates: make(map[string]float64, len(rates)+1),
+	}
+	for currency, rate := range rates {
+		converter.rates[strings.ToUpper(currency)] = rate
+	}
+	converter.rates[base] = 1
+
+	return converter
+}
+
+// BaseCurrency returns the currency amounts are converted to
+func (c *CurrencyConverter) BaseCurrency() string {
+	return c.base
+}
+
+// Convert converts an amount in the given currency to the base currency.
+// It reports false when there is no rate for the currency.
+func (c *CurrencyConverter) Convert(amount float64, currency string) (float64, bool) {
+	rate, exists := c.rates[strings.ToUpper(strings.TrimSpace(currency))]
+	if !exists {
+		return 0, false
+	}
+	return amount * rate, true
+}
+
+// ParseCurrencyRates parses comma-separated currency:rate pairs such as "EUR:11.5,USD:10.8".
+// Malformed pairs and rates that aren't positive numbers are logged and skipped.
+func ParseCurrencyRates(value string) map[string]float64 {
+	rates := make(map[string]float64)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		currency, rateStr, found := strings.Cut(pair, ":")
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rateStr), 64)
+		if !found || currency == "" || err != nil || rate <= 0 {
+			logger.Warn("Skipping invalid currency rate", zap.String("rate", pair))
+			continue
+		}
+
+		rates[currency] = rate
+	}
+	return rates
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+func TestParseCurrencyRates(t *testing.T) {
+	rates := ParseCurrencyRates(" eur:11.5, USD : 10.8,SEK,GBP:abc,DKK:-1,:2")
+
+	if len(rates) != 2 || rates["EUR"] != 11.5 || rates["USD"] != 10.8 {
+		t.Errorf("Expected only the valid EUR and USD rates, got %v", rates)
+	}
+	if rates := ParseCurrencyRates(""); len(rates) != 0 {
+		t.Errorf("Expected no rates for an empty setting, got %v", rates)
+	}
+}
+
+func TestCurrencyConverter_Convert(t *testing.T) {
+	converter := NewCurrencyConverter("nok", map[string]float64{"eur": 11.5})
+
+	if converter.BaseCurrency() != "NOK" {
+		t.Errorf("Expected base currency NOK, got %s", converter.BaseCurrency())
+	}
+	if amount, ok := converter.Convert(100, "NOK"); !ok || amount != 100 {
+		t.Errorf("Expected the base currency to convert 1:1, got %v/%v", amount, ok)
+	}
+	if amount, ok := converter.Convert(10, "Eur"); !ok || amount != 115 {
+		t.Errorf("Expected 10 EUR to be 115 NOK, got %v/%v", amount, ok)
+	}
+	if _, ok := converter.Convert(10, "USD"); ok {
+		t.Error("Expected a currency without a rate not to convert")
+	}
+}
+
+func TestConvertRevenue(t *testing.T) {
+	converter := NewCurrencyConverter("NOK", map[string]float64{"EUR": 11.5})
+	transactions := []entities.Transaction{
+		{ID: "1", Amount: 100, Currency: "nok", Status: consts.TRANSACTION_STATUS_SUCCEEDED},
+		{ID: "2", Amount: 10, Currency: "EUR", Status: consts.TRANSACTION_STATUS_SUCCEEDED},
+		{ID: "3", Amount: 5, Currency: "USD", Status: consts.TRANSACTION_STATUS_SUCCEEDED},
+		{ID: "4", Amount: 1000, Currency: "NOK", Status: consts.TRANSACTION_STATUS_PENDING},
+	}
+
+	converted := convertRevenue(transactions, converter)
+
+	if converted.BaseCurrency != "NOK" || converted.Revenue != 215 {
+		t.Errorf("Expected 215 NOK, got %v %s", converted.Revenue, converted.BaseCurrency)
+	}
+	if converted.Unconvertible.Count != 1 || converted.Unconvertible.RevenueByCurrency["USD"] != 5 {
+		t.Errorf("Expected the USD transaction to be unconvertible, got %+v", converted.Unconvertible)
+	}
+	if transactions[1].Amount != 10 || transactions[1].Currency != "EUR" {
+		t.Error("Expected the original transaction amounts to be untouched")
+	}
+}
+
+func TestConvertProductRevenue(t *testing.T) {
+	converter := NewCurrencyConverter("NOK", map[string]float64{"EUR": 11.5})
+	kayak, cabin := "Kayak", "Cabin"
+	transactions := []entities.Transaction{
+		{ID: "1", Amount: 600, Currency: "NOK", Status: consts.TRANSACTION_STATUS_SUCCEEDED, Product: &cabin},
+		{ID: "2", Amount: 60, Currency: "EUR", Status: consts.TRANSACTION_STATUS_SUCCEEDED, Product: &kayak},
+		{ID: "3", Amount: 7, Currency: "USD", Status: consts.TRANSACTION_STATUS_SUCCEEDED, Product: &kayak},
+	}
+
+	report := revenueByProduct(transactions)
+	convertProductRevenue(&report, transactions, converter)
+
+	// Unconverted, the cabin's 600 sorts above the kayak's 67; converted, the kayak's 690 NOK wins
+	if report.Products[0].Product != kayak || *report.Products[0].ConvertedRevenue != 690 {
+		t.Errorf("Expected kayak first with 690 NOK, got %+v", report.Products[0])
+	}
+	if report.Converted == nil || report.Converted.Revenue != 1290 || report.Converted.Unconvertible.Count != 1 {
+		t.Errorf("Unexpected converted totals: %+v", report.Converted)
+	}
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/services/prices"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+)
+
+// PriceCacheKey returns the price cache key of a product. Product names are matched case-insensitively,
+// like in the price list.
+func PriceCacheKey(product string) string {
+	return strings.ToLower(strings.TrimSpace(product))
+}
+
+// SeedPriceCache stores the prices in the cache by product and removes cached prices of products no longer listed
+func SeedPriceCache(cache interfaces.Cache, priceList []prices.Price) {
+	listed := make(map[string]bool, len(priceList))
+	for _, price := range priceList {
+		key := PriceCacheKey(price.Product)
+		listed[key] = true
+		cache.SetPrice(key, price)
+	}
+
+	for _, cached := range cache.GetPrices() {
+		if key := PriceCacheKey(cached.Product); !listed[key] {
+			cache.DeletePrice(key)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/cache"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/services/prices"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+// usePriceService loads a price service from the CSV for the test, restoring the global one afterwards
+func usePriceService(t *testing.T, csv string) *prices.PriceService {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "prices.csv")
+	if err := os.WriteFile(path, []byte(csv), 0o644); err != nil {
+		t.Fatalf("Failed to write price list: %v", err)
+	}
+	priceService, err := prices.NewPriceService(path)
+	if err != nil {
+		t.Fatalf("Failed to load price list: %v", err)
+	}
+
+	previous := PriceService
+	PriceService = priceService
+	t.Cleanup(func() { PriceService = previous })
+	return priceService
+}
+
+func TestInitializeTransactionServices_SeedsPriceCache(t *testing.T) {
+	priceService := usePriceService(t, "Product;Price;Currency\nCabin;650;NOK\nShower;15;NOK\n")
+	memoryCache := cache.NewInMemoryCache(time.Hour, time.Hour)
+	memoryCache.SetPrice(PriceCacheKey("Sauna"), prices.Price{Product: "Sauna", Price: 100, Currency: "NOK"})
+
+	InitializeTransactionServices(memoryCache, cache.NewObservableCache(memoryCache), nil, nil, nil, nil, time.UTC)
+
+	cabin, found := memoryCache.GetPrice(PriceCacheKey("cabin"))
+	if !found || cabin.Price != 650 {
+		t.Errorf("Expected the cabin price in the cache, got %+v (found %v)", cabin, found)
+	}
+	if _, found := memoryCache.GetPrice(PriceCacheKey("Shower")); !found {
+		t.Error("Expected the shower price in the cache")
+	}
+	if _, found := memoryCache.GetPrice(PriceCacheKey("Sauna")); found {
+		t.Error("Expected the unlisted sauna price to be removed from the cache")
+	}
+
+	// Price changes reach the cache
+	if err := priceService.UpsertPrice(prices.Price{Product: "Cabin", Price: 700, Currency: "NOK"}); err != nil {
+		t.Fatalf("Failed to update price: %v", err)
+	}
+	if cabin, _ := memoryCache.GetPrice(PriceCacheKey("Cabin")); cabin.Price != 700 {
+		t.Errorf("Expected the updated cabin price in the cache, got %v", cabin.Price)
+	}
+}
+
+func TestTransactionService_EnrichUsesPriceCache(t *testing.T) {
+	usePriceService(t, "Product;Price;Currency\nCabin;650;NOK\nCabin deluxe;650;NOK\n")
+	memoryCache := cache.NewInMemoryCache(time.Hour, time.Hour)
+	SeedPriceCache(memoryCache, PriceService.GetAllPrices())
+	service := NewTransactionService(nil, WithPriceCache(memoryCache))
+
+	// Both products share the price, the cached product named by the description is certain
+	enriched := service.enrichTransactionWithProduct(entities.Transaction{ID: "t1", Amount: 650, Description: "cabin deluxe"})
+	if enriched.Product == nil || *enriched.Product != "Cabin deluxe" || *enriched.ProductMatchConfidence != 1 {
+		t.Errorf("Expected a certain match on Cabin deluxe, got %v", enriched.Product)
+	}
+
+	// Without a cached product, the price list is matched
+	enriched = service.enrichTransactionWithProduct(entities.Transaction{ID: "t2", Amount: 650, Description: "Zettle VISA payment"})
+	if enriched.Product == nil || *enriched.ProductMatchConfidence == 1 {
+		t.Errorf("Expected an uncertain match from the price list, got %v", enriched.ProductMatchConfidence)
+	}
+}
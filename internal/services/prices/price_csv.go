@@ -0,0 +1,188 @@
+package prices
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Required CSV columns, matched case-insensitively against the header row
+const (
+	columnProduct  = "product"
+	columnPrice    = "price"
+	columnCurrency = "currency"
+)
+
+// RowError describes a CSV row that could not be loaded
+type RowError struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// LoadReport summarizes a load of the price CSV
+type LoadReport struct {
+	Loaded  int        `json:"loaded"`
+	Skipped []RowError `json:"skipped,omitempty"`
+}
+
+// loadPricesFromCSV reads and parses the CSV file. Columns are mapped by header name, so their order
+// doesn't matter. A zero delimiter is detected from the header line.
+// All invalid rows are reported together. In lenient mode they are skipped and the valid rows are loaded.
+func loadPricesFromCSV(filePath string, delimiter rune, lenient bool) ([]Price, LoadReport, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, LoadReport{}, fmt.Errorf("failed to open CSV file: %w", err)
+	}
+
+	// Excel prefixes UTF-8 exports with a byte order mark
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	if delimiter == 0 {
+		delimiter = detectDelimiter(data)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1 // Column counts are checked per record below
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, LoadReport{}, fmt.Errorf("failed to read CSV records: %w", err)
+	}
+
+	if len(records) < 2 {
+		return nil, LoadReport{}, fmt.Errorf("CSV file must contain at least header and one data row")
+	}
+
+	columns, err := mapColumns(records[0])
+	if err != nil {
+		return nil, LoadReport{}, err
+	}
+	minColumns := max(columns[columnProduct], columns[columnPrice], columns[columnCurrency]) + 1
+
+	var report LoadReport
+	prices := make([]Price, 0, len(records)-1)
+	for i, record := range records[1:] { // Skip header
+		line := i + 2
+
+		if len(record) < minColumns {
+			report.Skipped = append(report.Skipped, RowError{line, fmt.Sprintf("expected %d columns, got %d", minColumns, len(record))})
+			continue
+		}
+
+		product := strings.TrimSpace(record[columns[columnProduct]])
+		if product == "" {
+			report.Skipped = append(report.Skipped, RowError{line, "product is empty"})
+			continue
+		}
+
+		price, err := parsePrice(record[columns[columnPrice]])
+		if err != nil {
+			report.Skipped = append(report.Skipped, RowError{line, err.Error()})
+			continue
+		}
+
+		prices = append(prices, Price{
+			Product:  product,
+			Price:    price,
+			Currency: strings.TrimSpace(record[columns[columnCurrency]]),
+		})
+	}
+	report.Loaded = len(prices)
+
+	if len(report.Skipped) > 0 && (!lenient || len(prices) == 0) {
+		rowErrors := make([]error, len(report.Skipped))
+		for i, rowError := range report.Skipped {
+			rowErrors[i] = rowError
+		}
+		return nil, report, fmt.Errorf("%d invalid rows in CSV file:\n%w", len(report.Skipped), errors.Join(rowErrors...))
+	}
+
+	return prices, report, nil
+}
+
+// detectDelimiter picks comma or semicolon, whichever occurs most in the header line.
+// Semicolon wins ties to stay compatible with the original price files.
+func detectDelimiter(data []byte) rune {
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(header, []byte(",")) > bytes.Count(header, []byte(";")) {
+		return ','
+	}
+	return ';'
+}
+
+// mapColumns returns the index of each required column in the header row
+func mapColumns(header []string) (map[string]int, error) {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, exists := columns[name]; !exists {
+			columns[name] = i
+		}
+	}
+
+	for _, required := range []string{columnProduct, columnPrice, columnCurrency} {
+		if _, exists := columns[required]; !exists {
+			return nil, fmt.Errorf("CSV header is missing required column '%s'", required)
+		}
+	}
+
+	return columns, nil
+}
+
+// parsePrice parses a price as written in Norwegian and international exports, e.g. "390,50", "1 390",
+// "kr 1.390,50" or "NOK 390,-". The last of comma and dot is the decimal separator, the other one and
+// spaces are thousands separators. Negative prices, NaN and infinity are rejected.
+func parsePrice(value string) (float64, error) {
+	cleaned := strings.TrimSuffix(trimCurrency(value), ",-")
+	cleaned = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '\u202f' {
+			return -1
+		}
+		return r
+	}, cleaned)
+
+	decimal, thousands := ",", "."
+	if strings.LastIndex(cleaned, ".") > strings.LastIndex(cleaned, ",") {
+		decimal, thousands = ".", ","
+	}
+	cleaned = strings.ReplaceAll(cleaned, thousands, "")
+	if strings.Count(cleaned, decimal) > 1 {
+		return 0, fmt.Errorf("invalid price '%s'", value)
+	}
+	cleaned = strings.Replace(cleaned, decimal, ".", 1)
+
+	price, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil || math.IsNaN(price) || math.IsInf(price, 0) {
+		return 0, fmt.Errorf("invalid price '%s'", value)
+	}
+	if price < 0 {
+		return 0, fmt.Errorf("negative price '%s'", value)
+	}
+	return price, nil
+}
+
+// trimCurrency removes currency symbols like "$" and codes like "kr" or "NOK" around a price.
+// Single letters are kept so typos like "39o" are still rejected.
+func trimCurrency(value string) string {
+	isSymbol := func(r rune) bool { return unicode.Is(unicode.Sc, r) || unicode.IsSpace(r) }
+
+	value = strings.TrimFunc(value, isSymbol)
+	if prefix := strings.IndexFunc(value, func(r rune) bool { return !unicode.IsLetter(r) }); prefix >= 2 {
+		value = value[prefix:]
+	}
+	if suffix := strings.LastIndexFunc(value, func(r rune) bool { return !unicode.IsLetter(r) }); suffix >= 0 && len(value)-suffix-1 >= 2 {
+		value = value[:suffix+1]
+	}
+	return strings.TrimFunc(value, isSymbol)
+}
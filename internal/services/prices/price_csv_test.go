@@ -0,0 +1,207 @@
+package prices
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCSV writes content to a temporary CSV file and returns its path
+func writeCSV(t *testing.T, content string) string {
+	t.Helper()
+
+	csvPath := filepath.Join(t.TempDir(), "prices.csv")
+	if err := os.WriteFile(csvPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test CSV file: %v", err)
+	}
+	return csvPath
+}
+
+func TestLoadPricesFromCSV_Formats(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		delimiter rune
+	}{
+		{"semicolon", "Product;Price;Currency\nCabin;650;NOK\nShower;15;NOK", 0},
+		{"comma", "Product,Price,Currency\nCabin,650,NOK\nShower,15,NOK", 0},
+		{"reordered columns", "Currency,Price,Product\nNOK,650,Cabin\nNOK,15,Shower", 0},
+		{"extra columns and lowercase header", "sku;product;currency;price\n1;Cabin;NOK;650\n2;Shower;NOK;15", 0},
+		{"byte order mark", "\xef\xbb\xbfProduct,Price,Currency\nCabin,650,NOK\nShower,15,NOK", 0},
+		{"configured delimiter", "Product\tPrice\tCurrency\nCabin\t650\tNOK\nShower\t15\tNOK", '\t'},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			prices, _, err := loadPricesFromCSV(writeCSV(t, tc.content), tc.delimiter, false)
+			if err != nil {
+				t.Fatalf("loadPricesFromCSV() error = %v", err)
+			}
+
+			want := []Price{
+				{Product: "Cabin", Price: 650, Currency: "NOK"},
+				{Product: "Shower", Price: 15, Currency: "NOK"},
+			}
+			if len(prices) != len(want) {
+				t.Fatalf("Expected %d prices, got %+v", len(want), prices)
+			}
+			for i := range want {
+				if prices[i] != want[i] {
+					t.Errorf("Price %d = %+v, want %+v", i, prices[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadPricesFromCSV_MissingColumn(t *testing.T) {
+	_, _, err := loadPricesFromCSV(writeCSV(t, "Product,Price\nCabin,650"), 0, false)
+	if err == nil || !strings.Contains(err.Error(), "'currency'") {
+		t.Errorf("Expected an error naming the currency column, got %v", err)
+	}
+}
+
+func TestLoadPricesFromCSV_ShortRecord(t *testing.T) {
+	_, _, err := loadPricesFromCSV(writeCSV(t, "Product;Price;Currency\nCabin;650"), 0, false)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error for line 2, got %v", err)
+	}
+}
+
+func TestSaveToCSV_ConfiguredDelimiter(t *testing.T) {
+	csvPath := writeCSV(t, "Product,Price,Currency\nCabin,650,NOK")
+	service, err := NewPriceService(csvPath, WithDelimiter(','))
+	if err != nil {
+		t.Fatalf("Failed to create price service: %v", err)
+	}
+
+	if err := service.SaveToCSV(); err != nil {
+		t.Fatalf("SaveToCSV() error = %v", err)
+	}
+
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatalf("Failed to read CSV file: %v", err)
+	}
+	if want := "Product,Price,Currency\nCabin,650,NOK\n"; string(data) != want {
+		t.Errorf("Saved CSV = %q, want %q", data, want)
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{value: "390", want: 390},
+		{value: "390.50", want: 390.5},
+		{value: "390,50", want: 390.5},
+		{value: " 390,50 ", want: 390.5},
+		{value: "1 390", want: 1390},
+		{value: "1 390,50", want: 1390.5},
+		{value: "1.390,50", want: 1390.5},
+		{value: "1,390.50", want: 1390.5},
+		{value: "kr 390,50", want: 390.5},
+		{value: "NOK 390,-", want: 390},
+		{value: "$15", want: 15},
+		{value: "15 €", want: 15},
+		{value: "3,9,0", wantErr: true},
+		{value: "3.9.0", wantErr: true},
+		{value: "", wantErr: true},
+		{value: "kr", wantErr: true},
+		{value: "abc", wantErr: true},
+		{value: "39o", wantErr: true},
+		{value: "NaN", wantErr: true},
+		{value: "Inf", wantErr: true},
+		{value: "-Infinity", wantErr: true},
+		{value: "-390", wantErr: true},
+		{value: "kr -1,50", wantErr: true},
+		{value: "0", want: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := parsePrice(tc.value)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("parsePrice(%q) = %v, want error", tc.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePrice(%q) error = %v", tc.value, err)
+			}
+			if got != tc.want {
+				t.Errorf("parsePrice(%q) = %v, want %v", tc.value, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadPricesFromCSV_CommaDecimals(t *testing.T) {
+	prices, _, err := loadPricesFromCSV(writeCSV(t, "Product;Price;Currency\nCabin;650,50;NOK\nFamily cabin;1 390;NOK"), 0, false)
+	if err != nil {
+		t.Fatalf("loadPricesFromCSV() error = %v", err)
+	}
+	if len(prices) != 2 || prices[0].Price != 650.5 || prices[1].Price != 1390 {
+		t.Errorf("Unexpected prices: %+v", prices)
+	}
+
+	if _, _, err := loadPricesFromCSV(writeCSV(t, "Product;Price;Currency\nCabin;6,5,0;NOK"), 0, false); err == nil {
+		t.Error("Expected an error for a malformed price")
+	}
+}
+
+func TestLoadPricesFromCSV_ReportsAllRowErrors(t *testing.T) {
+	content := `Product;Price;Currency
+Cabin;650;NOK
+;75;NOK
+Shower;fifteen;NOK
+Washing machine;40
+Bed linen;75;NOK`
+	csvPath := writeCSV(t, content)
+
+	_, report, err := loadPricesFromCSV(csvPath, 0, false)
+	if err == nil {
+		t.Fatal("Expected an error for the invalid rows")
+	}
+	for _, want := range []string{"line 3: product is empty", "line 4: invalid price 'fifteen'", "line 5: expected 3 columns, got 2"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got %v", want, err)
+		}
+	}
+	if len(report.Skipped) != 3 {
+		t.Errorf("Expected 3 skipped rows, got %+v", report.Skipped)
+	}
+
+	prices, report, err := loadPricesFromCSV(csvPath, 0, true)
+	if err != nil {
+		t.Fatalf("Expected lenient load to succeed, got %v", err)
+	}
+	if len(prices) != 2 || prices[0].Product != "Cabin" || prices[1].Product != "Bed linen" {
+		t.Errorf("Expected the valid rows to be loaded, got %+v", prices)
+	}
+	if report.Loaded != 2 || len(report.Skipped) != 3 || report.Skipped[0].Line != 3 {
+		t.Errorf("Unexpected load report: %+v", report)
+	}
+}
+
+func TestLoadPricesFromCSV_LenientWithoutValidRows(t *testing.T) {
+	if _, _, err := loadPricesFromCSV(writeCSV(t, "Product;Price;Currency\nCabin;abc;NOK"), 0, true); err == nil {
+		t.Error("Expected an error when no row is valid")
+	}
+}
+
+func TestPriceService_LastLoadReport(t *testing.T) {
+	service, err := NewPriceService(writeCSV(t, "Product;Price;Currency\nCabin;650;NOK\nShower;x;NOK"), WithLenient(true))
+	if err != nil {
+		t.Fatalf("Failed to create price service: %v", err)
+	}
+
+	report := service.LastLoadReport()
+	if report.Loaded != 1 || len(report.Skipped) != 1 || report.Skipped[0].Line != 3 {
+		t.Errorf("Unexpected load report: %+v", report)
+	}
+}
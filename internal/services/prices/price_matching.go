@@ -0,0 +1,116 @@
+package prices
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultMatchThreshold is the minimum similarity score for a description to match a product
+const DefaultMatchThreshold = 0.5
+
+// tokenMatchThreshold is the minimum similarity for two words to count as the same word, allowing small typos
+const tokenMatchThreshold = 0.75
+
+// DefaultSynonyms maps words found in transaction descriptions to the word used in product names
+var DefaultSynonyms = map[string]string{
+	"person":  "pers",
+	"persons": "pers",
+	"people":  "pers",
+	"one":     "1",
+	"two":     "2",
+	"three":   "3",
+	"four":    "4",
+}
+
+// matchScore returns how similar a description is to a product name, between 0 and 1.
+// Both are split into words, and the score is the share of words on either side that have
+// a close counterpart on the other side, whichever is higher.
+func (ps *PriceService) matchScore(description, productName string) float64 {
+	descTokens := ps.tokenize(description)
+	prodTokens := ps.tokenize(productName)
+	if len(descTokens) == 0 || len(prodTokens) == 0 {
+		return 0
+	}
+
+	return max(coverage(descTokens, prodTokens), coverage(prodTokens, descTokens))
+}
+
+// coverage returns the average best similarity of each token in from against the tokens in to,
+// ignoring similarities below tokenMatchThreshold
+func coverage(from, to []string) float64 {
+	total := 0.0
+	for _, f := range from {
+		best := 0.0
+		for _, t := range to {
+			best = max(best, tokenSimilarity(f, t))
+		}
+		if best >= tokenMatchThreshold {
+			total += best
+		}
+	}
+	return total / float64(len(from))
+}
+
+// tokenize lowercases text, splits it into words and numbers and replaces synonyms
+func (ps *PriceService) tokenize(text string) []string {
+	synonyms := ps.synonyms
+	if synonyms == nil {
+		synonyms = DefaultSynonyms
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		if canonical, ok := synonyms[word]; ok {
+			words[i] = canonical
+		}
+	}
+	return words
+}
+
+// tokenSimilarity compares two words using normalized Levenshtein distance.
+// Short words (like numbers) must match exactly, so "3" never matches "4".
+func tokenSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+
+	ra, rb := []rune(a), []rune(b)
+	shortest := min(len(ra), len(rb))
+	longest := max(len(ra), len(rb))
+	if shortest <= 3 {
+		return 0
+	}
+
+	// A word cut short, e.g. "wash" for "washing"
+	if strings.HasPrefix(a, b) || strings.HasPrefix(b, a) {
+		return 0.85
+	}
+
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein returns the number of single-character edits needed to turn a into b
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
@@ -3,83 +3,254 @@ package prices
 import (
 	"encoding/csv"
 	"fmt"
+	"math"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // Price represents a price entry from the CSV
 type Price struct {
-	Product  string
-	Price    float64
-	Currency string
+	Product  string  `json:"product"`
+	Price    float64 `json:"price"`
+	Currency string  `json:"currency"`
+}
+
+// Strategies reported in ProductMatch.Strategy
+const (
+	MatchStrategyExactPrice       = "exact_price"
+	MatchStrategyFuzzyDescription = "fuzzy_description"
+	MatchStrategyPriceRange       = "price_range"
+)
+
+// ProductMatch is a product matched to a transaction, with the strategy that found it
+// and a confidence between 0 and 1
+type ProductMatch struct {
+	Price      Price   `json:"price"`
+	Confidence float64 `json:"confidence"`
+	Strategy   string  `json:"strategy"`
 }
 
 // PriceService handles price-related operations
 type PriceService struct {
+	csvFilePath string
+	// mu guards prices. The slice is replaced as a whole and never modified in place,
+	// so readers can keep iterating a snapshot without holding the lock.
+	mu     sync.RWMutex
 	prices []Price
+
+	// Description matching settings, see WithMatchThreshold and WithSynonyms
+	matchThreshold float64
+	synonyms       map[string]string
+
+	// CSV delimiter, detected from the header line when zero
+	delimiter rune
+	// lenient skips invalid CSV rows instead of failing the load, see WithLenient
+	lenient    bool
+	lastReport LoadReport
+
+	// onChange is called with the new prices after a reload or upsert, see OnChange
+	onChange func([]Price)
+}
+
+// Option configures optional settings on a PriceService
+type Option func(*PriceService)
+
+// WithMatchThreshold sets the minimum similarity (0-1) for a description to match a product name
+func WithMatchThreshold(threshold float64) Option {
+	return func(ps *PriceService) {
+		if threshold > 0 && threshold <= 1 {
+			ps.matchThreshold = threshold
+		}
+	}
+}
+
+// WithSynonyms replaces the words treated as equal to words in product names, e.g. "people" -> "pers"
+func WithSynonyms(synonyms map[string]string) Option {
+	return func(ps *PriceService) {
+		ps.synonyms = synonyms
+	}
+}
+
+// WithDelimiter sets the CSV delimiter, e.g. ',' for Excel exports.
+// By default the delimiter is detected from the header line.
+func WithDelimiter(delimiter rune) Option {
+	return func(ps *PriceService) {
+		ps.delimiter = delimiter
+	}
+}
+
+// WithLenient loads the valid rows of a CSV file with invalid rows instead of failing.
+// The skipped rows are available from LastLoadReport.
+func WithLenient(lenient bool) Option {
+	return func(ps *PriceService) {
+		ps.lenient = lenient
+	}
 }
 
 // NewPriceService creates a new PriceService and loads prices from the CSV file
-func NewPriceService(csvFilePath string) (*PriceService, error) {
+func NewPriceService(csvFilePath string, opts ...Option) (*PriceService, error) {
 	service := &PriceService{
-		prices: make([]Price, 0),
+		csvFilePath: csvFilePath,
+	}
+
+	for _, opt := range opts {
+		opt(service)
 	}
 
-	err := service.loadPricesFromCSV(csvFilePath)
+	prices, report, err := loadPricesFromCSV(csvFilePath, service.delimiter, service.lenient)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load prices from CSV: %w", err)
 	}
+	service.prices = prices
+	service.lastReport = report
 
 	return service, nil
 }
 
-// loadPricesFromCSV reads and parses the CSV file
-func (ps *PriceService) loadPricesFromCSV(filePath string) error {
-	file, err := os.Open(filePath)
+// Reload re-reads the CSV file the service was created with and returns the number of prices loaded.
+// On error the current prices are kept.
+func (ps *PriceService) Reload() (int, error) {
+	prices, report, err := loadPricesFromCSV(ps.csvFilePath, ps.delimiter, ps.lenient)
 	if err != nil {
-		return fmt.Errorf("failed to open CSV file: %w", err)
+		return 0, fmt.Errorf("failed to reload prices from CSV: %w", err)
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.Comma = ';' // CSV uses semicolon as delimiter
+	ps.mu.Lock()
+	ps.prices = prices
+	ps.lastReport = report
+	onChange := ps.onChange
+	ps.mu.Unlock()
 
-	records, err := reader.ReadAll()
-	if err != nil {
-		return fmt.Errorf("failed to read CSV records: %w", err)
+	if onChange != nil {
+		onChange(slices.Clone(prices))
 	}
 
-	// Skip header row
-	if len(records) < 2 {
-		return fmt.Errorf("CSV file must contain at least header and one data row")
+	return len(prices), nil
+}
+
+// OnChange registers a function called with the new prices after every successful reload or upsert,
+// replacing any registered before. It is called without holding the service's lock.
+func (ps *PriceService) OnChange(fn func(prices []Price)) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.onChange = fn
+}
+
+// LastLoadReport returns the summary of the last successful load or reload of the CSV file
+func (ps *PriceService) LastLoadReport() LoadReport {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return LoadReport{Loaded: ps.lastReport.Loaded, Skipped: slices.Clone(ps.lastReport.Skipped)}
+}
+
+// UpsertPrice replaces the price of an existing product (matched case-insensitively) or adds a new product.
+// The price must be non-negative and the currency a 3-letter code.
+func (ps *PriceService) UpsertPrice(price Price) error {
+	price.Product = strings.TrimSpace(price.Product)
+	price.Currency = strings.ToUpper(strings.TrimSpace(price.Currency))
+
+	if price.Product == "" {
+		return fmt.Errorf("product is required")
+	}
+	if price.Price < 0 || math.IsNaN(price.Price) || math.IsInf(price.Price, 0) {
+		return fmt.Errorf("price must be a non-negative number")
+	}
+	if !isCurrencyCode(price.Currency) {
+		return fmt.Errorf("currency must be a 3-letter code, got '%s'", price.Currency)
 	}
 
-	for i, record := range records[1:] { // Skip header
-		if len(record) != 3 {
-			return fmt.Errorf("invalid record at line %d: expected 3 columns, got %d", i+2, len(record))
-		}
+	ps.mu.Lock()
+	// Copy on write, so readers holding the previous snapshot are unaffected
+	prices := slices.Clone(ps.prices)
+	index := slices.IndexFunc(prices, func(p Price) bool {
+		return strings.EqualFold(p.Product, price.Product)
+	})
+	if index >= 0 {
+		prices[index] = price
+	} else {
+		prices = append(prices, price)
+	}
+	ps.prices = prices
+	onChange := ps.onChange
+	ps.mu.Unlock()
 
-		price, err := strconv.ParseFloat(record[1], 64)
-		if err != nil {
-			return fmt.Errorf("invalid price value at line %d: %w", i+2, err)
-		}
+	if onChange != nil {
+		onChange(slices.Clone(prices))
+	}
+
+	return nil
+}
+
+// SaveToCSV writes the current prices back to the CSV file the service was created with,
+// using the configured delimiter or semicolons when it is detected on load.
+// The file is replaced atomically so a failed write never leaves a truncated price list.
+func (ps *PriceService) SaveToCSV() error {
+	prices := ps.snapshot()
+
+	records := make([][]string, 0, len(prices)+1)
+	records = append(records, []string{"Product", "Price", "Currency"})
+	for _, p := range prices {
+		records = append(records, []string{p.Product, strconv.FormatFloat(p.Price, 'f', -1, 64), p.Currency})
+	}
+
+	tmpPath := ps.csvFilePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV file: %w", err)
+	}
+
+	writer := csv.NewWriter(file)
+	writer.Comma = ';'
+	if ps.delimiter != 0 {
+		writer.Comma = ps.delimiter
+	}
+	if err := writer.WriteAll(records); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write CSV records: %w", err)
+	}
 
-		ps.prices = append(ps.prices, Price{
-			Product:  strings.TrimSpace(record[0]),
-			Price:    price,
-			Currency: strings.TrimSpace(record[2]),
-		})
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close CSV file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, ps.csvFilePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace CSV file: %w", err)
 	}
 
 	return nil
 }
 
+// isCurrencyCode reports whether the value looks like an ISO 4217 code, e.g. NOK
+func isCurrencyCode(value string) bool {
+	if len(value) != 3 {
+		return false
+	}
+	for _, r := range value {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshot returns the current price list, which must not be modified
+func (ps *PriceService) snapshot() []Price {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.prices
+}
+
 // GetPriceByProduct returns the price for a given product
 func (ps *PriceService) GetPriceByProduct(product string) (*Price, error) {
 	product = strings.TrimSpace(product)
 
-	for _, p := range ps.prices {
+	for _, p := range ps.snapshot() {
 		if strings.EqualFold(p.Product, product) {
 			return &p, nil
 		}
@@ -92,7 +263,7 @@ func (ps *PriceService) GetPriceByProduct(product string) (*Price, error) {
 func (ps *PriceService) GetProductsByPrice(price float64) ([]Price, error) {
 	var matchingProducts []Price
 
-	for _, p := range ps.prices {
+	for _, p := range ps.snapshot() {
 		if p.Price == price {
 			matchingProducts = append(matchingProducts, p)
 		}
@@ -113,7 +284,7 @@ func (ps *PriceService) GetProductsByPriceRange(minPrice, maxPrice float64) ([]P
 
 	var matchingProducts []Price
 
-	for _, p := range ps.prices {
+	for _, p := range ps.snapshot() {
 		if p.Price >= minPrice && p.Price <= maxPrice {
 			matchingProducts = append(matchingProducts, p)
 		}
@@ -123,142 +294,124 @@ func (ps *PriceService) GetProductsByPriceRange(minPrice, maxPrice float64) ([]P
 }
 
 // FindBestProductMatch attempts to find the best product match for a transaction
-// It tries multiple strategies: exact price match, price range match, and description matching
+// It returns the top ranked candidate from FindProductMatches
 func (ps *PriceService) FindBestProductMatch(amount float64, description string) *Price {
-	// Strategy 1: Try exact price match first
-	products, err := ps.GetProductsByPrice(amount)
-	if err == nil && len(products) == 1 {
-		// If exactly one product matches the price, it's likely correct
-		return &products[0]
-	}
-
-	// Strategy 2: Try fuzzy description matching if we have a description
-	if description != "" {
-		for _, p := range ps.prices {
-			if ps.fuzzyMatch(description, p.Product) {
-				return &p
-			}
-		}
+	match := ps.MatchProduct(amount, description)
+	if match == nil {
+		return nil
 	}
+	return &match.Price
+}
 
-	// Strategy 3: If multiple products match the price, try to disambiguate with description
-	if err == nil && len(products) > 1 && description != "" {
-		for _, p := range products {
-			if ps.fuzzyMatch(description, p.Product) {
-				return &p
-			}
+// MatchProduct finds the best product match for a transaction together with how it was found and
+// how confident the match is. It returns nil if no product matches.
+func (ps *PriceService) MatchProduct(amount float64, description string) *ProductMatch {
+	matches := ps.FindProductMatches(amount, description, 1)
+	if len(matches) == 0 {
+		return nil
+	}
+	return &matches[0]
+}
+
+// FindProductMatches returns up to n plausible products for a transaction, best first (all when n <= 0).
+// Products with the exact price always rank above products matched by description only, which rank above
+// products within ±5% of the amount. Ties keep the order of the price list.
+func (ps *PriceService) FindProductMatches(amount float64, description string, n int) []ProductMatch {
+	// Rank tiers, lower is better
+	const (
+		tierExactPrice = iota
+		tierDescription
+		tierPriceRange
+	)
+
+	type candidate struct {
+		match ProductMatch
+		tier  int
+		index int
+	}
+
+	prices := ps.snapshot()
+
+	exactCount := 0
+	for _, p := range prices {
+		if p.Price == amount {
+			exactCount++
 		}
-		// If no description match but multiple price matches, return the first one
-		return &products[0]
 	}
 
-	// Strategy 4: Try price range matching (±5% tolerance)
 	tolerance := amount * 0.05
-	rangeProducts, err := ps.GetProductsByPriceRange(amount-tolerance, amount+tolerance)
-	if err == nil && len(rangeProducts) > 0 {
-		// If we have a description, try to match within the range
+	var candidates []candidate
+	for i, p := range prices {
+		score := 0.0
 		if description != "" {
-			for _, p := range rangeProducts {
-				if ps.fuzzyMatch(description, p.Product) {
-					return &p
-				}
+			if s := ps.matchScore(description, p.Product); s >= ps.threshold() {
+				score = s
 			}
 		}
-		// Return the closest price match
-		var closest *Price
-		var minDiff float64 = tolerance + 1
-		for _, p := range rangeProducts {
-			diff := amount - p.Price
-			if diff < 0 {
-				diff = -diff
-			}
-			if diff < minDiff {
-				minDiff = diff
-				closest = &p
+
+		switch {
+		case p.Price == amount && exactCount == 1:
+			// If exactly one product matches the price, it's likely correct
+			candidates = append(candidates, candidate{ProductMatch{p, 1, MatchStrategyExactPrice}, tierExactPrice, i})
+		case p.Price == amount && score > 0:
+			// Several products share the price, the description disambiguates
+			candidates = append(candidates, candidate{ProductMatch{p, score, MatchStrategyFuzzyDescription}, tierExactPrice, i})
+		case p.Price == amount:
+			candidates = append(candidates, candidate{ProductMatch{p, 1 / float64(exactCount), MatchStrategyExactPrice}, tierExactPrice, i})
+		case score > 0:
+			candidates = append(candidates, candidate{ProductMatch{p, score, MatchStrategyFuzzyDescription}, tierDescription, i})
+		case math.Abs(amount-p.Price) <= tolerance:
+			// A guess by price alone is never more than half certain, less the further off it is
+			confidence := 0.5
+			if tolerance > 0 {
+				confidence = 0.5 * (1 - math.Abs(amount-p.Price)/tolerance)
 			}
-		}
-		if closest != nil {
-			return closest
+			candidates = append(candidates, candidate{ProductMatch{p, confidence, MatchStrategyPriceRange}, tierPriceRange, i})
 		}
 	}
 
-	return nil
-}
-
-// fuzzyMatch performs fuzzy string matching between description and product name
-func (ps *PriceService) fuzzyMatch(description, productName string) bool {
-	desc := strings.ToLower(strings.TrimSpace(description))
-	prod := strings.ToLower(strings.TrimSpace(productName))
-
-	// Handle empty strings
-	if desc == "" || prod == "" {
-		return false
-	}
-
-	// Exact match
-	if desc == prod {
-		return true
-	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		if a.tier != b.tier {
+			return a.tier - b.tier
+		}
+		if a.match.Confidence != b.match.Confidence {
+			if a.match.Confidence > b.match.Confidence {
+				return -1
+			}
+			return 1
+		}
+		return a.index - b.index
+	})
 
-	// Contains match
-	if strings.Contains(desc, prod) || strings.Contains(prod, desc) {
-		return true
+	if n > 0 && len(candidates) > n {
+		candidates = candidates[:n]
 	}
 
-	// Split and check for word matches
-	descWords := strings.Fields(desc)
-	prodWords := strings.Fields(prod)
-
-	if len(prodWords) == 0 {
-		return false
+	matches := make([]ProductMatch, len(candidates))
+	for i, c := range candidates {
+		matches[i] = c.match
 	}
+	return matches
+}
 
-	matchCount := 0
-	for _, dWord := range descWords {
-		for _, pWord := range prodWords {
-			// Clean up words (remove punctuation)
-			cleanPWord := strings.Trim(pWord, "/-,.")
-			cleanDWord := strings.Trim(dWord, "/-,.")
-
-			if len(cleanPWord) > 2 && (strings.Contains(cleanDWord, cleanPWord) || strings.Contains(cleanPWord, cleanDWord)) {
-				matchCount++
-				break
-			}
-
-			// Special cases for numbers and common abbreviations
-			if cleanPWord == "1-2" && (cleanDWord == "2" || cleanDWord == "1") {
-				matchCount++
-				break
-			}
-			if cleanPWord == "3" && (cleanDWord == "3" || cleanDWord == "three") {
-				matchCount++
-				break
-			}
-			if cleanPWord == "4" && (cleanDWord == "4" || cleanDWord == "four") {
-				matchCount++
-				break
-			}
-			if cleanPWord == "pers" && (cleanDWord == "people" || cleanDWord == "person") {
-				matchCount++
-				break
-			}
-		}
+// threshold returns the configured match threshold, or the default when none is set
+func (ps *PriceService) threshold() float64 {
+	if ps.matchThreshold > 0 {
+		return ps.matchThreshold
 	}
-
-	// Consider it a match if at least half the product words are found
-	threshold := float64(len(prodWords)) * 0.4 // Lower threshold for better matching
-	return float64(matchCount) >= threshold
+	return DefaultMatchThreshold
 }
 
 // GetAllPrices returns all loaded prices
 func (ps *PriceService) GetAllPrices() []Price {
-	return ps.prices
+	return slices.Clone(ps.snapshot())
 }
 
 // GetAllProducts returns all product names
 func (ps *PriceService) GetAllProducts() []string {
-	products := make([]string, len(ps.prices))
-	for i, p := range ps.prices {
+	prices := ps.snapshot()
+	products := make([]string, len(prices))
+	for i, p := range prices {
 		products[i] = p.Product
 	}
 	return products
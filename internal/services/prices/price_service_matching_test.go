@@ -1,6 +1,7 @@
 package prices
 
 import (
+	"slices"
 	"testing"
 )
 
@@ -103,42 +104,180 @@ func TestPriceService_FindBestProductMatch(t *testing.T) {
 	}
 }
 
-func TestPriceService_fuzzyMatch(t *testing.T) {
-	ps := &PriceService{}
+// Helper functions for creating pointers
+func stringPtr(s string) *string {
+	return &s
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+func TestPriceService_FindBestProductMatch_Typos(t *testing.T) {
+	ps := &PriceService{
+		prices: []Price{
+			{Product: "Cabin", Price: 650.0, Currency: "NOK"},
+			{Product: "Caravan/motorhome/tent 3 pers", Price: 410.0, Currency: "NOK"},
+			{Product: "Caravan/motorhome/tent 4 pers", Price: 430.0, Currency: "NOK"},
+			{Product: "Washing machine", Price: 40.0, Currency: "NOK"},
+		},
+	}
 
 	tests := []struct {
 		description string
-		productName string
-		want        bool
+		want        string
 	}{
-		{"cabin", "Cabin", true},
-		{"CABIN BOOKING", "Cabin", true},
-		{"tent 2 pers", "Caravan/motorhome/tent 1-2 pers", true},
-		{"caravan for 4 people", "Caravan/motorhome/tent 4 pers", true},
-		{"washing", "Washing machine", true},
-		{"laundry service", "Washing machine", false}, // "laundry" doesn't contain "washing"
-		{"shower time", "Shower", true},
-		{"completely different", "Cabin", false},
-		{"", "Cabin", false},
-		{"bed linen rental", "Bed linen", true},
-		{"motorhome", "Caravan/motorhome/tent 4 pers", true},
-		{"tent for 3", "Caravan/motorhome/tent 3 pers", true},
+		{"caravn 4 persons", "Caravan/motorhome/tent 4 pers"},
+		{"motorhme for three people", "Caravan/motorhome/tent 3 pers"},
+		{"cabn", "Cabin"},
+		{"wasing machne", "Washing machine"},
 	}
 
 	for _, tc := range tests {
-		t.Run(tc.description+"->"+tc.productName, func(t *testing.T) {
-			if got := ps.fuzzyMatch(tc.description, tc.productName); got != tc.want {
-				t.Errorf("fuzzyMatch(%q, %q) = %v, want %v", tc.description, tc.productName, got, tc.want)
+		t.Run(tc.description, func(t *testing.T) {
+			// An amount without any price match forces description matching
+			result := ps.FindBestProductMatch(9999, tc.description)
+			if result == nil {
+				t.Fatalf("FindBestProductMatch(%q) = nil, want %s", tc.description, tc.want)
+			}
+			if result.Product != tc.want {
+				t.Errorf("FindBestProductMatch(%q) = %s, want %s", tc.description, result.Product, tc.want)
 			}
 		})
 	}
 }
 
-// Helper functions for creating pointers
-func stringPtr(s string) *string {
-	return &s
+func TestPriceService_matchScore(t *testing.T) {
+	ps := &PriceService{}
+
+	// Short words must match exactly
+	if score := ps.matchScore("tent 3", "tent 4"); score >= 1 {
+		t.Errorf("Expected different numbers to lower the score, got %f", score)
+	}
+	if score := ps.matchScore("cab", "Cabin"); score != 0 {
+		t.Errorf("Expected no match for a short partial word, got %f", score)
+	}
+
+	// Exact matches score higher than typos
+	if exact, typo := ps.matchScore("caravan", "Caravan"), ps.matchScore("caravn", "Caravan"); exact <= typo {
+		t.Errorf("Expected exact match (%f) to score higher than typo (%f)", exact, typo)
+	}
 }
 
-func float64Ptr(f float64) *float64 {
-	return &f
+func TestPriceService_MatchOptions(t *testing.T) {
+	ps := &PriceService{}
+	WithSynonyms(map[string]string{"hytte": "cabin"})(ps)
+
+	if ps.matchScore("hytte", "Cabin") < ps.threshold() {
+		t.Error("Expected configured synonym to match")
+	}
+	if tokens := ps.tokenize("people"); len(tokens) != 1 || tokens[0] != "people" {
+		t.Errorf("Expected default synonyms to be replaced, got %v", tokens)
+	}
+
+	strict := &PriceService{}
+	WithMatchThreshold(0.9)(strict)
+	if strict.matchScore("cabn", "Cabin") >= strict.threshold() {
+		t.Error("Expected a high threshold to reject typos")
+	}
+}
+
+func TestPriceService_MatchProduct(t *testing.T) {
+	ps := &PriceService{
+		prices: []Price{
+			{Product: "Cabin", Price: 650.0, Currency: "NOK"},
+			{Product: "Kayak", Price: 200.0, Currency: "NOK"},
+			{Product: "Canoe", Price: 200.0, Currency: "NOK"},
+			{Product: "Shower", Price: 15.0, Currency: "NOK"},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		amount         float64
+		description    string
+		wantProduct    string
+		wantStrategy   string
+		wantConfidence float64
+	}{
+		{"exact price", 650, "", "Cabin", MatchStrategyExactPrice, 1},
+		{"description", 180, "canoe rental", "Canoe", MatchStrategyFuzzyDescription, 1},
+		{"ambiguous price", 200, "", "Kayak", MatchStrategyExactPrice, 0.5},
+		{"exact price ignores description", 15, "unrelated", "Shower", MatchStrategyExactPrice, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			match := ps.MatchProduct(tc.amount, tc.description)
+			if match == nil {
+				t.Fatalf("MatchProduct() = nil, want %s", tc.wantProduct)
+			}
+			if match.Price.Product != tc.wantProduct || match.Strategy != tc.wantStrategy || match.Confidence != tc.wantConfidence {
+				t.Errorf("MatchProduct() = %s/%s/%f, want %s/%s/%f",
+					match.Price.Product, match.Strategy, match.Confidence, tc.wantProduct, tc.wantStrategy, tc.wantConfidence)
+			}
+		})
+	}
+
+	// A guess by price alone is at most half certain
+	match := ps.MatchProduct(14.5, "")
+	if match == nil || match.Strategy != MatchStrategyPriceRange || match.Confidence <= 0 || match.Confidence > 0.5 {
+		t.Errorf("Expected a low-confidence price range match, got %+v", match)
+	}
+
+	if match := ps.MatchProduct(999, "unknown"); match != nil {
+		t.Errorf("Expected no match, got %+v", match)
+	}
+}
+
+func TestPriceService_FindProductMatches(t *testing.T) {
+	ps := &PriceService{
+		prices: []Price{
+			{Product: "Kayak", Price: 200.0, Currency: "NOK"},
+			{Product: "Canoe", Price: 200.0, Currency: "NOK"},
+			{Product: "Canoe deluxe", Price: 250.0, Currency: "NOK"},
+			{Product: "Bike", Price: 205.0, Currency: "NOK"},
+		},
+	}
+
+	productsOf := func(matches []ProductMatch) []string {
+		products := make([]string, len(matches))
+		for i, m := range matches {
+			products[i] = m.Price.Product
+		}
+		return products
+	}
+
+	// Exact prices rank above the fuzzy-only and price range matches, the description picks among them
+	matches := ps.FindProductMatches(200, "canoe rental", 0)
+	want := []string{"Canoe", "Kayak", "Canoe deluxe", "Bike"}
+	if got := productsOf(matches); !slices.Equal(got, want) {
+		t.Errorf("FindProductMatches() = %v, want %v", got, want)
+	}
+	if matches[0].Strategy != MatchStrategyFuzzyDescription || matches[2].Strategy != MatchStrategyFuzzyDescription {
+		t.Errorf("Expected description strategies for the canoes, got %+v", matches)
+	}
+	if matches[3].Strategy != MatchStrategyPriceRange {
+		t.Errorf("Expected price range strategy for Bike, got %s", matches[3].Strategy)
+	}
+
+	// Ties keep the order of the price list
+	for range 10 {
+		if got := productsOf(ps.FindProductMatches(200, "", 2)); !slices.Equal(got, []string{"Kayak", "Canoe"}) {
+			t.Fatalf("FindProductMatches() = %v, want [Kayak Canoe]", got)
+		}
+	}
+
+	if got := ps.FindProductMatches(200, "", 1); len(got) != 1 {
+		t.Errorf("Expected 1 match with n=1, got %d", len(got))
+	}
+
+	if got := ps.FindProductMatches(999, "unknown", 5); len(got) != 0 {
+		t.Errorf("Expected no matches, got %+v", got)
+	}
+
+	// FindBestProductMatch returns the top ranked candidate
+	if best := ps.FindBestProductMatch(200, "canoe rental"); best == nil || best.Product != "Canoe" {
+		t.Errorf("FindBestProductMatch() = %+v, want Canoe", best)
+	}
 }
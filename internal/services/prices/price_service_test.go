@@ -3,6 +3,7 @@ package prices
 import (
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -134,3 +135,120 @@ func TestGetAllProducts(t *testing.T) {
 		t.Errorf("Expected 5 products, got %d", len(allProducts))
 	}
 }
+
+func TestReload(t *testing.T) {
+	csvPath := createTestCSV(t)
+
+	service, err := NewPriceService(csvPath)
+	if err != nil {
+		t.Fatalf("Failed to create PriceService: %v", err)
+	}
+
+	content := `Product;Price;Currency
+Cabin;700;NOK
+Bed linen;80;NOK`
+	if err := os.WriteFile(csvPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to update test CSV file: %v", err)
+	}
+
+	count, err := service.Reload()
+	if err != nil {
+		t.Fatalf("Failed to reload prices: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 prices after reload, got %d", count)
+	}
+
+	price, err := service.GetPriceByProduct("Cabin")
+	if err != nil || price.Price != 700 {
+		t.Errorf("Expected reloaded cabin price 700, got %v (err %v)", price, err)
+	}
+
+	// A broken file keeps the current prices
+	if err := os.WriteFile(csvPath, []byte("Product;Price;Currency\nCabin;not-a-number;NOK"), 0644); err != nil {
+		t.Fatalf("Failed to update test CSV file: %v", err)
+	}
+	if _, err := service.Reload(); err == nil {
+		t.Error("Expected error when reloading an invalid CSV file")
+	}
+	if len(service.GetAllPrices()) != 2 {
+		t.Errorf("Expected previous prices to be kept, got %d", len(service.GetAllPrices()))
+	}
+}
+
+func TestReload_ConcurrentReads(t *testing.T) {
+	service, err := NewPriceService(createTestCSV(t))
+	if err != nil {
+		t.Fatalf("Failed to create PriceService: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				service.FindBestProductMatch(650, "Cabin")
+			}
+		}()
+	}
+
+	for range 20 {
+		if _, err := service.Reload(); err != nil {
+			t.Errorf("Failed to reload prices: %v", err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestUpsertPrice(t *testing.T) {
+	csvPath := createTestCSV(t)
+
+	service, err := NewPriceService(csvPath)
+	if err != nil {
+		t.Fatalf("Failed to create PriceService: %v", err)
+	}
+
+	// Existing products are matched case-insensitively
+	if err := service.UpsertPrice(Price{Product: "cabin", Price: 700, Currency: "nok"}); err != nil {
+		t.Fatalf("Failed to update price: %v", err)
+	}
+	if err := service.UpsertPrice(Price{Product: "Family cabin", Price: 950, Currency: "NOK"}); err != nil {
+		t.Fatalf("Failed to add price: %v", err)
+	}
+
+	if len(service.GetAllPrices()) != 6 {
+		t.Errorf("Expected 6 prices, got %d", len(service.GetAllPrices()))
+	}
+	price, err := service.GetPriceByProduct("Cabin")
+	if err != nil || price.Price != 700 || price.Currency != "NOK" {
+		t.Errorf("Expected updated cabin price 700 NOK, got %v (err %v)", price, err)
+	}
+
+	invalid := []Price{
+		{Product: "", Price: 100, Currency: "NOK"},
+		{Product: "Cabin", Price: -1, Currency: "NOK"},
+		{Product: "Cabin", Price: 100, Currency: "KRONER"},
+		{Product: "Cabin", Price: 100, Currency: "N0K"},
+	}
+	for _, p := range invalid {
+		if err := service.UpsertPrice(p); err == nil {
+			t.Errorf("Expected validation error for %+v", p)
+		}
+	}
+
+	// Saved prices survive a reload
+	if err := service.SaveToCSV(); err != nil {
+		t.Fatalf("Failed to save prices: %v", err)
+	}
+	count, err := service.Reload()
+	if err != nil {
+		t.Fatalf("Failed to reload prices: %v", err)
+	}
+	if count != 6 {
+		t.Errorf("Expected 6 prices after reload, got %d", count)
+	}
+	if price, err := service.GetPriceByProduct("Family cabin"); err != nil || price.Price != 950 {
+		t.Errorf("Expected saved family cabin price 950, got %v (err %v)", price, err)
+	}
+}
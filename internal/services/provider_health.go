@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// DefaultProviderHealthTimeout is how long each provider check may take when no timeout is configured
+const DefaultProviderHealthTimeout = 5 * time.Second
+
+// CheckProviderHealth runs the checks concurrently, each bounded by timeout, and returns the results ordered by provider name
+func CheckProviderHealth(ctx context.Context, checkers map[string]interfaces.HealthChecker, timeout time.Duration) []entities.ProviderHealth {
+	if timeout <= 0 {
+		timeout = DefaultProviderHealthTimeout
+	}
+
+	results := make([]entities.ProviderHealth, 0, len(checkers))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for provider, checker := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := checkProvider(ctx, provider, checker, timeout)
+
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Provider < results[j].Provider
+	})
+	return results
+}
+
+// checkProvider runs a single check and records how long it took
+func checkProvider(ctx context.Context, provider string, checker interfaces.HealthChecker, timeout time.Duration) entities.ProviderHealth {
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := checker.CheckHealth(checkCtx)
+	result := entities.ProviderHealth{
+		Provider:  provider,
+		OK:        err == nil,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+
+	if err != nil {
+		if errors.Is(checkCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		result.Error = err.Error()
+		logger.Warn("Provider health check failed", zap.String("provider", provider), zap.Error(err))
+	}
+	return result
+}
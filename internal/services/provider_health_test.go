@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+)
+
+// fakeHealthChecker fails with err, or waits for the context when block is set
+type fakeHealthChecker struct {
+	err   error
+	block bool
+}
+
+func (f fakeHealthChecker) CheckHealth(ctx context.Context) error {
+	if f.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return f.err
+}
+
+func TestCheckProviderHealth(t *testing.T) {
+	checkers := map[string]interfaces.HealthChecker{
+		"zettle": fakeHealthChecker{block: true},
+		"stripe": fakeHealthChecker{},
+		"vipps":  fakeHealthChecker{err: errors.New("token request failed with status 401")},
+	}
+
+	start := time.Now()
+	results := CheckProviderHealth(context.Background(), checkers, 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected checks to be bounded by the timeout, took %v", elapsed)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for i, provider := range []string{"stripe", "vipps", "zettle"} {
+		if results[i].Provider != provider {
+			t.Errorf("Expected result %d to be %s, got %s", i, provider, results[i].Provider)
+		}
+	}
+
+	if !results[0].OK || results[0].Error != "" {
+		t.Errorf("Expected stripe to be healthy, got %+v", results[0])
+	}
+	if results[1].OK || !strings.Contains(results[1].Error, "401") {
+		t.Errorf("Expected vipps to report the check error, got %+v", results[1])
+	}
+	if results[2].OK || !strings.Contains(results[2].Error, "timed out") {
+		t.Errorf("Expected zettle to report a timeout, got %+v", results[2])
+	}
+	if results[2].LatencyMs < 50 {
+		t.Errorf("Expected zettle latency of at least the timeout, got %dms", results[2].LatencyMs)
+	}
+}
+
+func TestCheckProviderHealth_NoProviders(t *testing.T) {
+	results := CheckProviderHealth(context.Background(), nil, time.Second)
+	if results == nil || len(results) != 0 {
+		t.Errorf("Expected an empty result list, got %#v", results)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+// MaxTimeseriesBuckets limits how many periods a single timeseries report may span
+const MaxTimeseriesBuckets = 1000
+
+// ErrTimeseriesRangeTooLarge is returned when the requested range spans more than MaxTimeseriesBuckets periods
+var ErrTimeseriesRangeTooLarge = errors.New("timeseries range spans too many periods")
+
+// GetRevenueTimeseries returns the count and revenue of succeeded transactions matching the filter per period,
+// with periods aligned to midnight in the report time zone. The filter's From and To are required and its status
+// criteria are ignored.
+func (s *TransactionService) GetRevenueTimeseries(ctx context.Context, filter entities.TransactionFilter, interval entities.TimeseriesInterval) (entities.RevenueTimeseriesReport, error) {
+	loc := s.location
+	if filter.From.IsZero() || filter.To.IsZero() {
+		return entities.RevenueTimeseriesReport{}, fmt.Errorf("timeseries requires both from and to")
+	}
+
+	buckets, err := timeseriesBuckets(interval, filter.From, filter.To, loc)
+	if err != nil {
+		return entities.RevenueTimeseriesReport{}, err
+	}
+
+	filter.Statuses = []string{consts.TRANSACTION_STATUS_SUCCEEDED}
+	transactions, err := s.repository.GetAllTransactions(ctx, filter)
+	if err != nil {
+		return entities.RevenueTimeseriesReport{}, err
+	}
+
+	index := make(map[int64]*entities.TimeseriesBucket, len(buckets))
+	for i := range buckets {
+		index[buckets[i].Start.Unix()] = &buckets[i]
+	}
+	for _, transaction := range transactions {
+		bucket := index[periodStart(transaction.CreatedAt, interval, loc).Unix()]
+		if bucket == nil {
+			continue
+		}
+		bucket.Count++
+		bucket.Revenue += transaction.Amount
+		bucket.RevenueByCurrency[strings.ToUpper(transaction.Currency)] += transaction.Amount
+	}
+
+	return entities.RevenueTimeseriesReport{
+		Interval: interval,
+		Timezone: loc.String(),
+		From:     filter.From.In(loc),
+		To:       filter.To.In(loc),
+		Buckets:  buckets,
+	}, nil
+}
+
+// timeseriesBuckets returns an empty bucket for every period overlapping [from, to)
+func timeseriesBuckets(interval entities.TimeseriesInterval, from, to time.Time, loc *time.Location) ([]entities.TimeseriesBucket, error) {
+	var buckets []entities.TimeseriesBucket
+	for start := periodStart(from, interval, loc); start.Before(to); start = nextPeriod(start, interval) {
+		if len(buckets) == MaxTimeseriesBuckets {
+			return nil, ErrTimeseriesRangeTooLarge
+		}
+		buckets = append(buckets, entities.TimeseriesBucket{
+			Period:            periodLabel(start, interval),
+			Start:             start,
+			RevenueByCurrency: make(map[string]float64),
+		})
+	}
+	return buckets, nil
+}
+
+// periodStart returns the start of the period containing t, at midnight in loc.
+// Weeks start on Monday as in ISO 8601.
+func periodStart(t time.Time, interval entities.TimeseriesInterval, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch interval {
+	case entities.TimeseriesIntervalWeek:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+	case entities.TimeseriesIntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// nextPeriod returns the start of the period after the one starting at start.
+// Calendar arithmetic keeps periods aligned to midnight across daylight saving changes.
+func nextPeriod(start time.Time, interval entities.TimeseriesInterval) time.Time {
+	switch interval {
+	case entities.TimeseriesIntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case entities.TimeseriesIntervalMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// periodLabel formats the period starting at start, using ISO 8601 week numbering for weeks
+func periodLabel(start time.Time, interval entities.TimeseriesInterval) string {
+	switch interval {
+	case entities.TimeseriesIntervalWeek:
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case entities.TimeseriesIntervalMonth:
+		return start.Format("2006-01")
+	default:
+		return start.Format("2006-01-02")
+	}
+}
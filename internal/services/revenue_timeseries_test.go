@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/cache"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/repository"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+func TestGetRevenueTimeseries_Days(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	c := cache.NewInMemoryCache(1*time.Hour, 10*time.Minute)
+	for _, transaction := range []entities.Transaction{
+		// 23:30 UTC on June 1st is 01:30 on June 2nd in Oslo
+		{ID: "late", Status: "succeeded", Amount: 100, Currency: "nok", CreatedAt: time.Date(2025, 6, 1, 23, 30, 0, 0, time.UTC)},
+		{ID: "morning", Status: "succeeded", Amount: 50, Currency: "NOK", CreatedAt: time.Date(2025, 6, 1, 8, 0, 0, 0, oslo)},
+		{ID: "pending", Status: "pending", Amount: 999, Currency: "NOK", CreatedAt: time.Date(2025, 6, 1, 9, 0, 0, 0, oslo)},
+		{ID: "later", Status: "succeeded", Amount: 25, Currency: "EUR", CreatedAt: time.Date(2025, 6, 4, 12, 0, 0, 0, oslo)},
+	} {
+		c.SetTransaction(transaction.ID, transaction, time.Hour)
+	}
+	service := NewTransactionService(repository.NewTransactionRepository(c, nil, nil, nil), WithReportLocation(oslo))
+
+	filter := entities.TransactionFilter{
+		From: time.Date(2025, 6, 1, 0, 0, 0, 0, oslo),
+		To:   time.Date(2025, 6, 5, 0, 0, 0, 0, oslo),
+	}
+	report, err := service.GetRevenueTimeseries(context.Background(), filter, entities.TimeseriesIntervalDay)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []struct {
+		period  string
+		count   int
+		revenue float64
+	}{
+		{"2025-06-01", 1, 50},
+		{"2025-06-02", 1, 100},
+		{"2025-06-03", 0, 0},
+		{"2025-06-04", 1, 25},
+	}
+	if len(report.Buckets) != len(expected) {
+		t.Fatalf("Expected %d buckets, got %d: %+v", len(expected), len(report.Buckets), report.Buckets)
+	}
+	for i, want := range expected {
+		bucket := report.Buckets[i]
+		if bucket.Period != want.period || bucket.Count != want.count || bucket.Revenue != want.revenue {
+			t.Errorf("Bucket %d: expected %s with %d/%.2f, got %s with %d/%.2f",
+				i, want.period, want.count, want.revenue, bucket.Period, bucket.Count, bucket.Revenue)
+		}
+	}
+	if report.Buckets[1].RevenueByCurrency["NOK"] != 100 {
+		t.Errorf("Expected currencies to be normalized, got %v", report.Buckets[1].RevenueByCurrency)
+	}
+	if report.Timezone != "Europe/Oslo" {
+		t.Errorf("Expected timezone Europe/Oslo, got %s", report.Timezone)
+	}
+}
+
+func TestTimeseriesBuckets(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		interval entities.TimeseriesInterval
+		from     time.Time
+		to       time.Time
+		expected []string
+	}{
+		{
+			name:     "days across the switch to summer time",
+			interval: entities.TimeseriesIntervalDay,
+			from:     time.Date(2025, 3, 29, 0, 0, 0, 0, oslo),
+			to:       time.Date(2025, 4, 1, 0, 0, 0, 0, oslo),
+			expected: []string{"2025-03-29", "2025-03-30", "2025-03-31"},
+		},
+		{
+			name:     "ISO weeks across the new year",
+			interval: entities.TimeseriesIntervalWeek,
+			from:     time.Date(2024, 12, 25, 0, 0, 0, 0, oslo),
+			to:       time.Date(2025, 1, 8, 0, 0, 0, 0, oslo),
+			expected: []string{"2024-W52", "2025-W01", "2025-W02"},
+		},
+		{
+			name:     "months of the season",
+			interval: entities.TimeseriesIntervalMonth,
+			from:     time.Date(2025, 5, 15, 0, 0, 0, 0, oslo),
+			to:       time.Date(2025, 9, 1, 0, 0, 0, 0, oslo),
+			expected: []string{"2025-05", "2025-06", "2025-07", "2025-08"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buckets, err := timeseriesBuckets(tt.interval, tt.from, tt.to, oslo)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(buckets) != len(tt.expected) {
+				t.Fatalf("Expected %d buckets, got %d", len(tt.expected), len(buckets))
+			}
+			for i, bucket := range buckets {
+				if bucket.Period != tt.expected[i] {
+					t.Errorf("Bucket %d: expected %s, got %s", i, tt.expected[i], bucket.Period)
+				}
+				if bucket.Start.Hour() != 0 || bucket.Start.Location() != oslo {
+					t.Errorf("Bucket %d: expected start at midnight in Oslo, got %s", i, bucket.Start)
+				}
+			}
+		})
+	}
+
+	_, err = timeseriesBuckets(entities.TimeseriesIntervalDay,
+		time.Date(2020, 1, 1, 0, 0, 0, 0, oslo), time.Date(2025, 1, 1, 0, 0, 0, 0, oslo), oslo)
+	if !errors.Is(err, ErrTimeseriesRangeTooLarge) {
+		t.Errorf("Expected ErrTimeseriesRangeTooLarge for five years of days, got %v", err)
+	}
+}
@@ -1,77 +1,128 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 )
 
 // RoleService handles role assignment and management
 type RoleService struct {
-	// In-memory role mappings (in production, this would come from a database)
+	// Manual role assignments keyed by lowercase email, mirrored to the store when one is set
+	mu          sync.RWMutex
 	userRoles   map[string]entities.Role
+	store       interfaces.RoleStore
 	adminEmails []string
 	usersEmails []string
+	// Roles for OAuth groups from GROUP_ROLE_MAP, keyed by lowercase group name
+	groupRoles map[string]entities.Role
+	// Compare Gmail addresses without dots and "+tag" suffixes, see normalizeEmail
+	canonicalizeGmail bool
+	// Role of verified users no other rule applies to, from DEFAULT_ROLE
+	defaultRole entities.Role
 }
 
-// NewRoleService creates a new role service
-func NewRoleService() *RoleService {
-	// Read admin emails from environment variable
-	adminEmailsStr := viper.GetString(consts.ADMIN_EMAILS)
-	var adminEmails []string
-	if adminEmailsStr != "" {
-		adminEmails = strings.Split(adminEmailsStr, ",")
-		// Trim whitespace from each email
-		for i, email := range adminEmails {
-			adminEmails[i] = strings.TrimSpace(email)
-		}
+// emailMatch describes how an email matched an entry in ADMIN_EMAILS or USER_EMAILS
+type emailMatch int
+
+const (
+	noMatch emailMatch = iota
+	// domainMatch is a verified email matching a domain entry such as "@svennescamping.no"
+	domainMatch
+	exactMatch
+)
+
+// RoleServiceOption configures optional settings on a RoleService
+type RoleServiceOption func(*RoleService)
+
+// WithRoleStore persists role assignments in the given store and loads the existing ones
+func WithRoleStore(store interfaces.RoleStore) RoleServiceOption {
+	return func(rs *RoleService) {
+		rs.store = store
 	}
+}
 
-	// Read user emails from environment variable
-	userEmailsStr := viper.GetString(consts.USER_EMAILS)
-	var userEmails []string
-	if userEmailsStr != "" {
-		userEmails = strings.Split(userEmailsStr, ",")
-		// Trim whitespace from each email
-		for i, email := range userEmails {
-			userEmails[i] = strings.TrimSpace(email)
-		}
+// NewRoleService creates a new role service. Role assignments are loaded from ROLES_FILE_PATH when set,
+// otherwise they are kept in memory only.
+func NewRoleService(opts ...RoleServiceOption) *RoleService {
+	rs := &RoleService{
+		userRoles:         make(map[string]entities.Role),
+		adminEmails:       parseEmailList(viper.GetString(consts.ADMIN_EMAILS)),
+		usersEmails:       parseEmailList(viper.GetString(consts.USER_EMAILS)),
+		groupRoles:        parseGroupRoleMap(viper.GetString(consts.GROUP_ROLE_MAP)),
+		canonicalizeGmail: viper.GetBool(consts.CANONICALIZE_GMAIL),
+		defaultRole:       entities.RoleNoAccess,
+	}
+
+	// An invalid default role is refused at startup, see DefaultRoleFromSettings
+	if defaultRole, err := DefaultRoleFromSettings(); err == nil {
+		rs.defaultRole = defaultRole
+	} else {
+		logger.Error("Ignoring invalid default role", zap.Error(err))
+	}
+
+	if rolesFilePath := viper.GetString(consts.ROLES_FILE_PATH); rolesFilePath != "" {
+		rs.store = NewFileRoleStore(rolesFilePath)
 	}
 
-	// Debug logging to verify environment variables are loaded
-	// logger.Info("Role service initialized",
-	// 	zap.String("admin_emails_raw", adminEmailsStr),
-	// 	zap.Strings("admin_emails", adminEmails),
-	// 	zap.String("user_emails_raw", userEmailsStr),
-	// 	zap.Strings("user_emails", userEmails),
-	// )
+	for _, opt := range opts {
+		opt(rs)
+	}
 
-	return &RoleService{
-		userRoles:   make(map[string]entities.Role),
-		adminEmails: adminEmails,
-		usersEmails: userEmails,
+	if rs.store != nil {
+		roles, err := rs.store.LoadRoles()
+		if err != nil {
+			// The env-var lists still apply, so keep running without the stored assignments
+			logger.Error("Failed to load role assignments", zap.Error(err))
+		}
+		for email, role := range roles {
+			if err := validateAssignmentEmail(email); err != nil {
+				logger.Warn("Skipping stored role assignment", zap.String("email", email), zap.Error(err))
+				continue
+			}
+			rs.userRoles[rs.normalizeEmail(email)] = role
+		}
 	}
+
+	return rs
 }
 
 // GetUserRole determines the role for a user based on their email and other criteria
 func (rs *RoleService) GetUserRole(user *entities.User) entities.Role {
+	adminMatch := rs.isAdminEmail(user.Email, user.Verified)
+	userMatch := rs.isUserEmail(user.Email, user.Verified)
+
 	// Check if user is in the admin list
-	if rs.isAdminEmail(user.Email) {
+	if adminMatch == exactMatch {
 		return entities.RoleAdmin
 	}
 
 	// Check if user is in the user list
-	if rs.isUserEmail(user.Email) {
+	if userMatch == exactMatch {
 		return entities.RoleUser
 	}
 
 	// Check if there's a specific role assignment for this user
-	if role, exists := rs.userRoles[user.Email]; exists {
+	if role, exists := rs.GetAssignedRole(user.Email); exists {
 		return role
 	}
 
+	// Configured group mappings take precedence over the built-in group names
+	for _, group := range user.Groups {
+		if role, exists := rs.groupRoles[strings.ToLower(strings.TrimSpace(group))]; exists {
+			return role
+		}
+	}
+
 	// Check if user belongs to specific groups that grant admin access
 	for _, group := range user.Groups {
 		if strings.ToLower(group) == "admin" || strings.ToLower(group) == "administrators" {
@@ -85,40 +136,203 @@ func (rs *RoleService) GetUserRole(user *entities.User) entities.Role {
 		}
 	}
 
-	// No access for unverified emails or unknown domains
+	// Domain entries are the broadest rule, so they only apply when nothing more specific did
+	if adminMatch == domainMatch {
+		return entities.RoleAdmin
+	}
+	if userMatch == domainMatch {
+		return entities.RoleUser
+	}
+
+	// Verified users nothing else applied to get the default role, unverified emails never get access
+	if user.Verified && strings.TrimSpace(user.Email) != "" {
+		return rs.defaultRole
+	}
 	return entities.RoleNoAccess
 }
 
-// SetUserRole manually sets a role for a specific user
-func (rs *RoleService) SetUserRole(email string, role entities.Role) {
-	if role.IsValid() {
-		rs.userRoles[email] = role
+// DefaultRoleFromSettings returns the role of verified users no other rule applies to, from DEFAULT_ROLE.
+// Any verified Google account gets the default role, so it can't be admin or editor. It returns an error
+// if the setting is another role.
+func DefaultRoleFromSettings() (entities.Role, error) {
+	role := entities.Role(strings.ToLower(strings.TrimSpace(viper.GetString(consts.DEFAULT_ROLE))))
+	switch role {
+	case "":
+		return entities.RoleNoAccess, nil
+	case entities.RoleUser, entities.RoleNoAccess:
+		return role, nil
+	}
+	return entities.RoleNoAccess, fmt.Errorf("invalid %s '%s': must be user or no_access",
+		consts.DEFAULT_ROLE, viper.GetString(consts.DEFAULT_ROLE))
+}
+
+// parseEmailList parses a comma-separated email list, trimming whitespace and dropping empty entries.
+// Entries keep their case for display and are normalized when matched.
+func parseEmailList(value string) []string {
+	var emails []string
+	for _, email := range strings.Split(value, ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// normalizeEmail normalizes an email for comparison, canonicalizing Gmail addresses when CANONICALIZE_GMAIL is set
+func (rs *RoleService) normalizeEmail(email string) string {
+	return normalizeEmail(email, rs.canonicalizeGmail)
+}
+
+// normalizeEmail returns the form emails are compared in: trimmed and lowercase. With canonicalizeGmail,
+// Gmail addresses also lose the dots and "+tag" suffix of the local part, which Gmail ignores when delivering,
+// so every alias of an account compares equal. Domain entries like "@gmail.com" are only trimmed and lowercased.
+func normalizeEmail(email string, canonicalizeGmail bool) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !canonicalizeGmail {
+		return email
+	}
+
+	local, domain, found := strings.Cut(email, "@")
+	if !found || local == "" || (domain != "gmail.com" && domain != "googlemail.com") {
+		return email
+	}
+	local, _, _ = strings.Cut(local, "+")
+	return strings.ReplaceAll(local, ".", "") + "@gmail.com"
+}
+
+// parseGroupRoleMap parses comma-separated group:role pairs. Malformed pairs and invalid roles are logged and skipped.
+func parseGroupRoleMap(value string) map[string]entities.Role {
+	groupRoles := make(map[string]entities.Role)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		// Split on the last colon, roles never contain one
+		idx := strings.LastIndex(pair, ":")
+		if idx <= 0 {
+			logger.Warn("Skipping malformed group role mapping", zap.String("mapping", pair))
+			continue
+		}
+
+		group := strings.ToLower(strings.TrimSpace(pair[:idx]))
+		role := entities.Role(strings.ToLower(strings.TrimSpace(pair[idx+1:])))
+		if group == "" || !role.IsValid() {
+			logger.Warn("Skipping invalid group role mapping",
+				zap.String("mapping", pair),
+				zap.String("role", string(role)),
+			)
+			continue
+		}
+
+		groupRoles[group] = role
+	}
+	return groupRoles
+}
+
+// SetUserRole manually sets a role for a specific user and persists it when a store is configured.
+// The ADMIN_EMAILS and USER_EMAILS lists still take precedence over the assignment.
+func (rs *RoleService) SetUserRole(email string, role entities.Role) error {
+	if !role.IsValid() {
+		return fmt.Errorf("invalid role '%s'", role)
+	}
+	if err := validateAssignmentEmail(email); err != nil {
+		return err
+	}
+
+	return rs.updateRoles(func(roles map[string]entities.Role) {
+		roles[rs.normalizeEmail(email)] = role
+	})
+}
+
+// validateAssignmentEmail rejects emails a role can't be assigned to: blank ones and domain entries,
+// which are rules for ADMIN_EMAILS and USER_EMAILS rather than users
+func validateAssignmentEmail(email string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return errors.New("email is required")
+	}
+	if isDomainEntry(email) {
+		return fmt.Errorf("cannot assign a role to domain entry '%s'", email)
 	}
+	return nil
 }
 
 // RemoveUserRole removes a specific role assignment
-func (rs *RoleService) RemoveUserRole(email string) {
-	delete(rs.userRoles, email)
+func (rs *RoleService) RemoveUserRole(email string) error {
+	return rs.updateRoles(func(roles map[string]entities.Role) {
+		delete(roles, rs.normalizeEmail(email))
+	})
 }
 
-// isAdminEmail checks if an email is in the admin list
-func (rs *RoleService) isAdminEmail(email string) bool {
-	for _, adminEmail := range rs.adminEmails {
-		if strings.EqualFold(email, adminEmail) {
-			return true
+// GetAssignedRole returns the manually assigned role for an email, if any
+func (rs *RoleService) GetAssignedRole(email string) (entities.Role, bool) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	role, exists := rs.userRoles[rs.normalizeEmail(email)]
+	return role, exists
+}
+
+// updateRoles applies a change to a copy of the assignments, saves it and only then makes it visible,
+// so a failed save leaves the current assignments untouched
+func (rs *RoleService) updateRoles(update func(roles map[string]entities.Role)) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	roles := make(map[string]entities.Role, len(rs.userRoles)+1)
+	for email, role := range rs.userRoles {
+		roles[email] = role
+	}
+	update(roles)
+
+	if rs.store != nil {
+		if err := rs.store.SaveRoles(roles); err != nil {
+			return fmt.Errorf("failed to save role assignments: %w", err)
 		}
 	}
-	return false
+
+	rs.userRoles = roles
+	return nil
+}
+
+// isAdminEmail checks if an email is in the admin list
+func (rs *RoleService) isAdminEmail(email string, verified bool) emailMatch {
+	return rs.matchEmailList(rs.adminEmails, email, verified)
+}
+
+// isUserEmail checks if an email is in the user list
+func (rs *RoleService) isUserEmail(email string, verified bool) emailMatch {
+	return rs.matchEmailList(rs.usersEmails, email, verified)
 }
 
-// isUsersEmail checks if an email is in the admin list
-func (rs *RoleService) isUserEmail(email string) bool {
-	for _, userEmail := range rs.usersEmails {
-		if strings.EqualFold(email, userEmail) {
-			return true
+// isDomainEntry reports whether an email list entry is a domain rule like "@svennescamping.no"
+func isDomainEntry(entry string) bool {
+	return strings.HasPrefix(entry, "@")
+}
+
+// matchEmailList matches an email against exact entries and, for verified emails, domain entries,
+// comparing normalized emails. An exact match wins over a domain match.
+func (rs *RoleService) matchEmailList(entries []string, email string, verified bool) emailMatch {
+	email = rs.normalizeEmail(email)
+	if email == "" {
+		return noMatch
+	}
+
+	match := noMatch
+	for _, entry := range entries {
+		entry = rs.normalizeEmail(entry)
+		switch {
+		case isDomainEntry(entry):
+			if verified && len(entry) > 1 && strings.HasSuffix(email, entry) {
+				match = domainMatch
+			}
+		case email == entry:
+			return exactMatch
 		}
 	}
-	return false
+	return match
 }
 
 // AddAdminEmail adds an email to the admin list
@@ -141,8 +355,50 @@ func (rs *RoleService) GetUserEmails() []string {
 	return rs.usersEmails
 }
 
+// ListAllUsers returns every user known from ADMIN_EMAILS, USER_EMAILS and explicit assignments with their
+// effective role, sorted by email. Domain entries are rules rather than users and are left out. The email lists take precedence over assignments, like in GetUserRole.
+func (rs *RoleService) ListAllUsers() []entities.UserRole {
+	users := make(map[string]*entities.UserRole)
+	add := func(email string, role entities.Role, source string) {
+		email = strings.TrimSpace(email)
+		key := rs.normalizeEmail(email)
+		if email == "" || isDomainEntry(email) || users[key] != nil {
+			return
+		}
+		users[key] = &entities.UserRole{Email: email, Role: role, Source: source}
+	}
+
+	// Added in order of precedence, so the first source seen for an email wins
+	for _, email := range rs.adminEmails {
+		add(email, entities.RoleAdmin, entities.RoleSourceAdminEmails)
+	}
+	for _, email := range rs.usersEmails {
+		add(email, entities.RoleUser, entities.RoleSourceUserEmails)
+	}
+
+	for email, role := range rs.GetAllUserRoles() {
+		add(email, role, entities.RoleSourceAssignment)
+		if user := users[rs.normalizeEmail(email)]; user != nil {
+			user.AssignedRole = role
+		}
+	}
+
+	result := make([]entities.UserRole, 0, len(users))
+	for _, user := range users {
+		result = append(result, *user)
+	}
+	slices.SortFunc(result, func(a, b entities.UserRole) int {
+		return strings.Compare(strings.ToLower(a.Email), strings.ToLower(b.Email))
+	})
+
+	return result
+}
+
 // GetAllUserRoles returns all user role assignments
 func (rs *RoleService) GetAllUserRoles() map[string]entities.Role {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
 	result := make(map[string]entities.Role)
 	for email, role := range rs.userRoles {
 		result[email] = role
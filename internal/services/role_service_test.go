@@ -112,3 +112,222 @@ func TestRoleService_EmailLists(t *testing.T) {
 		t.Errorf("Expected %d user emails, got %d", len(expectedUsers), len(userEmails))
 	}
 }
+
+func TestRoleService_GroupRoleMap(t *testing.T) {
+	viper.Set("ADMIN_EMAILS", "")
+	viper.Set("USER_EMAILS", "")
+	viper.Set("GROUP_ROLE_MAP", " Camping-Admins@company.com:admin, staff@company.com:editor,guests@company.com:superuser,broken,users:no_access")
+	t.Cleanup(func() { viper.Set("GROUP_ROLE_MAP", "") })
+
+	rs := NewRoleService()
+
+	tests := []struct {
+		name     string
+		groups   []string
+		expected entities.Role
+	}{
+		{"mapped group is case-insensitive", []string{"camping-admins@company.com"}, entities.RoleAdmin},
+		{"mapped group to editor", []string{"staff@company.com"}, entities.RoleEditor},
+		{"invalid role is skipped", []string{"guests@company.com"}, entities.RoleNoAccess},
+		{"mapping overrides built-in group name", []string{"users"}, entities.RoleNoAccess},
+		{"mapping takes precedence over earlier built-in group", []string{"admin", "staff@company.com"}, entities.RoleEditor},
+		{"unmapped group falls back to built-in names", []string{"administrators"}, entities.RoleAdmin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &entities.User{Email: "someone@example.com", Verified: true, Groups: tt.groups}
+			if result := rs.GetUserRole(user); result != tt.expected {
+				t.Errorf("GetUserRole() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseGroupRoleMap(t *testing.T) {
+	if roles := parseGroupRoleMap(""); len(roles) != 0 {
+		t.Errorf("Expected no mappings for an empty setting, got %v", roles)
+	}
+
+	roles := parseGroupRoleMap("a:admin,:user,b:,c:bogus,d:USER")
+	expected := map[string]entities.Role{"a": entities.RoleAdmin, "d": entities.RoleUser}
+	if len(roles) != len(expected) {
+		t.Fatalf("Expected %d mappings, got %v", len(expected), roles)
+	}
+	for group, role := range expected {
+		if roles[group] != role {
+			t.Errorf("Expected group %s to map to %s, got %s", group, role, roles[group])
+		}
+	}
+}
+
+func TestRoleService_DomainEntries(t *testing.T) {
+	viper.Set("ADMIN_EMAILS", "@admins.test,boss@camping.test")
+	viper.Set("USER_EMAILS", "@camping.test,lead@admins.test")
+	t.Cleanup(func() {
+		viper.Set("ADMIN_EMAILS", "")
+		viper.Set("USER_EMAILS", "")
+	})
+
+	rs := NewRoleService()
+	if err := rs.SetUserRole("revoked@camping.test", entities.RoleNoAccess); err != nil {
+		t.Fatalf("SetUserRole() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		user     *entities.User
+		expected entities.Role
+	}{
+		{"verified email in user domain", &entities.User{Email: "Someone@Camping.test", Verified: true}, entities.RoleUser},
+		{"unverified email in user domain", &entities.User{Email: "someone@camping.test", Verified: false}, entities.RoleNoAccess},
+		{"verified email in admin domain", &entities.User{Email: "someone@admins.test", Verified: true}, entities.RoleAdmin},
+		{"unverified email in admin domain", &entities.User{Email: "someone@admins.test", Verified: false}, entities.RoleNoAccess},
+		{"exact admin email wins over user domain", &entities.User{Email: "boss@camping.test", Verified: true}, entities.RoleAdmin},
+		{"exact user email wins over admin domain", &entities.User{Email: "lead@admins.test", Verified: true}, entities.RoleUser},
+		{"exact email does not require verification", &entities.User{Email: "boss@camping.test", Verified: false}, entities.RoleAdmin},
+		{"assignment wins over domain", &entities.User{Email: "revoked@camping.test", Verified: true}, entities.RoleNoAccess},
+		{"subdomain suffix does not match", &entities.User{Email: "someone@notcamping.test", Verified: true}, entities.RoleNoAccess},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := rs.GetUserRole(tt.user); result != tt.expected {
+				t.Errorf("GetUserRole() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+
+	for _, user := range rs.ListAllUsers() {
+		if isDomainEntry(user.Email) {
+			t.Errorf("Expected domain entry %s not to be listed as a user", user.Email)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email             string
+		canonicalizeGmail bool
+		expected          string
+	}{
+		{"  Admin@Test.com ", false, "admin@test.com"},
+		{"Admin+test@Gmail.com", false, "admin+test@gmail.com"},
+		{"Admin+test@Gmail.com", true, "admin@gmail.com"},
+		{"first.last@googlemail.com", true, "firstlast@gmail.com"},
+		{"first.last+camp@example.com", true, "first.last+camp@example.com"},
+		{"@gmail.com", true, "@gmail.com"},
+		{"", true, ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeEmail(tt.email, tt.canonicalizeGmail); got != tt.expected {
+			t.Errorf("normalizeEmail(%q, %v) = %q, want %q", tt.email, tt.canonicalizeGmail, got, tt.expected)
+		}
+	}
+}
+
+func TestRoleService_CanonicalizeGmail(t *testing.T) {
+	viper.Set("ADMIN_EMAILS", " admin@gmail.com ,")
+	viper.Set("USER_EMAILS", "")
+	t.Cleanup(func() {
+		viper.Set("ADMIN_EMAILS", "")
+		viper.Set("CANONICALIZE_GMAIL", false)
+	})
+
+	alias := &entities.User{Email: "Admin+test@Gmail.com", Verified: true}
+
+	if role := NewRoleService().GetUserRole(alias); role != entities.RoleNoAccess {
+		t.Errorf("Expected a Gmail alias not to match without canonicalization, got %v", role)
+	}
+
+	viper.Set("CANONICALIZE_GMAIL", true)
+	rs := NewRoleService()
+	if role := rs.GetUserRole(alias); role != entities.RoleAdmin {
+		t.Errorf("Expected Admin+test@Gmail.com to match admin@gmail.com, got %v", role)
+	}
+	if role := rs.GetUserRole(&entities.User{Email: "ad.min@gmail.com", Verified: true}); role != entities.RoleAdmin {
+		t.Errorf("Expected a dotted Gmail alias to match admin@gmail.com, got %v", role)
+	}
+	if role := rs.GetUserRole(&entities.User{Email: "admin+test@example.com", Verified: true}); role != entities.RoleNoAccess {
+		t.Errorf("Expected non-Gmail addresses to keep their tag, got %v", role)
+	}
+
+	// Assignments are canonicalized too
+	if err := rs.SetUserRole("Staff.Member+camp@gmail.com", entities.RoleEditor); err != nil {
+		t.Fatalf("SetUserRole() error = %v", err)
+	}
+	if role := rs.GetUserRole(&entities.User{Email: "staffmember@gmail.com", Verified: true}); role != entities.RoleEditor {
+		t.Errorf("Expected the assigned role for the canonical address, got %v", role)
+	}
+}
+
+func TestRoleService_DefaultRole(t *testing.T) {
+	viper.Set("ADMIN_EMAILS", "admin@test.com")
+	viper.Set("USER_EMAILS", "")
+	viper.Set("DEFAULT_ROLE", "user")
+	t.Cleanup(func() {
+		viper.Set("ADMIN_EMAILS", "")
+		viper.Set("DEFAULT_ROLE", "")
+	})
+
+	rs := NewRoleService()
+	if err := rs.SetUserRole("blocked@test.com", entities.RoleNoAccess); err != nil {
+		t.Fatalf("SetUserRole() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		user     *entities.User
+		expected entities.Role
+	}{
+		{"verified unknown user gets the default role", &entities.User{Email: "new@test.com", Verified: true}, entities.RoleUser},
+		{"unverified unknown user gets no access", &entities.User{Email: "new@test.com", Verified: false}, entities.RoleNoAccess},
+		{"user without email gets no access", &entities.User{Verified: true}, entities.RoleNoAccess},
+		{"email list wins over the default role", &entities.User{Email: "admin@test.com", Verified: true}, entities.RoleAdmin},
+		{"assignment wins over the default role", &entities.User{Email: "blocked@test.com", Verified: true}, entities.RoleNoAccess},
+		{"group wins over the default role", &entities.User{Email: "grouped@test.com", Verified: true, Groups: []string{"noaccess"}}, entities.RoleNoAccess},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := rs.GetUserRole(tt.user); result != tt.expected {
+				t.Errorf("GetUserRole() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDefaultRoleFromSettings(t *testing.T) {
+	t.Cleanup(func() { viper.Set("DEFAULT_ROLE", "") })
+
+	tests := []struct {
+		value    string
+		expected entities.Role
+		wantErr  bool
+	}{
+		{"", entities.RoleNoAccess, false},
+		{"no_access", entities.RoleNoAccess, false},
+		{" User ", entities.RoleUser, false},
+		{"superuser", entities.RoleNoAccess, true},
+		// Every verified account gets the default role, so it can't grant more than user
+		{"editor", entities.RoleNoAccess, true},
+		{"admin", entities.RoleNoAccess, true},
+	}
+
+	for _, tt := range tests {
+		viper.Set("DEFAULT_ROLE", tt.value)
+		role, err := DefaultRoleFromSettings()
+		if (err != nil) != tt.wantErr || role != tt.expected {
+			t.Errorf("DefaultRoleFromSettings() with %q = %v, %v, want %v (error %v)", tt.value, role, err, tt.expected, tt.wantErr)
+		}
+	}
+
+	// An invalid default role never grants access
+	for _, value := range []string{"superuser", "admin"} {
+		viper.Set("DEFAULT_ROLE", value)
+		if role := NewRoleService().GetUserRole(&entities.User{Email: "new@test.com", Verified: true}); role != entities.RoleNoAccess {
+			t.Errorf("Expected no access with default role %q, got %v", value, role)
+		}
+	}
+}
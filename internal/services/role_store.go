@@ -0,0 +1,67 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+)
+
+// FileRoleStore keeps role assignments in a JSON file mapping emails to roles
+type FileRoleStore struct {
+	path string
+}
+
+// Compile-time check to ensure FileRoleStore implements RoleStore interface
+var _ interfaces.RoleStore = (*FileRoleStore)(nil)
+
+// NewFileRoleStore creates a role store backed by the JSON file at path
+func NewFileRoleStore(path string) *FileRoleStore {
+	return &FileRoleStore{path: path}
+}
+
+// LoadRoles reads the role assignments. A missing file means no assignments yet.
+func (s *FileRoleStore) LoadRoles() (map[string]entities.Role, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]entities.Role), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read role file: %w", err)
+	}
+
+	roles := make(map[string]entities.Role)
+	if err := json.Unmarshal(data, &roles); err != nil {
+		return nil, fmt.Errorf("failed to parse role file: %w", err)
+	}
+	return roles, nil
+}
+
+// SaveRoles writes the role assignments. The file is replaced atomically so a failed write never loses roles.
+func (s *FileRoleStore) SaveRoles(roles map[string]entities.Role) error {
+	data, err := json.MarshalIndent(roles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode roles: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create role file directory: %w", err)
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write role file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace role file: %w", err)
+	}
+
+	return nil
+}
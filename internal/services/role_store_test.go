@@ -0,0 +1,159 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/spf13/viper"
+)
+
+// failingRoleStore fails every save
+type failingRoleStore struct{}
+
+func (failingRoleStore) LoadRoles() (map[string]entities.Role, error) {
+	return map[string]entities.Role{}, nil
+}
+
+func (failingRoleStore) SaveRoles(map[string]entities.Role) error {
+	return errors.New("disk full")
+}
+
+func TestFileRoleStore(t *testing.T) {
+	store := NewFileRoleStore(filepath.Join(t.TempDir(), "data", "roles.json"))
+
+	roles, err := store.LoadRoles()
+	if err != nil || len(roles) != 0 {
+		t.Fatalf("Expected no roles from a missing file, got %v (err %v)", roles, err)
+	}
+
+	want := map[string]entities.Role{"guest@example.com": entities.RoleUser, "owner@example.com": entities.RoleAdmin}
+	if err := store.SaveRoles(want); err != nil {
+		t.Fatalf("SaveRoles() error = %v", err)
+	}
+
+	roles, err = store.LoadRoles()
+	if err != nil {
+		t.Fatalf("LoadRoles() error = %v", err)
+	}
+	if len(roles) != len(want) || roles["guest@example.com"] != entities.RoleUser || roles["owner@example.com"] != entities.RoleAdmin {
+		t.Errorf("LoadRoles() = %v, want %v", roles, want)
+	}
+}
+
+func TestRoleService_PersistsAssignments(t *testing.T) {
+	viper.Set("ADMIN_EMAILS", "admin@test.com")
+	viper.Set("USER_EMAILS", "")
+	t.Cleanup(viper.Reset)
+
+	store := NewFileRoleStore(filepath.Join(t.TempDir(), "roles.json"))
+	rs := NewRoleService(WithRoleStore(store))
+
+	if err := rs.SetUserRole("Guest@Example.com", entities.RoleUser); err != nil {
+		t.Fatalf("SetUserRole() error = %v", err)
+	}
+	if err := rs.SetUserRole("admin@test.com", entities.RoleNoAccess); err != nil {
+		t.Fatalf("SetUserRole() error = %v", err)
+	}
+	if err := rs.SetUserRole("guest@example.com", entities.Role("superuser")); err == nil {
+		t.Error("Expected an error for an invalid role")
+	}
+
+	// A new service, e.g. after a restart, sees the same assignments
+	restarted := NewRoleService(WithRoleStore(store))
+	if role := restarted.GetUserRole(&entities.User{Email: "guest@example.com"}); role != entities.RoleUser {
+		t.Errorf("Expected stored role %s, got %s", entities.RoleUser, role)
+	}
+
+	// The env-var lists take precedence over assignments
+	if role := restarted.GetUserRole(&entities.User{Email: "admin@test.com"}); role != entities.RoleAdmin {
+		t.Errorf("Expected ADMIN_EMAILS to win, got %s", role)
+	}
+
+	if err := restarted.RemoveUserRole("guest@example.com"); err != nil {
+		t.Fatalf("RemoveUserRole() error = %v", err)
+	}
+	if _, exists := NewRoleService(WithRoleStore(store)).GetAssignedRole("guest@example.com"); exists {
+		t.Error("Expected the removed assignment to be gone after a restart")
+	}
+}
+
+func TestRoleService_FailedSaveKeepsAssignments(t *testing.T) {
+	rs := NewRoleService(WithRoleStore(failingRoleStore{}))
+
+	if err := rs.SetUserRole("guest@example.com", entities.RoleAdmin); err == nil {
+		t.Fatal("Expected an error when the store fails")
+	}
+	if _, exists := rs.GetAssignedRole("guest@example.com"); exists {
+		t.Error("Expected the assignment not to apply when it couldn't be saved")
+	}
+}
+
+func TestRoleService_ListAllUsers(t *testing.T) {
+	viper.Set("ADMIN_EMAILS", "owner@test.com, Staff@test.com")
+	viper.Set("USER_EMAILS", "staff@test.com,guest@test.com,")
+	t.Cleanup(viper.Reset)
+
+	rs := NewRoleService(WithRoleStore(NewFileRoleStore(filepath.Join(t.TempDir(), "roles.json"))))
+	if err := rs.SetUserRole("guest@test.com", entities.RoleNoAccess); err != nil {
+		t.Fatalf("SetUserRole() error = %v", err)
+	}
+	if err := rs.SetUserRole("editor@test.com", entities.RoleAdmin); err != nil {
+		t.Fatalf("SetUserRole() error = %v", err)
+	}
+
+	want := []entities.UserRole{
+		{Email: "editor@test.com", Role: entities.RoleAdmin, Source: entities.RoleSourceAssignment, AssignedRole: entities.RoleAdmin},
+		{Email: "guest@test.com", Role: entities.RoleUser, Source: entities.RoleSourceUserEmails, AssignedRole: entities.RoleNoAccess},
+		{Email: "owner@test.com", Role: entities.RoleAdmin, Source: entities.RoleSourceAdminEmails},
+		{Email: "Staff@test.com", Role: entities.RoleAdmin, Source: entities.RoleSourceAdminEmails},
+	}
+
+	got := rs.ListAllUsers()
+	if len(got) != len(want) {
+		t.Fatalf("ListAllUsers() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ListAllUsers()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// The listed role matches the role users actually get
+	for _, user := range got {
+		if role := rs.GetUserRole(&entities.User{Email: user.Email}); role != user.Role {
+			t.Errorf("Listed role %s for %s, but GetUserRole returns %s", user.Role, user.Email, role)
+		}
+	}
+}
+
+func TestRoleService_RejectsDomainAndBlankAssignments(t *testing.T) {
+	store := NewFileRoleStore(filepath.Join(t.TempDir(), "roles.json"))
+	// A hand-edited roles file can contain entries SetUserRole refuses
+	if err := store.SaveRoles(map[string]entities.Role{
+		"@svennescamping.no": entities.RoleUser,
+		" ":                  entities.RoleAdmin,
+		"guest@example.com":  entities.RoleUser,
+	}); err != nil {
+		t.Fatalf("SaveRoles() error = %v", err)
+	}
+
+	rs := NewRoleService(WithRoleStore(store))
+	for _, email := range []string{"@svennescamping.no", "", "  "} {
+		if err := rs.SetUserRole(email, entities.RoleUser); err == nil {
+			t.Errorf("Expected an error assigning a role to %q", email)
+		}
+	}
+
+	roles := rs.GetAllUserRoles()
+	if len(roles) != 1 || roles["guest@example.com"] != entities.RoleUser {
+		t.Errorf("Expected only the stored user assignment to load, got %v", roles)
+	}
+
+	// Listing users must not panic on skipped entries
+	users := rs.ListAllUsers()
+	if len(users) != 1 || users[0].Email != "guest@example.com" {
+		t.Errorf("ListAllUsers() = %+v, want only guest@example.com", users)
+	}
+}
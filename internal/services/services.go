@@ -5,8 +5,11 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/rogerwesterbo/svennescamping-backend/internal/readiness"
 	"github.com/rogerwesterbo/svennescamping-backend/internal/services/prices"
+	"github.com/rogerwesterbo/svennescamping-backend/internal/settings"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httpclienthelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
 	"github.com/spf13/viper"
@@ -17,6 +20,12 @@ var (
 	PriceService             *prices.PriceService
 	GlobalTransactionService *TransactionService
 	GlobalBackgroundFetcher  *BackgroundFetcher
+	// GlobalCurrencyConverter converts revenue to BASE_CURRENCY when a summary or report asks for it
+	GlobalCurrencyConverter *CurrencyConverter
+	// GlobalCacheNotifier notifies subscribers of transactions set or deleted in the cache
+	GlobalCacheNotifier interfaces.CacheNotifier
+	// GlobalWebhookDispatcher posts new transactions to OUTBOUND_WEBHOOK_URL
+	GlobalWebhookDispatcher *WebhookDispatcher
 )
 
 func InitializeServices() {
@@ -31,38 +40,126 @@ func InitializeServices() {
 	}
 
 	// Initialize the price service
-	PriceService, err = prices.NewPriceService(absPath)
+	// The CSV delimiter is detected from the header line unless configured
+	priceOptions := []prices.Option{
+		prices.WithMatchThreshold(viper.GetFloat64(consts.PRICE_MATCH_THRESHOLD)),
+		prices.WithLenient(viper.GetBool(consts.PRICES_CSV_LENIENT)),
+	}
+	if delimiter := []rune(viper.GetString(consts.PRICES_CSV_DELIMITER)); len(delimiter) > 0 {
+		priceOptions = append(priceOptions, prices.WithDelimiter(delimiter[0]))
+	}
+
+	PriceService, err = prices.NewPriceService(absPath, priceOptions...)
 	if err != nil {
 		logger.Fatal("Failed to initialize price service: %v", zap.Error(err))
 	}
+
+	readiness.Set(readiness.CheckPriceService, true)
+
+	for _, skipped := range PriceService.LastLoadReport().Skipped {
+		logger.Warn("Skipped invalid price row", zap.Int("line", skipped.Line), zap.String("reason", skipped.Reason))
+	}
 }
 
 // InitializeTransactionServices initializes transaction-related services
 func InitializeTransactionServices(
 	cache interfaces.Cache,
+	notifier interfaces.CacheNotifier,
 	transactionRepo interfaces.TransactionRepository,
 	stripeClient interfaces.Transactions,
 	vippsClient interfaces.Transactions,
 	zettleClient interfaces.Transactions,
+	reportLocation *time.Location,
 ) {
-	// Initialize transaction service
-	GlobalTransactionService = NewTransactionService(transactionRepo)
+	// Seed the price cache and keep it in sync with the price list, so enrichment can look products up in it
+	if PriceService != nil {
+		SeedPriceCache(cache, PriceService.GetAllPrices())
+		PriceService.OnChange(func(priceList []prices.Price) {
+			SeedPriceCache(cache, priceList)
+		})
+	}
+
+	// Initialize transaction service, with report dates and periods in the configured time zone
+	GlobalTransactionService = NewTransactionService(transactionRepo, WithReportLocation(reportLocation), WithPriceCache(cache))
+	GlobalCacheNotifier = notifier
+
+	GlobalCurrencyConverter = NewCurrencyConverter(
+		viper.GetString(consts.BASE_CURRENCY),
+		ParseCurrencyRates(viper.GetString(consts.CURRENCY_RATES)),
+	)
 
-	// Initialize background fetcher with 5-minute interval
+	// Initialize background fetcher with the configured interval (default 5 minutes)
+	// Failed provider fetches back off exponentially from the base up to the max
+	fetchInterval := settings.GetDuration(consts.FETCH_INTERVAL, 5*time.Minute)
+	backoffBase := settings.GetDuration(consts.FETCH_BACKOFF_BASE, 5*time.Minute)
+	backoffMax := settings.GetDuration(consts.FETCH_BACKOFF_MAX, 30*time.Minute)
 	GlobalBackgroundFetcher = NewBackgroundFetcher(
 		cache,
 		stripeClient,
 		vippsClient,
 		zettleClient,
-		5*time.Minute,
+		fetchInterval,
+		backoffBase,
+		backoffMax,
+		WithTransactionTTL(settings.GetDuration(consts.CACHE_TTL, consts.CACHE_TTL_DEFAULT)),
+		WithBatchSize(FetchBatchSize()),
+		WithAnnotationRetention(time.Duration(viper.GetInt(consts.FETCH_LOOKBACK_DAYS))*24*time.Hour),
+	)
+
+	// Unsigned deliveries can't be told apart from forged ones, so refuse to post them
+	webhookURL := viper.GetString(consts.OUTBOUND_WEBHOOK_URL)
+	if webhookURL != "" && viper.GetString(consts.OUTBOUND_WEBHOOK_SECRET) == "" {
+		logger.Fatal("OUTBOUND_WEBHOOK_SECRET must be set when OUTBOUND_WEBHOOK_URL is set")
+	}
+
+	GlobalWebhookDispatcher = NewWebhookDispatcher(
+		cache,
+		notifier,
+		webhookURL,
+		WithWebhookSecret(viper.GetString(consts.OUTBOUND_WEBHOOK_SECRET)),
+		WithWebhookMaxAttempts(viper.GetInt(consts.OUTBOUND_WEBHOOK_MAX_ATTEMPTS)),
+		WithWebhookBackoff(
+			settings.GetDuration(consts.OUTBOUND_WEBHOOK_BACKOFF_BASE, 2*time.Second),
+			settings.GetDuration(consts.OUTBOUND_WEBHOOK_BACKOFF_MAX, time.Minute),
+		),
+		WithWebhookStatePath(viper.GetString(consts.OUTBOUND_WEBHOOK_STATE_PATH)),
+		WithWebhookRetention(time.Duration(viper.GetInt(consts.FETCH_LOOKBACK_DAYS))*24*time.Hour),
+		WithWebhookHTTPClient(httpclienthelpers.NewClient(settings.GetDuration(consts.HTTP_CLIENT_TIMEOUT, httpclienthelpers.DefaultTimeout))),
 	)
 
 	logger.Info("Transaction services initialized successfully")
 }
 
+// FetchBatchSize reads how many transactions are fetched per provider from FETCH_BATCH_SIZE.
+// Non-positive values fall back to the default and values above the maximum are capped, both with a warning.
+func FetchBatchSize() int {
+	size := viper.GetInt(consts.FETCH_BATCH_SIZE)
+	switch {
+	case size <= 0:
+		logger.Warn("Invalid fetch batch size, using default",
+			zap.String("key", consts.FETCH_BATCH_SIZE),
+			zap.String("value", viper.GetString(consts.FETCH_BATCH_SIZE)),
+			zap.Int("default", consts.FETCH_BATCH_SIZE_DEFAULT))
+		return consts.FETCH_BATCH_SIZE_DEFAULT
+	case size > consts.FETCH_BATCH_SIZE_MAX:
+		logger.Warn("Fetch batch size too large, capping it",
+			zap.String("key", consts.FETCH_BATCH_SIZE),
+			zap.Int("value", size),
+			zap.Int("max", consts.FETCH_BATCH_SIZE_MAX))
+		return consts.FETCH_BATCH_SIZE_MAX
+	}
+	return size
+}
+
 // StartBackgroundFetching starts the background data fetching from all providers
 func StartBackgroundFetching(ctx context.Context) {
 	if GlobalBackgroundFetcher != nil {
+		// Register the check before starting so /ready can't report ready ahead of the initial fetch
+		if viper.GetBool(consts.WARM_CACHE_ON_START) {
+			readiness.Set(readiness.CheckCacheWarm, false)
+			go waitForWarmCache(ctx, GlobalBackgroundFetcher, settings.GetDuration(consts.WARM_CACHE_TIMEOUT, 2*time.Minute))
+		}
+
 		logger.Info("Starting background transaction fetching")
 		GlobalBackgroundFetcher.Start(ctx)
 	} else {
@@ -70,12 +167,58 @@ func StartBackgroundFetching(ctx context.Context) {
 	}
 }
 
-// StopBackgroundFetching stops the background data fetching
-func StopBackgroundFetching() {
+// waitForWarmCache marks the cache as warm for readiness once the initial fetch has completed,
+// or after the timeout so a slow provider can't keep the API unready forever
+func waitForWarmCache(ctx context.Context, fetcher *BackgroundFetcher, timeout time.Duration) {
+	if fetcher.WaitForInitialFetch(ctx, timeout) {
+		logger.Info("Transaction cache warmed up")
+	} else if ctx.Err() != nil {
+		return
+	} else {
+		logger.Warn("Timed out waiting for the initial fetch, reporting ready with a partially warm cache",
+			zap.Duration("timeout", timeout))
+	}
+
+	readiness.Set(readiness.CheckCacheWarm, true)
+}
+
+// StartWebhookDispatcher starts delivering new transactions to the outbound webhook, if configured
+func StartWebhookDispatcher(ctx context.Context) {
+	if GlobalWebhookDispatcher != nil {
+		GlobalWebhookDispatcher.Start(ctx)
+	}
+}
+
+// StopWebhookDispatcher stops outbound webhook deliveries
+func StopWebhookDispatcher() {
+	if GlobalWebhookDispatcher != nil {
+		GlobalWebhookDispatcher.Stop()
+	}
+}
+
+// StopBackgroundFetching stops the background data fetching, waiting for in-flight fetches until the context is done
+func StopBackgroundFetching(ctx context.Context) error {
 	if GlobalBackgroundFetcher != nil {
 		logger.Info("Stopping background transaction fetching")
-		GlobalBackgroundFetcher.Stop()
+		return GlobalBackgroundFetcher.Shutdown(ctx)
+	}
+	return nil
+}
+
+// GetBackgroundFetchInterval returns the configured background fetch interval
+func GetBackgroundFetchInterval() time.Duration {
+	if GlobalBackgroundFetcher != nil {
+		return GlobalBackgroundFetcher.Interval()
+	}
+	return 0
+}
+
+// GetBackgroundFetchStats returns per-provider fetch statistics
+func GetBackgroundFetchStats() map[string]ProviderStats {
+	if GlobalBackgroundFetcher != nil {
+		return GlobalBackgroundFetcher.Stats()
 	}
+	return map[string]ProviderStats{}
 }
 
 // IsBackgroundFetchingRunning returns true if background fetching is active
@@ -1,9 +1,16 @@
 package services
 
 import (
+	"cmp"
 	"context"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/rogerwesterbo/svennescamping-backend/internal/services/prices"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/statushelpers"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
 	"go.uber.org/zap"
@@ -11,23 +18,142 @@ import (
 
 type TransactionService struct {
 	repository interfaces.TransactionRepository
+	location   *time.Location   // Time zone plain dates and report periods are aligned to
+	priceCache interfaces.Cache // Prices by product, looked up before matching against the price list
 }
 
-func NewTransactionService(repository interfaces.TransactionRepository) *TransactionService {
-	return &TransactionService{
+// TransactionServiceOption configures optional settings on a TransactionService
+type TransactionServiceOption func(*TransactionService)
+
+// WithReportLocation sets the time zone plain dates and report periods are aligned to. A nil location keeps UTC.
+func WithReportLocation(loc *time.Location) TransactionServiceOption {
+	return func(s *TransactionService) {
+		if loc != nil {
+			s.location = loc
+		}
+	}
+}
+
+func NewTransactionService(repository interfaces.TransactionRepository, opts ...TransactionServiceOption) *TransactionService {
+	s := &TransactionService{
 		repository: repository,
+		location:   time.UTC,
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
-func (s *TransactionService) GetTransactions(ctx context.Context, limit int) ([]entities.Transaction, error) {
-	transactions, err := s.repository.GetTransactions(ctx, limit)
+// WithPriceCache sets the cache prices are looked up in by product before matching against the price list
+func WithPriceCache(cache interfaces.Cache) TransactionServiceOption {
+	return func(s *TransactionService) {
+		s.priceCache = cache
+	}
+}
+
+// ReportLocation returns the time zone plain dates and report periods are aligned to
+func (s *TransactionService) ReportLocation() *time.Location {
+	return s.location
+}
+
+// GetTransactions returns up to limit enriched transactions, with warnings for providers that failed to
+// return theirs. It only fails when no provider returned transactions.
+func (s *TransactionService) GetTransactions(ctx context.Context, filter entities.TransactionFilter, limit int) (entities.TransactionsResult, error) {
+	result, err := s.repository.GetTransactions(ctx, filter, limit)
 	if err != nil {
-		return nil, err
+		return entities.TransactionsResult{}, err
 	}
 
 	// Enrich transactions with product information
-	enrichedTransactions := s.enrichTransactionsWithProducts(transactions)
-	return enrichedTransactions, nil
+	result.Items = s.enrichTransactionsWithProducts(result.Items)
+	return result, nil
+}
+
+// GetTransactionsPage returns a page of enriched transactions, with warnings for providers that failed to
+// return theirs, and the cursor for the next page
+func (s *TransactionService) GetTransactionsPage(ctx context.Context, filter entities.TransactionFilter, cursor string, limit int) (entities.TransactionsResult, string, error) {
+	result, nextCursor, err := s.repository.GetTransactionsPage(ctx, filter, cursor, limit)
+	if err != nil {
+		return entities.TransactionsResult{}, "", err
+	}
+
+	result.Items = s.enrichTransactionsWithProducts(result.Items)
+	return result, nextCursor, nil
+}
+
+// GetTransactionsSummary returns aggregate totals for all cached transactions matching the filter.
+// Revenue is also converted to the converter's base currency when a converter is given.
+func (s *TransactionService) GetTransactionsSummary(ctx context.Context, filter entities.TransactionFilter, converter *CurrencyConverter) (entities.TransactionSummary, error) {
+	transactions, err := s.repository.GetAllTransactions(ctx, filter)
+	if err != nil {
+		return entities.TransactionSummary{}, err
+	}
+
+	summary := summarizeTransactions(transactions)
+	if converter != nil {
+		converted := convertRevenue(transactions, converter)
+		summary.Converted = &converted
+	}
+	return summary, nil
+}
+
+// CountTransactions returns the number of cached transactions matching the filter
+func (s *TransactionService) CountTransactions(ctx context.Context, filter entities.TransactionFilter) (int, error) {
+	return s.repository.CountTransactions(ctx, filter)
+}
+
+// GetLatestTransactionBySource returns the newest enriched cached transaction of each configured source, keyed by source
+func (s *TransactionService) GetLatestTransactionBySource(ctx context.Context) (map[string]entities.Transaction, error) {
+	latest, err := s.repository.GetLatestTransactionBySource(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for source, transaction := range latest {
+		latest[source] = s.enrichTransactionWithProduct(transaction)
+	}
+	return latest, nil
+}
+
+// SearchTransactions returns up to limit enriched transactions, newest first, matching a free-text query
+func (s *TransactionService) SearchTransactions(ctx context.Context, query string, limit int) ([]entities.Transaction, error) {
+	transactions, err := s.repository.SearchTransactions(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.enrichTransactionsWithProducts(transactions), nil
+}
+
+// GetAllTransactions returns all enriched cached transactions matching the filter, sorted newest first
+func (s *TransactionService) GetAllTransactions(ctx context.Context, filter entities.TransactionFilter) ([]entities.Transaction, error) {
+	transactions, err := s.repository.GetAllTransactions(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.enrichTransactionsWithProducts(transactions), nil
+}
+
+// GetRevenueByProduct returns the revenue of succeeded transactions matching the filter per matched product.
+// The status criteria of the filter are ignored. When a converter is given, revenue is also converted to its
+// base currency and products are sorted by the converted revenue.
+func (s *TransactionService) GetRevenueByProduct(ctx context.Context, filter entities.TransactionFilter, converter *CurrencyConverter) (entities.RevenueByProductReport, error) {
+	filter.Statuses = []string{consts.TRANSACTION_STATUS_SUCCEEDED}
+
+	transactions, err := s.GetAllTransactions(ctx, filter)
+	if err != nil {
+		return entities.RevenueByProductReport{}, err
+	}
+
+	report := revenueByProduct(transactions)
+	if converter != nil {
+		convertProductRevenue(&report, transactions, converter)
+	}
+	return report, nil
 }
 
 func (s *TransactionService) GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error) {
@@ -41,10 +167,190 @@ func (s *TransactionService) GetTransactionByID(ctx context.Context, id string)
 	return enrichedTransaction, nil
 }
 
-func (s *TransactionService) RefreshCache(ctx context.Context) error {
+// RefreshTransaction re-fetches a single enriched transaction from the providers, bypassing and updating the cache
+func (s *TransactionService) RefreshTransaction(ctx context.Context, id string) (entities.Transaction, error) {
+	transaction, err := s.repository.RefreshTransaction(ctx, id)
+	if err != nil {
+		return entities.Transaction{}, err
+	}
+
+	return s.enrichTransactionWithProduct(transaction), nil
+}
+
+// DeleteTransaction evicts a single transaction from the cache
+func (s *TransactionService) DeleteTransaction(ctx context.Context, id string) error {
+	return s.repository.DeleteTransaction(ctx, id)
+}
+
+// ArchiveTransaction hides a single transaction from listings, returning it enriched
+func (s *TransactionService) ArchiveTransaction(ctx context.Context, id string) (entities.Transaction, error) {
+	transaction, err := s.repository.ArchiveTransaction(ctx, id)
+	if err != nil {
+		return entities.Transaction{}, err
+	}
+
+	return s.enrichTransactionWithProduct(transaction), nil
+}
+
+// UpdateTransactionNotes sets the staff notes on a transaction, where nil removes them, returning it enriched
+func (s *TransactionService) UpdateTransactionNotes(ctx context.Context, id string, notes *string) (entities.Transaction, error) {
+	transaction, err := s.repository.AnnotateTransaction(ctx, id, func(annotation *entities.TransactionAnnotation) {
+		annotation.Notes = notes
+	})
+	if err != nil {
+		return entities.Transaction{}, err
+	}
+
+	return s.enrichTransactionWithProduct(transaction), nil
+}
+
+// UpsertTransaction stores a transaction received outside the regular fetch cycle (e.g. from a webhook)
+func (s *TransactionService) UpsertTransaction(ctx context.Context, transaction entities.Transaction) error {
+	return s.repository.UpsertTransaction(ctx, transaction)
+}
+
+// UpdateTransaction upserts what update returns for the cached transaction with id, for changes received outside
+// the regular fetch cycle that depend on the cached transaction
+func (s *TransactionService) UpdateTransaction(ctx context.Context, id string, update func(cached entities.Transaction, found bool) entities.Transaction) error {
+	return s.repository.UpdateTransaction(ctx, id, update)
+}
+
+// RefreshCache fetches the latest transactions from the providers into the cache, sharing a refresh already
+// in flight and reusing a recent one
+func (s *TransactionService) RefreshCache(ctx context.Context) (entities.RefreshResult, error) {
 	return s.repository.RefreshCache(ctx)
 }
 
+// summarizeTransactions aggregates counts and revenue for the given transactions.
+// Only succeeded transactions count toward revenue.
+func summarizeTransactions(transactions []entities.Transaction) entities.TransactionSummary {
+	summary := entities.TransactionSummary{
+		TotalCount:        len(transactions),
+		RevenueByCurrency: make(map[string]float64),
+		BySource:          make(map[string]entities.SourceSummary),
+		ByStatus:          make(map[string]int),
+	}
+
+	for _, transaction := range transactions {
+		summary.ByStatus[transaction.Status]++
+
+		sourceSummary, exists := summary.BySource[transaction.Source]
+		if !exists {
+			sourceSummary = entities.SourceSummary{RevenueByCurrency: make(map[string]float64)}
+		}
+		sourceSummary.Count++
+
+		if statushelpers.IsSuccessfulStatus(transaction.Status) {
+			currency := strings.ToUpper(transaction.Currency)
+			summary.RevenueByCurrency[currency] += transaction.Amount
+			sourceSummary.RevenueByCurrency[currency] += transaction.Amount
+		}
+
+		summary.BySource[transaction.Source] = sourceSummary
+	}
+
+	return summary
+}
+
+// convertRevenue sums the revenue of succeeded transactions in the converter's base currency.
+// Transactions without a rate for their currency are collected as unconvertible rather than dropped.
+func convertRevenue(transactions []entities.Transaction, converter *CurrencyConverter) entities.ConvertedRevenue {
+	converted := entities.ConvertedRevenue{
+		BaseCurrency:  converter.BaseCurrency(),
+		Unconvertible: entities.UnconvertibleRevenue{RevenueByCurrency: make(map[string]float64)},
+	}
+
+	for _, transaction := range transactions {
+		if !statushelpers.IsSuccessfulStatus(transaction.Status) {
+			continue
+		}
+
+		amount, ok := converter.Convert(transaction.Amount, transaction.Currency)
+		if !ok {
+			converted.Unconvertible.Count++
+			converted.Unconvertible.RevenueByCurrency[strings.ToUpper(transaction.Currency)] += transaction.Amount
+			continue
+		}
+		converted.Revenue += amount
+	}
+
+	return converted
+}
+
+// convertProductRevenue adds revenue in the converter's base currency to a revenue by product report
+// and sorts the products by it
+func convertProductRevenue(report *entities.RevenueByProductReport, transactions []entities.Transaction, converter *CurrencyConverter) {
+	converted := convertRevenue(transactions, converter)
+	report.Converted = &converted
+
+	convertBucket := func(product *entities.ProductRevenue) {
+		revenue := 0.0
+		for currency, amount := range product.RevenueByCurrency {
+			if convertedAmount, ok := converter.Convert(amount, currency); ok {
+				revenue += convertedAmount
+			}
+		}
+		product.ConvertedRevenue = &revenue
+	}
+
+	for i := range report.Products {
+		convertBucket(&report.Products[i])
+	}
+	convertBucket(&report.Unmatched)
+
+	slices.SortFunc(report.Products, func(a, b entities.ProductRevenue) int {
+		if c := cmp.Compare(*b.ConvertedRevenue, *a.ConvertedRevenue); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Product, b.Product)
+	})
+}
+
+// unmatchedProduct names the revenue bucket for transactions without a matched product
+const unmatchedProduct = "unmatched"
+
+// revenueByProduct groups enriched transactions by the product they were matched to.
+// Only succeeded transactions count toward revenue.
+func revenueByProduct(transactions []entities.Transaction) entities.RevenueByProductReport {
+	byProduct := make(map[string]*entities.ProductRevenue)
+	unmatched := &entities.ProductRevenue{Product: unmatchedProduct, RevenueByCurrency: make(map[string]float64)}
+
+	for _, transaction := range transactions {
+		if !statushelpers.IsSuccessfulStatus(transaction.Status) {
+			continue
+		}
+
+		bucket := unmatched
+		if transaction.Product != nil {
+			bucket = byProduct[*transaction.Product]
+			if bucket == nil {
+				bucket = &entities.ProductRevenue{Product: *transaction.Product, RevenueByCurrency: make(map[string]float64)}
+				byProduct[*transaction.Product] = bucket
+			}
+		}
+
+		bucket.Count++
+		bucket.Revenue += transaction.Amount
+		bucket.RevenueByCurrency[strings.ToUpper(transaction.Currency)] += transaction.Amount
+	}
+
+	report := entities.RevenueByProductReport{
+		Products:  make([]entities.ProductRevenue, 0, len(byProduct)),
+		Unmatched: *unmatched,
+	}
+	for _, product := range byProduct {
+		report.Products = append(report.Products, *product)
+	}
+	slices.SortFunc(report.Products, func(a, b entities.ProductRevenue) int {
+		if c := cmp.Compare(b.Revenue, a.Revenue); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Product, b.Product)
+	})
+
+	return report
+}
+
 // enrichTransactionsWithProducts enriches a slice of transactions with product information from the price list
 func (s *TransactionService) enrichTransactionsWithProducts(transactions []entities.Transaction) []entities.Transaction {
 	if PriceService == nil {
@@ -60,24 +366,45 @@ func (s *TransactionService) enrichTransactionsWithProducts(transactions []entit
 	return enrichedTransactions
 }
 
+// cachedProductMatch looks the transaction description up as a product in the price cache. A product named by the
+// description and priced at the amount is a certain match, found without scoring the whole price list.
+func (s *TransactionService) cachedProductMatch(transaction entities.Transaction) *prices.ProductMatch {
+	if s.priceCache == nil || transaction.Description == "" {
+		return nil
+	}
+
+	price, found := s.priceCache.GetPrice(PriceCacheKey(transaction.Description))
+	if !found || price.Price != transaction.Amount {
+		return nil
+	}
+	return &prices.ProductMatch{Price: price, Confidence: 1, Strategy: prices.MatchStrategyExactPrice}
+}
+
 // enrichTransactionWithProduct enriches a single transaction with product information from the price list
 func (s *TransactionService) enrichTransactionWithProduct(transaction entities.Transaction) entities.Transaction {
 	if PriceService == nil {
 		return transaction
 	}
 
-	// Try to find a matching product
-	matchedProduct := PriceService.FindBestProductMatch(transaction.Amount, transaction.Description)
-	if matchedProduct != nil {
+	// Try to find a matching product, in the price cache first
+	match := s.cachedProductMatch(transaction)
+	if match == nil {
+		match = PriceService.MatchProduct(transaction.Amount, transaction.Description)
+	}
+	if match != nil {
 		// Create copies to avoid modifying the original transaction
 		enrichedTransaction := transaction
-		enrichedTransaction.Product = &matchedProduct.Product
-		enrichedTransaction.ProductPrice = &matchedProduct.Price
+		enrichedTransaction.Product = &match.Price.Product
+		enrichedTransaction.ProductPrice = &match.Price.Price
+		enrichedTransaction.ProductMatchConfidence = &match.Confidence
+		enrichedTransaction.ProductMatchStrategy = &match.Strategy
 
 		logger.Debug("Enriched transaction with product information",
 			zap.String("transaction_id", transaction.ID),
-			zap.String("matched_product", matchedProduct.Product),
-			zap.Float64("product_price", matchedProduct.Price),
+			zap.String("matched_product", match.Price.Product),
+			zap.Float64("product_price", match.Price.Price),
+			zap.Float64("confidence", match.Confidence),
+			zap.String("strategy", match.Strategy),
 			zap.Float64("transaction_amount", transaction.Amount),
 			zap.String("description", transaction.Description))
 
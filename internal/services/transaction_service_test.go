@@ -0,0 +1,85 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+func TestSummarizeTransactions(t *testing.T) {
+	transactions := []entities.Transaction{
+		{ID: "1", Source: consts.PAYMENT_SOURCE_STRIPE, Amount: 100, Currency: "nok", Status: consts.TRANSACTION_STATUS_SUCCEEDED},
+		{ID: "2", Source: consts.PAYMENT_SOURCE_ZETTLE, Amount: 390, Currency: "NOK", Status: consts.TRANSACTION_STATUS_SUCCEEDED},
+		{ID: "3", Source: consts.PAYMENT_SOURCE_ZETTLE, Amount: 50, Currency: "EUR", Status: consts.TRANSACTION_STATUS_SUCCEEDED},
+		{ID: "4", Source: consts.PAYMENT_SOURCE_VIPPS, Amount: 650, Currency: "NOK", Status: consts.TRANSACTION_STATUS_PENDING},
+		{ID: "5", Source: consts.PAYMENT_SOURCE_STRIPE, Amount: 75, Currency: "NOK", Status: consts.TRANSACTION_STATUS_REFUNDED},
+	}
+
+	summary := summarizeTransactions(transactions)
+
+	if summary.TotalCount != 5 {
+		t.Errorf("Expected total count 5, got %d", summary.TotalCount)
+	}
+
+	if summary.RevenueByCurrency["NOK"] != 490 {
+		t.Errorf("Expected NOK revenue 490, got %f", summary.RevenueByCurrency["NOK"])
+	}
+	if summary.RevenueByCurrency["EUR"] != 50 {
+		t.Errorf("Expected EUR revenue 50, got %f", summary.RevenueByCurrency["EUR"])
+	}
+
+	if summary.ByStatus[consts.TRANSACTION_STATUS_SUCCEEDED] != 3 {
+		t.Errorf("Expected 3 succeeded, got %d", summary.ByStatus[consts.TRANSACTION_STATUS_SUCCEEDED])
+	}
+	if summary.ByStatus[consts.TRANSACTION_STATUS_PENDING] != 1 {
+		t.Errorf("Expected 1 pending, got %d", summary.ByStatus[consts.TRANSACTION_STATUS_PENDING])
+	}
+
+	stripeSummary := summary.BySource[consts.PAYMENT_SOURCE_STRIPE]
+	if stripeSummary.Count != 2 {
+		t.Errorf("Expected 2 stripe transactions, got %d", stripeSummary.Count)
+	}
+	if stripeSummary.RevenueByCurrency["NOK"] != 100 {
+		t.Errorf("Expected stripe NOK revenue 100, got %f", stripeSummary.RevenueByCurrency["NOK"])
+	}
+
+	vippsSummary := summary.BySource[consts.PAYMENT_SOURCE_VIPPS]
+	if vippsSummary.Count != 1 || len(vippsSummary.RevenueByCurrency) != 0 {
+		t.Errorf("Expected 1 vipps transaction without revenue, got %+v", vippsSummary)
+	}
+}
+
+func TestRevenueByProduct(t *testing.T) {
+	cabin, shower := "Cabin", "Shower"
+	transactions := []entities.Transaction{
+		{ID: "1", Amount: 650, Currency: "nok", Status: consts.TRANSACTION_STATUS_SUCCEEDED, Product: &cabin},
+		{ID: "2", Amount: 650, Currency: "NOK", Status: consts.TRANSACTION_STATUS_SUCCEEDED, Product: &cabin},
+		{ID: "3", Amount: 20, Currency: "NOK", Status: consts.TRANSACTION_STATUS_SUCCEEDED, Product: &shower},
+		{ID: "4", Amount: 650, Currency: "NOK", Status: consts.TRANSACTION_STATUS_REFUNDED, Product: &cabin},
+		{ID: "5", Amount: 123, Currency: "NOK", Status: consts.TRANSACTION_STATUS_SUCCEEDED},
+		{ID: "6", Amount: 10, Currency: "EUR", Status: consts.TRANSACTION_STATUS_SUCCEEDED},
+	}
+
+	report := revenueByProduct(transactions)
+
+	if len(report.Products) != 2 {
+		t.Fatalf("Expected 2 products, got %+v", report.Products)
+	}
+	if report.Products[0].Product != cabin || report.Products[0].Count != 2 || report.Products[0].Revenue != 1300 {
+		t.Errorf("Expected cabin first with 2 transactions and revenue 1300, got %+v", report.Products[0])
+	}
+	if report.Products[0].RevenueByCurrency["NOK"] != 1300 {
+		t.Errorf("Expected cabin NOK revenue 1300, got %+v", report.Products[0].RevenueByCurrency)
+	}
+	if report.Products[1].Product != shower || report.Products[1].Count != 1 {
+		t.Errorf("Expected shower second, got %+v", report.Products[1])
+	}
+
+	if report.Unmatched.Product != unmatchedProduct || report.Unmatched.Count != 2 {
+		t.Errorf("Expected 2 unmatched transactions, got %+v", report.Unmatched)
+	}
+	if report.Unmatched.RevenueByCurrency["NOK"] != 123 || report.Unmatched.RevenueByCurrency["EUR"] != 10 {
+		t.Errorf("Unexpected unmatched revenue: %+v", report.Unmatched.RevenueByCurrency)
+	}
+}
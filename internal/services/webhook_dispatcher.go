@@ -0,0 +1,373 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/httpclienthelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/interfaces"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Headers sent with every outbound webhook delivery
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookIDHeader        = "X-Webhook-Id"
+)
+
+const (
+	webhookQueueSize = 256
+	webhookWorkers   = 4
+)
+
+// WebhookDispatcher posts new transactions to an external URL.
+// Deliveries are signed with an HMAC of the timestamp and body and retried with exponential backoff.
+// Which transactions were delivered is tracked by ID against a high-water mark, optionally persisted,
+// so cache expiry, re-fetches and restarts don't deliver a transaction twice.
+type WebhookDispatcher struct {
+	cache       interfaces.Cache
+	notifier    interfaces.CacheNotifier
+	url         string
+	secret      string
+	client      *http.Client
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	statePath   string
+	retention   time.Duration
+	now         func() time.Time
+
+	// state and pending are guarded by stateMu; pending holds the IDs queued or being delivered
+	stateMu sync.Mutex
+	state   webhookState
+	pending map[string]struct{}
+
+	queue   chan entities.Transaction
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running bool
+	mu      sync.Mutex
+}
+
+// WebhookDispatcherOption configures optional settings on a WebhookDispatcher
+type WebhookDispatcherOption func(*WebhookDispatcher)
+
+// WithWebhookSecret sets the shared secret deliveries are signed with
+func WithWebhookSecret(secret string) WebhookDispatcherOption {
+	return func(d *WebhookDispatcher) {
+		d.secret = secret
+	}
+}
+
+// WithWebhookMaxAttempts sets how many times a delivery is attempted before it is dropped
+func WithWebhookMaxAttempts(attempts int) WebhookDispatcherOption {
+	return func(d *WebhookDispatcher) {
+		if attempts > 0 {
+			d.maxAttempts = attempts
+		}
+	}
+}
+
+// WithWebhookBackoff sets the delay after the first failed delivery, doubled per attempt up to max
+func WithWebhookBackoff(base, max time.Duration) WebhookDispatcherOption {
+	return func(d *WebhookDispatcher) {
+		if base > 0 {
+			d.baseBackoff = base
+		}
+		if max > 0 {
+			d.maxBackoff = max
+		}
+	}
+}
+
+// WithWebhookStatePath persists which transactions were delivered to the JSON file at path, so a restart
+// neither delivers them again nor skips transactions created while the API was down
+func WithWebhookStatePath(path string) WebhookDispatcherOption {
+	return func(d *WebhookDispatcher) {
+		d.statePath = path
+	}
+}
+
+// WithWebhookRetention sets how long delivered transaction IDs are remembered. Transactions created longer
+// ago are never delivered, so it should cover the fetch lookback window.
+func WithWebhookRetention(retention time.Duration) WebhookDispatcherOption {
+	return func(d *WebhookDispatcher) {
+		if retention > 0 {
+			d.retention = retention
+		}
+	}
+}
+
+// WithWebhookHTTPClient sets the HTTP client deliveries are sent with
+func WithWebhookHTTPClient(client *http.Client) WebhookDispatcherOption {
+	return func(d *WebhookDispatcher) {
+		if client != nil {
+			d.client = client
+		}
+	}
+}
+
+// NewWebhookDispatcher creates a dispatcher posting transactions written to cache to url.
+// It does nothing when url is empty.
+func NewWebhookDispatcher(cache interfaces.Cache, notifier interfaces.CacheNotifier, url string, opts ...WebhookDispatcherOption) *WebhookDispatcher {
+	d := &WebhookDispatcher{
+		cache:       cache,
+		notifier:    notifier,
+		url:         url,
+		client:      httpclienthelpers.DefaultClient(),
+		maxAttempts: 5,
+		baseBackoff: 2 * time.Second,
+		maxBackoff:  time.Minute,
+		retention:   time.Duration(consts.FETCH_LOOKBACK_DAYS_DEFAULT) * 24 * time.Hour,
+		now:         time.Now,
+		pending:     make(map[string]struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// Enabled reports whether the dispatcher has a URL and a cache to deliver from
+func (d *WebhookDispatcher) Enabled() bool {
+	return d.url != "" && d.cache != nil && d.notifier != nil
+}
+
+// Start subscribes to the cache notifier and delivers new transactions until Stop is called or the context is done.
+// Transactions already cached and not delivered yet are delivered first.
+func (d *WebhookDispatcher) Start(ctx context.Context) {
+	if !d.Enabled() {
+		logger.Debug("Outbound webhook URL not configured, webhook dispatcher disabled")
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		logger.Warn("Webhook dispatcher is already running")
+		return
+	}
+
+	if d.secret == "" {
+		logger.Error("Outbound webhook secret not configured, deliveries will not be signed and receivers can't verify them")
+	}
+
+	d.loadState()
+
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.queue = make(chan entities.Transaction, webhookQueueSize)
+	d.running = true
+	logger.Info("Starting webhook dispatcher", zap.String("url", d.url))
+
+	// Subscribe before returning so transactions cached right after Start are seen
+	events, unsubscribe := d.notifier.Subscribe()
+	d.wg.Add(1)
+	go d.listen(ctx, events, unsubscribe)
+
+	for i := 0; i < webhookWorkers; i++ {
+		d.wg.Add(1)
+		go d.work(ctx)
+	}
+}
+
+// Stop cancels pending deliveries and waits for the dispatcher to finish
+func (d *WebhookDispatcher) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.running {
+		return
+	}
+
+	logger.Info("Stopping webhook dispatcher")
+	d.cancel()
+	d.wg.Wait()
+	d.running = false
+
+	if pending := len(d.queue); pending > 0 {
+		logger.Warn("Stopped with undelivered webhooks, they are delivered after the next start if still cached",
+			zap.Int("pending", pending))
+	}
+	logger.Info("Webhook dispatcher stopped")
+}
+
+// listen queues undelivered transactions, starting with a scan of the cache. Queueing blocks while the workers
+// are busy, so the notifier may drop the listener for falling behind; it then resubscribes and scans the
+// cache again, so no transaction is lost.
+func (d *WebhookDispatcher) listen(ctx context.Context, events <-chan entities.CacheEvent, unsubscribe func()) {
+	defer d.wg.Done()
+	defer func() { unsubscribe() }()
+
+	d.scan(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				logger.Warn("Webhook dispatcher fell behind the cache notifier, resubscribing and rescanning the cache")
+				events, unsubscribe = d.notifier.Subscribe()
+				d.scan(ctx)
+				continue
+			}
+			if event.Type != entities.CacheEventSet {
+				continue
+			}
+			d.enqueue(ctx, event.Transaction)
+		}
+	}
+}
+
+// scan queues every cached transaction that hasn't been delivered yet
+func (d *WebhookDispatcher) scan(ctx context.Context) {
+	for _, transaction := range d.cache.GetTransactions("") {
+		if ctx.Err() != nil {
+			return
+		}
+		d.enqueue(ctx, transaction)
+	}
+}
+
+// enqueue queues the transaction unless it was delivered, is already queued or is older than the high-water mark,
+// waiting for room in the queue rather than dropping it
+func (d *WebhookDispatcher) enqueue(ctx context.Context, transaction entities.Transaction) {
+	if !d.claim(transaction) {
+		return
+	}
+
+	select {
+	case d.queue <- transaction:
+	case <-ctx.Done():
+		d.release(transaction.ID)
+	}
+}
+
+// work delivers queued transactions until the context is done
+func (d *WebhookDispatcher) work(ctx context.Context) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case transaction := <-d.queue:
+			if d.deliver(ctx, transaction) {
+				d.markDelivered(transaction)
+			} else {
+				d.release(transaction.ID)
+			}
+		}
+	}
+}
+
+// deliver posts the transaction, retrying with backoff until it succeeds or maxAttempts is reached.
+// It reports whether the transaction was delivered.
+func (d *WebhookDispatcher) deliver(ctx context.Context, transaction entities.Transaction) bool {
+	body, err := json.Marshal(transaction)
+	if err != nil {
+		logger.Error("Failed to encode webhook payload", zap.String("id", transaction.ID), zap.Error(err))
+		return false
+	}
+
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		err := d.post(ctx, transaction.ID, body)
+		if err == nil {
+			logger.Debug("Delivered webhook", zap.String("id", transaction.ID), zap.Int("attempt", attempt))
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		if attempt == d.maxAttempts {
+			// Not marked delivered, so the next scan of the cache tries again
+			logger.Error("Giving up on webhook after failed attempts",
+				zap.String("id", transaction.ID),
+				zap.Int("attempts", attempt),
+				zap.Error(err))
+			return false
+		}
+
+		delay := d.backoff(attempt)
+		logger.Warn("Webhook delivery failed, retrying",
+			zap.String("id", transaction.ID),
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_in", delay),
+			zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+	return false
+}
+
+// backoff returns the delay after the given failed attempt, doubling from baseBackoff up to maxBackoff
+func (d *WebhookDispatcher) backoff(attempt int) time.Duration {
+	delay := d.baseBackoff
+	for i := 1; i < attempt && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
+
+// post sends a single delivery, treating any non-2xx response as a failure
+func (d *WebhookDispatcher) post(ctx context.Context, id string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, id)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	if d.secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(d.secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>" that receivers verify deliveries against
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
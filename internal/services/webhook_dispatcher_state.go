@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// webhookState is what the dispatcher remembers about deliveries, persisted at the state path when one is set
+type webhookState struct {
+	// Since is the high-water mark: transactions created before it are never delivered. On the first start
+	// it is the start time, so the transactions of the initial fetch aren't posted.
+	Since time.Time `json:"since"`
+	// Delivered holds the CreatedAt of every delivered transaction since Since, by ID
+	Delivered map[string]time.Time `json:"delivered"`
+}
+
+// loadState restores the delivery state from the state path. Without a state path, or a readable state,
+// delivery starts from now so the transactions already cached are not posted again.
+func (d *WebhookDispatcher) loadState() {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	d.pending = make(map[string]struct{})
+	if d.state.Delivered != nil {
+		// Restarted in the same process, the in-memory state is current
+		return
+	}
+
+	state, err := readWebhookState(d.statePath)
+	if err != nil {
+		logger.Error("Failed to read webhook delivery state, only delivering transactions created from now",
+			zap.String("path", d.statePath),
+			zap.Error(err))
+	}
+	if state.Delivered == nil {
+		state = webhookState{Since: d.now(), Delivered: make(map[string]time.Time)}
+	}
+	d.state = state
+	d.pruneState()
+}
+
+// readWebhookState reads the state file. A missing path or file means there is no state yet.
+func readWebhookState(path string) (webhookState, error) {
+	if path == "" {
+		return webhookState{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return webhookState{}, nil
+	}
+	if err != nil {
+		return webhookState{}, fmt.Errorf("failed to read webhook state file: %w", err)
+	}
+
+	var state webhookState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return webhookState{}, fmt.Errorf("failed to parse webhook state file: %w", err)
+	}
+	if state.Delivered == nil {
+		state.Delivered = make(map[string]time.Time)
+	}
+	return state, nil
+}
+
+// claim marks the transaction as pending and reports whether it should be delivered
+func (d *WebhookDispatcher) claim(transaction entities.Transaction) bool {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	if transaction.ID == "" || transaction.CreatedAt.Before(d.state.Since) {
+		return false
+	}
+	if _, delivered := d.state.Delivered[transaction.ID]; delivered {
+		return false
+	}
+	if _, pending := d.pending[transaction.ID]; pending {
+		return false
+	}
+
+	d.pending[transaction.ID] = struct{}{}
+	return true
+}
+
+// release forgets a pending transaction that wasn't delivered, so it is queued again when next seen
+func (d *WebhookDispatcher) release(id string) {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	delete(d.pending, id)
+}
+
+// markDelivered records a delivered transaction and saves the state
+func (d *WebhookDispatcher) markDelivered(transaction entities.Transaction) {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	delete(d.pending, transaction.ID)
+	d.state.Delivered[transaction.ID] = transaction.CreatedAt
+	d.pruneState()
+
+	if err := d.saveState(); err != nil {
+		// The delivery is still remembered in memory, only a restart could deliver it again
+		logger.Error("Failed to save webhook delivery state", zap.String("path", d.statePath), zap.Error(err))
+	}
+}
+
+// pruneState moves the high-water mark up to the retention window and forgets deliveries before it.
+// The caller must hold stateMu.
+func (d *WebhookDispatcher) pruneState() {
+	if cutoff := d.now().Add(-d.retention); cutoff.After(d.state.Since) {
+		d.state.Since = cutoff
+	}
+	for id, createdAt := range d.state.Delivered {
+		if createdAt.Before(d.state.Since) {
+			delete(d.state.Delivered, id)
+		}
+	}
+}
+
+// saveState writes the state file, replacing it atomically. The caller must hold stateMu.
+func (d *WebhookDispatcher) saveState() error {
+	if d.statePath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(d.state)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.statePath), 0755); err != nil {
+		return fmt.Errorf("failed to create webhook state directory: %w", err)
+	}
+
+	tmpPath := d.statePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write webhook state file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, d.statePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace webhook state file: %w", err)
+	}
+
+	return nil
+}
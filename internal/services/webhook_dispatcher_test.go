@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/internal/cache"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+)
+
+// webhookDelivery is a request received by the test webhook endpoint
+type webhookDelivery struct {
+	header http.Header
+	body   []byte
+}
+
+func newObservableTestCache() *cache.ObservableCache {
+	return cache.NewObservableCache(cache.NewInMemoryCache(1*time.Hour, 10*time.Minute))
+}
+
+func TestWebhookDispatcher_DeliversSignedNewTransactions(t *testing.T) {
+	deliveries := make(chan webhookDelivery, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- webhookDelivery{header: r.Header.Clone(), body: body}
+	}))
+	defer server.Close()
+
+	c := newObservableTestCache()
+	dispatcher := NewWebhookDispatcher(c, c, server.URL, WithWebhookSecret("shared-secret"))
+	dispatcher.Start(context.Background())
+	defer dispatcher.Stop()
+
+	// Transactions created before the first start are history, not new
+	c.SetTransaction("tx_old", entities.Transaction{ID: "tx_old", CreatedAt: time.Now().Add(-time.Hour)}, time.Hour)
+
+	transaction := entities.Transaction{ID: "tx_1", Source: "stripe", Amount: 500, CreatedAt: time.Now()}
+	c.SetTransaction(transaction.ID, transaction, time.Hour)
+	// Updates and deletes of a cached transaction are not delivered
+	c.SetTransaction(transaction.ID, transaction, time.Hour)
+	c.DeleteTransaction(transaction.ID)
+
+	var delivery webhookDelivery
+	select {
+	case delivery = <-deliveries:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for webhook delivery")
+	}
+
+	var received entities.Transaction
+	if err := json.Unmarshal(delivery.body, &received); err != nil {
+		t.Fatalf("Failed to decode webhook body: %v", err)
+	}
+	if received.ID != "tx_1" || received.Amount != 500 {
+		t.Errorf("Unexpected webhook payload: %+v", received)
+	}
+	if id := delivery.header.Get(WebhookIDHeader); id != "tx_1" {
+		t.Errorf("Expected %s header tx_1, got %q", WebhookIDHeader, id)
+	}
+
+	expected := "sha256=" + SignWebhook("shared-secret", delivery.header.Get(WebhookTimestampHeader), delivery.body)
+	if signature := delivery.header.Get(WebhookSignatureHeader); signature != expected {
+		t.Errorf("Expected signature %q, got %q", expected, signature)
+	}
+
+	select {
+	case extra := <-deliveries:
+		t.Errorf("Expected a single delivery, got another: %s", extra.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookDispatcher_RetriesThenDrops(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	c := newObservableTestCache()
+	dispatcher := NewWebhookDispatcher(c, c, server.URL,
+		WithWebhookMaxAttempts(3),
+		WithWebhookBackoff(time.Millisecond, 5*time.Millisecond),
+	)
+	dispatcher.Start(context.Background())
+	defer dispatcher.Stop()
+
+	c.SetTransaction("tx_1", entities.Transaction{ID: "tx_1", CreatedAt: time.Now()}, time.Hour)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for attempts.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Give a fourth attempt the chance to happen before checking it didn't
+	time.Sleep(50 * time.Millisecond)
+
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("Expected 3 delivery attempts, got %d", got)
+	}
+}
+
+// countingWebhookServer counts deliveries per transaction ID
+func countingWebhookServer(t *testing.T) (*httptest.Server, func() map[string]int) {
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		counts[r.Header.Get(WebhookIDHeader)]++
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		result := make(map[string]int, len(counts))
+		for id, count := range counts {
+			result[id] = count
+		}
+		return result
+	}
+}
+
+// waitForDeliveries waits until n distinct transactions were delivered
+func waitForDeliveries(t *testing.T, counts func() map[string]int, n int) map[string]int {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := counts(); len(got) >= n {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d deliveries, got %d", n, len(counts()))
+	return nil
+}
+
+func TestWebhookDispatcher_DeliversBurstWithoutDropping(t *testing.T) {
+	server, counts := countingWebhookServer(t)
+
+	c := newObservableTestCache()
+	dispatcher := NewWebhookDispatcher(c, c, server.URL, WithWebhookSecret("shared-secret"))
+	dispatcher.Start(context.Background())
+	defer dispatcher.Stop()
+
+	// More than the subscriber buffer and the queue hold, like an initial fetch
+	const total = 1000
+	createdAt := time.Now()
+	for i := 0; i < total; i++ {
+		id := fmt.Sprintf("tx_%d", i)
+		c.SetTransaction(id, entities.Transaction{ID: id, CreatedAt: createdAt}, time.Hour)
+	}
+
+	got := waitForDeliveries(t, counts, total)
+	time.Sleep(50 * time.Millisecond)
+	for id, count := range counts() {
+		if count != 1 {
+			t.Errorf("Expected %s to be delivered once, got %d", id, count)
+		}
+	}
+	if len(got) != total {
+		t.Errorf("Expected %d deliveries, got %d", total, len(got))
+	}
+}
+
+func TestWebhookDispatcher_DoesNotRedeliverAfterRestartOrExpiry(t *testing.T) {
+	server, counts := countingWebhookServer(t)
+	statePath := filepath.Join(t.TempDir(), "webhook-state.json")
+
+	c := newObservableTestCache()
+	first := NewWebhookDispatcher(c, c, server.URL, WithWebhookSecret("shared-secret"), WithWebhookStatePath(statePath))
+	first.Start(context.Background())
+
+	delivered := entities.Transaction{ID: "tx_1", CreatedAt: time.Now()}
+	c.SetTransaction(delivered.ID, delivered, time.Hour)
+	waitForDeliveries(t, counts, 1)
+
+	// An expired transaction fetched again is not new
+	c.DeleteTransaction(delivered.ID)
+	c.SetTransaction(delivered.ID, delivered, time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	first.Stop()
+
+	// A transaction created while the API was down is delivered after the restart, the delivered one isn't
+	missed := entities.Transaction{ID: "tx_2", CreatedAt: time.Now()}
+	restarted := newObservableTestCache()
+	restarted.SetTransaction(delivered.ID, delivered, time.Hour)
+	restarted.SetTransaction(missed.ID, missed, time.Hour)
+
+	second := NewWebhookDispatcher(restarted, restarted, server.URL, WithWebhookSecret("shared-secret"), WithWebhookStatePath(statePath))
+	second.Start(context.Background())
+	defer second.Stop()
+
+	got := waitForDeliveries(t, counts, 2)
+	time.Sleep(50 * time.Millisecond)
+	if got = counts(); got["tx_1"] != 1 || got["tx_2"] != 1 {
+		t.Errorf("Expected tx_1 and tx_2 to be delivered once each, got %v", got)
+	}
+}
+
+func TestWebhookDispatcher_DisabledWithoutURL(t *testing.T) {
+	c := newObservableTestCache()
+	dispatcher := NewWebhookDispatcher(c, c, "")
+	if dispatcher.Enabled() {
+		t.Fatal("Expected dispatcher without a URL to be disabled")
+	}
+
+	// Starting and stopping a disabled dispatcher is a no-op
+	dispatcher.Start(context.Background())
+	dispatcher.Stop()
+}
+
+func TestWebhookDispatcher_Backoff(t *testing.T) {
+	dispatcher := NewWebhookDispatcher(nil, nil, "", WithWebhookBackoff(time.Second, 5*time.Second))
+
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := dispatcher.backoff(tt.attempt); got != tt.expected {
+			t.Errorf("backoff(%d) = %v, expected %v", tt.attempt, got, tt.expected)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package settings
 import (
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/rogerwesterbo/svennescamping-backend/internal/readiness"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/consts"
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
 	"github.com/spf13/viper"
@@ -22,15 +24,116 @@ func Init() {
 
 	// Set default values
 	viper.SetDefault(consts.DEVELOPMENT, false)
+	viper.SetDefault(consts.USE_MOCK_CLIENTS, false)
+	viper.SetDefault(consts.HOST, "")
+	viper.SetDefault(consts.PORT, 8888)
+	viper.SetDefault(consts.SHUTDOWN_TIMEOUT, "20s")
 	viper.SetDefault(consts.STRIPE_APIKEY, "")
 	viper.SetDefault(consts.STRIPE_WEBHOOKKEY, "")
 	viper.SetDefault(consts.STRIPE_WEBHOOKURL, "https://example.com/webhook")
 	viper.SetDefault(consts.STRIPE_APIURL, "https://api.stripe.com")
 	viper.SetDefault(consts.STRIPE_APIVERSION, "2020-08-27")
+	viper.SetDefault(consts.STRIPE_OBJECT_TYPE, consts.STRIPE_OBJECT_TYPE_CHARGE)
+	viper.SetDefault(consts.STRIPE_MAX_RETRY_ATTEMPTS, 3)
+	viper.SetDefault(consts.STRIPE_ENABLED, true)
+	viper.SetDefault(consts.VIPPS_ENABLED, true)
+	viper.SetDefault(consts.ZETTLE_ENABLED, true)
 	viper.SetDefault(consts.CORS_ORIGINS, "http://localhost:5173")
+	viper.SetDefault(consts.CORS_METHODS, "GET;POST;PUT;PATCH;DELETE;OPTIONS")
+	viper.SetDefault(consts.CORS_HEADERS, "Content-Type;Authorization;X-Requested-With;X-Request-ID")
+	viper.SetDefault(consts.CORS_PUBLIC_ORIGINS, "*")
+	viper.SetDefault(consts.LOG_FORMAT, "")
+	viper.SetDefault(consts.LOG_SAMPLING_INITIAL, 100)
+	viper.SetDefault(consts.LOG_SAMPLING_THEREAFTER, 100)
+	viper.SetDefault(consts.ROLES_FILE_PATH, "")
+	viper.SetDefault(consts.GROUP_ROLE_MAP, "")
+	viper.SetDefault(consts.CANONICALIZE_GMAIL, false)
+	viper.SetDefault(consts.DEFAULT_ROLE, "no_access")
+	viper.SetDefault(consts.GOOGLE_CLIENT_ID, "")
+	viper.SetDefault(consts.GOOGLE_USERINFO_MAX_ATTEMPTS, 3)
+	viper.SetDefault(consts.RATE_LIMIT_RPS, 10)
+	viper.SetDefault(consts.RATE_LIMIT_BURST, 20)
+	// Off by default, since behind a proxy without TRUSTED_PROXIES all clients would share one limit
+	viper.SetDefault(consts.RATE_LIMIT_IP_RPS, 0)
+	viper.SetDefault(consts.RATE_LIMIT_IP_BURST, 40)
+	viper.SetDefault(consts.MAX_REQUEST_BODY_BYTES, consts.MAX_REQUEST_BODY_BYTES_DEFAULT)
+	viper.SetDefault(consts.CACHE_TTL, "24h")
+	viper.SetDefault(consts.CACHE_CLEANUP_INTERVAL, "1h")
+	viper.SetDefault(consts.CACHE_SNAPSHOT_PATH, "")
+	viper.SetDefault(consts.CACHE_SNAPSHOT_INTERVAL, "5m")
+	viper.SetDefault(consts.REDIS_URL, "")
+	viper.SetDefault(consts.REFRESH_COOLDOWN, "10s")
+	viper.SetDefault(consts.FALLBACK_REFRESH_TIMEOUT, "10s")
+	viper.SetDefault(consts.HTTP_CLIENT_TIMEOUT, "30s")
+	viper.SetDefault(consts.DEBUG_HTTP, false)
+	viper.SetDefault(consts.PROVIDER_HEALTH_TIMEOUT, "5s")
+	viper.SetDefault(consts.PRICE_MATCH_THRESHOLD, 0.5)
+	viper.SetDefault(consts.BASE_CURRENCY, "NOK")
+	viper.SetDefault(consts.CURRENCY_RATES, "")
+	viper.SetDefault(consts.REPORT_TIMEZONE, "Europe/Oslo")
+	viper.SetDefault(consts.PRICES_CSV_DELIMITER, "")
+	viper.SetDefault(consts.PRICES_CSV_LENIENT, false)
+	viper.SetDefault(consts.DEDUPE_WINDOW, "")
+	viper.SetDefault(consts.DEDUPE_PREFERRED_SOURCES, "stripe;vipps;zettle")
+	viper.SetDefault(consts.FETCH_INTERVAL, "5m")
+	viper.SetDefault(consts.FETCH_BACKOFF_BASE, "5m")
+	viper.SetDefault(consts.FETCH_BACKOFF_MAX, "30m")
+	viper.SetDefault(consts.FETCH_LOOKBACK_DAYS, consts.FETCH_LOOKBACK_DAYS_DEFAULT)
+	viper.SetDefault(consts.FETCH_BATCH_SIZE, consts.FETCH_BATCH_SIZE_DEFAULT)
+	viper.SetDefault(consts.WARM_CACHE_ON_START, false)
+	viper.SetDefault(consts.WARM_CACHE_TIMEOUT, "2m")
+	viper.SetDefault(consts.OUTBOUND_WEBHOOK_URL, "")
+	viper.SetDefault(consts.OUTBOUND_WEBHOOK_SECRET, "")
+	viper.SetDefault(consts.OUTBOUND_WEBHOOK_MAX_ATTEMPTS, 5)
+	viper.SetDefault(consts.OUTBOUND_WEBHOOK_BACKOFF_BASE, "2s")
+	viper.SetDefault(consts.OUTBOUND_WEBHOOK_BACKOFF_MAX, "1m")
+	viper.SetDefault(consts.OUTBOUND_WEBHOOK_STATE_PATH, "")
 
 	// Load environment variables from the process (highest priority)
 	viper.AutomaticEnv()
+
+	readiness.Set(readiness.CheckSettings, true)
+}
+
+// GetDuration reads a Go duration setting (e.g. "2m"), falling back to the given default
+// with a warning if the value is missing or invalid
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	value := viper.GetString(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		logger.Warn("Invalid duration setting, using default",
+			zap.String("key", key),
+			zap.String("value", value),
+			zap.Duration("default", fallback))
+		return fallback
+	}
+
+	return duration
+}
+
+// GetLocation reads an IANA time zone setting (e.g. "Europe/Oslo"), falling back to the given location
+// with a warning if the value is missing or unknown
+func GetLocation(key string, fallback *time.Location) *time.Location {
+	value := viper.GetString(key)
+	if value == "" {
+		return fallback
+	}
+
+	location, err := time.LoadLocation(value)
+	if err != nil {
+		logger.Warn("Invalid time zone setting, using default",
+			zap.String("key", key),
+			zap.String("value", value),
+			zap.String("default", fallback.String()),
+			zap.Error(err))
+		return fallback
+	}
+
+	return location
 }
 
 // loadEnvFile loads environment variables from a file if it exists
@@ -1,21 +1,159 @@
 package consts
 
+import "time"
+
 // Environment and general config
 var (
-	DEVELOPMENT     = "DEVELOPMENT"
-	CORS_ORIGINS    = "CORS_ORIGINS"
-	USER_EMAILS     = "USER_EMAILS"
-	ADMIN_EMAILS    = "ADMIN_EMAILS"
-	PRICES_CSV_PATH = "PRICES_CSV_PATH"
+	DEVELOPMENT             = "DEVELOPMENT"
+	CORS_ORIGINS            = "CORS_ORIGINS"
+	CORS_METHODS            = "CORS_METHODS"
+	CORS_HEADERS            = "CORS_HEADERS"
+	CORS_PUBLIC_ORIGINS     = "CORS_PUBLIC_ORIGINS"
+	USER_EMAILS             = "USER_EMAILS"
+	ADMIN_EMAILS            = "ADMIN_EMAILS"
+	PRICES_CSV_PATH         = "PRICES_CSV_PATH"
+	ROLES_FILE_PATH         = "ROLES_FILE_PATH"
+	GROUP_ROLE_MAP          = "GROUP_ROLE_MAP"
+	LOG_FORMAT              = "LOG_FORMAT"
+	LOG_SAMPLING_INITIAL    = "LOG_SAMPLING_INITIAL"
+	LOG_SAMPLING_THEREAFTER = "LOG_SAMPLING_THEREAFTER"
+	USE_MOCK_CLIENTS        = "USE_MOCK_CLIENTS"
+	CANONICALIZE_GMAIL      = "CANONICALIZE_GMAIL"
+	DEFAULT_ROLE            = "DEFAULT_ROLE"
+)
+
+// HTTP server configuration
+var (
+	HOST             = "HOST"
+	PORT             = "PORT"
+	SHUTDOWN_TIMEOUT = "SHUTDOWN_TIMEOUT"
+)
+
+// Authentication configuration
+var (
+	GOOGLE_CLIENT_ID             = "GOOGLE_CLIENT_ID"
+	GOOGLE_USERINFO_MAX_ATTEMPTS = "GOOGLE_USERINFO_MAX_ATTEMPTS"
+)
+
+// Rate limiting configuration
+var (
+	RATE_LIMIT_RPS      = "RATE_LIMIT_RPS"
+	RATE_LIMIT_BURST    = "RATE_LIMIT_BURST"
+	RATE_LIMIT_IP_RPS   = "RATE_LIMIT_IP_RPS"
+	RATE_LIMIT_IP_BURST = "RATE_LIMIT_IP_BURST"
+	TRUSTED_PROXIES     = "TRUSTED_PROXIES"
+)
+
+// Request limits
+var (
+	MAX_REQUEST_BODY_BYTES = "MAX_REQUEST_BODY_BYTES"
+)
+
+// MAX_REQUEST_BODY_BYTES_DEFAULT is used when MAX_REQUEST_BODY_BYTES is missing or not positive
+const MAX_REQUEST_BODY_BYTES_DEFAULT = 1 << 20
+
+// Price list CSV configuration
+var (
+	PRICES_CSV_DELIMITER = "PRICES_CSV_DELIMITER"
+	PRICES_CSV_LENIENT   = "PRICES_CSV_LENIENT"
+)
+
+// Price matching configuration
+var (
+	PRICE_MATCH_THRESHOLD = "PRICE_MATCH_THRESHOLD"
+)
+
+// Currency conversion configuration
+var (
+	BASE_CURRENCY  = "BASE_CURRENCY"
+	CURRENCY_RATES = "CURRENCY_RATES"
+)
+
+// Report configuration
+var (
+	REPORT_TIMEZONE = "REPORT_TIMEZONE"
+)
+
+// Background fetcher configuration
+var (
+	FETCH_INTERVAL      = "FETCH_INTERVAL"
+	FETCH_BACKOFF_BASE  = "FETCH_BACKOFF_BASE"
+	FETCH_BACKOFF_MAX   = "FETCH_BACKOFF_MAX"
+	FETCH_LOOKBACK_DAYS = "FETCH_LOOKBACK_DAYS"
+	FETCH_BATCH_SIZE    = "FETCH_BATCH_SIZE"
+	WARM_CACHE_ON_START = "WARM_CACHE_ON_START"
+	WARM_CACHE_TIMEOUT  = "WARM_CACHE_TIMEOUT"
+)
+
+// Provider fetch lookback limits, in days. Missing or non-positive values use the default and larger values are capped.
+var (
+	FETCH_LOOKBACK_DAYS_DEFAULT = 30
+	FETCH_LOOKBACK_DAYS_MAX     = 365
+)
+
+// Transactions fetched per provider on each fetch. Missing or non-positive values use the default and larger values
+// are capped at the largest provider maximum (Zettle); providers with a lower maximum cap it further.
+var (
+	FETCH_BATCH_SIZE_DEFAULT = 100
+	FETCH_BATCH_SIZE_MAX     = 1000
+)
+
+// Cache configuration
+var (
+	CACHE_TTL                = "CACHE_TTL"
+	CACHE_CLEANUP_INTERVAL   = "CACHE_CLEANUP_INTERVAL"
+	CACHE_SNAPSHOT_PATH      = "CACHE_SNAPSHOT_PATH"
+	CACHE_SNAPSHOT_INTERVAL  = "CACHE_SNAPSHOT_INTERVAL"
+	REDIS_URL                = "REDIS_URL"
+	REFRESH_COOLDOWN         = "REFRESH_COOLDOWN"
+	FALLBACK_REFRESH_TIMEOUT = "FALLBACK_REFRESH_TIMEOUT"
+)
+
+// Cache defaults, used when CACHE_TTL or CACHE_CLEANUP_INTERVAL is missing or invalid
+var (
+	CACHE_TTL_DEFAULT              = 24 * time.Hour
+	CACHE_CLEANUP_INTERVAL_DEFAULT = 1 * time.Hour
+)
+
+// Cross-provider deduplication configuration
+var (
+	DEDUPE_WINDOW            = "DEDUPE_WINDOW"
+	DEDUPE_PREFERRED_SOURCES = "DEDUPE_PREFERRED_SOURCES"
+)
+
+// Outbound webhook configuration
+var (
+	OUTBOUND_WEBHOOK_URL          = "OUTBOUND_WEBHOOK_URL"
+	OUTBOUND_WEBHOOK_SECRET       = "OUTBOUND_WEBHOOK_SECRET"
+	OUTBOUND_WEBHOOK_MAX_ATTEMPTS = "OUTBOUND_WEBHOOK_MAX_ATTEMPTS"
+	OUTBOUND_WEBHOOK_BACKOFF_BASE = "OUTBOUND_WEBHOOK_BACKOFF_BASE"
+	OUTBOUND_WEBHOOK_BACKOFF_MAX  = "OUTBOUND_WEBHOOK_BACKOFF_MAX"
+	OUTBOUND_WEBHOOK_STATE_PATH   = "OUTBOUND_WEBHOOK_STATE_PATH"
+)
+
+// HTTP client configuration shared by the payment clients
+var (
+	HTTP_CLIENT_TIMEOUT     = "HTTP_CLIENT_TIMEOUT"
+	DEBUG_HTTP              = "DEBUG_HTTP"
+	PROVIDER_HEALTH_TIMEOUT = "PROVIDER_HEALTH_TIMEOUT"
 )
 
 // Stripe configuration
 var (
-	STRIPE_APIKEY     = "STRIPE_APIKEY"
-	STRIPE_WEBHOOKKEY = "STRIPE_WEBHOOKKEY"
-	STRIPE_WEBHOOKURL = "STRIPE_WEBHOOKURL"
-	STRIPE_APIURL     = "STRIPE_APIURL"
-	STRIPE_APIVERSION = "STRIPE_APIVERSION"
+	STRIPE_APIKEY             = "STRIPE_APIKEY"
+	STRIPE_WEBHOOKKEY         = "STRIPE_WEBHOOKKEY"
+	STRIPE_WEBHOOKURL         = "STRIPE_WEBHOOKURL"
+	STRIPE_APIURL             = "STRIPE_APIURL"
+	STRIPE_APIVERSION         = "STRIPE_APIVERSION"
+	STRIPE_OBJECT_TYPE        = "STRIPE_OBJECT_TYPE"
+	STRIPE_MAX_RETRY_ATTEMPTS = "STRIPE_MAX_RETRY_ATTEMPTS"
+	STRIPE_ENABLED            = "STRIPE_ENABLED"
+)
+
+// Stripe object types that can be listed as transactions
+const (
+	STRIPE_OBJECT_TYPE_CHARGE         = "charge"
+	STRIPE_OBJECT_TYPE_PAYMENT_INTENT = "payment_intent"
 )
 
 // Vipps configuration
@@ -25,6 +163,8 @@ var (
 	VIPPS_CLIENT_ID              = "VIPPS_CLIENT_ID"
 	VIPPS_SECRET                 = "VIPPS_SECRET"
 	VIPPS_MERCHANT_SERIAL_NUMBER = "VIPPS_MERCHANT_SERIAL_NUMBER"
+	VIPPS_WEBHOOK_SECRET         = "VIPPS_WEBHOOK_SECRET"
+	VIPPS_ENABLED                = "VIPPS_ENABLED"
 )
 
 // Zettle configuration
@@ -33,6 +173,7 @@ var (
 	ZETTLE_APIURL    = "ZETTLE_APIURL"
 	ZETTLE_CLIENT_ID = "ZETTLE_CLIENT_ID"
 	ZETTLE_SECRET    = "ZETTLE_SECRET"
+	ZETTLE_ENABLED   = "ZETTLE_ENABLED"
 )
 
 // Payment sources
@@ -42,19 +183,39 @@ var (
 	PAYMENT_SOURCE_ZETTLE = "zettle"
 )
 
+// ValidPaymentSources lists all supported payment sources
+var ValidPaymentSources = []string{
+	PAYMENT_SOURCE_STRIPE,
+	PAYMENT_SOURCE_VIPPS,
+	PAYMENT_SOURCE_ZETTLE,
+}
+
 // Transaction status constants - unified across all payment providers
 var (
 	TRANSACTION_STATUS_PENDING    = "pending"    // Payment initiated but not completed
 	TRANSACTION_STATUS_SUCCEEDED  = "succeeded"  // Payment completed successfully
 	TRANSACTION_STATUS_FAILED     = "failed"     // Payment failed or was declined
 	TRANSACTION_STATUS_CANCELLED  = "cancelled"  // Payment was cancelled by user or system
-	TRANSACTION_STATUS_REFUNDED   = "refunded"   // Payment was refunded (partial or full)
+	TRANSACTION_STATUS_REFUNDED   = "refunded"   // Payment was fully refunded, partial refunds stay succeeded
 	TRANSACTION_STATUS_PROCESSING = "processing" // Payment is being processed
 	TRANSACTION_STATUS_EXPIRED    = "expired"    // Payment session expired without completion
 	TRANSACTION_STATUS_UNKNOWN    = "unknown"    // Status could not be determined
 )
 
+// ValidTransactionStatuses lists all unified transaction statuses
+var ValidTransactionStatuses = []string{
+	TRANSACTION_STATUS_PENDING,
+	TRANSACTION_STATUS_SUCCEEDED,
+	TRANSACTION_STATUS_FAILED,
+	TRANSACTION_STATUS_CANCELLED,
+	TRANSACTION_STATUS_REFUNDED,
+	TRANSACTION_STATUS_PROCESSING,
+	TRANSACTION_STATUS_EXPIRED,
+	TRANSACTION_STATUS_UNKNOWN,
+}
+
 // Stripe status mapping to unified status
+// Covers both charge and PaymentIntent statuses
 var StripeStatusMapping = map[string]string{
 	"requires_payment_method": TRANSACTION_STATUS_PENDING,
 	"requires_confirmation":   TRANSACTION_STATUS_PENDING,
@@ -75,6 +236,7 @@ var VippsStatusMapping = map[string]string{
 	"RESERVE":   TRANSACTION_STATUS_PROCESSING,
 	"CAPTURE":   TRANSACTION_STATUS_SUCCEEDED,
 	"SALE":      TRANSACTION_STATUS_SUCCEEDED,
+	"SETTLED":   TRANSACTION_STATUS_SUCCEEDED,
 	"CANCEL":    TRANSACTION_STATUS_CANCELLED,
 	"VOID":      TRANSACTION_STATUS_CANCELLED,
 	"REFUND":    TRANSACTION_STATUS_REFUNDED,
@@ -82,6 +244,14 @@ var VippsStatusMapping = map[string]string{
 	"REJECTED":  TRANSACTION_STATUS_FAILED,
 	"EXPIRED":   TRANSACTION_STATUS_EXPIRED,
 	"ABANDONED": TRANSACTION_STATUS_CANCELLED,
+	// ePayment webhook event names
+	"CREATED":    TRANSACTION_STATUS_PENDING,
+	"AUTHORIZED": TRANSACTION_STATUS_PROCESSING,
+	"CAPTURED":   TRANSACTION_STATUS_SUCCEEDED,
+	"CANCELLED":  TRANSACTION_STATUS_CANCELLED,
+	"REFUNDED":   TRANSACTION_STATUS_REFUNDED,
+	"ABORTED":    TRANSACTION_STATUS_CANCELLED,
+	"TERMINATED": TRANSACTION_STATUS_CANCELLED,
 }
 
 // Zettle status mapping to unified status
@@ -103,3 +273,6 @@ var (
 	TRANSACTION_LIMIT_DEFAULT = 25
 	TRANSACTION_LIMIT_MAX     = 1000
 )
+
+// Maximum length in characters of the staff notes on a transaction
+const TRANSACTION_NOTES_MAX_LENGTH = 1000
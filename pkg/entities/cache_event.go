@@ -0,0 +1,19 @@
+package entities
+
+// CacheEventType is the kind of change a CacheEvent describes
+type CacheEventType string
+
+const (
+	CacheEventSet    CacheEventType = "set"
+	CacheEventDelete CacheEventType = "delete"
+)
+
+// CacheEvent describes a transaction being written to or removed from the cache
+type CacheEvent struct {
+	Type CacheEventType `json:"type"`
+	Key  string         `json:"key"`
+	// Transaction is the written transaction, or for deletes the removed one if it was cached
+	Transaction Transaction `json:"transaction"`
+	// Created is true when a set added a transaction that wasn't cached before
+	Created bool `json:"created"`
+}
@@ -0,0 +1,16 @@
+package entities
+
+import "time"
+
+// CacheStats summarizes the contents of the transaction cache
+type CacheStats struct {
+	TotalTransactions int            `json:"total_transactions"`
+	BySource          map[string]int `json:"by_source"`
+	// Oldest and newest CreatedAt of the cached transactions, unset when the cache is empty
+	OldestCreatedAt *time.Time `json:"oldest_created_at,omitempty"`
+	NewestCreatedAt *time.Time `json:"newest_created_at,omitempty"`
+	// Transactions expiring within NearExpiryWindow
+	NearingExpiry    int    `json:"nearing_expiry"`
+	NearExpiryWindow string `json:"near_expiry_window"`
+	Prices           int    `json:"prices"`
+}
@@ -0,0 +1,9 @@
+package entities
+
+// ProviderHealth is the result of a connectivity check against a payment provider
+type ProviderHealth struct {
+	Provider  string `json:"provider"`
+	OK        bool   `json:"ok"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
@@ -0,0 +1,12 @@
+package entities
+
+import "time"
+
+// RefreshResult describes a refresh of the transaction cache from the payment providers
+type RefreshResult struct {
+	Transactions int               `json:"transactions"` // Transactions fetched into the cache
+	Warnings     []ProviderWarning `json:"warnings,omitempty"`
+	RefreshedAt  time.Time         `json:"refreshed_at"`
+	// Cached is true when a recent refresh was returned instead of fetching again
+	Cached bool `json:"cached"`
+}
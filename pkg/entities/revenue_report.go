@@ -0,0 +1,20 @@
+package entities
+
+// RevenueByProductReport holds the revenue of succeeded transactions per matched product
+type RevenueByProductReport struct {
+	Products  []ProductRevenue `json:"products"`  // Sorted by revenue, highest first
+	Unmatched ProductRevenue   `json:"unmatched"` // Transactions without a matched product
+	// Revenue in the base currency, only set when conversion is requested
+	Converted *ConvertedRevenue `json:"converted,omitempty"`
+}
+
+// ProductRevenue holds the number of transactions and revenue for a single product.
+// Revenue sums the amounts as they are, RevenueByCurrency splits it per currency and
+// ConvertedRevenue sums the convertible amounts in the base currency when conversion is requested.
+type ProductRevenue struct {
+	Product           string             `json:"product"`
+	Count             int                `json:"count"`
+	Revenue           float64            `json:"revenue"`
+	RevenueByCurrency map[string]float64 `json:"revenue_by_currency"`
+	ConvertedRevenue  *float64           `json:"converted_revenue,omitempty"`
+}
@@ -0,0 +1,39 @@
+package entities
+
+import "time"
+
+// TimeseriesInterval is the length of the periods a timeseries report is bucketed by
+type TimeseriesInterval string
+
+const (
+	TimeseriesIntervalDay   TimeseriesInterval = "day"
+	TimeseriesIntervalWeek  TimeseriesInterval = "week" // ISO 8601 weeks, starting on Monday
+	TimeseriesIntervalMonth TimeseriesInterval = "month"
+)
+
+// ValidTimeseriesIntervals lists all supported timeseries intervals
+var ValidTimeseriesIntervals = []TimeseriesInterval{
+	TimeseriesIntervalDay,
+	TimeseriesIntervalWeek,
+	TimeseriesIntervalMonth,
+}
+
+// RevenueTimeseriesReport holds the succeeded transactions per period between From and To.
+// Every period in the range has a bucket, including periods without transactions.
+type RevenueTimeseriesReport struct {
+	Interval TimeseriesInterval `json:"interval"`
+	Timezone string             `json:"timezone"`
+	From     time.Time          `json:"from"`
+	To       time.Time          `json:"to"`
+	Buckets  []TimeseriesBucket `json:"buckets"`
+}
+
+// TimeseriesBucket holds the number and revenue of succeeded transactions in a single period.
+// Period labels the bucket as 2025-06-01 for days, 2025-W23 for weeks and 2025-06 for months.
+type TimeseriesBucket struct {
+	Period            string             `json:"period"`
+	Start             time.Time          `json:"start"`
+	Count             int                `json:"count"`
+	Revenue           float64            `json:"revenue"`
+	RevenueByCurrency map[string]float64 `json:"revenue_by_currency"`
+}
@@ -6,12 +6,30 @@ type Role string
 const (
 	// RoleAdmin has full access to all resources
 	RoleAdmin Role = "admin"
+	// RoleEditor can view all transactions and refresh the cache, but not manage users
+	RoleEditor Role = "editor"
 	// RoleUser has access to user-level resources
 	RoleUser Role = "user"
 	// RoleNoAccess has no access to protected resources
 	RoleNoAccess Role = "no_access"
 )
 
+// Sources of a user's effective role, see UserRole
+const (
+	RoleSourceAdminEmails = "admin_emails"
+	RoleSourceUserEmails  = "user_emails"
+	RoleSourceAssignment  = "assignment"
+)
+
+// UserRole is the effective role of a known user and where it comes from
+type UserRole struct {
+	Email  string `json:"email"`
+	Role   Role   `json:"role"`
+	Source string `json:"source"`
+	// AssignedRole is the explicit assignment, set even when an email list overrides it
+	AssignedRole Role `json:"assigned_role,omitempty"`
+}
+
 // Permission represents a specific permission
 type Permission string
 
@@ -21,10 +39,11 @@ const (
 	PermissionUpdateOwnProfile Permission = "update:own_profile"
 
 	// Transaction permissions
-	PermissionReadTransactions   Permission = "read:transactions"
-	PermissionCreateTransactions Permission = "create:transactions"
-	PermissionUpdateTransactions Permission = "update:transactions"
-	PermissionDeleteTransactions Permission = "delete:transactions"
+	PermissionReadTransactions    Permission = "read:transactions"
+	PermissionCreateTransactions  Permission = "create:transactions"
+	PermissionUpdateTransactions  Permission = "update:transactions"
+	PermissionDeleteTransactions  Permission = "delete:transactions"
+	PermissionRefreshTransactions Permission = "refresh:transactions"
 
 	// Admin permissions
 	PermissionReadAllUsers Permission = "read:all_users"
@@ -42,10 +61,18 @@ var RolePermissions = map[Role][]Permission{
 		PermissionCreateTransactions,
 		PermissionUpdateTransactions,
 		PermissionDeleteTransactions,
+		PermissionRefreshTransactions,
 		PermissionReadAllUsers,
 		PermissionManageUsers,
 		PermissionSystemAdmin,
 	},
+	RoleEditor: {
+		// Editor works with transactions but has no user management
+		PermissionReadOwnProfile,
+		PermissionUpdateOwnProfile,
+		PermissionReadTransactions,
+		PermissionRefreshTransactions,
+	},
 	RoleUser: {
 		// User has limited permissions
 		PermissionReadOwnProfile,
@@ -75,13 +102,30 @@ func (r Role) HasPermission(permission Permission) bool {
 // IsValid checks if the role is a valid role
 func (r Role) IsValid() bool {
 	switch r {
-	case RoleAdmin, RoleUser, RoleNoAccess:
+	case RoleAdmin, RoleEditor, RoleUser, RoleNoAccess:
 		return true
 	default:
 		return false
 	}
 }
 
+// Level returns the numeric level of the role in the hierarchy admin > editor > user > no_access.
+// Unknown roles have level 0.
+func (r Role) Level() int {
+	switch r {
+	case RoleAdmin:
+		return 4
+	case RoleEditor:
+		return 3
+	case RoleUser:
+		return 2
+	case RoleNoAccess:
+		return 1
+	default:
+		return 0
+	}
+}
+
 // String returns the string representation of the role
 func (r Role) String() string {
 	return string(r)
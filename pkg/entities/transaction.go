@@ -19,7 +19,12 @@ type Transaction struct {
 	Data            any               `json:"data,omitempty"`          // Additional data if needed
 	TransferData    any               `json:"transfer_data,omitempty"` // Data related to transfer, if applicable
 	CachedAt        time.Time         `json:"cached_at"`               // When the transaction was cached
+	Archived        bool              `json:"archived"`                // Hidden from listings unless asked for
+	Notes           *string           `json:"notes,omitempty"`         // Free-text notes added by staff
 	// Product information enriched from price list
 	Product      *string  `json:"product,omitempty"`       // Matched product name from price list
 	ProductPrice *float64 `json:"product_price,omitempty"` // Expected price for the product
+	// How the product was matched, so low-confidence guesses can be reviewed
+	ProductMatchConfidence *float64 `json:"product_match_confidence,omitempty"` // 0-1, where 1 is certain
+	ProductMatchStrategy   *string  `json:"product_match_strategy,omitempty"`   // exact_price, fuzzy_description or price_range
 }
@@ -0,0 +1,24 @@
+package entities
+
+import "time"
+
+// TransactionAnnotation holds the manual state attached to a transaction, such as it being archived. It is stored
+// apart from the cached transaction, so the provider re-fetches that overwrite the transaction never clobber it.
+type TransactionAnnotation struct {
+	Archived bool    `json:"archived,omitempty"`
+	Notes    *string `json:"notes,omitempty"`
+	// When the annotated transaction was created, so annotations can be pruned once it leaves the lookback window
+	TransactionCreatedAt time.Time `json:"transaction_created_at"`
+}
+
+// Apply returns the transaction with its annotated fields taken from the annotation
+func (a TransactionAnnotation) Apply(transaction Transaction) Transaction {
+	transaction.Archived = a.Archived
+	transaction.Notes = a.Notes
+	return transaction
+}
+
+// WithoutAnnotations returns the transaction with only its provider-derived fields, as written to the cache
+func (t Transaction) WithoutAnnotations() Transaction {
+	return TransactionAnnotation{}.Apply(t)
+}
@@ -0,0 +1,60 @@
+package entities
+
+import "time"
+
+// TransactionFilter holds the criteria used to narrow down a transaction listing.
+// Empty fields match all transactions, except that archived transactions are left out unless IncludeArchived is set.
+type TransactionFilter struct {
+	Statuses []string  // Unified statuses to include
+	Sources  []string  // Payment sources to include
+	From     time.Time // Include transactions created at or after this time
+	To       time.Time // Include transactions created before this time
+	// Inclusive amount bounds in the transaction's own currency, unset when nil
+	MinAmount *float64
+	MaxAmount *float64
+	// Metadata keys the transaction must have, each with exactly the given value (case-sensitive)
+	Metadata map[string]string
+	// Include archived transactions, which are left out by default
+	IncludeArchived bool
+}
+
+// Matches checks if a transaction satisfies all criteria of the filter
+func (f TransactionFilter) Matches(transaction Transaction) bool {
+	if transaction.Archived && !f.IncludeArchived {
+		return false
+	}
+	if len(f.Statuses) > 0 && !containsString(f.Statuses, transaction.Status) {
+		return false
+	}
+	if len(f.Sources) > 0 && !containsString(f.Sources, transaction.Source) {
+		return false
+	}
+	if !f.From.IsZero() && transaction.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !transaction.CreatedAt.Before(f.To) {
+		return false
+	}
+	if f.MinAmount != nil && transaction.Amount < *f.MinAmount {
+		return false
+	}
+	if f.MaxAmount != nil && transaction.Amount > *f.MaxAmount {
+		return false
+	}
+	for key, value := range f.Metadata {
+		if actual, ok := transaction.Metadata[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// containsString checks if a value is present in a slice
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package entities
+
+// TransactionSummary holds aggregate totals for a set of transactions.
+// Revenue only includes succeeded transactions, while counts include all statuses.
+type TransactionSummary struct {
+	TotalCount        int                      `json:"total_count"`
+	RevenueByCurrency map[string]float64       `json:"revenue_by_currency"`
+	BySource          map[string]SourceSummary `json:"by_source"`
+	ByStatus          map[string]int           `json:"by_status"`
+	// Revenue in the base currency, only set when conversion is requested
+	Converted *ConvertedRevenue `json:"converted,omitempty"`
+}
+
+// SourceSummary holds aggregate totals for a single payment source
+type SourceSummary struct {
+	Count             int                `json:"count"`
+	RevenueByCurrency map[string]float64 `json:"revenue_by_currency"`
+}
+
+// ConvertedRevenue holds revenue converted to a single base currency.
+// Transactions in a currency without a conversion rate are reported in Unconvertible instead.
+type ConvertedRevenue struct {
+	BaseCurrency  string               `json:"base_currency"`
+	Revenue       float64              `json:"revenue"`
+	Unconvertible UnconvertibleRevenue `json:"unconvertible"`
+}
+
+// UnconvertibleRevenue holds the revenue in currencies without a conversion rate
+type UnconvertibleRevenue struct {
+	Count             int                `json:"count"`
+	RevenueByCurrency map[string]float64 `json:"revenue_by_currency"`
+}
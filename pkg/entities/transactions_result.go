@@ -0,0 +1,14 @@
+package entities
+
+// TransactionsResult holds listed transactions together with warnings about providers that failed to return
+// theirs, so callers can use the transactions that were fetched when only some providers failed
+type TransactionsResult struct {
+	Items    []Transaction     `json:"items"`
+	Warnings []ProviderWarning `json:"warnings,omitempty"`
+}
+
+// ProviderWarning describes a payment provider that failed to return transactions
+type ProviderWarning struct {
+	Source  string `json:"source"`
+	Message string `json:"message"`
+}
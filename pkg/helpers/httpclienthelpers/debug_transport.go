@@ -0,0 +1,112 @@
+package httpclienthelpers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/helpers/redacthelpers"
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// MaxDebugBodyBytes is how much of a request or response body is logged by a debug transport
+const MaxDebugBodyBytes = 2048
+
+// debugTransport logs requests and responses at debug level, with credentials redacted
+type debugTransport struct {
+	next http.RoundTripper
+}
+
+// NewDebugClient returns a copy of the client that logs each request URL and body and each response body at debug
+// level, truncated to MaxDebugBodyBytes. Secrets are redacted, but bodies may still hold personal data,
+// so it is meant for debugging provider integrations only.
+func NewDebugClient(client *http.Client) *http.Client {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	debugClient := *client
+	debugClient.Transport = &debugTransport{next: next}
+	return &debugClient
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := peekRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.WithContext(req.Context()).Debug("Outbound HTTP request",
+		zap.String("method", req.Method),
+		zap.String("url", redacthelpers.RedactURL(req.URL)),
+		zap.Any("headers", redacthelpers.RedactHeaders(req.Header)),
+		zap.String("body", debugBody(requestBody)),
+	)
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		logger.WithContext(req.Context()).Debug("Outbound HTTP request failed",
+			zap.String("method", req.Method),
+			zap.String("url", redacthelpers.RedactURL(req.URL)),
+			zap.Duration("duration", time.Since(start)),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	responseBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	// Hand the body on as read, so a failed read surfaces to the caller like it would have without logging
+	resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(responseBody), errorReader{err}))
+
+	logger.WithContext(req.Context()).Debug("Outbound HTTP response",
+		zap.String("method", req.Method),
+		zap.String("url", redacthelpers.RedactURL(req.URL)),
+		zap.Int("status", resp.StatusCode),
+		zap.Duration("duration", time.Since(start)),
+		zap.Any("headers", redacthelpers.RedactHeaders(resp.Header)),
+		zap.String("body", debugBody(responseBody)),
+	)
+
+	return resp, nil
+}
+
+// peekRequestBody returns the request body, leaving the request with an unread copy of it
+func peekRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// errorReader returns its error once the body before it has been read, or io.EOF when there is none
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read([]byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
+
+// debugBody redacts secrets from a body for logging and truncates it to MaxDebugBodyBytes
+func debugBody(body []byte) string {
+	text := redacthelpers.Redact(string(body))
+	if len(text) > MaxDebugBodyBytes {
+		return text[:MaxDebugBodyBytes] + "...(truncated)"
+	}
+	return text
+}
@@ -0,0 +1,65 @@
+package httpclienthelpers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDebugClient_PassesBodiesThrough(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(`{"echo":"` + string(body) + `","access_token":"secret-token"}`))
+	}))
+	defer server.Close()
+
+	client := NewDebugClient(NewClient(time.Second))
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	// Only the logs are redacted, the caller gets the response as sent
+	if string(body) != `{"echo":"hello","access_token":"secret-token"}` {
+		t.Errorf("Unexpected response body %q", body)
+	}
+}
+
+func TestDebugBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		secret   string
+		expected string
+	}{
+		{"JSON token response", `{"token_type":"Bearer","access_token":"eyJ.secret"}`, "eyJ.secret", "Bearer"},
+		{"form token request", "grant_type=jwt&client_id=abc&assertion=api-key-secret", "api-key-secret", "client_id=abc"},
+		{"form with client secret", "client_secret=s3cr3t&grant_type=client_credentials", "s3cr3t", "client_credentials"},
+		{"plain text", "upstream unavailable", "", "upstream unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redacted := debugBody([]byte(tt.body))
+			if tt.secret != "" && strings.Contains(redacted, tt.secret) {
+				t.Errorf("Expected %q to be redacted from %q", tt.secret, redacted)
+			}
+			if !strings.Contains(redacted, tt.expected) {
+				t.Errorf("Expected %q to be kept in %q", tt.expected, redacted)
+			}
+		})
+	}
+
+	long := debugBody([]byte(strings.Repeat("a", MaxDebugBodyBytes+10)))
+	if !strings.HasSuffix(long, "...(truncated)") || len(long) > MaxDebugBodyBytes+20 {
+		t.Errorf("Expected the body to be truncated, got %d bytes", len(long))
+	}
+}
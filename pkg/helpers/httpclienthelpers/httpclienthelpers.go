@@ -0,0 +1,37 @@
+package httpclienthelpers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is the request timeout of the shared client
+const DefaultTimeout = 30 * time.Second
+
+var (
+	defaultClient     *http.Client
+	defaultClientOnce sync.Once
+)
+
+// NewClient creates an HTTP client with the given timeout and a pooled transport suited for
+// a handful of payment provider APIs
+func NewClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 10
+	transport.IdleConnTimeout = 90 * time.Second
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
+
+// DefaultClient returns the client shared by payment clients that aren't given their own
+func DefaultClient() *http.Client {
+	defaultClientOnce.Do(func() {
+		defaultClient = NewClient(DefaultTimeout)
+	})
+	return defaultClient
+}
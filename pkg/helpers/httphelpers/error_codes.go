@@ -0,0 +1,81 @@
+package httphelpers
+
+import "net/http"
+
+// Error codes returned in the "code" field of error responses. They are stable so clients can rely on them,
+// e.g. to localize messages, and are documented in docs/errors.md.
+const (
+	// Generic codes, used by RespondWithError based on the status code
+	ErrorCodeBadRequest         = "bad_request"
+	ErrorCodeUnauthorized       = "unauthorized"
+	ErrorCodeForbidden          = "forbidden"
+	ErrorCodeNotFound           = "not_found"
+	ErrorCodeTooManyRequests    = "too_many_requests"
+	ErrorCodeInternal           = "internal_error"
+	ErrorCodeBadGateway         = "bad_gateway"
+	ErrorCodeServiceUnavailable = "service_unavailable"
+
+	// Request validation
+	ErrorCodeInvalidParameter   = "invalid_parameter"
+	ErrorCodeMissingParameter   = "missing_parameter"
+	ErrorCodeInvalidRequestBody = "invalid_request_body"
+	ErrorCodeRequestTooLarge    = "request_too_large"
+
+	// Authentication and authorization
+	ErrorCodeMissingAuthorization    = "missing_authorization"
+	ErrorCodeInvalidAuthorization    = "invalid_authorization"
+	ErrorCodeInvalidToken            = "invalid_token"
+	ErrorCodeAuthenticationRequired  = "authentication_required"
+	ErrorCodeInsufficientPermissions = "insufficient_permissions"
+	ErrorCodeAccessDenied            = "access_denied"
+	ErrorCodeRateLimited             = "rate_limited"
+	ErrorCodeUserUnavailable         = "user_unavailable"
+
+	// Users and roles
+	ErrorCodeInvalidRole   = "invalid_role"
+	ErrorCodeEmailRequired = "email_required"
+	ErrorCodeInvalidEmail  = "invalid_email"
+
+	// Transactions
+	ErrorCodeTransactionNotFound  = "transaction_not_found"
+	ErrorCodeProvidersUnavailable = "providers_unavailable"
+	ErrorCodeInvalidNotes         = "invalid_notes"
+
+	// Cache
+	ErrorCodeCacheStatsUnavailable = "cache_stats_unavailable"
+
+	// Prices
+	ErrorCodeInvalidPrice            = "invalid_price"
+	ErrorCodePriceNotPersisted       = "price_not_persisted"
+	ErrorCodePriceServiceUnavailable = "price_service_unavailable"
+
+	// Webhooks
+	ErrorCodeWebhookNotConfigured  = "webhook_not_configured"
+	ErrorCodeInvalidSignature      = "invalid_signature"
+	ErrorCodeInvalidWebhookPayload = "invalid_webhook_payload"
+)
+
+// GenericErrorCode returns the generic error code for an HTTP status code
+func GenericErrorCode(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return ErrorCodeBadRequest
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrorCodeForbidden
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusTooManyRequests:
+		return ErrorCodeTooManyRequests
+	case http.StatusBadGateway:
+		return ErrorCodeBadGateway
+	case http.StatusServiceUnavailable:
+		return ErrorCodeServiceUnavailable
+	}
+
+	if statusCode >= 400 && statusCode < 500 {
+		return ErrorCodeBadRequest
+	}
+	return ErrorCodeInternal
+}
@@ -1,31 +1,69 @@
 package httphelpers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
+
+	"github.com/rogerwesterbo/svennescamping-backend/pkg/logger"
+	"go.uber.org/zap"
 )
 
 // ErrorResponse represents a standard error response structure
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error ErrorDetail `json:"error"`
 }
 
-// RespondWithError sends an HTTP error response with the specified status code and error message
-func RespondWithError(w http.ResponseWriter, statusCode int, errorMsg string) {
+// ErrorDetail holds a stable machine-readable error code and a human-readable message
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// RespondWithErrorCode sends an HTTP error response with the specified status code, error code and message.
+// Codes are listed in error_codes.go.
+func RespondWithErrorCode(w http.ResponseWriter, statusCode int, code string, message string) {
 	w.WriteHeader(statusCode)
 
 	response := ErrorResponse{
-		Error: errorMsg,
+		Error: ErrorDetail{
+			Code:    code,
+			Message: message,
+		},
 	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		// If we can't even encode the error response, log it and send a plain text response
 		log.Printf("Failed to encode error response: %v", err)
-		http.Error(w, errorMsg, statusCode)
+		http.Error(w, message, statusCode)
 	}
 }
 
+// RespondWithError sends an HTTP error response with the specified status code and error message,
+// using the generic error code for the status code
+func RespondWithError(w http.ResponseWriter, statusCode int, errorMsg string) {
+	RespondWithErrorCode(w, statusCode, GenericErrorCode(statusCode), errorMsg)
+}
+
+// RespondWithBodyError responds to a request body that couldn't be read or decoded: 413 when it exceeded the
+// limit set with http.MaxBytesReader, otherwise 400 with the given message
+func RespondWithBodyError(w http.ResponseWriter, err error, message string) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		RespondWithErrorCode(w, http.StatusRequestEntityTooLarge, ErrorCodeRequestTooLarge,
+			fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit))
+		return
+	}
+	RespondWithErrorCode(w, http.StatusBadRequest, ErrorCodeInvalidRequestBody, message)
+}
+
 // RespondWithJSON sends a successful HTTP response with the provided data
 func RespondWithJSON(w http.ResponseWriter, statusCode int, data any) error {
 	w.WriteHeader(statusCode)
@@ -36,3 +74,63 @@ func RespondWithJSON(w http.ResponseWriter, statusCode int, data any) error {
 
 	return nil
 }
+
+// RespondWithJSONETag sends data as JSON with a weak ETag of the encoded body. When the request's If-None-Match
+// already holds that ETag it responds 304 Not Modified without a body, so polling clients skip unchanged payloads.
+func RespondWithJSONETag(w http.ResponseWriter, r *http.Request, data any) error {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(data); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	// Responses depend on the user, so only the client may store them, and it must revalidate each time
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(body.Bytes())
+	return err
+}
+
+// etagMatches reports whether an If-None-Match header lists the ETag, using the weak comparison
+// required for If-None-Match (the W/ prefix is ignored)
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestLogger returns a child of the given logger that tags every entry with the request ID
+func RequestLogger(r *http.Request, base *zap.Logger) *zap.Logger {
+	return logger.WithRequestID(base, r.Context())
+}
+
+type shutdownKey struct{}
+
+// WithShutdown returns a context carrying a channel that is closed when the server starts shutting down
+func WithShutdown(ctx context.Context, shuttingDown <-chan struct{}) context.Context {
+	return context.WithValue(ctx, shutdownKey{}, shuttingDown)
+}
+
+// ShutdownSignal returns the channel closed when the server handling the request starts shutting down, or nil
+// if there is none. Long-lived responses such as event streams must end on it, since the server waits for them.
+func ShutdownSignal(ctx context.Context) <-chan struct{} {
+	shuttingDown, _ := ctx.Value(shutdownKey{}).(<-chan struct{})
+	return shuttingDown
+}
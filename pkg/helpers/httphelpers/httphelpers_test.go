@@ -0,0 +1,95 @@
+package httphelpers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespondWithErrorCode(t *testing.T) {
+	rec := httptest.NewRecorder()
+	RespondWithErrorCode(rec, http.StatusNotFound, ErrorCodeTransactionNotFound, "Transaction 'x' not found")
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	var body map[string]map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body["error"]["code"] != ErrorCodeTransactionNotFound || body["error"]["message"] != "Transaction 'x' not found" {
+		t.Errorf("Unexpected error response %v", body)
+	}
+}
+
+func TestRespondWithError_UsesGenericCode(t *testing.T) {
+	tests := []struct {
+		status       int
+		expectedCode string
+	}{
+		{http.StatusBadRequest, ErrorCodeBadRequest},
+		{http.StatusNotFound, ErrorCodeNotFound},
+		{http.StatusConflict, ErrorCodeBadRequest},
+		{http.StatusServiceUnavailable, ErrorCodeServiceUnavailable},
+		{http.StatusInternalServerError, ErrorCodeInternal},
+		{http.StatusGatewayTimeout, ErrorCodeInternal},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		RespondWithError(rec, tt.status, "Something went wrong")
+
+		var response ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Error.Code != tt.expectedCode || response.Error.Message != "Something went wrong" {
+			t.Errorf("Expected code %q for status %d, got %+v", tt.expectedCode, tt.status, response.Error)
+		}
+	}
+}
+
+func TestRespondWithJSONETag(t *testing.T) {
+	data := map[string]int{"count": 3}
+
+	rec := httptest.NewRecorder()
+	if err := RespondWithJSONETag(rec, httptest.NewRequest("GET", "/", nil), data); err != nil {
+		t.Fatalf("Failed to respond: %v", err)
+	}
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Body.Len() == 0 {
+		t.Fatalf("Expected 200 with an ETag and a body, got %d, ETag %q, %d bytes", rec.Code, etag, rec.Body.Len())
+	}
+
+	tests := []struct {
+		ifNoneMatch    string
+		data           any
+		expectedStatus int
+	}{
+		{etag, data, http.StatusNotModified},
+		{`"other", ` + etag, data, http.StatusNotModified},
+		// Weak comparison ignores the W/ prefix
+		{etag[2:], data, http.StatusNotModified},
+		{"*", data, http.StatusNotModified},
+		{`W/"other"`, data, http.StatusOK},
+		{etag, map[string]int{"count": 4}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		rec := httptest.NewRecorder()
+		if err := RespondWithJSONETag(rec, req, tt.data); err != nil {
+			t.Fatalf("Failed to respond: %v", err)
+		}
+
+		if rec.Code != tt.expectedStatus {
+			t.Errorf("Expected status %d for If-None-Match %s, got %d", tt.expectedStatus, tt.ifNoneMatch, rec.Code)
+		}
+		if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("Expected no body with 304, got %q", rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package redacthelpers
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Mask replaces secrets in redacted text
+const Mask = "[REDACTED]"
+
+// minSecretLength is the shortest configured secret masked, so a short value can't garble unrelated text
+const minSecretLength = 6
+
+// sensitiveHeaders are headers carrying credentials, compared case-insensitively
+var sensitiveHeaders = []string{"Authorization", "client_secret", "Ocp-Apim-Subscription-Key", "Cookie", "Set-Cookie"}
+
+// sensitiveFields are form, query and JSON fields carrying credentials, compared case-insensitively
+var sensitiveFields = []string{"client_secret", "assertion", "access_token", "refresh_token", "id_token", "api_key", "password"}
+
+var (
+	// sensitiveJSONField matches a JSON string field named like a sensitive field, capturing the part before the value
+	sensitiveJSONField = regexp.MustCompile(`(?i)("(?:` + strings.Join(sensitiveFields, "|") + `)"\s*:\s*)"[^"]*"`)
+	// sensitiveFormField matches a form or query field named like a sensitive field, capturing the part before the value
+	sensitiveFormField = regexp.MustCompile(`(?i)((?:^|[?&\s])(?:` + strings.Join(sensitiveFields, "|") + `)=)[^&\s]*`)
+
+	// secretPatterns match credentials by their format wherever they appear
+	secretPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\b(?:sk|rk|pk)_(?:live|test)_[0-9A-Za-z]+`),           // Stripe API keys
+		regexp.MustCompile(`\bwhsec_[0-9A-Za-z]+`),                                // Stripe webhook secrets
+		regexp.MustCompile(`(?i)\bBearer\s+[0-9A-Za-z\-._~+/]+=*`),                // Bearer tokens
+		regexp.MustCompile(`\beyJ[0-9A-Za-z_-]+\.[0-9A-Za-z_-]+\.[0-9A-Za-z_-]*`), // JWTs
+	}
+)
+
+// Configured secret values masked wherever they appear, see AddSecrets
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+)
+
+// AddSecrets registers configured secrets, such as API keys, to be masked wherever they appear in redacted text.
+// Empty values and values shorter than six characters are ignored.
+func AddSecrets(values ...string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if len(value) >= minSecretLength && !slices.Contains(secrets, value) {
+			secrets = append(secrets, value)
+		}
+	}
+	// Longest first, so a secret containing another is masked as a whole
+	slices.SortFunc(secrets, func(a, b string) int { return len(b) - len(a) })
+}
+
+// Redact masks secrets in text before it is logged or returned in an error: configured secrets, credentials
+// recognised by their format and the values of credential fields in JSON, form and query strings
+func Redact(text string) string {
+	if text == "" {
+		return text
+	}
+
+	secretsMu.RLock()
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, Mask)
+	}
+	secretsMu.RUnlock()
+
+	text = sensitiveJSONField.ReplaceAllString(text, `$1"`+Mask+`"`)
+	text = sensitiveFormField.ReplaceAllString(text, `${1}`+Mask)
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllString(text, Mask)
+	}
+	return text
+}
+
+// RedactHeaders returns the headers as a map for logging, with credential headers masked and other values redacted
+func RedactHeaders(header http.Header) map[string]string {
+	redacted := make(map[string]string, len(header))
+	for name, values := range header {
+		if isSensitiveHeader(name) {
+			redacted[name] = Mask
+			continue
+		}
+		redacted[name] = Redact(strings.Join(values, ", "))
+	}
+	return redacted
+}
+
+// RedactURL returns the URL for logging with secrets in it, such as an access_token query parameter, masked
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return Redact(u.Redacted())
+}
+
+// isSensitiveHeader reports whether a header carries credentials
+func isSensitiveHeader(name string) bool {
+	for _, sensitive := range sensitiveHeaders {
+		if strings.EqualFold(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
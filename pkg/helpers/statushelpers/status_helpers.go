@@ -127,6 +127,16 @@ func inferStatusFromCommonNames(status string) string {
 	return consts.TRANSACTION_STATUS_UNKNOWN
 }
 
+// IsValidStatus checks if a status is one of the unified transaction statuses
+func IsValidStatus(status string) bool {
+	for _, validStatus := range consts.ValidTransactionStatuses {
+		if status == validStatus {
+			return true
+		}
+	}
+	return false
+}
+
 // IsSuccessfulStatus checks if a unified status represents a successful payment
 func IsSuccessfulStatus(status string) bool {
 	return status == consts.TRANSACTION_STATUS_SUCCEEDED
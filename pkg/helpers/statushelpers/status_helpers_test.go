@@ -58,6 +58,12 @@ func TestNormalizeTransactionStatus(t *testing.T) {
 			source:         consts.PAYMENT_SOURCE_VIPPS,
 			expected:       consts.TRANSACTION_STATUS_PROCESSING,
 		},
+		{
+			name:           "Vipps SETTLED",
+			providerStatus: "SETTLED",
+			source:         consts.PAYMENT_SOURCE_VIPPS,
+			expected:       consts.TRANSACTION_STATUS_SUCCEEDED,
+		},
 		{
 			name:           "Vipps FAILED",
 			providerStatus: "FAILED",
@@ -262,3 +268,41 @@ func TestGetStatusDescription(t *testing.T) {
 		})
 	}
 }
+
+func TestIsValidStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		expected bool
+	}{
+		{
+			name:     "Succeeded status",
+			status:   consts.TRANSACTION_STATUS_SUCCEEDED,
+			expected: true,
+		},
+		{
+			name:     "Unknown status is still a valid unified status",
+			status:   consts.TRANSACTION_STATUS_UNKNOWN,
+			expected: true,
+		},
+		{
+			name:     "Provider specific status",
+			status:   "CAPTURE",
+			expected: false,
+		},
+		{
+			name:     "Empty status",
+			status:   "",
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(sub *testing.T) {
+			result := IsValidStatus(test.status)
+			if result != test.expected {
+				sub.Errorf("IsValidStatus(%q) = %t, want %t", test.status, result, test.expected)
+			}
+		})
+	}
+}
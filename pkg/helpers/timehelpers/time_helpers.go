@@ -0,0 +1,49 @@
+package timehelpers
+
+import (
+	"fmt"
+	"time"
+)
+
+// DateLayout is the YYYY-MM-DD layout providers and query parameters use for plain dates
+const DateLayout = "2006-01-02"
+
+// zonedLayouts carry their own offset, which is preserved
+var zonedLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+}
+
+// localLayouts have no zone and are read as local time in the given location
+var localLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	DateLayout,
+}
+
+// ParseTimestamp parses a provider or query timestamp. Values with a zone or offset keep it, while values without
+// one, such as a plain YYYY-MM-DD date, are read as local time in loc so they land on the right calendar day.
+func ParseTimestamp(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range zonedLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", value)
+}
+
+// IsDate reports whether the value is a plain YYYY-MM-DD date without a time of day
+func IsDate(value string) bool {
+	_, err := time.Parse(DateLayout, value)
+	return err == nil
+}
@@ -0,0 +1,89 @@
+package timehelpers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Time
+	}{
+		{"plain date starts at local midnight", "2025-06-01", time.Date(2025, 5, 31, 22, 0, 0, 0, time.UTC)},
+		{"plain date in winter time", "2025-01-01", time.Date(2024, 12, 31, 23, 0, 0, 0, time.UTC)},
+		{"local time without zone", "2025-06-01T23:30:00", time.Date(2025, 6, 1, 21, 30, 0, 0, time.UTC)},
+		{"local time with space", "2025-06-01 00:15:00", time.Date(2025, 5, 31, 22, 15, 0, 0, time.UTC)},
+		{"UTC zone is preserved", "2025-06-01T23:30:00Z", time.Date(2025, 6, 1, 23, 30, 0, 0, time.UTC)},
+		{"offset is preserved", "2025-06-01T23:30:00+05:00", time.Date(2025, 6, 1, 18, 30, 0, 0, time.UTC)},
+		{"fractional seconds", "2025-06-01T23:30:00.123Z", time.Date(2025, 6, 1, 23, 30, 0, 123000000, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTimestamp(tt.value, oslo)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("Expected %s, got %s", tt.expected, got.UTC())
+			}
+		})
+	}
+
+	if _, err := ParseTimestamp("June 1st", oslo); err == nil {
+		t.Error("Expected an error for an unrecognized timestamp")
+	}
+}
+
+func TestParseTimestamp_MidnightBoundary(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+
+	// A payment at 23:00 Oslo time on June 1st is 21:00 UTC and must stay on June 1st,
+	// while one at 00:30 on June 2nd is still June 1st in UTC and must move to June 2nd
+	lateEvening, err := ParseTimestamp("2025-06-01T23:00:00", oslo)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if day := lateEvening.In(oslo).Format(DateLayout); day != "2025-06-01" {
+		t.Errorf("Expected 23:00 to stay on 2025-06-01, got %s", day)
+	}
+
+	afterMidnight, err := ParseTimestamp("2025-06-02T00:30:00", oslo)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if day := afterMidnight.In(oslo).Format(DateLayout); day != "2025-06-02" {
+		t.Errorf("Expected 00:30 to land on 2025-06-02, got %s", day)
+	}
+	if day := afterMidnight.UTC().Format(DateLayout); day != "2025-06-01" {
+		t.Errorf("Expected 00:30 Oslo time to be the previous day in UTC, got %s", day)
+	}
+
+	// Without a location the old UTC behavior is kept
+	utcDate, err := ParseTimestamp("2025-06-02", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !utcDate.Equal(time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected UTC midnight without a location, got %s", utcDate)
+	}
+}
+
+func TestIsDate(t *testing.T) {
+	if !IsDate("2025-06-01") {
+		t.Error("Expected 2025-06-01 to be a plain date")
+	}
+	if IsDate("2025-06-01T00:00:00Z") {
+		t.Error("Expected an RFC3339 timestamp not to be a plain date")
+	}
+}
@@ -12,6 +12,8 @@ type Cache interface {
 	SetTransaction(key string, transaction entities.Transaction, expiration time.Duration)
 	GetTransaction(key string) (entities.Transaction, bool)
 	GetTransactions(pattern string) []entities.Transaction
+	// GetTransactionsBySource returns the cached transactions whose Source field equals source
+	GetTransactionsBySource(source string) []entities.Transaction
 	DeleteTransaction(key string)
 
 	// Price cache methods (no expiration)
@@ -20,6 +22,25 @@ type Cache interface {
 	GetPrices() []prices.Price
 	DeletePrice(key string)
 
+	// Annotation cache methods (no expiration), stored apart from the transactions so a re-fetch doesn't clobber them
+	SetAnnotation(key string, annotation entities.TransactionAnnotation)
+	GetAnnotation(key string) (entities.TransactionAnnotation, bool)
+	// GetAnnotations returns all annotations by transaction key
+	GetAnnotations() map[string]entities.TransactionAnnotation
+	DeleteAnnotation(key string)
+
 	// Clear cache
 	Clear()
 }
+
+// CacheStatsProvider is implemented by caches that can summarize their contents
+type CacheStatsProvider interface {
+	Stats() entities.CacheStats
+}
+
+// CacheNotifier notifies subscribers of transactions being set or deleted in the cache
+type CacheNotifier interface {
+	// Subscribe returns a channel receiving cache events and a function that unsubscribes and closes it.
+	// The channel is also closed if the subscriber falls too far behind.
+	Subscribe() (<-chan entities.CacheEvent, func())
+}
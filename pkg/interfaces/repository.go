@@ -7,7 +7,18 @@ import (
 )
 
 type TransactionRepository interface {
-	GetTransactions(ctx context.Context, limit int) ([]entities.Transaction, error)
+	GetTransactions(ctx context.Context, filter entities.TransactionFilter, limit int) (entities.TransactionsResult, error)
+	GetTransactionsPage(ctx context.Context, filter entities.TransactionFilter, cursor string, limit int) (entities.TransactionsResult, string, error)
+	GetAllTransactions(ctx context.Context, filter entities.TransactionFilter) ([]entities.Transaction, error)
+	CountTransactions(ctx context.Context, filter entities.TransactionFilter) (int, error)
+	GetLatestTransactionBySource(ctx context.Context) (map[string]entities.Transaction, error)
+	SearchTransactions(ctx context.Context, query string, limit int) ([]entities.Transaction, error)
 	GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error)
-	RefreshCache(ctx context.Context) error
+	RefreshTransaction(ctx context.Context, id string) (entities.Transaction, error)
+	UpsertTransaction(ctx context.Context, transaction entities.Transaction) error
+	UpdateTransaction(ctx context.Context, id string, update func(cached entities.Transaction, found bool) entities.Transaction) error
+	DeleteTransaction(ctx context.Context, id string) error
+	ArchiveTransaction(ctx context.Context, id string) (entities.Transaction, error)
+	AnnotateTransaction(ctx context.Context, id string, update func(*entities.TransactionAnnotation)) (entities.Transaction, error)
+	RefreshCache(ctx context.Context) (entities.RefreshResult, error)
 }
@@ -0,0 +1,9 @@
+package interfaces
+
+import "github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
+
+// RoleStore persists manual role assignments, keyed by email
+type RoleStore interface {
+	LoadRoles() (map[string]entities.Role, error)
+	SaveRoles(roles map[string]entities.Role) error
+}
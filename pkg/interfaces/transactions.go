@@ -2,11 +2,26 @@ package interfaces
 
 import (
 	"context"
+	"errors"
 
 	"github.com/rogerwesterbo/svennescamping-backend/pkg/entities"
 )
 
+// ErrTransactionNotFound is returned, possibly wrapped, when a transaction does not exist.
+// Check for it with errors.Is.
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// ErrAllProvidersFailed is returned, possibly wrapped, when every configured payment provider failed to
+// return transactions. Check for it with errors.Is.
+var ErrAllProvidersFailed = errors.New("all payment providers failed")
+
 type Transactions interface {
 	GetLatestTransactions(ctx context.Context, limit int) ([]entities.Transaction, error)
 	GetTransactionByID(ctx context.Context, id string) (entities.Transaction, error)
 }
+
+// HealthChecker is implemented by payment clients that can run a lightweight connectivity check
+type HealthChecker interface {
+	// CheckHealth returns an error if the provider cannot be reached or rejects the configured credentials
+	CheckHealth(ctx context.Context) error
+}
@@ -0,0 +1,38 @@
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// contextKey is the type of the keys the logger stores in a context
+type contextKey string
+
+const requestIDKey contextKey = "request_id"
+
+// ContextWithRequestID returns a copy of the context carrying the request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in the context, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// WithContext returns a child of the global logger that adds the request ID from the context to every entry
+func WithContext(ctx context.Context) *zap.Logger {
+	return WithRequestID(GetLogger(), ctx)
+}
+
+// WithRequestID returns a child of the given logger that adds the request ID from the context to every entry.
+// The logger is returned unchanged when the context has no request ID.
+func WithRequestID(base *zap.Logger, ctx context.Context) *zap.Logger {
+	requestID := RequestIDFromContext(ctx)
+	if requestID == "" {
+		return base
+	}
+	return base.With(zap.String("request_id", requestID))
+}
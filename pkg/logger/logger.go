@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -29,14 +30,37 @@ const (
 	RedBg = "\033[41m"
 )
 
-// coloredWriter wraps the output to add colors to the entire line
-type coloredWriter struct{}
+// coloredWriter wraps the output to add colors to the entire line when it's a terminal
+type coloredWriter struct {
+	out      io.Writer
+	colorize bool
+}
 
-func newColoredWriter() *coloredWriter {
-	return &coloredWriter{}
+// newColoredWriter creates a writer to out that only adds colors when out is a terminal,
+// so logs redirected to a file or pipe stay free of escape codes
+func newColoredWriter(out io.Writer) *coloredWriter {
+	return &coloredWriter{out: out, colorize: isTerminal(out)}
+}
+
+// isTerminal reports whether the writer is a character device such as a terminal
+func isTerminal(out io.Writer) bool {
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
 
 func (cw *coloredWriter) Write(p []byte) (n int, err error) {
+	if !cw.colorize {
+		return cw.out.Write(p)
+	}
+
 	line := string(p)
 
 	// Determine color based on log level in the line
@@ -59,20 +83,128 @@ func (cw *coloredWriter) Write(p []byte) (n int, err error) {
 
 	// Apply color to entire line
 	coloredLine := color + strings.TrimRight(line, "\n") + Reset + "\n"
-	return os.Stdout.Write([]byte(coloredLine))
+	return cw.out.Write([]byte(coloredLine))
 }
 
-// InitLogger initializes the global logger based on environment with colored output
+// Log output formats
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// InitLogger initializes the global logger based on environment, with colored console output in
+// development and JSON output otherwise
 func InitLogger(development bool) error {
-	var config zapcore.EncoderConfig
-	var logLevel zapcore.Level
+	return InitLoggerWithFormat(development, "")
+}
+
+// Option configures optional behavior of the global logger
+type Option func(*options)
+
+type options struct {
+	samplingInitial    int
+	samplingThereafter int
+}
+
+// WithSampling throttles repeated entries outside development. Each second, the first initial entries with the
+// same level and message are logged, then every thereafter-th. A non-positive initial disables sampling.
+func WithSampling(initial, thereafter int) Option {
+	return func(o *options) {
+		o.samplingInitial = initial
+		o.samplingThereafter = max(thereafter, 0)
+	}
+}
+
+// InitLoggerWithFormat initializes the global logger based on environment in the given format.
+// An empty format picks console output in development and JSON output otherwise.
+func InitLoggerWithFormat(development bool, format string, opts ...Option) error {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	format = strings.ToLower(strings.TrimSpace(format))
+	unknownFormat := format != "" && format != FormatConsole && format != FormatJSON
+	if format == "" || unknownFormat {
+		format = defaultFormat(development)
+	}
+
+	// Only console output is colored, escape codes would corrupt JSON lines
+	var writer zapcore.WriteSyncer
+	if format == FormatConsole {
+		writer = zapcore.AddSync(newColoredWriter(os.Stdout))
+	} else {
+		writer = zapcore.Lock(os.Stdout)
+	}
+
+	// Sampling keeps sustained outages from flooding production logs, development logs everything
+	var core zapcore.Core
+	if !development && o.samplingInitial > 0 {
+		core = newSampledCore(development, format, writer, o.samplingInitial, o.samplingThereafter)
+	} else {
+		core = newCore(development, format, writer)
+	}
 
+	Logger = zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+
+	if unknownFormat {
+		Logger.Warn("Unknown log format, using default", zap.String("default", format))
+	}
+	return nil
+}
+
+// defaultFormat returns the log format used when none is configured
+func defaultFormat(development bool) string {
+	if development {
+		return FormatConsole
+	}
+	return FormatJSON
+}
+
+// logLevel returns the minimum level logged in the environment
+func logLevel(development bool) zapcore.Level {
+	if development {
+		return zapcore.DebugLevel
+	}
+	return zapcore.InfoLevel
+}
+
+// newCore creates the logging core writing entries in the given format to the writer
+func newCore(development bool, format string, writer zapcore.WriteSyncer) zapcore.Core {
+	return zapcore.NewCore(newEncoder(development, format), writer, logLevel(development))
+}
+
+// newSampledCore creates a logging core like newCore that samples repeated entries per second.
+// Panics and fatal errors bypass the sampler so they are never dropped.
+func newSampledCore(development bool, format string, writer zapcore.WriteSyncer, initial, thereafter int) zapcore.Core {
+	level := logLevel(development)
+	encoder := newEncoder(development, format)
+
+	sampled := zapcore.NewCore(encoder, writer, zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return level.Enabled(l) && l < zapcore.DPanicLevel
+	}))
+	unsampled := zapcore.NewCore(encoder.Clone(), writer, zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l >= zapcore.DPanicLevel
+	}))
+
+	return zapcore.NewTee(
+		zapcore.NewSamplerWithOptions(sampled, time.Second, initial, thereafter),
+		unsampled,
+	)
+}
+
+// newEncoder creates the encoder for the given format
+func newEncoder(development bool, format string) zapcore.Encoder {
+	if format == FormatJSON {
+		// Use the production field names (level, ts, caller, msg) so log pipelines can parse every line
+		config := zap.NewProductionEncoderConfig()
+		config.EncodeTime = zapcore.ISO8601TimeEncoder
+		return zapcore.NewJSONEncoder(config)
+	}
+
+	config := zap.NewProductionEncoderConfig()
 	if development {
 		config = zap.NewDevelopmentEncoderConfig()
-		logLevel = zapcore.DebugLevel
-	} else {
-		config = zap.NewProductionEncoderConfig()
-		logLevel = zapcore.InfoLevel
 	}
 
 	// Configure encoder for console output
@@ -81,13 +213,7 @@ func InitLogger(development bool) error {
 	config.EncodeCaller = zapcore.ShortCallerEncoder
 	config.EncodeLevel = zapcore.CapitalLevelEncoder // Use capital level names without color
 
-	// Create encoder and core with custom colored writer
-	encoder := zapcore.NewConsoleEncoder(config)
-	writer := zapcore.AddSync(newColoredWriter())
-	core := zapcore.NewCore(encoder, writer, logLevel)
-
-	Logger = zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
-	return nil
+	return zapcore.NewConsoleEncoder(config)
 }
 
 // GetLogger returns the global logger instance
@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewCore_JSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	log := zap.New(newCore(false, FormatJSON, zapcore.AddSync(&buf)), zap.AddCaller())
+
+	log.Info("Fetched transactions", zap.Int("count", 3))
+	log.Warn("Provider failed", zap.String("provider", "vipps"))
+
+	scanner := bufio.NewScanner(&buf)
+	lines := 0
+	for scanner.Scan() {
+		lines++
+		line := scanner.Text()
+		if strings.Contains(line, "\033[") {
+			t.Errorf("Expected no color codes in JSON output, got %q", line)
+		}
+
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Expected a valid JSON line, got %q: %v", line, err)
+		}
+		for _, key := range []string{"level", "ts", "caller", "msg"} {
+			if _, ok := entry[key]; !ok {
+				t.Errorf("Expected key %q in %q", key, line)
+			}
+		}
+	}
+
+	if lines != 2 {
+		t.Errorf("Expected 2 log lines, got %d", lines)
+	}
+}
+
+func TestNewCore_LevelByEnvironment(t *testing.T) {
+	var buf bytes.Buffer
+	zap.New(newCore(false, FormatJSON, zapcore.AddSync(&buf))).Debug("Hidden in production")
+	if buf.Len() != 0 {
+		t.Errorf("Expected debug entries to be dropped in production, got %q", buf.String())
+	}
+
+	zap.New(newCore(true, FormatConsole, zapcore.AddSync(&buf))).Debug("Shown in development")
+	if !strings.Contains(buf.String(), "Shown in development") {
+		t.Errorf("Expected debug entries in development, got %q", buf.String())
+	}
+}
+
+func TestDefaultFormat(t *testing.T) {
+	if defaultFormat(true) != FormatConsole || defaultFormat(false) != FormatJSON {
+		t.Errorf("Expected console in development and JSON otherwise")
+	}
+}
+
+func TestColoredWriter_NonTerminal(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newColoredWriter(&buf)
+	log := zap.New(newCore(true, FormatConsole, zapcore.AddSync(writer)))
+
+	log.Info("Fetched transactions")
+	log.Error("Provider failed")
+
+	if strings.Contains(buf.String(), "\033[") {
+		t.Errorf("Expected no escape sequences when not writing to a terminal, got %q", buf.String())
+	}
+	if !strings.Contains(buf.String(), "Fetched transactions") || !strings.Contains(buf.String(), "Provider failed") {
+		t.Errorf("Expected the lines unchanged, got %q", buf.String())
+	}
+}
+
+func TestColoredWriter_Terminal(t *testing.T) {
+	var buf bytes.Buffer
+	writer := &coloredWriter{out: &buf, colorize: true}
+
+	if _, err := writer.Write([]byte("WARN\tProvider slow\n")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	if got := buf.String(); got != Yellow+"WARN\tProvider slow"+Reset+"\n" {
+		t.Errorf("Expected a yellow line, got %q", got)
+	}
+}
+
+func TestNewSampledCore(t *testing.T) {
+	var buf bytes.Buffer
+	log := zap.New(newSampledCore(false, FormatJSON, zapcore.AddSync(&buf), 2, 0))
+
+	for range 5 {
+		log.Error("Failed to fetch Vipps transactions")
+	}
+	log.Error("Failed to fetch Zettle transactions")
+	for range 3 {
+		log.DPanic("Unexpected provider state")
+	}
+
+	output := buf.String()
+	if got := strings.Count(output, "Failed to fetch Vipps transactions"); got != 2 {
+		t.Errorf("Expected the repeated error to be sampled down to 2 lines, got %d", got)
+	}
+	if !strings.Contains(output, "Failed to fetch Zettle transactions") {
+		t.Errorf("Expected the first occurrence of a different error to get through, got %q", output)
+	}
+	if got := strings.Count(output, "Unexpected provider state"); got != 3 {
+		t.Errorf("Expected panic level entries to bypass sampling, got %d", got)
+	}
+}